@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/operator"
+)
+
+type dumpOptions struct {
+	kubeconfig            string
+	outputDir             string
+	metricsURL            string
+	insecureSkipTLSVerify bool
+	timeout               time.Duration
+}
+
+func newDumpCommand() *cobra.Command {
+	o := &dumpOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump the state of the operator for support bundles",
+		Long: `Dump gathers the registry Config, the ImagePruner, the ClusterOperator,
+their conditions, the objects in the operator namespace and the operator
+metrics. The bundle is written to a directory, or to the standard output as a
+YAML stream. The values of secrets, the HTTP secret of the registry and the
+private keys of the routes are redacted.
+
+When run in the cluster, the service account of the pod is used unless a
+kubeconfig is provided.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, the in-cluster configuration is used if empty")
+	cmd.Flags().StringVar(&o.outputDir, "output-dir", "", "Directory the bundle is written to, the standard output is used if empty")
+	cmd.Flags().StringVar(&o.metricsURL, "metrics-url", "", "URL of the operator metrics, e.g. https://localhost:60000/metrics, the metrics are not gathered if empty")
+	cmd.Flags().BoolVar(&o.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Don't verify the certificate of the operator metrics server")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", time.Minute, "Maximum duration of the gathering")
+
+	return cmd
+}
+
+func (o *dumpOptions) run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	listers, err := operator.NewSupportBundleListers(ctx, kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	var metrics []byte
+	if o.metricsURL != "" {
+		// The metrics are only a part of the bundle, the rest of the
+		// state is still useful without them.
+		metrics, err = o.fetchMetrics(ctx)
+		if err != nil {
+			klog.Warningf("unable to gather the operator metrics: %s", err)
+		}
+	}
+
+	bundle, err := operator.GatherSupportBundle(listers, metrics)
+	if err != nil {
+		return err
+	}
+
+	if o.outputDir == "" {
+		return bundle.Write(os.Stdout)
+	}
+	return bundle.WriteDir(o.outputDir)
+}
+
+func (o *dumpOptions) fetchMetrics(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, o.metricsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: o.insecureSkipTLSVerify,
+			},
+		},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	imageclient "github.com/openshift/client-go/image/clientset/versioned/typed/image/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/integrityscan"
+)
+
+type integrityScanOptions struct {
+	kubeconfig           string
+	registryURL          string
+	certificateAuthority string
+	jobName              string
+}
+
+func newIntegrityScanCommand() *cobra.Command {
+	o := &integrityScanOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "integrity-scan",
+		Short: "Verify the digests of the blobs stored by the registry",
+		Long: `Integrity-scan reads the layers of the images pushed to the integrated
+registry and verifies that their content matches their digests. The progress
+and the blobs that failed the verification are reported to the
+image-registry-integrity-scan config map, the operator copies them to the
+status of the ImagePruner. The blobs are not deleted.
+
+It is run by the image-integrity-scan cron job.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, the in-cluster configuration is used if empty")
+	cmd.Flags().StringVar(&o.registryURL, "registry-url", "", "URL of the integrated registry")
+	cmd.Flags().StringVar(&o.certificateAuthority, "certificate-authority", "", "Path to the certificate authority of the registry")
+	cmd.Flags().StringVar(&o.jobName, "job-name", os.Getenv("JOB_NAME"), "Name of the scan job reported in the status")
+
+	return cmd
+}
+
+func (o *integrityScanOptions) httpClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if o.certificateAuthority != "" {
+		ca, err := ioutil.ReadFile(o.certificateAuthority)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", o.certificateAuthority)
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+func (o *integrityScanOptions) run() error {
+	if o.registryURL == "" {
+		return fmt.Errorf("--registry-url is required")
+	}
+
+	ctx := context.Background()
+
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", o.kubeconfig)
+	if err != nil {
+		return err
+	}
+	token := kubeconfig.BearerToken
+	if token == "" && kubeconfig.BearerTokenFile != "" {
+		data, err := ioutil.ReadFile(kubeconfig.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageClient, err := imageclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	client, err := o.httpClient()
+	if err != nil {
+		return err
+	}
+
+	streams, err := imageClient.ImageStreams(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list the image streams: %s", err)
+	}
+	images, err := imageClient.Images().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list the images: %s", err)
+	}
+
+	blobs := integrityscan.CollectBlobs(streams.Items, images.Items)
+	klog.Infof("verifying %d blobs", len(blobs))
+
+	scanner := integrityscan.NewScanner(kubeClient.CoreV1(), client, o.registryURL, token, o.jobName)
+	if err := scanner.Run(ctx, blobs); err != nil {
+		return err
+	}
+
+	klog.Infof("%d blobs verified, %d failed the verification", scanner.Status.ScannedBlobs, scanner.Status.CorruptBlobCount)
+	return nil
+}
@@ -17,17 +17,41 @@ import (
 	configv1 "github.com/openshift/api/config/v1"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
 
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 	"github.com/openshift/cluster-image-registry-operator/pkg/operator"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 	"github.com/openshift/cluster-image-registry-operator/pkg/signals"
 	"github.com/openshift/cluster-image-registry-operator/pkg/version"
 )
 
-const metricsPort = 60000
+const (
+	metricsPort = 60000
+
+	// defaultReconcileTimeout leaves enough time to the slowest cloud APIs
+	// to provision the storage.
+	defaultReconcileTimeout = 10 * time.Minute
+
+	// defaultMaxOverloadBackoff is the longest the syncs are delayed while
+	// the API server is overloaded, unless it asks for more.
+	defaultMaxOverloadBackoff = 5 * time.Minute
+)
 
 var (
-	filesToWatch []string
+	filesToWatch     []string
+	disableBootstrap bool
+	reconcileTimeout time.Duration
+
+	maxOverloadBackoff time.Duration
+
+	storageConnectivityThresholds resource.StorageConnectivityThresholds
+
+	servingCertRotationThreshold time.Duration
+
+	dryRun bool
+
+	leaderElection configv1.LeaderElection
 )
 
 func printVersion() {
@@ -60,17 +84,31 @@ func main() {
 		Use:   "cluster-image-registry-operator",
 		Short: "OpenShift cluster image registry operator",
 		Run: func(cmd *cobra.Command, args []string) {
+			if dryRun {
+				kubeconfig, err := client.GetConfig()
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := operator.RunDryRun(ctx, kubeconfig, os.Stdout); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+
+			// The replicas that don't hold the lease still serve their
+			// metrics.
+			go metrics.RunServer(metricsPort)
+
 			ctrl := controllercmd.NewController(
 				"image-registry-operator",
 				func(ctx context.Context, cctx *controllercmd.ControllerContext) error {
 					printVersion()
 					klog.Infof("Watching files %v...", filesToWatch)
 					rand.Seed(time.Now().UnixNano())
-					go metrics.RunServer(metricsPort)
-					return operator.RunOperator(ctx, cctx.KubeConfig)
+					return operator.RunOperator(ctx, cctx.KubeConfig, disableBootstrap, reconcileTimeout, maxOverloadBackoff, storageConnectivityThresholds, servingCertRotationThreshold)
 				},
 			).WithLeaderElection(
-				configv1.LeaderElection{},
+				leaderElection,
 				defaults.ImageRegistryOperatorNamespace,
 				"openshift-master-controllers",
 			).WithRestartOnChange(
@@ -84,6 +122,19 @@ func main() {
 	}
 
 	cmd.Flags().StringArrayVar(&filesToWatch, "files", []string{}, "List of files to watch")
+	cmd.Flags().BoolVar(&disableBootstrap, "disable-bootstrap", false, "Don't create the image registry configuration when it doesn't exist")
+	cmd.Flags().DurationVar(&reconcileTimeout, "reconcile-timeout", defaultReconcileTimeout, "Maximum duration of a single reconciliation of the image registry configuration, the reconciliation is cancelled and retried once it's over (0 for no limit)")
+	cmd.Flags().DurationVar(&maxOverloadBackoff, "max-overload-backoff", defaultMaxOverloadBackoff, "Maximum delay of the syncs while the API server responds with 429 or 504, the Retry-After of the responses is always respected (0 disables the backoff)")
+	cmd.Flags().IntVar(&storageConnectivityThresholds.Failures, "storage-connectivity-failure-threshold", resource.DefaultStorageConnectivityThresholds.Failures, "Number of consecutive failed checks of the storage needed to set the StorageConnectivity condition to False")
+	cmd.Flags().IntVar(&storageConnectivityThresholds.Successes, "storage-connectivity-success-threshold", resource.DefaultStorageConnectivityThresholds.Successes, "Number of consecutive successful checks of the storage needed to set the StorageConnectivity condition back to True")
+	cmd.Flags().DurationVar(&servingCertRotationThreshold, "serving-cert-rotation-threshold", operator.DefaultServingCertRotationThreshold, "How long before its expiry the registry serving certificate is deleted to be regenerated by the service-ca operator")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes a single sync would make to the storage and to the objects of the registry, and exit without making them")
+	cmd.Flags().DurationVar(&leaderElection.LeaseDuration.Duration, "leader-elect-lease-duration", 0, "How long the other replicas wait before they take over a lease that isn't renewed (0 for the library-go default of 60s)")
+	cmd.Flags().DurationVar(&leaderElection.RenewDeadline.Duration, "leader-elect-renew-deadline", 0, "How long the leader retries to renew its lease before it stops its controllers (0 for the library-go default of 35s)")
+	cmd.Flags().DurationVar(&leaderElection.RetryPeriod.Duration, "leader-elect-retry-period", 0, "Delay between two attempts to acquire or renew the lease (0 for the library-go default of 10s)")
+	cmd.AddCommand(newRenderCommand())
+	cmd.AddCommand(newDumpCommand())
+	cmd.AddCommand(newIntegrityScanCommand())
 
 	if err := cmd.Execute(); err != nil {
 		klog.Errorf("%v", err)
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+type renderOptions struct {
+	config         string
+	infrastructure string
+	platform       string
+	proxy          string
+	namespace      string
+	secrets        []string
+	configMaps     []string
+}
+
+func newRenderCommand() *cobra.Command {
+	o := &renderOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Render the manifests the operator would apply for a configuration",
+		Long: `Render prints the registry Deployment, Service, Routes and storage Secret
+the operator would apply for the given configuration. Nothing is read from or
+written to a cluster, the registry configuration and the cluster state it
+depends on are read from files. The rendered manifests are validated and the
+command fails if they are inconsistent. Storage secret values and route private
+keys are redacted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Drivers that manage objects in the operator namespace
+			// expect to find it in the environment.
+			if _, ok := os.LookupEnv(client.WatchNamespaceEnvVar); !ok {
+				os.Setenv(client.WatchNamespaceEnvVar, defaults.ImageRegistryOperatorNamespace)
+			}
+
+			in, err := o.inputs()
+			if err != nil {
+				return err
+			}
+			return resource.Render(os.Stdout, in)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.config, "config", "", "File with the imageregistry.operator.openshift.io Config to render")
+	cmd.Flags().StringVar(&o.infrastructure, "infrastructure", "", "File with the cluster Infrastructure, overrides --platform")
+	cmd.Flags().StringVar(&o.platform, "platform", string(configv1.NonePlatformType), "Platform type used when no Infrastructure file is provided")
+	cmd.Flags().StringVar(&o.proxy, "proxy", "", "File with the cluster Proxy configuration")
+	cmd.Flags().StringVar(&o.namespace, "namespace", "", "File with the operator Namespace")
+	cmd.Flags().StringArrayVar(&o.secrets, "secret", []string{}, "File with a Secret from the operator namespace, e.g. storage credentials")
+	cmd.Flags().StringArrayVar(&o.configMaps, "configmap", []string{}, "File with a ConfigMap from the operator namespace")
+	_ = cmd.MarkFlagRequired("config")
+
+	return cmd
+}
+
+func (o *renderOptions) inputs() (*resource.RenderInputs, error) {
+	in := &resource.RenderInputs{
+		Config: &imageregistryv1.Config{},
+	}
+	if err := readObject(o.config, in.Config); err != nil {
+		return nil, err
+	}
+
+	if o.infrastructure != "" {
+		in.Infrastructure = &configv1.Infrastructure{}
+		if err := readObject(o.infrastructure, in.Infrastructure); err != nil {
+			return nil, err
+		}
+	} else {
+		in.Infrastructure = platformInfrastructure(configv1.PlatformType(o.platform))
+	}
+
+	if o.proxy != "" {
+		in.Proxy = &configv1.Proxy{}
+		if err := readObject(o.proxy, in.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.namespace != "" {
+		in.Namespace = &corev1.Namespace{}
+		if err := readObject(o.namespace, in.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filename := range o.secrets {
+		sec := &corev1.Secret{}
+		if err := readObject(filename, sec); err != nil {
+			return nil, err
+		}
+		if sec.Namespace == "" {
+			sec.Namespace = defaults.ImageRegistryOperatorNamespace
+		}
+		in.Secrets = append(in.Secrets, sec)
+	}
+
+	for _, filename := range o.configMaps {
+		cm := &corev1.ConfigMap{}
+		if err := readObject(filename, cm); err != nil {
+			return nil, err
+		}
+		if cm.Namespace == "" {
+			cm.Namespace = defaults.ImageRegistryOperatorNamespace
+		}
+		in.ConfigMaps = append(in.ConfigMaps, cm)
+	}
+
+	return in, nil
+}
+
+// platformInfrastructure returns a minimal cluster Infrastructure for the
+// given platform.
+func platformInfrastructure(platform configv1.PlatformType) *configv1.Infrastructure {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			Platform: platform,
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: platform,
+			},
+		},
+	}
+	switch platform {
+	case configv1.AWSPlatformType:
+		infra.Status.PlatformStatus.AWS = &configv1.AWSPlatformStatus{}
+	case configv1.AzurePlatformType:
+		infra.Status.PlatformStatus.Azure = &configv1.AzurePlatformStatus{}
+	case configv1.GCPPlatformType:
+		infra.Status.PlatformStatus.GCP = &configv1.GCPPlatformStatus{}
+	}
+	return infra
+}
+
+func readObject(filename string, obj interface{}) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(buf, obj); err != nil {
+		return fmt.Errorf("unable to decode %s: %s", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// APIServerBackoff slows down the reconciles of the controllers while the API
+// server reports that it's overloaded. It observes the responses of the API
+// server through the transport of the clients: every 429 (Too Many Requests)
+// or 504 (Gateway Timeout) response doubles the delay, starting from
+// baseDelay up to maxDelay, and the delay is never shorter than the
+// Retry-After header of the response. The first response that isn't an
+// overload resets the delay, the current backoff period still has to pass.
+//
+// A nil *APIServerBackoff never delays anything.
+type APIServerBackoff struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	clock     func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+}
+
+// NewAPIServerBackoff returns a backoff starting at baseDelay and never
+// longer than maxDelay, unless the API server asks for more.
+func NewAPIServerBackoff(baseDelay, maxDelay time.Duration) *APIServerBackoff {
+	return &APIServerBackoff{
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+		clock:     time.Now,
+	}
+}
+
+// isOverloaded returns true if the response tells that the API server can't
+// keep up with the requests.
+func isOverloaded(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusGatewayTimeout
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the
+// response, only the delays in seconds are supported.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// observe updates the backoff from a response of the API server.
+func (b *APIServerBackoff) observe(resp *http.Response) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isOverloaded(resp) {
+		b.failures = 0
+		return
+	}
+
+	delay := b.baseDelay
+	for i := 0; i < b.failures && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+	b.failures++
+	if d := retryAfter(resp); d > delay {
+		delay = d
+	}
+
+	until := b.clock().Add(delay)
+	if until.After(b.until) {
+		b.until = until
+		klog.Warningf("the API server is overloaded (%s), slowing down the reconciles for %s", resp.Status, delay)
+	}
+}
+
+// Delay returns how long the reconciles should still wait for the API
+// server to recover.
+func (b *APIServerBackoff) Delay() time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if delay := b.until.Sub(b.clock()); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// WrapTransport returns a transport that feeds the backoff with the
+// responses of rt, it can be used as the WrapTransport of a rest.Config.
+func (b *APIServerBackoff) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	if b == nil {
+		return rt
+	}
+	return &backoffRoundTripper{
+		backoff:  b,
+		delegate: rt,
+	}
+}
+
+// RateLimiter returns a rate limiter for the workqueues of the controllers
+// that doesn't requeue the items before the end of the backoff.
+func (b *APIServerBackoff) RateLimiter(rateLimiter workqueue.RateLimiter) workqueue.RateLimiter {
+	if b == nil {
+		return rateLimiter
+	}
+	return &backoffRateLimiter{
+		RateLimiter: rateLimiter,
+		backoff:     b,
+	}
+}
+
+type backoffRoundTripper struct {
+	backoff  *APIServerBackoff
+	delegate http.RoundTripper
+}
+
+func (rt *backoffRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.delegate.RoundTrip(req)
+	if err == nil {
+		rt.backoff.observe(resp)
+	}
+	return resp, err
+}
+
+type backoffRateLimiter struct {
+	workqueue.RateLimiter
+	backoff *APIServerBackoff
+}
+
+func (r *backoffRateLimiter) When(item interface{}) time.Duration {
+	when := r.RateLimiter.When(item)
+	if delay := r.backoff.Delay(); delay > when {
+		return delay
+	}
+	return when
+}
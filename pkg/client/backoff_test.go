@@ -0,0 +1,185 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+type fakeRoundTripper struct {
+	responses []*http.Response
+}
+
+func (rt *fakeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := rt.responses[0]
+	rt.responses = rt.responses[1:]
+	return resp, nil
+}
+
+func response(code int, retryAfter string) *http.Response {
+	resp := &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     http.Header{},
+	}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestAPIServerBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		responses     []*http.Response
+		expectedDelay time.Duration
+	}{
+		{
+			name:          "no overload",
+			responses:     []*http.Response{response(http.StatusOK, ""), response(http.StatusNotFound, "")},
+			expectedDelay: 0,
+		},
+		{
+			name:          "too many requests",
+			responses:     []*http.Response{response(http.StatusTooManyRequests, "")},
+			expectedDelay: time.Second,
+		},
+		{
+			name:          "timeout",
+			responses:     []*http.Response{response(http.StatusGatewayTimeout, "")},
+			expectedDelay: time.Second,
+		},
+		{
+			name: "repeated overloads",
+			responses: []*http.Response{
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusGatewayTimeout, ""),
+			},
+			expectedDelay: 4 * time.Second,
+		},
+		{
+			name: "capped delay",
+			responses: []*http.Response{
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+			},
+			expectedDelay: 10 * time.Second,
+		},
+		{
+			name:          "retry after",
+			responses:     []*http.Response{response(http.StatusTooManyRequests, "30")},
+			expectedDelay: 30 * time.Second,
+		},
+		{
+			name:          "retry after shorter than the backoff",
+			responses:     []*http.Response{response(http.StatusTooManyRequests, ""), response(http.StatusTooManyRequests, "1")},
+			expectedDelay: 2 * time.Second,
+		},
+		{
+			name:          "invalid retry after",
+			responses:     []*http.Response{response(http.StatusTooManyRequests, "Wed, 21 Oct 2015 07:28:00 GMT")},
+			expectedDelay: time.Second,
+		},
+		{
+			name: "recovered",
+			responses: []*http.Response{
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusTooManyRequests, ""),
+				response(http.StatusOK, ""),
+				response(http.StatusTooManyRequests, ""),
+			},
+			// the current backoff period isn't shortened, but the next
+			// overload starts again from the base delay
+			expectedDelay: 2 * time.Second,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			b := NewAPIServerBackoff(time.Second, 10*time.Second)
+			b.clock = func() time.Time { return now }
+
+			rt := b.WrapTransport(&fakeRoundTripper{responses: tt.responses})
+			for range tt.responses {
+				if _, err := rt.RoundTrip(&http.Request{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if delay := b.Delay(); delay != tt.expectedDelay {
+				t.Errorf("got delay %s, want %s", delay, tt.expectedDelay)
+			}
+		})
+	}
+}
+
+func TestAPIServerBackoffExpires(t *testing.T) {
+	now := time.Now()
+	b := NewAPIServerBackoff(time.Second, 10*time.Second)
+	b.clock = func() time.Time { return now }
+
+	b.observe(response(http.StatusTooManyRequests, "5"))
+	if delay := b.Delay(); delay != 5*time.Second {
+		t.Errorf("got delay %s, want %s", delay, 5*time.Second)
+	}
+
+	now = now.Add(3 * time.Second)
+	if delay := b.Delay(); delay != 2*time.Second {
+		t.Errorf("got delay %s, want %s", delay, 2*time.Second)
+	}
+
+	now = now.Add(3 * time.Second)
+	if delay := b.Delay(); delay != 0 {
+		t.Errorf("got delay %s, want 0", delay)
+	}
+}
+
+func TestAPIServerBackoffRateLimiter(t *testing.T) {
+	now := time.Now()
+	b := NewAPIServerBackoff(time.Second, time.Minute)
+	b.clock = func() time.Time { return now }
+
+	rateLimiter := b.RateLimiter(workqueue.NewItemExponentialFailureRateLimiter(10*time.Millisecond, time.Second))
+
+	if when := rateLimiter.When("item"); when != 10*time.Millisecond {
+		t.Errorf("got %s without overload, want %s", when, 10*time.Millisecond)
+	}
+
+	b.observe(response(http.StatusTooManyRequests, "20"))
+	if when := rateLimiter.When("item"); when != 20*time.Second {
+		t.Errorf("got %s while overloaded, want %s", when, 20*time.Second)
+	}
+	if n := rateLimiter.NumRequeues("item"); n != 2 {
+		t.Errorf("got %d requeues, want 2", n)
+	}
+
+	now = now.Add(time.Minute)
+	rateLimiter.Forget("item")
+	if when := rateLimiter.When("item"); when != 10*time.Millisecond {
+		t.Errorf("got %s after the overload, want %s", when, 10*time.Millisecond)
+	}
+}
+
+func TestNilAPIServerBackoff(t *testing.T) {
+	var b *APIServerBackoff
+
+	if delay := b.Delay(); delay != 0 {
+		t.Errorf("got delay %s, want 0", delay)
+	}
+
+	rt := &fakeRoundTripper{}
+	if wrapped := b.WrapTransport(rt); wrapped != rt {
+		t.Errorf("expected the transport not to be wrapped")
+	}
+
+	rateLimiter := workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Second)
+	if wrapped := b.RateLimiter(rateLimiter); wrapped != rateLimiter {
+		t.Errorf("expected the rate limiter not to be wrapped")
+	}
+}
@@ -18,6 +18,11 @@ const (
 	// OperatorNameEnvVar is the constant for env variable OPERATOR_NAME
 	// which is the name of the current operator
 	OperatorNameEnvVar = "OPERATOR_NAME"
+
+	// ManageCredentialsRequestEnvVar is the constant for env variable
+	// MANAGE_CREDENTIALS_REQUEST which, when set to true, makes the operator
+	// create and reconcile the CredentialsRequest for the storage credentials.
+	ManageCredentialsRequestEnvVar = "MANAGE_CREDENTIALS_REQUEST"
 )
 
 // GetConfig creates a *rest.Config for talking to a Kubernetes apiserver.
@@ -70,3 +75,9 @@ func GetOperatorName() (string, error) {
 	}
 	return operatorName, nil
 }
+
+// ManageCredentialsRequest returns true if the operator should create the
+// CredentialsRequest for the storage credentials itself.
+func ManageCredentialsRequest() bool {
+	return os.Getenv(ManageCredentialsRequestEnvVar) == "true"
+}
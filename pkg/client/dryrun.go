@@ -0,0 +1,33 @@
+package client
+
+import (
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DryRunTransport returns a transport that makes the API server only
+// validate the writes sent through rt, they are not persisted. It can be used
+// as the WrapTransport of a rest.Config.
+func DryRunTransport(rt http.RoundTripper) http.RoundTripper {
+	return &dryRunRoundTripper{
+		delegate: rt,
+	}
+}
+
+type dryRunRoundTripper struct {
+	delegate http.RoundTripper
+}
+
+func (rt *dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return rt.delegate.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	query.Set("dryRun", metav1.DryRunAll)
+	req.URL.RawQuery = query.Encode()
+	return rt.delegate.RoundTrip(req)
+}
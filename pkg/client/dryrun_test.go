@@ -0,0 +1,53 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+)
+
+type recordingRoundTripper struct {
+	requests []*http.Request
+}
+
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, req)
+	return response(http.StatusOK, ""), nil
+}
+
+func TestDryRunTransport(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		url      string
+		expected string
+	}{
+		{method: http.MethodGet, url: "https://api/apis/apps/v1/namespaces/openshift-image-registry/deployments/image-registry", expected: ""},
+		{method: http.MethodGet, url: "https://api/api/v1/namespaces/openshift-image-registry/secrets?watch=true", expected: "watch=true"},
+		{method: http.MethodPost, url: "https://api/api/v1/namespaces/openshift-image-registry/services", expected: "dryRun=All"},
+		{method: http.MethodPut, url: "https://api/apis/apps/v1/namespaces/openshift-image-registry/deployments/image-registry?fieldManager=operator", expected: "dryRun=All&fieldManager=operator"},
+		{method: http.MethodPatch, url: "https://api/api/v1/namespaces/openshift-image-registry/serviceaccounts/registry", expected: "dryRun=All"},
+		{method: http.MethodDelete, url: "https://api/apis/route.openshift.io/v1/namespaces/openshift-image-registry/routes/default-route", expected: "dryRun=All"},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			original := req.URL.RawQuery
+
+			delegate := &recordingRoundTripper{}
+			if _, err := DryRunTransport(delegate).RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(delegate.requests) != 1 {
+				t.Fatalf("expected one request, got %d", len(delegate.requests))
+			}
+			if got := delegate.requests[0].URL.RawQuery; got != tt.expected {
+				t.Errorf("%s %s: got the query %q, want %q", tt.method, tt.url, got, tt.expected)
+			}
+			if req.URL.RawQuery != original {
+				t.Errorf("the original request was modified: %q", req.URL.RawQuery)
+			}
+		})
+	}
+}
@@ -3,11 +3,15 @@ package fake
 import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kfake "k8s.io/client-go/kubernetes/fake"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	policyv1listers "k8s.io/client-go/listers/policy/v1"
 	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
 	"k8s.io/client-go/tools/cache"
 
@@ -28,12 +32,15 @@ type FixturesBuilder struct {
 	secretsIndexer             cache.Indexer
 	configMapsIndexer          cache.Indexer
 	serviceAcctIndexer         cache.Indexer
+	networkPoliciesIndexer     cache.Indexer
+	pdbIndexer                 cache.Indexer
 	routesIndexer              cache.Indexer
 	clusterRolesIndexer        cache.Indexer
 	clusterRoleBindingsIndexer cache.Indexer
 	registryConfigsIndexer     cache.Indexer
 	proxyConfigsIndexer        cache.Indexer
 	infraIndexer               cache.Indexer
+	networkConfigsIndexer      cache.Indexer
 
 	kClientSet []runtime.Object
 }
@@ -53,12 +60,15 @@ func NewFixturesBuilder() *FixturesBuilder {
 		secretsIndexer:             cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		configMapsIndexer:          cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		serviceAcctIndexer:         cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
+		networkPoliciesIndexer:     cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
+		pdbIndexer:                 cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		routesIndexer:              cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		clusterRolesIndexer:        cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		clusterRoleBindingsIndexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		registryConfigsIndexer:     cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		proxyConfigsIndexer:        cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		infraIndexer:               cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
+		networkConfigsIndexer:      cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
 		kClientSet:                 []runtime.Object{},
 	}
 	return factory
@@ -132,6 +142,30 @@ func (f *FixturesBuilder) AddServiceAccounts(objs ...*corev1.ServiceAccount) *Fi
 	return f
 }
 
+// AddNetworkPolicies adds networkingv1.NetworkPolicies to the lister cache
+func (f *FixturesBuilder) AddNetworkPolicies(objs ...*networkingv1.NetworkPolicy) *FixturesBuilder {
+	for _, v := range objs {
+		err := f.networkPoliciesIndexer.Add(v)
+		if err != nil {
+			panic(err)
+		}
+		f.kClientSet = append(f.kClientSet, v)
+	}
+	return f
+}
+
+// AddPodDisruptionBudgets adds policyv1.PodDisruptionBudgets to the lister cache
+func (f *FixturesBuilder) AddPodDisruptionBudgets(objs ...*policyv1.PodDisruptionBudget) *FixturesBuilder {
+	for _, v := range objs {
+		err := f.pdbIndexer.Add(v)
+		if err != nil {
+			panic(err)
+		}
+		f.kClientSet = append(f.kClientSet, v)
+	}
+	return f
+}
+
 // AddRoutes adds route.openshift.io/v1 Routes to the lister cahce
 func (f *FixturesBuilder) AddRoutes(objs ...*routev1.Route) *FixturesBuilder {
 	for _, v := range objs {
@@ -195,6 +229,15 @@ func (f *FixturesBuilder) AddInfraConfig(config *configv1.Infrastructure) *Fixtu
 	return f
 }
 
+// AddNetworkConfig adds cluster-wide config.openshift.io/v1 Network to the lister cache
+func (f *FixturesBuilder) AddNetworkConfig(config *configv1.Network) *FixturesBuilder {
+	err := f.networkConfigsIndexer.Add(config)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
 // Build creates the fixtures from the provided objects.
 func (f *FixturesBuilder) Build() *Fixtures {
 	fixtures := &Fixtures{
@@ -212,15 +255,19 @@ func (f *FixturesBuilder) BuildListers() *client.Listers {
 		Secrets:                corev1listers.NewSecretLister(f.secretsIndexer).Secrets("openshift-image-registry"),
 		ConfigMaps:             corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-image-registry"),
 		ServiceAccounts:        corev1listers.NewServiceAccountLister(f.serviceAcctIndexer).ServiceAccounts("openshift-image-registry"),
+		PodDisruptionBudgets:   policyv1listers.NewPodDisruptionBudgetLister(f.pdbIndexer).PodDisruptionBudgets("openshift-image-registry"),
+		NetworkPolicies:        networkingv1listers.NewNetworkPolicyLister(f.networkPoliciesIndexer).NetworkPolicies("openshift-image-registry"),
 		Routes:                 routev1listers.NewRouteLister(f.routesIndexer).Routes("openshift-image-registry"),
 		ClusterRoles:           rbacv1listers.NewClusterRoleLister(f.clusterRolesIndexer),
 		ClusterRoleBindings:    rbacv1listers.NewClusterRoleBindingLister(f.clusterRoleBindingsIndexer),
 		OpenShiftConfig:        corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-config"),
 		OpenShiftConfigManaged: corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("openshift-config-managed"),
+		OpenShiftConfigSecrets: corev1listers.NewSecretLister(f.secretsIndexer).Secrets("openshift-config"),
 		RegistryConfigs:        regopv1listers.NewConfigLister(f.registryConfigsIndexer),
 		InstallerConfigMaps:    corev1listers.NewConfigMapLister(f.configMapsIndexer).ConfigMaps("kube-system"),
 		ProxyConfigs:           configv1listers.NewProxyLister(f.proxyConfigsIndexer),
 		Infrastructures:        configv1listers.NewInfrastructureLister(f.infraIndexer),
+		NetworkConfigs:         configv1listers.NewNetworkLister(f.networkConfigsIndexer),
 	}
 	return listers
 }
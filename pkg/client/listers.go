@@ -5,6 +5,7 @@ import (
 	kbatchlisters "k8s.io/client-go/listers/batch/v1"
 	kjoblisters "k8s.io/client-go/listers/batch/v1"
 	kcorelisters "k8s.io/client-go/listers/core/v1"
+	knetworkinglisters "k8s.io/client-go/listers/networking/v1"
 	kpolicylisters "k8s.io/client-go/listers/policy/v1"
 	krbaclisters "k8s.io/client-go/listers/rbac/v1"
 
@@ -20,15 +21,18 @@ type Listers struct {
 	ConfigMaps             kcorelisters.ConfigMapNamespaceLister
 	ServiceAccounts        kcorelisters.ServiceAccountNamespaceLister
 	PodDisruptionBudgets   kpolicylisters.PodDisruptionBudgetNamespaceLister
+	NetworkPolicies        knetworkinglisters.NetworkPolicyNamespaceLister
 	Routes                 routelisters.RouteNamespaceLister
 	ClusterRoles           krbaclisters.ClusterRoleLister
 	ClusterRoleBindings    krbaclisters.ClusterRoleBindingLister
 	OpenShiftConfig        kcorelisters.ConfigMapNamespaceLister
 	OpenShiftConfigManaged kcorelisters.ConfigMapNamespaceLister
+	OpenShiftConfigSecrets kcorelisters.SecretNamespaceLister
 	RegistryConfigs        regoplisters.ConfigLister
 	InstallerConfigMaps    kcorelisters.ConfigMapNamespaceLister
 	ProxyConfigs           configlisters.ProxyLister
 	Infrastructures        configlisters.InfrastructureLister
+	NetworkConfigs         configlisters.NetworkLister
 }
 
 type ImagePrunerControllerListers struct {
@@ -21,6 +21,10 @@ const (
 	// ClusterProxyResourceName is the name of the cluster proxy config instance
 	ClusterProxyResourceName = "cluster"
 
+	// ClusterNetworkResourceName is the name of the cluster network config
+	// instance
+	ClusterNetworkResourceName = "cluster"
+
 	// CloudCredentialsName is the name of the cloud credentials secret
 	CloudCredentialsName = "installer-cloud-credentials"
 
@@ -81,6 +85,142 @@ const (
 	// medium is configured to automatically cleanup incomplete uploads
 	StorageIncompleteUploadCleanupEnabled = "StorageIncompleteUploadCleanupEnabled"
 
+	// StorageSASTokenValid denotes whether or not the shared access signature
+	// provided by the user for Azure storage is valid and not about to expire
+	StorageSASTokenValid = "StorageSASTokenValid"
+
+	// StorageCredentialsProvisioned denotes whether or not the storage
+	// credentials requested from the cloud-credential-operator have been
+	// provisioned
+	StorageCredentialsProvisioned = "StorageCredentialsProvisioned"
+
+	// StorageCredentialsExpiring denotes whether or not the session token
+	// of the temporary storage credentials is about to expire
+	StorageCredentialsExpiring = "StorageCredentialsExpiring"
+
+	// StorageRoleAssumed denotes whether or not the operator could assume
+	// the IAM role configured to access the S3 bucket, e.g. a role of another
+	// AWS account
+	StorageRoleAssumed = "StorageRoleAssumed"
+
+	// StorageServiceAccountImpersonated denotes whether or not the operator
+	// could impersonate the GCP service account configured to access the
+	// GCS bucket
+	StorageServiceAccountImpersonated = "StorageServiceAccountImpersonated"
+
+	// StorageProvisioningDeferred denotes whether or not the provisioning of
+	// the storage and of the registry is deferred until it is explicitly
+	// enabled
+	StorageProvisioningDeferred = "StorageProvisioningDeferred"
+
+	// DeploymentOwnershipConflict denotes whether or not the registry
+	// deployment is claimed by another controller, in which case the
+	// operator stops reconciling it
+	DeploymentOwnershipConflict = "DeploymentOwnershipConflict"
+
+	// StoragePrivateEndpointReachable denotes whether or not the storage
+	// account resolves to a private address and is reachable through the
+	// configured Azure Private Endpoint
+	StoragePrivateEndpointReachable = "StoragePrivateEndpointReachable"
+
+	// CloudAPIUnavailable denotes whether or not the API of the cloud
+	// provider managing the storage responded that it is unavailable, as
+	// opposed to denying the access or not being reachable
+	CloudAPIUnavailable = "CloudAPIUnavailable"
+
+	// InsufficientOperatorPermissions denotes whether or not the API server
+	// denied the operator an operation on one of the objects it manages
+	InsufficientOperatorPermissions = "InsufficientOperatorPermissions"
+
+	// ServiceAccountRecreated denotes whether or not the registry service
+	// account was found missing and recreated during the last sync, the
+	// registry pods can't be created while it's missing
+	ServiceAccountRecreated = "ServiceAccountRecreated"
+
+	// StorageMultipartPartSizeClamped denotes whether or not the configured
+	// multipart part size is out of the limits of the S3 backend, in which
+	// case the closest supported size is used
+	StorageMultipartPartSizeClamped = "StorageMultipartPartSizeClamped"
+
+	// StorageInsecure denotes whether or not the S3 bucket is accessed over
+	// http, in which case the images and the signed requests are sent
+	// unencrypted
+	StorageInsecure = "StorageInsecure"
+
+	// StorageClassSuboptimal denotes whether or not the registry claim is
+	// backed by a storage class that is not recommended for the registry,
+	// e.g. standard Azure disks instead of premium SSD ones
+	StorageClassSuboptimal = "StorageClassSuboptimal"
+
+	// StorageObjectLocked denotes whether or not object lock (WORM) is enabled
+	// on the S3 bucket, in which case the objects can't be deleted before the
+	// end of their retention
+	StorageObjectLocked = "StorageObjectLocked"
+
+	// StoragePrunedBlobExpirationEnabled denotes whether or not the S3 bucket
+	// has the lifecycle rule expiring the tagged objects
+	StoragePrunedBlobExpirationEnabled = "StoragePrunedBlobExpirationEnabled"
+
+	// StorageUsingEphemeralFallback denotes whether or not the registry runs
+	// on emptyDir storage because no persistent storage was configured for
+	// the platform, in which case the registry data is not durable
+	StorageUsingEphemeralFallback = "StorageUsingEphemeralFallback"
+
+	// StorageRegionMismatch denotes whether or not the storage is in another
+	// region than the cluster, in which case the registry traffic crosses
+	// regions
+	StorageRegionMismatch = "StorageRegionMismatch"
+
+	// ServiceCAUnavailable denotes whether or not the service CA is missing
+	// from the serviceca configmap, in which case the registry serving
+	// certificate can't be trusted by the registry clients
+	ServiceCAUnavailable = "ServiceCAUnavailable"
+
+	// CABundleStale denotes whether or not some registry pods were started
+	// with previous dependencies of the deployment, whose CA bundle may no
+	// longer match the configmaps it is extracted from
+	CABundleStale = "CABundleStale"
+
+	// ServingCertRotated denotes whether or not the registry serving
+	// certificate was rotated by the operator ahead of its expiry
+	ServingCertRotated = "ServingCertRotated"
+
+	// InternalHostnameReachable denotes whether or not the operator can
+	// resolve and connect to the internal registry hostname published in
+	// the image config
+	InternalHostnameReachable = "InternalHostnameReachable"
+
+	// StorageConnectivity denotes whether or not the operator can reach the
+	// storage, it changes only after several consecutive checks agree
+	StorageConnectivity = "StorageConnectivity"
+
+	// StorageConfigurationSource records where the active storage
+	// configuration comes from, its reason is one of the
+	// StorageSource* values
+	StorageConfigurationSource = "StorageConfigurationSource"
+
+	// StorageSourceUserConfigured, StorageSourcePlatformDetected and
+	// StorageSourceDefault are the reasons of the StorageConfigurationSource
+	// condition: the storage was configured by the administrator, detected
+	// from the platform, or the emptyDir storage is used because the
+	// platform doesn't provide persistent storage.
+	StorageSourceUserConfigured   = "UserConfigured"
+	StorageSourcePlatformDetected = "PlatformDetected"
+	StorageSourceDefault          = "Default"
+
+	// PruningBlocked denotes whether or not the last run of the image pruner
+	// skipped the pruning, or pruned only partially, because some image
+	// streams reference images that can't be resolved
+	PruningBlocked = "PruningBlocked"
+
+	// DegradedReasonVerificationFailed, DegradedReasonStorageNotConfigured
+	// and DegradedReasonInvalidTimeout are the reasons of the Degraded
+	// conditions that need the registry configuration to be fixed, they always
+	// block upgrades.
+	DegradedReasonVerificationFailed   = "VerificationFailed"
+	DegradedReasonStorageNotConfigured = "StorageNotConfigured"
+	DegradedReasonInvalidTimeout       = "InvalidTimeout"
+
 	// VersionAnnotation reflects the version of the registry that this deployment
 	// is running.
 	VersionAnnotation = "release.openshift.io/version"
@@ -90,8 +230,31 @@ const (
 	ChecksumOperatorAnnotation     = "imageregistry.operator.openshift.io/checksum"
 	ChecksumOperatorDepsAnnotation = "imageregistry.operator.openshift.io/dependencies-checksum"
 
+	// ChecksumStorageSecretAnnotation is the checksum of the data the
+	// storage secret is expected to hold.
+	ChecksumStorageSecretAnnotation = "imageregistry.operator.openshift.io/storage-secret-checksum"
+
+	// ChangeCauseAnnotation summarizes why the operator last updated the
+	// registry deployment.
+	ChangeCauseAnnotation = "kubernetes.io/change-cause"
+
+	// ExternallyScaledAnnotation set to "true" on the registry deployment
+	// tells the operator that its replicas are managed by an autoscaler,
+	// e.g. a HorizontalPodAutoscaler, and must not be reset to the replicas
+	// of the registry config.
+	ExternallyScaledAnnotation = "imageregistry.operator.openshift.io/externally-scaled"
+
 	SupplementalGroupsAnnotation = "openshift.io/sa.scc.supplemental-groups"
 
+	// RoleARNAnnotation is the annotation of the registry service account
+	// that holds the IAM role assumed with web identity credentials.
+	RoleARNAnnotation = "eks.amazonaws.com/role-arn"
+
+	// GCPServiceAccountAnnotation is the annotation of the registry service
+	// account that binds it to a GCP service account with GKE Workload
+	// Identity.
+	GCPServiceAccountAnnotation = "iam.gke.io/gcp-service-account"
+
 	ServiceName           = "image-registry"
 	ServiceAccountName    = "registry"
 	ContainerPort         = 5000
@@ -104,6 +267,10 @@ const (
 	ServiceCAName = "serviceca"
 	TrustedCAName = "trusted-ca"
 
+	// ServingCertSecretName is the name of the secret the service-ca
+	// operator generates the registry serving certificate into.
+	ServingCertSecretName = ImageRegistryName + "-tls"
+
 	// OpenShiftConfigNamespace is a namespace with global configuration resources.
 	OpenShiftConfigNamespace = "openshift-config"
 
@@ -0,0 +1,257 @@
+package integrityscan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	imageapiv1 "github.com/openshift/api/image/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	// ConfigMapName is the name of the config map the scan job reports its
+	// progress and its results to.
+	ConfigMapName = "image-registry-integrity-scan"
+
+	// StatusKey is the key of the config map that holds the
+	// ImagePrunerIntegrityScanStatus of the scan, encoded in JSON.
+	StatusKey = "status.json"
+
+	// MaxCorruptBlobs is the number of corrupt blobs listed in the status.
+	MaxCorruptBlobs = 50
+
+	// progressInterval is the number of blobs verified between two progress
+	// reports.
+	progressInterval = 100
+)
+
+// Blob is a blob to verify and the repository it is read from.
+type Blob struct {
+	Digest     string
+	Repository string
+}
+
+// CollectBlobs returns the layers of the images pushed to the integrated
+// registry, each blob once. The images pulled through or referenced from
+// other registries are skipped, their blobs are not in the storage.
+func CollectBlobs(streams []imageapiv1.ImageStream, images []imageapiv1.Image) []Blob {
+	repositories := map[string]string{}
+	for _, is := range streams {
+		if len(is.Status.DockerImageRepository) == 0 {
+			continue
+		}
+		repository := is.Namespace + "/" + is.Name
+		for _, tag := range is.Status.Tags {
+			for _, event := range tag.Items {
+				if !strings.HasPrefix(event.DockerImageReference, is.Status.DockerImageRepository+"@") {
+					continue
+				}
+				if _, ok := repositories[event.Image]; !ok {
+					repositories[event.Image] = repository
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var blobs []Blob
+	for _, image := range images {
+		repository, ok := repositories[image.Name]
+		if !ok {
+			continue
+		}
+		for _, layer := range image.DockerImageLayers {
+			if seen[layer.Name] {
+				continue
+			}
+			seen[layer.Name] = true
+			blobs = append(blobs, Blob{Digest: layer.Name, Repository: repository})
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Digest < blobs[j].Digest
+	})
+	return blobs
+}
+
+// Scanner verifies the blobs through the registry API and reports the
+// results to the config map. The blobs that fail the verification are not
+// deleted.
+type Scanner struct {
+	ConfigMaps  coreset.ConfigMapsGetter
+	Client      *http.Client
+	RegistryURL string
+	Token       string
+
+	Status imageregistryv1.ImagePrunerIntegrityScanStatus
+
+	clock func() time.Time
+}
+
+// NewScanner returns a scanner for the job jobName.
+func NewScanner(configMaps coreset.ConfigMapsGetter, client *http.Client, registryURL, token, jobName string) *Scanner {
+	return &Scanner{
+		ConfigMaps:  configMaps,
+		Client:      client,
+		RegistryURL: strings.TrimSuffix(registryURL, "/"),
+		Token:       token,
+		Status: imageregistryv1.ImagePrunerIntegrityScanStatus{
+			JobName: jobName,
+		},
+		clock: time.Now,
+	}
+}
+
+// verify reads the blob and returns why its content doesn't match its
+// digest, or an empty string. Errors that don't tell anything about the
+// blob are returned.
+func (s *Scanner) verify(ctx context.Context, blob Blob) (string, error) {
+	parts := strings.SplitN(blob.Digest, ":", 2)
+	if len(parts) != 2 || parts[0] != "sha256" {
+		klog.Warningf("the blob %s can't be verified, only the sha256 digests are supported", blob.Digest)
+		return "", nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v2/%s/blobs/%s", s.RegistryURL, blob.Repository, blob.Digest), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "the blob is missing from the storage", nil
+	default:
+		return "", fmt.Errorf("unable to get the blob %s from %s: unexpected status %s", blob.Digest, blob.Repository, resp.Status)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("unable to read the blob %s from %s: %s", blob.Digest, blob.Repository, err)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != parts[1] {
+		return fmt.Sprintf("the content has the digest sha256:%s", actual), nil
+	}
+	return "", nil
+}
+
+// addCorruptBlob records a blob that failed the verification.
+func (s *Scanner) addCorruptBlob(blob Blob, message string) {
+	klog.Warningf("the blob %s in %s failed the verification: %s", blob.Digest, blob.Repository, message)
+	s.Status.CorruptBlobCount++
+	if len(s.Status.CorruptBlobs) < MaxCorruptBlobs {
+		s.Status.CorruptBlobs = append(s.Status.CorruptBlobs, imageregistryv1.ImagePrunerCorruptBlob{
+			Digest:     blob.Digest,
+			Repository: blob.Repository,
+			Message:    message,
+		})
+	}
+}
+
+// Run verifies the blobs and reports the progress of the scan every
+// progressInterval blobs. The scan stops at the first error that doesn't
+// come from a blob.
+func (s *Scanner) Run(ctx context.Context, blobs []Blob) error {
+	s.Status.StartTime = metav1.NewTime(s.clock())
+	s.Status.TotalBlobs = int64(len(blobs))
+	if err := s.report(ctx); err != nil {
+		return err
+	}
+
+	for i, blob := range blobs {
+		message, err := s.verify(ctx, blob)
+		if err != nil {
+			s.finish(ctx, err.Error())
+			return err
+		}
+		if message != "" {
+			s.addCorruptBlob(blob, message)
+		}
+		s.Status.ScannedBlobs++
+
+		if (i+1)%progressInterval == 0 {
+			if err := s.report(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.finish(ctx, "")
+}
+
+// finish records the end of the scan.
+func (s *Scanner) finish(ctx context.Context, message string) error {
+	now := metav1.NewTime(s.clock())
+	s.Status.CompletionTime = &now
+	s.Status.Message = message
+	return s.report(ctx)
+}
+
+// report stores the status of the scan in the config map.
+func (s *Scanner) report(ctx context.Context) error {
+	data, err := json.Marshal(s.Status)
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.ConfigMaps.ConfigMaps(defaults.ImageRegistryOperatorNamespace)
+	cm, err := configMaps.Get(ctx, ConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ConfigMapName,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: map[string]string{
+				StatusKey: string(data),
+			},
+		}, metav1.CreateOptions{})
+	} else if err == nil {
+		cm = cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[StatusKey] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("unable to report the scan status to the config map %s: %s", ConfigMapName, err)
+	}
+	return nil
+}
+
+// ParseStatus returns the status stored in the config map by the scan job.
+func ParseStatus(cm *corev1.ConfigMap) (*imageregistryv1.ImagePrunerIntegrityScanStatus, error) {
+	data, ok := cm.Data[StatusKey]
+	if !ok {
+		return nil, fmt.Errorf("the config map %s does not contain the key %s", cm.Name, StatusKey)
+	}
+	status := &imageregistryv1.ImagePrunerIntegrityScanStatus{}
+	if err := json.Unmarshal([]byte(data), status); err != nil {
+		return nil, fmt.Errorf("unable to decode the scan status from the config map %s: %s", cm.Name, err)
+	}
+	return status, nil
+}
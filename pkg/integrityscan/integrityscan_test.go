@@ -0,0 +1,174 @@
+package integrityscan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	imageapiv1 "github.com/openshift/api/image/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func digestOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestCollectBlobs(t *testing.T) {
+	streams := []imageapiv1.ImageStream{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"},
+			Status: imageapiv1.ImageStreamStatus{
+				DockerImageRepository: "image-registry.openshift-image-registry.svc:5000/ns/app",
+				Tags: []imageapiv1.NamedTagEventList{
+					{
+						Tag: "latest",
+						Items: []imageapiv1.TagEvent{
+							{DockerImageReference: "image-registry.openshift-image-registry.svc:5000/ns/app@sha256:pushed", Image: "sha256:pushed"},
+							{DockerImageReference: "quay.io/upstream/app@sha256:external", Image: "sha256:external"},
+						},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "imported"},
+			Status: imageapiv1.ImageStreamStatus{
+				Tags: []imageapiv1.NamedTagEventList{
+					{
+						Tag: "latest",
+						Items: []imageapiv1.TagEvent{
+							{DockerImageReference: "quay.io/upstream/app@sha256:external", Image: "sha256:external"},
+						},
+					},
+				},
+			},
+		},
+	}
+	images := []imageapiv1.Image{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "sha256:pushed"},
+			DockerImageLayers: []imageapiv1.ImageLayer{
+				{Name: "sha256:bbb"},
+				{Name: "sha256:aaa"},
+				{Name: "sha256:bbb"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "sha256:external"},
+			DockerImageLayers: []imageapiv1.ImageLayer{
+				{Name: "sha256:ccc"},
+			},
+		},
+	}
+
+	expected := []Blob{
+		{Digest: "sha256:aaa", Repository: "ns/app"},
+		{Digest: "sha256:bbb", Repository: "ns/app"},
+	}
+	if blobs := CollectBlobs(streams, images); !reflect.DeepEqual(blobs, expected) {
+		t.Errorf("got %#v, want %#v", blobs, expected)
+	}
+}
+
+func TestScannerRun(t *testing.T) {
+	valid := "valid layer"
+	corrupt := "corrupt layer"
+	missing := "missing layer"
+
+	contents := map[string]string{
+		"/v2/ns/app/blobs/" + digestOf(valid):   valid,
+		"/v2/ns/app/blobs/" + digestOf(corrupt): "truncated",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		content, ok := contents[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	now := time.Date(2021, 1, 1, 3, 0, 0, 0, time.Local)
+	clientset := fake.NewSimpleClientset()
+	scanner := NewScanner(clientset.CoreV1(), server.Client(), server.URL+"/", "token", "image-integrity-scan-1")
+	scanner.clock = func() time.Time { return now }
+
+	blobs := []Blob{
+		{Digest: digestOf(valid), Repository: "ns/app"},
+		{Digest: digestOf(corrupt), Repository: "ns/app"},
+		{Digest: digestOf(missing), Repository: "ns/app"},
+		{Digest: "sha512:unsupported", Repository: "ns/app"},
+	}
+	if err := scanner.Run(context.Background(), blobs); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := ParseStatus(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion := metav1.NewTime(now)
+	expected := &imageregistryv1.ImagePrunerIntegrityScanStatus{
+		JobName:          "image-integrity-scan-1",
+		StartTime:        metav1.NewTime(now),
+		CompletionTime:   &completion,
+		TotalBlobs:       4,
+		ScannedBlobs:     4,
+		CorruptBlobCount: 2,
+		CorruptBlobs: []imageregistryv1.ImagePrunerCorruptBlob{
+			{Digest: digestOf(corrupt), Repository: "ns/app", Message: "the content has the digest " + digestOf("truncated")},
+			{Digest: digestOf(missing), Repository: "ns/app", Message: "the blob is missing from the storage"},
+		},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("unexpected status:\n got: %#v\nwant: %#v", status, expected)
+	}
+}
+
+func TestScannerRunError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	clientset := fake.NewSimpleClientset()
+	scanner := NewScanner(clientset.CoreV1(), server.Client(), server.URL, "token", "image-integrity-scan-1")
+
+	err := scanner.Run(context.Background(), []Blob{{Digest: digestOf("layer"), Repository: "ns/app"}})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := ParseStatus(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.CompletionTime == nil || status.Message == "" || status.ScannedBlobs != 0 {
+		t.Errorf("expected a failed scan with a message, got %#v", status)
+	}
+}
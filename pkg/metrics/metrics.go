@@ -12,6 +12,10 @@ var (
 		Name: "image_registry_operator_image_pruner_install_status",
 		Help: "Installation status code related to the automatic image pruning feature. 0 = not installed, 1 = suspended, 2 = enabled",
 	})
+	storageProvisioningDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "image_registry_operator_storage_provisioning_duration_seconds",
+		Help: "Time it took to provision the current storage of the image registry.",
+	})
 	azurePrimaryKeyCache = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "image_registry_operator_azure_key_cache_requests_total",
@@ -19,12 +23,29 @@ var (
 		},
 		[]string{"result"},
 	)
+	storageBytesUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "imageregistry_storage_bytes_used",
+			Help: "Number of bytes stored in the storage of the image registry.",
+		},
+		[]string{"backend"},
+	)
+	storageBytesCapacity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "imageregistry_storage_bytes_capacity",
+			Help: "Capacity in bytes of the storage of the image registry, not reported for storages without a fixed capacity.",
+		},
+		[]string{"backend"},
+	)
 )
 
 func init() {
 	registry.MustRegister(
 		storageReconfigured,
 		imagePrunerInstallStatus,
+		storageProvisioningDuration,
 		azurePrimaryKeyCache,
+		storageBytesUsed,
+		storageBytesCapacity,
 	)
 }
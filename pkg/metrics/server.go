@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -47,6 +48,12 @@ func StorageReconfigured() {
 	storageReconfigured.Inc()
 }
 
+// StorageProvisioningDuration reports how long the provisioning of the
+// current storage took.
+func StorageProvisioningDuration(d time.Duration) {
+	storageProvisioningDuration.Set(d.Seconds())
+}
+
 // ImagePrunerInstallStatus reports the installation state of automatic image pruner CronJob to Prometheus
 func ImagePrunerInstallStatus(installed bool, enabled bool) {
 	if !installed {
@@ -69,3 +76,21 @@ func AzureKeyCacheHit() {
 func AzureKeyCacheMiss() {
 	azurePrimaryKeyCache.With(map[string]string{"result": "miss"}).Inc()
 }
+
+// StorageUsage reports how many bytes are stored in the storage backend of
+// the registry and its capacity. A negative capacity means the backend has
+// no fixed capacity, the capacity is then not reported.
+func StorageUsage(backend string, used, capacity int64) {
+	ResetStorageUsage()
+	storageBytesUsed.With(map[string]string{"backend": backend}).Set(float64(used))
+	if capacity >= 0 {
+		storageBytesCapacity.With(map[string]string{"backend": backend}).Set(float64(capacity))
+	}
+}
+
+// ResetStorageUsage stops reporting the usage of the storage, e.g. when it
+// can't be measured.
+func ResetStorageUsage() {
+	storageBytesUsed.Reset()
+	storageBytesCapacity.Reset()
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -150,6 +151,26 @@ func TestStorageReconfigured(t *testing.T) {
 	}
 }
 
+func TestStorageProvisioningDuration(t *testing.T) {
+	metricName := "image_registry_operator_storage_provisioning_duration_seconds"
+
+	StorageProvisioningDuration(90 * time.Second)
+
+	resp, err := http.Get("https://localhost:5000/metrics")
+	if err != nil {
+		t.Fatalf("error requesting metrics server: %v", err)
+	}
+
+	metrics := findMetricsByCounter(resp.Body, metricName)
+	if len(metrics) == 0 {
+		t.Fatal("unable to locate metric", metricName)
+	}
+
+	if val := metrics[0].Gauge.GetValue(); val != 90 {
+		t.Errorf("expected 90, found %f", val)
+	}
+}
+
 func TestImagePrunerInstallStatus(t *testing.T) {
 	metricName := "image_registry_operator_image_pruner_install_status"
 	testCases := []struct {
@@ -204,6 +225,71 @@ func TestImagePrunerInstallStatus(t *testing.T) {
 
 }
 
+func TestStorageUsage(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		backend          string
+		used             int64
+		capacity         int64
+		expectedCapacity bool
+	}{
+		{
+			name:             "with capacity",
+			backend:          "pvc",
+			used:             1024,
+			capacity:         4096,
+			expectedCapacity: true,
+		},
+		{
+			name:     "without capacity",
+			backend:  "s3",
+			used:     2048,
+			capacity: -1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			StorageUsage(tt.backend, tt.used, tt.capacity)
+
+			resp, err := http.Get("https://localhost:5000/metrics")
+			if err != nil {
+				t.Fatalf("error requesting metrics server: %v", err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			used := findMetricsByCounter(ioutil.NopCloser(bytes.NewReader(body)), "imageregistry_storage_bytes_used")
+			if len(used) != 1 {
+				t.Fatalf("expected one imageregistry_storage_bytes_used metric, got %d", len(used))
+			}
+			if label := used[0].GetLabel()[0]; label.GetName() != "backend" || label.GetValue() != tt.backend {
+				t.Errorf("expected the backend label %s, got %s=%s", tt.backend, label.GetName(), label.GetValue())
+			}
+			if val := used[0].Gauge.GetValue(); val != float64(tt.used) {
+				t.Errorf("expected %d bytes used, found %f", tt.used, val)
+			}
+
+			capacity := findMetricsByCounter(ioutil.NopCloser(bytes.NewReader(body)), "imageregistry_storage_bytes_capacity")
+			if !tt.expectedCapacity {
+				if len(capacity) != 0 {
+					t.Errorf("expected no imageregistry_storage_bytes_capacity metric, got %v", capacity)
+				}
+				return
+			}
+			if len(capacity) != 1 {
+				t.Fatalf("expected one imageregistry_storage_bytes_capacity metric, got %d", len(capacity))
+			}
+			if val := capacity[0].Gauge.GetValue(); val != float64(tt.capacity) {
+				t.Errorf("expected a capacity of %d bytes, found %f", tt.capacity, val)
+			}
+		})
+	}
+
+	ResetStorageUsage()
+}
+
 func findMetricsByCounter(buf io.ReadCloser, name string) []*io_prometheus_client.Metric {
 	defer buf.Close()
 	mf := io_prometheus_client.MetricFamily{}
@@ -3,6 +3,7 @@ package operator
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	appsapi "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -59,7 +60,7 @@ func (c *Controller) Bootstrap() error {
 	// unknown we will bootstrap as Managed but using EmptyDir storage
 	// engine(ephemeral).
 	mgmtState := operatorapi.Managed
-	if platformStorage == noStorage {
+	if reflect.DeepEqual(platformStorage, noStorage) {
 		mgmtState = operatorapi.Removed
 	}
 
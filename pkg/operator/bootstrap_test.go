@@ -84,3 +84,71 @@ func TestBootstrapAWS(t *testing.T) {
 		t.Errorf("unexpected config: %s", cmp.Diff(expected, config.Spec))
 	}
 }
+
+func TestSyncBootstrapDisabled(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		disableBootstrap bool
+		expectConfig     bool
+	}{
+		{
+			name:         "bootstrap",
+			expectConfig: true,
+		},
+		{
+			name:             "bootstrap disabled",
+			disableBootstrap: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			configClient := configfakeclient.NewSimpleClientset(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+					},
+				},
+			})
+			configInformerFactory := configinformers.NewSharedInformerFactory(configClient, 0)
+
+			imageregistryClient := imageregistryfakeclient.NewSimpleClientset()
+			imageregistryInformerFactory := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, 0)
+
+			c := &Controller{
+				listers: &client.Listers{
+					Infrastructures: configInformerFactory.Config().V1().Infrastructures().Lister(),
+					RegistryConfigs: imageregistryInformerFactory.Imageregistry().V1().Configs().Lister(),
+				},
+				clients: &client.Clients{
+					RegOp: imageregistryClient,
+				},
+				disableBootstrap: tt.disableBootstrap,
+			}
+
+			configInformerFactory.Start(ctx.Done())
+			imageregistryInformerFactory.Start(ctx.Done())
+			configInformerFactory.WaitForCacheSync(ctx.Done())
+			imageregistryInformerFactory.WaitForCacheSync(ctx.Done())
+
+			if err := c.sync(); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+
+			configs, err := imageregistryClient.ImageregistryV1().Configs().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expectConfig && len(configs.Items) != 1 {
+				t.Errorf("expected the config to be bootstrapped, got %d configs", len(configs.Items))
+			}
+			if !tt.expectConfig && len(configs.Items) != 0 {
+				t.Errorf("expected no config to be created, got %d configs", len(configs.Items))
+			}
+		})
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"crypto/rand"
 	"fmt"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/swift"
 )
 
 // randomSecretSize is the number of random bytes to generate
@@ -23,26 +28,94 @@ func appendFinalizer(cr *imageregistryv1.Config) {
 	cr.ObjectMeta.Finalizers = append(cr.ObjectMeta.Finalizers, defaults.ImageRegistryOperatorResourceFinalizer)
 }
 
-func verifyResource(cr *imageregistryv1.Config) error {
+func verifyResource(cr *imageregistryv1.Config, listers *regopclient.Listers) error {
 	if cr.Spec.Replicas < 0 {
 		return fmt.Errorf("replicas must be greater than or equal to 0")
 	}
 
+	if cr.Spec.MinReadySeconds < 0 {
+		return fmt.Errorf("minReadySeconds must be greater than or equal to 0")
+	}
+
 	names := map[string]struct{}{
 		defaults.RouteName: {},
 	}
 
+	hostnames := map[string]struct{}{}
+
 	for _, routeSpec := range cr.Spec.Routes {
 		_, found := names[routeSpec.Name]
 		if found {
 			return fmt.Errorf("duplication of names has been detected in the additional routes")
 		}
 		names[routeSpec.Name] = struct{}{}
+
+		// The router admits only one of the routes that claim the same
+		// hostname.
+		if len(routeSpec.Hostname) == 0 {
+			continue
+		}
+		if _, found := hostnames[routeSpec.Hostname]; found {
+			return fmt.Errorf("the hostname %s is used by several additional routes", routeSpec.Hostname)
+		}
+		hostnames[routeSpec.Hostname] = struct{}{}
+	}
+
+	// A pull-through cache doesn't accept pushes and expires the blobs it
+	// caches, it must not share a storage with the pushed images.
+	if cr.Spec.MirrorRegistry != nil && !mirrorStorage(cr.Spec.Storage) {
+		return fmt.Errorf("mirrorRegistry can only be used with emptyDir storage, the registry expires the content of its storage when it is a pull-through cache")
+	}
+
+	if err := verifyRequestTimeouts(cr.Spec.RequestTimeouts); err != nil {
+		return newPermanentError(defaults.DegradedReasonInvalidTimeout, err)
+	}
+
+	if cr.Spec.Storage.Azure != nil {
+		if err := azure.VerifyManagedIdentity(cr.Spec.Storage.Azure, listers.Secrets); err != nil {
+			return err
+		}
+	}
+
+	if cr.Spec.Storage.Swift != nil {
+		if err := swift.VerifyApplicationCredential(cr.Spec.Storage.Swift, listers.Secrets); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// verifyRequestTimeouts checks that the timeouts of the registry connections
+// are positive, a zero timeout would otherwise disable it silently.
+func verifyRequestTimeouts(timeouts imageregistryv1.ImageRegistryConfigRequestTimeouts) error {
+	for _, timeout := range []struct {
+		field    string
+		duration *metav1.Duration
+	}{
+		{field: "read", duration: timeouts.Read},
+		{field: "write", duration: timeouts.Write},
+		{field: "idle", duration: timeouts.Idle},
+	} {
+		if timeout.duration != nil && timeout.duration.Duration <= 0 {
+			return fmt.Errorf("requestTimeouts.%s must be positive, got %s", timeout.field, timeout.duration.Duration)
+		}
+	}
+	return nil
+}
+
+// mirrorStorage returns whether the storage can hold the cache of a
+// pull-through cache, i.e. whether it is an emptyDir or not configured yet.
+func mirrorStorage(storage imageregistryv1.ImageRegistryConfigStorage) bool {
+	return storage.S3 == nil &&
+		storage.GCS == nil &&
+		storage.Swift == nil &&
+		storage.PVC == nil &&
+		storage.Azure == nil &&
+		storage.Filesystem == nil &&
+		storage.OCI == nil
+}
+
 func applyDefaults(cr *imageregistryv1.Config) error {
 	if cr.Spec.HTTPSecret == "" {
 		var secretBytes [randomSecretSize]byte
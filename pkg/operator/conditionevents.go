@@ -0,0 +1,257 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// conditionEventsDebounce is the minimum time between two events about the
+// same condition. A condition that flaps back to the last reported status
+// within this time doesn't produce any event.
+const conditionEventsDebounce = 5 * time.Minute
+
+// conditionEventState is what the controller knows about a condition.
+type conditionEventState struct {
+	// reported is the status of the condition that was last reported with
+	// an event, or observed when the controller started.
+	reported string
+	// reportedAt is when the last event about the condition was emitted.
+	reportedAt time.Time
+}
+
+// observedCondition is a condition of the registry config or of the cluster
+// operator in a common form.
+type observedCondition struct {
+	source  string
+	ctype   string
+	status  string
+	reason  string
+	message string
+}
+
+// ConditionEventsController mirrors the transitions of the conditions of the
+// registry config and of the cluster operator into Kubernetes events, so
+// they can be caught by event based alerting.
+type ConditionEventsController struct {
+	imageRegistryConfigLister imageregistryv1listers.ConfigLister
+	clusterOperatorLister     configv1listers.ClusterOperatorLister
+	recorder                  events.Recorder
+
+	// states is only accessed by the single worker of the controller.
+	states   map[string]*conditionEventState
+	debounce time.Duration
+	clock    func() time.Time
+
+	cachesToSync []cache.InformerSynced
+	queue        workqueue.RateLimitingInterface
+}
+
+func NewConditionEventsController(
+	recorder events.Recorder,
+	imageRegistryConfigInformer imageregistryv1informers.ConfigInformer,
+	clusterOperatorInformer configv1informers.ClusterOperatorInformer,
+) *ConditionEventsController {
+	c := &ConditionEventsController{
+		imageRegistryConfigLister: imageRegistryConfigInformer.Lister(),
+		clusterOperatorLister:     clusterOperatorInformer.Lister(),
+		recorder:                  recorder,
+		states:                    map[string]*conditionEventState{},
+		debounce:                  conditionEventsDebounce,
+		clock:                     time.Now,
+		queue:                     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ConditionEventsController"),
+	}
+
+	imageRegistryConfigInformer.Informer().AddEventHandler(c.eventHandler())
+	c.cachesToSync = append(c.cachesToSync, imageRegistryConfigInformer.Informer().HasSynced)
+
+	clusterOperatorInformer.Informer().AddEventHandler(c.eventHandler())
+	c.cachesToSync = append(c.cachesToSync, clusterOperatorInformer.Informer().HasSynced)
+
+	return c
+}
+
+func (c *ConditionEventsController) eventHandler() cache.ResourceEventHandler {
+	const workQueueKey = "instance"
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.queue.Add(workQueueKey) },
+		UpdateFunc: func(old, new interface{}) { c.queue.Add(workQueueKey) },
+		DeleteFunc: func(obj interface{}) { c.queue.Add(workQueueKey) },
+	}
+}
+
+func (c *ConditionEventsController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ConditionEventsController) processNextWorkItem() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	klog.V(4).Infof("get event from workqueue")
+	if err := c.sync(); err != nil {
+		c.queue.AddRateLimited(workqueueKey)
+		klog.Errorf("ConditionEventsController: unable to sync: %s, requeuing", err)
+	} else {
+		c.queue.Forget(obj)
+		klog.V(4).Infof("ConditionEventsController: event from workqueue successfully processed")
+	}
+	return true
+}
+
+func (c *ConditionEventsController) sync() error {
+	var conditions []observedCondition
+
+	cr, err := c.imageRegistryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	} else if err == nil {
+		for _, cond := range cr.Status.Conditions {
+			conditions = append(conditions, observedCondition{
+				source:  "Config",
+				ctype:   cond.Type,
+				status:  string(cond.Status),
+				reason:  cond.Reason,
+				message: cond.Message,
+			})
+		}
+	}
+
+	co, err := c.clusterOperatorLister.Get(defaults.ImageRegistryClusterOperatorResourceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	} else if err == nil {
+		for _, cond := range co.Status.Conditions {
+			conditions = append(conditions, observedCondition{
+				source:  "ClusterOperator",
+				ctype:   string(cond.Type),
+				status:  string(cond.Status),
+				reason:  cond.Reason,
+				message: cond.Message,
+			})
+		}
+	}
+
+	if retry := c.reportConditions(conditions); retry > 0 {
+		c.queue.AddAfter(workqueueKey, retry)
+	}
+	return nil
+}
+
+// reportConditions emits events for the conditions whose status differs
+// from the last reported one. Conditions that changed too recently after
+// the previous event are postponed, the returned duration is when the
+// conditions should be reported again, or zero.
+func (c *ConditionEventsController) reportConditions(conditions []observedCondition) time.Duration {
+	now := c.clock()
+	var retry time.Duration
+	for _, cond := range conditions {
+		key := cond.source + "/" + cond.ctype
+		state, ok := c.states[key]
+		if !ok {
+			// Don't replay the history of the conditions when the operator
+			// starts, but let the alerting know about the bad ones.
+			c.states[key] = &conditionEventState{reported: cond.status}
+			if conditionEventType(cond) == corev1.EventTypeWarning {
+				c.emit(cond)
+				c.states[key].reportedAt = now
+			}
+			continue
+		}
+
+		if cond.status == state.reported {
+			continue
+		}
+
+		if delay := state.reportedAt.Add(c.debounce).Sub(now); delay > 0 {
+			if retry == 0 || delay < retry {
+				retry = delay
+			}
+			continue
+		}
+
+		c.emit(cond)
+		state.reported = cond.status
+		state.reportedAt = now
+	}
+	return retry
+}
+
+func (c *ConditionEventsController) emit(cond observedCondition) {
+	reason := conditionEventReason(cond)
+	message := fmt.Sprintf("%s condition %s is %s", cond.source, cond.ctype, cond.status)
+	if cond.reason != "" {
+		message += fmt.Sprintf(" (%s)", cond.reason)
+	}
+	if cond.message != "" {
+		message += ": " + cond.message
+	}
+
+	if conditionEventType(cond) == corev1.EventTypeWarning {
+		c.recorder.Warning(reason, message)
+	} else {
+		c.recorder.Event(reason, message)
+	}
+}
+
+// conditionEventReason returns the reason of the event for the condition,
+// e.g. ClusterOperatorDegradedTrue. It depends only on the source, the type
+// and the status of the condition so that alerts can match on it.
+func conditionEventReason(cond observedCondition) string {
+	return cond.source + cond.ctype + cond.status
+}
+
+// conditionEventType returns Warning when the condition reports a problem,
+// and Normal otherwise.
+func conditionEventType(cond observedCondition) string {
+	var bad configv1.ConditionStatus
+	switch {
+	case strings.HasSuffix(cond.ctype, "Degraded"), strings.HasSuffix(cond.ctype, "Unavailable"):
+		bad = configv1.ConditionTrue
+	case strings.HasSuffix(cond.ctype, "Available"), strings.HasSuffix(cond.ctype, "Exists"), strings.HasSuffix(cond.ctype, "Reachable"):
+		bad = configv1.ConditionFalse
+	default:
+		return corev1.EventTypeNormal
+	}
+	if cond.status == string(bad) {
+		return corev1.EventTypeWarning
+	}
+	return corev1.EventTypeNormal
+}
+
+func (c *ConditionEventsController) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting ConditionEventsController")
+	if !cache.WaitForCacheSync(stopCh, c.cachesToSync...) {
+		return
+	}
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	klog.Infof("Started ConditionEventsController")
+	<-stopCh
+	klog.Infof("Shutting down ConditionEventsController")
+}
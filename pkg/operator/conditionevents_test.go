@@ -0,0 +1,134 @@
+package operator
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+)
+
+func TestConditionEventType(t *testing.T) {
+	for _, tt := range []struct {
+		ctype     string
+		status    string
+		eventType string
+	}{
+		{ctype: "Degraded", status: "True", eventType: corev1.EventTypeWarning},
+		{ctype: "Degraded", status: "False", eventType: corev1.EventTypeNormal},
+		{ctype: "Available", status: "False", eventType: corev1.EventTypeWarning},
+		{ctype: "Available", status: "True", eventType: corev1.EventTypeNormal},
+		{ctype: "ServiceCAUnavailable", status: "True", eventType: corev1.EventTypeWarning},
+		{ctype: "StorageExists", status: "False", eventType: corev1.EventTypeWarning},
+		{ctype: "InternalHostnameReachable", status: "False", eventType: corev1.EventTypeWarning},
+		{ctype: "InternalHostnameReachable", status: "Unknown", eventType: corev1.EventTypeNormal},
+		{ctype: "Progressing", status: "True", eventType: corev1.EventTypeNormal},
+	} {
+		cond := observedCondition{source: "ClusterOperator", ctype: tt.ctype, status: tt.status}
+		if eventType := conditionEventType(cond); eventType != tt.eventType {
+			t.Errorf("%s=%s: expected event type %s, got %s", tt.ctype, tt.status, tt.eventType, eventType)
+		}
+	}
+}
+
+func TestConditionEvents(t *testing.T) {
+	recorder := events.NewInMemoryRecorder("test")
+	now := time.Now()
+	c := &ConditionEventsController{
+		recorder: recorder,
+		states:   map[string]*conditionEventState{},
+		debounce: time.Minute,
+		clock:    func() time.Time { return now },
+	}
+
+	degraded := func(status string) []observedCondition {
+		return []observedCondition{
+			{source: "ClusterOperator", ctype: "Available", status: "True"},
+			{source: "ClusterOperator", ctype: "Degraded", status: status, reason: "Unavailable", message: "The deployment does not have available replicas"},
+		}
+	}
+
+	type event struct {
+		eventType string
+		reason    string
+	}
+	expectEvents := func(step string, retry time.Duration, expectedRetry time.Duration, expected ...event) {
+		t.Helper()
+		var got []event
+		for _, e := range recorder.Events() {
+			got = append(got, event{eventType: e.Type, reason: e.Reason})
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected events %v, got %v", step, expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("%s: expected events %v, got %v", step, expected, got)
+			}
+		}
+		if retry != expectedRetry {
+			t.Fatalf("%s: expected retry after %s, got %s", step, expectedRetry, retry)
+		}
+	}
+
+	retry := c.reportConditions(degraded("False"))
+	expectEvents("initial state", retry, 0)
+
+	now = now.Add(time.Second)
+	retry = c.reportConditions(degraded("True"))
+	expectEvents("degraded", retry, 0,
+		event{corev1.EventTypeWarning, "ClusterOperatorDegradedTrue"},
+	)
+
+	// Flapping within the debounce period is not reported.
+	now = now.Add(10 * time.Second)
+	retry = c.reportConditions(degraded("False"))
+	expectEvents("flapping", retry, 50*time.Second,
+		event{corev1.EventTypeWarning, "ClusterOperatorDegradedTrue"},
+	)
+	now = now.Add(10 * time.Second)
+	retry = c.reportConditions(degraded("True"))
+	expectEvents("flapped back", retry, 0,
+		event{corev1.EventTypeWarning, "ClusterOperatorDegradedTrue"},
+	)
+
+	// The recovery is reported once the debounce period is over.
+	now = now.Add(10 * time.Second)
+	retry = c.reportConditions(degraded("False"))
+	expectEvents("recovering", retry, 30*time.Second,
+		event{corev1.EventTypeWarning, "ClusterOperatorDegradedTrue"},
+	)
+	now = now.Add(30 * time.Second)
+	retry = c.reportConditions(degraded("False"))
+	expectEvents("recovered", retry, 0,
+		event{corev1.EventTypeWarning, "ClusterOperatorDegradedTrue"},
+		event{corev1.EventTypeNormal, "ClusterOperatorDegradedFalse"},
+	)
+}
+
+func TestConditionEventsInitialWarnings(t *testing.T) {
+	recorder := events.NewInMemoryRecorder("test")
+	c := &ConditionEventsController{
+		recorder: recorder,
+		states:   map[string]*conditionEventState{},
+		debounce: time.Minute,
+		clock:    time.Now,
+	}
+
+	c.reportConditions([]observedCondition{
+		{source: "Config", ctype: "Available", status: "False", reason: "NoReplicasAvailable"},
+		{source: "Config", ctype: "Progressing", status: "True"},
+	})
+
+	events := recorder.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %d", len(events))
+	}
+	if events[0].Type != corev1.EventTypeWarning || events[0].Reason != "ConfigAvailableFalse" {
+		t.Errorf("expected a ConfigAvailableFalse warning, got %s %s", events[0].Type, events[0].Reason)
+	}
+	if expected := "Config condition Available is False (NoReplicasAvailable)"; events[0].Message != expected {
+		t.Errorf("expected message %q, got %q", expected, events[0].Message)
+	}
+}
@@ -6,15 +6,21 @@ import (
 	"reflect"
 	"time"
 
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	kmeta "k8s.io/apimachinery/pkg/api/meta"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclient "k8s.io/client-go/kubernetes"
+	kcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
@@ -25,9 +31,11 @@ import (
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
 	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	imageregistryscheme "github.com/openshift/client-go/imageregistry/clientset/versioned/scheme"
 	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
 	routeclient "github.com/openshift/client-go/route/clientset/versioned"
 	routeinformers "github.com/openshift/client-go/route/informers/externalversions"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -41,6 +49,10 @@ const (
 	kubeSystemNamespace   = "kube-system"
 	workqueueKey          = "changes"
 	defaultResyncDuration = 10 * time.Minute
+
+	// overloadBackoffBaseDelay is the delay of the syncs after the first
+	// overload response of the API server.
+	overloadBackoffBaseDelay = time.Second
 )
 
 type permanentError struct {
@@ -69,6 +81,7 @@ func NewController(
 	configClient configclient.Interface,
 	imageregistryClient imageregistryclient.Interface,
 	routeClient routeclient.Interface,
+	dynamicClient dynamic.Interface,
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	openshiftConfigKubeInformerFactory kubeinformers.SharedInformerFactory,
 	openshiftConfigManagedKubeInformerFactory kubeinformers.SharedInformerFactory,
@@ -76,19 +89,38 @@ func NewController(
 	configInformerFactory configinformers.SharedInformerFactory,
 	regopInformerFactory imageregistryinformers.SharedInformerFactory,
 	routeInformerFactory routeinformers.SharedInformerFactory,
+	disableBootstrap bool,
+	reconcileTimeout time.Duration,
+	overloadBackoff *regopclient.APIServerBackoff,
+	storageConnectivityThresholds resource.StorageConnectivityThresholds,
 ) *Controller {
 	listers := &regopclient.Listers{}
 	clients := &regopclient.Clients{}
+	generator := resource.NewGenerator(kubeconfig, clients, listers)
+	generator.SetStorageConnectivityThresholds(storageConnectivityThresholds)
 	c := &Controller{
 		kubeconfig: kubeconfig,
-		generator:  resource.NewGenerator(kubeconfig, clients, listers),
-		workqueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Changes"),
+		generator:  generator,
+		workqueue:  workqueue.NewNamedRateLimitingQueue(overloadBackoff.RateLimiter(workqueue.DefaultControllerRateLimiter()), "Changes"),
 		listers:    listers,
 		clients:    clients,
+
+		disableBootstrap: disableBootstrap,
+		reconcileTimeout: reconcileTimeout,
+		overloadBackoff:  overloadBackoff,
 	}
 
-	// Initial event to bootstrap CR if it doesn't exist.
-	c.workqueue.AddRateLimited(workqueueKey)
+	// The registry config is cluster scoped, its events are created in the
+	// default namespace.
+	c.eventBroadcaster = record.NewBroadcaster()
+	c.recorder = c.eventBroadcaster.NewRecorder(imageregistryscheme.Scheme, corev1.EventSource{Component: "cluster-image-registry-operator"})
+	c.clock = time.Now
+
+	// Initial event to bootstrap CR if it doesn't exist. Without bootstrap
+	// the controller waits for the events of the informers.
+	if !disableBootstrap {
+		c.workqueue.AddRateLimited(workqueueKey)
+	}
 
 	c.clients.Core = kubeClient.CoreV1()
 	c.clients.Apps = kubeClient.AppsV1()
@@ -98,6 +130,7 @@ func NewController(
 	c.clients.Config = configClient.ConfigV1()
 	c.clients.RegOp = imageregistryClient
 	c.clients.Batch = kubeClient.BatchV1()
+	c.clients.Dynamic = dynamicClient
 
 	for _, ctor := range []func() cache.SharedIndexInformer{
 		func() cache.SharedIndexInformer {
@@ -130,6 +163,13 @@ func NewController(
 			c.listers.PodDisruptionBudgets = informer.Lister().PodDisruptionBudgets(defaults.ImageRegistryOperatorNamespace)
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := kubeInformerFactory.Networking().V1().NetworkPolicies()
+			c.listers.NetworkPolicies = informer.Lister().NetworkPolicies(defaults.ImageRegistryOperatorNamespace)
+			return informer.Informer()
+		},
+		// The deletions of the routes are enqueued by the DeleteFunc of
+		// handler like the other events, the next sync recreates them.
 		func() cache.SharedIndexInformer {
 			informer := routeInformerFactory.Route().V1().Routes()
 			c.listers.Routes = informer.Lister().Routes(defaults.ImageRegistryOperatorNamespace)
@@ -155,6 +195,11 @@ func NewController(
 			c.listers.OpenShiftConfigManaged = informer.Lister().ConfigMaps(defaults.OpenShiftConfigManagedNamespace)
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := openshiftConfigKubeInformerFactory.Core().V1().Secrets()
+			c.listers.OpenShiftConfigSecrets = informer.Lister().Secrets(defaults.OpenShiftConfigNamespace)
+			return informer.Informer()
+		},
 		func() cache.SharedIndexInformer {
 			informer := configInformerFactory.Config().V1().Proxies()
 			c.listers.ProxyConfigs = informer.Lister()
@@ -175,6 +220,11 @@ func NewController(
 			c.listers.Infrastructures = informer.Lister()
 			return informer.Informer()
 		},
+		func() cache.SharedIndexInformer {
+			informer := configInformerFactory.Config().V1().Networks()
+			c.listers.NetworkConfigs = informer.Lister()
+			return informer.Informer()
+		},
 	} {
 		informer := ctor()
 		informer.AddEventHandler(c.handler())
@@ -192,14 +242,47 @@ type Controller struct {
 	listers      *regopclient.Listers
 	clients      *regopclient.Clients
 	cachesToSync []cache.InformerSynced
+
+	// disableBootstrap prevents the controller from creating the registry
+	// custom resource when it doesn't exist.
+	disableBootstrap bool
+
+	// reconcileTimeout is how long the storage and the objects of the
+	// registry can be reconciled during a single sync, zero means no limit.
+	reconcileTimeout time.Duration
+
+	// overloadBackoff delays the syncs while the API server is overloaded,
+	// nil if the syncs are never delayed.
+	overloadBackoff *regopclient.APIServerBackoff
+
+	// eventBroadcaster sends the events of recorder to the API server once
+	// the controller runs.
+	eventBroadcaster record.EventBroadcaster
+	recorder         record.EventRecorder
+
+	// recordedErrors is when the errors of the syncs were last reported with
+	// an event, it's only accessed by the event processor.
+	recordedErrors map[string]time.Time
+	clock          func() time.Time
 }
 
-func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
+// reconcileContext returns the context for applying the registry
+// configuration, it's done once the reconcile timeout is over.
+func (c *Controller) reconcileContext() (context.Context, context.CancelFunc) {
+	if c.reconcileTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.reconcileTimeout)
+}
+
+func (c *Controller) createOrUpdateResources(ctx context.Context, cr *imageregistryv1.Config) error {
 	appendFinalizer(cr)
 
-	err := verifyResource(cr)
-	if err != nil {
-		return newPermanentError("VerificationFailed", fmt.Errorf("unable to complete resource: %s", err))
+	err := verifyResource(cr, c.listers)
+	if e, ok := err.(permanentError); ok {
+		return newPermanentError(e.Reason, fmt.Errorf("unable to complete resource: %s", e.Err))
+	} else if err != nil {
+		return newPermanentError(defaults.DegradedReasonVerificationFailed, fmt.Errorf("unable to complete resource: %s", err))
 	}
 
 	err = applyDefaults(cr)
@@ -207,9 +290,17 @@ func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
 		return err
 	}
 
-	err = c.generator.Apply(cr)
+	deferred := storage.ProvisioningDeferred(cr)
+	updateProvisioningDeferredCondition(cr, deferred)
+	if deferred {
+		return nil
+	}
+
+	err = c.generator.Apply(ctx, cr)
 	if err == storage.ErrStorageNotConfigured {
-		return newPermanentError("StorageNotConfigured", err)
+		return newPermanentError(defaults.DegradedReasonStorageNotConfigured, err)
+	} else if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("unable to apply the configuration within %s: %s", c.reconcileTimeout, err)
 	} else if err != nil {
 		return err
 	}
@@ -221,18 +312,10 @@ func (c *Controller) createOrUpdateResources(cr *imageregistryv1.Config) error {
 // the default route if configured.
 func (c *Controller) getRoutes(cr *imageregistryv1.Config) ([]*routev1.Route, error) {
 	var routes []*routev1.Route
-	if cr.Spec.DefaultRoute {
-		if route, err := c.listers.Routes.Get(defaults.RouteName); err != nil {
-			klog.V(4).Infof("unable to get default route: %s", err)
-		} else {
-			routes = append(routes, route)
-		}
-	}
-
-	for _, rcfg := range cr.Spec.Routes {
-		route, err := c.listers.Routes.Get(rcfg.Name)
+	for _, name := range resource.ConfiguredRoutes(cr) {
+		route, err := c.listers.Routes.Get(name)
 		if err != nil {
-			klog.V(4).Infof("unable to get route: %s", err)
+			klog.V(4).Infof("unable to get route %s: %s", name, err)
 			continue
 		}
 		routes = append(routes, route)
@@ -240,10 +323,41 @@ func (c *Controller) getRoutes(cr *imageregistryv1.Config) ([]*routev1.Route, er
 	return routes, nil
 }
 
+// syncCABundleStatus compares the dependencies checksum of the registry pods,
+// which covers the configmaps the CA bundle is extracted from, with the one
+// of the deployment. The pods are only listed while the deployment has pods
+// from a previous template.
+func (c *Controller) syncCABundleStatus(cr *imageregistryv1.Config, deploy *appsapi.Deployment) error {
+	if deploy == nil {
+		return nil
+	}
+	checksum := deploy.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation]
+	if deploy.Status.ObservedGeneration >= deploy.Generation && deploy.Status.UpdatedReplicas == deploy.Status.Replicas {
+		updateCABundleStaleCondition(cr, checksum, nil)
+		return nil
+	}
+	podList, err := c.clients.Core.Pods(defaults.ImageRegistryOperatorNamespace).List(context.TODO(), metaapi.ListOptions{
+		LabelSelector: labels.SelectorFromSet(defaults.DeploymentLabels).String(),
+	})
+	if err != nil {
+		return err
+	}
+	pods := make([]*corev1.Pod, 0, len(podList.Items))
+	for i := range podList.Items {
+		pods = append(pods, &podList.Items[i])
+	}
+	updateCABundleStaleCondition(cr, checksum, pods)
+	return nil
+}
+
 func (c *Controller) sync() error {
 	cr, err := c.listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			if c.disableBootstrap {
+				klog.V(2).Infof("%q registry operator resource not found, bootstrap is disabled", defaults.ImageRegistryResourceName)
+				return nil
+			}
 			return c.Bootstrap()
 		}
 		return fmt.Errorf("failed to get %q registry operator resource: %s", defaults.ImageRegistryResourceName, err)
@@ -256,12 +370,23 @@ func (c *Controller) sync() error {
 		return err
 	}
 
+	if isUnmanagedStatusSynced(cr) {
+		return c.syncUnmanaged(cr)
+	}
+
+	// Only applying the configuration is bound to the reconcile timeout, the
+	// status below should be updated even if it took too long.
+	ctx, cancel := c.reconcileContext()
+	defer cancel()
+
 	var applyError error
 	switch cr.Spec.ManagementState {
 	case operatorv1.Removed:
 		applyError = c.RemoveResources(cr)
 	case operatorv1.Managed:
-		applyError = c.createOrUpdateResources(cr)
+		applyError = c.createOrUpdateResources(ctx, cr)
+		updatePermissionsCondition(cr, applyError)
+		c.recordErrorEvent(cr, applyError)
 	case operatorv1.Unmanaged:
 		// ignore
 	default:
@@ -283,6 +408,12 @@ func (c *Controller) sync() error {
 	}
 	c.syncStatus(cr, deploy, routes, applyError)
 
+	if cr.Spec.ManagementState == operatorv1.Managed {
+		if err := c.syncCABundleStatus(cr, deploy); err != nil {
+			klog.Errorf("unable to check the CA bundle of the registry pods: %s", err)
+		}
+	}
+
 	metadataChanged := strategy.Metadata(&prevCR.ObjectMeta, &cr.ObjectMeta)
 	specChanged := !reflect.DeepEqual(prevCR.Spec, cr.Spec)
 	if metadataChanged || specChanged {
@@ -340,6 +471,10 @@ func (c *Controller) sync() error {
 		}
 	}
 
+	if applyError == nil && cr.Spec.ManagementState == operatorv1.Managed {
+		c.scheduleCredentialsRefresh(cr)
+	}
+
 	if _, ok := applyError.(permanentError); !ok {
 		return applyError
 	}
@@ -347,6 +482,56 @@ func (c *Controller) sync() error {
 	return nil
 }
 
+// scheduleCredentialsRefresh requeues the config once the credentials
+// refresh interval of the storage is over. The next sync re-reads the
+// credentials and rolls out the registry if they changed. Pending refreshes
+// are not postponed by the syncs in between.
+func (c *Controller) scheduleCredentialsRefresh(cr *imageregistryv1.Config) {
+	interval := storage.CredentialsRefreshInterval(&cr.Spec.Storage)
+	if interval <= 0 {
+		return
+	}
+	klog.V(4).Infof("the storage credentials will be refreshed in %s", interval)
+	c.workqueue.AddAfter(workqueueKey, interval)
+}
+
+// isUnmanagedStatusSynced returns true when the registry is unmanaged and its
+// status already reports it.
+func isUnmanagedStatusSynced(cr *imageregistryv1.Config) bool {
+	if cr.Spec.ManagementState != operatorv1.Unmanaged {
+		return false
+	}
+	for _, condtype := range []string{
+		operatorv1.OperatorStatusTypeAvailable,
+		operatorv1.OperatorStatusTypeProgressing,
+		operatorv1.OperatorStatusTypeDegraded,
+	} {
+		cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, condtype)
+		if cond == nil || cond.Reason != "Unmanaged" {
+			return false
+		}
+	}
+	return true
+}
+
+// syncUnmanaged is the fast path of sync for unmanaged registries, nothing
+// is applied and the status is updated only when a new generation of the
+// config is observed.
+func (c *Controller) syncUnmanaged(cr *imageregistryv1.Config) error {
+	if cr.Status.ObservedGeneration == cr.Generation {
+		return nil
+	}
+
+	cr.Status.ObservedGeneration = cr.Generation
+	_, err := c.clients.RegOp.ImageregistryV1().Configs().UpdateStatus(
+		context.TODO(), cr, metaapi.UpdateOptions{},
+	)
+	if err != nil && !errors.IsConflict(err) {
+		klog.Errorf("unable to update status %s: %s", utilObjectInfo(cr), err)
+	}
+	return err
+}
+
 func (c *Controller) eventProcessor() {
 	for {
 		obj, shutdown := c.workqueue.Get()
@@ -364,6 +549,12 @@ func (c *Controller) eventProcessor() {
 				return
 			}
 
+			if delay := c.overloadBackoff.Delay(); delay > 0 {
+				klog.V(1).Infof("the API server is overloaded, delaying the sync by %s", delay)
+				c.workqueue.AddAfter(obj, delay)
+				return
+			}
+
 			if err := c.sync(); err != nil {
 				c.workqueue.AddRateLimited(workqueueKey)
 				klog.Errorf("unable to sync: %s, requeuing", err)
@@ -441,8 +632,15 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 		return
 	}
 
+	c.eventBroadcaster.StartRecordingToSink(&kcorev1.EventSinkImpl{Interface: c.clients.Core.Events("")})
+	defer c.eventBroadcaster.Shutdown()
+
 	klog.Infof("Starting Controller")
+	if c.disableBootstrap {
+		klog.Infof("Bootstrap is disabled, the registry is not deployed until the %q registry operator resource is created", defaults.ImageRegistryResourceName)
+	}
 	go wait.Until(c.eventProcessor, time.Second, stopCh)
+	go wait.Until(c.collectStorageUsage, defaultResyncDuration, stopCh)
 
 	<-stopCh
 	klog.Infof("Shutting down Controller ...")
@@ -0,0 +1,630 @@
+package operator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	imageregistryfakeclient "github.com/openshift/client-go/imageregistry/clientset/versioned/fake"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+func TestSyncUnmanaged(t *testing.T) {
+	unmanagedConditions := []operatorv1.OperatorCondition{
+		{Type: operatorv1.OperatorStatusTypeAvailable, Status: operatorv1.ConditionTrue, Reason: "Unmanaged"},
+		{Type: operatorv1.OperatorStatusTypeProgressing, Status: operatorv1.ConditionFalse, Reason: "Unmanaged"},
+		{Type: operatorv1.OperatorStatusTypeDegraded, Status: operatorv1.ConditionFalse, Reason: "Unmanaged"},
+	}
+	managedConditions := []operatorv1.OperatorCondition{
+		{Type: operatorv1.OperatorStatusTypeAvailable, Status: operatorv1.ConditionTrue, Reason: "Ready"},
+		{Type: operatorv1.OperatorStatusTypeProgressing, Status: operatorv1.ConditionFalse, Reason: "Ready"},
+		{Type: operatorv1.OperatorStatusTypeDegraded, Status: operatorv1.ConditionFalse},
+	}
+
+	for _, tt := range []struct {
+		name               string
+		conditions         []operatorv1.OperatorCondition
+		observedGeneration int64
+		expectUpdate       bool
+	}{
+		{
+			name:               "status up to date",
+			conditions:         unmanagedConditions,
+			observedGeneration: 2,
+		},
+		{
+			name:               "new generation",
+			conditions:         unmanagedConditions,
+			observedGeneration: 1,
+			expectUpdate:       true,
+		},
+		{
+			name:               "switched from managed",
+			conditions:         managedConditions,
+			observedGeneration: 1,
+			expectUpdate:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       defaults.ImageRegistryResourceName,
+					Generation: 2,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: operatorv1.Unmanaged,
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{
+						Conditions:         tt.conditions,
+						ObservedGeneration: tt.observedGeneration,
+					},
+				},
+			}
+
+			imageregistryClient := imageregistryfakeclient.NewSimpleClientset(cr)
+			c := &Controller{
+				listers: cirofake.NewFixturesBuilder().AddRegistryOperatorConfig(cr).BuildListers(),
+				clients: &client.Clients{
+					RegOp: imageregistryClient,
+				},
+			}
+
+			if err := c.sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			actions := imageregistryClient.Actions()
+			if !tt.expectUpdate {
+				if len(actions) != 0 {
+					t.Fatalf("expected no requests, got %v", actions)
+				}
+				return
+			}
+			if len(actions) != 1 || actions[0].GetVerb() != "update" || actions[0].GetSubresource() != "status" {
+				t.Fatalf("expected a single status update, got %v", actions)
+			}
+
+			updated, err := imageregistryClient.Tracker().Get(imageregistryv1.SchemeGroupVersion.WithResource("configs"), "", defaults.ImageRegistryResourceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := updated.(*imageregistryv1.Config).Status
+			if status.ObservedGeneration != 2 {
+				t.Errorf("expected observed generation 2, got %d", status.ObservedGeneration)
+			}
+			if cond := v1helpers.FindOperatorCondition(status.Conditions, operatorv1.OperatorStatusTypeAvailable); cond == nil || cond.Reason != "Unmanaged" {
+				t.Errorf("expected the Available condition to report the unmanaged state, got %#v", cond)
+			}
+		})
+	}
+}
+
+func TestIsUnmanagedStatusSynced(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			ManagementState: operatorv1.Managed,
+		},
+		Status: imageregistryv1.ImageRegistryStatus{
+			OperatorStatus: operatorv1.OperatorStatus{
+				Conditions: []operatorv1.OperatorCondition{
+					{Type: operatorv1.OperatorStatusTypeAvailable, Status: operatorv1.ConditionTrue, Reason: "Unmanaged"},
+					{Type: operatorv1.OperatorStatusTypeProgressing, Status: operatorv1.ConditionFalse, Reason: "Unmanaged"},
+					{Type: operatorv1.OperatorStatusTypeDegraded, Status: operatorv1.ConditionFalse, Reason: "Unmanaged"},
+				},
+			},
+		},
+	}
+
+	// A registry switched back to Managed must go through the full sync
+	// even though its status still reports the unmanaged state.
+	if isUnmanagedStatusSynced(cr) {
+		t.Errorf("expected a managed registry not to take the unmanaged fast path")
+	}
+
+	cr.Spec.ManagementState = operatorv1.Unmanaged
+	if !isUnmanagedStatusSynced(cr) {
+		t.Errorf("expected an unmanaged registry with an up to date status to take the fast path")
+	}
+}
+
+func TestReconcileContext(t *testing.T) {
+	c := &Controller{}
+	ctx, cancel := c.reconcileContext()
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("expected no deadline without a reconcile timeout")
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("expected the context to be cancelled, got %v", ctx.Err())
+	}
+
+	c.reconcileTimeout = time.Minute
+	ctx, cancel = c.reconcileContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("expected a deadline with a reconcile timeout")
+	}
+	if remaining := time.Until(deadline); remaining > time.Minute || remaining < 50*time.Second {
+		t.Errorf("expected the deadline to be in a minute, got %s", remaining)
+	}
+}
+
+func TestCreateOrUpdateResourcesTimeout(t *testing.T) {
+	listers := cirofake.NewFixturesBuilder().BuildListers()
+	c := &Controller{
+		generator:        resource.NewGenerator(nil, &client.Clients{}, listers),
+		listers:          listers,
+		reconcileTimeout: time.Millisecond,
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+
+	ctx, cancel := c.reconcileContext()
+	defer cancel()
+	<-ctx.Done()
+
+	err := c.createOrUpdateResources(ctx, cr)
+	if err == nil || !strings.Contains(err.Error(), "unable to apply the configuration within 1ms") {
+		t.Fatalf("expected the reconcile timeout to be reported, got %v", err)
+	}
+	if _, ok := err.(permanentError); ok {
+		t.Errorf("expected the timeout to be retried, got a permanent error")
+	}
+}
+
+func TestCreateOrUpdateResourcesDeferred(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		provisioning   string
+		status         imageregistryv1.ImageRegistryConfigStorage
+		expectApplied  bool
+		expectedStatus operatorv1.ConditionStatus
+	}{
+		{
+			name:           "deferred",
+			provisioning:   imageregistryv1.StorageProvisioningDeferred,
+			expectedStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:           "deferred, already provisioned",
+			provisioning:   imageregistryv1.StorageProvisioningDeferred,
+			status:         imageregistryv1.ImageRegistryConfigStorage{EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{}},
+			expectApplied:  true,
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name:           "immediate",
+			provisioning:   imageregistryv1.StorageProvisioningImmediate,
+			expectApplied:  true,
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().BuildListers()
+			c := &Controller{
+				generator:        resource.NewGenerator(nil, &client.Clients{}, listers),
+				listers:          listers,
+				reconcileTimeout: time.Millisecond,
+			}
+
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryResourceName,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						EmptyDir:     &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+						Provisioning: tt.provisioning,
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: tt.status,
+				},
+			}
+
+			// The generator fails with the expired context, it is
+			// only reached when the provisioning isn't deferred.
+			ctx, cancel := c.reconcileContext()
+			defer cancel()
+			<-ctx.Done()
+
+			err := c.createOrUpdateResources(ctx, cr)
+			if tt.expectApplied && err == nil {
+				t.Fatalf("expected the configuration to be applied")
+			} else if !tt.expectApplied && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageProvisioningDeferred)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageProvisioningDeferred)
+			}
+			if cond.Status != tt.expectedStatus {
+				t.Errorf("expected %s to be %s, got %s", defaults.StorageProvisioningDeferred, tt.expectedStatus, cond.Status)
+			}
+		})
+	}
+}
+
+// delayRecorder records the items added to the queue with a delay.
+type delayRecorder struct {
+	workqueue.RateLimitingInterface
+	delays []time.Duration
+}
+
+func (q *delayRecorder) AddAfter(item interface{}, duration time.Duration) {
+	q.delays = append(q.delays, duration)
+}
+
+func TestScheduleCredentialsRefresh(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		storage imageregistryv1.ImageRegistryConfigStorage
+		delays  []time.Duration
+	}{
+		{
+			name: "s3 without refresh interval",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{},
+			},
+		},
+		{
+			name: "s3 with refresh interval",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					CredentialsRefreshInterval: metav1.Duration{Duration: 15 * time.Minute},
+				},
+			},
+			delays: []time.Duration{15 * time.Minute},
+		},
+		{
+			name: "invalid refresh interval",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					CredentialsRefreshInterval: metav1.Duration{Duration: time.Second},
+				},
+			},
+		},
+		{
+			name: "storage without credentials",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &delayRecorder{}
+			c := &Controller{
+				workqueue: queue,
+			}
+			c.scheduleCredentialsRefresh(&imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: tt.storage,
+				},
+			})
+
+			if len(queue.delays) != len(tt.delays) {
+				t.Fatalf("expected the refreshes %v to be scheduled, got %v", tt.delays, queue.delays)
+			}
+			for i := range tt.delays {
+				if queue.delays[i] != tt.delays[i] {
+					t.Errorf("expected the refreshes %v to be scheduled, got %v", tt.delays, queue.delays)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateResourcesMirrorRegistry(t *testing.T) {
+	listers := cirofake.NewFixturesBuilder().BuildListers()
+	c := &Controller{
+		generator: resource.NewGenerator(nil, &client.Clients{}, listers),
+		listers:   listers,
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry"},
+			},
+			MirrorRegistry: &imageregistryv1.ImageRegistryConfigMirrorRegistry{
+				RemoteURL: "https://registry-1.docker.io",
+			},
+		},
+	}
+
+	err := c.createOrUpdateResources(context.Background(), cr)
+	permanentErr, ok := err.(permanentError)
+	if !ok {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if permanentErr.Reason != defaults.DegradedReasonVerificationFailed {
+		t.Errorf("expected the reason %s, got %s", defaults.DegradedReasonVerificationFailed, permanentErr.Reason)
+	}
+	if !strings.Contains(err.Error(), "mirrorRegistry can only be used with emptyDir storage") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cr.Spec.Storage = imageregistryv1.ImageRegistryConfigStorage{
+		EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+	}
+	if err := verifyResource(cr, c.listers); err != nil {
+		t.Errorf("expected the emptyDir storage to be accepted, got %v", err)
+	}
+}
+
+func TestCreateOrUpdateResourcesInvalidTimeout(t *testing.T) {
+	listers := cirofake.NewFixturesBuilder().BuildListers()
+	c := &Controller{
+		generator: resource.NewGenerator(nil, &client.Clients{}, listers),
+		listers:   listers,
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			RequestTimeouts: imageregistryv1.ImageRegistryConfigRequestTimeouts{
+				Read:  &metav1.Duration{Duration: time.Minute},
+				Write: &metav1.Duration{Duration: -time.Second},
+			},
+		},
+	}
+
+	err := c.createOrUpdateResources(context.Background(), cr)
+	permanentErr, ok := err.(permanentError)
+	if !ok {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if permanentErr.Reason != defaults.DegradedReasonInvalidTimeout {
+		t.Errorf("expected the reason %s, got %s", defaults.DegradedReasonInvalidTimeout, permanentErr.Reason)
+	}
+	if err.Error() != "unable to complete resource: requestTimeouts.write must be positive, got -1s" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cr.Spec.RequestTimeouts.Write = &metav1.Duration{Duration: time.Minute}
+	if err := verifyResource(cr, listers); err != nil {
+		t.Errorf("expected the positive timeouts to be accepted, got %v", err)
+	}
+}
+
+func TestCreateOrUpdateResourcesAzureManagedIdentity(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("key"),
+		},
+	})
+	listers := builder.BuildListers()
+	c := &Controller{
+		generator: resource.NewGenerator(nil, &client.Clients{}, listers),
+		listers:   listers,
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+					AccountName: "account",
+					ClientID:    "11111111-2222-3333-4444-555555555555",
+				},
+			},
+		},
+	}
+
+	err := c.createOrUpdateResources(context.Background(), cr)
+	permanentErr, ok := err.(permanentError)
+	if !ok {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if permanentErr.Reason != defaults.DegradedReasonVerificationFailed {
+		t.Errorf("expected the reason %s, got %s", defaults.DegradedReasonVerificationFailed, permanentErr.Reason)
+	}
+	if !strings.Contains(err.Error(), "storage.azure.clientID cannot be used together with REGISTRY_STORAGE_AZURE_ACCOUNTKEY") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := verifyResource(cr, cirofake.NewFixturesBuilder().BuildListers()); err != nil {
+		t.Errorf("expected the managed identity without a key to be accepted, got %v", err)
+	}
+}
+
+func TestVerifyResourceSwiftApplicationCredential(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.ImageRegistryConfigStorageSwift
+		data   map[string][]byte
+		err    string
+	}{
+		{
+			name:   "password",
+			config: &imageregistryv1.ImageRegistryConfigStorageSwift{},
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_USERNAME": []byte("user"),
+				"REGISTRY_STORAGE_SWIFT_PASSWORD": []byte("password"),
+			},
+		},
+		{
+			name: "application credential",
+			config: &imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialID: "appcred",
+			},
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte("secret"),
+			},
+		},
+		{
+			name: "application credential and password",
+			config: &imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialName: "registry",
+			},
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_USERNAME": []byte("user"),
+				"REGISTRY_STORAGE_SWIFT_PASSWORD": []byte("password"),
+			},
+			err: "the swift application credential cannot be used together with REGISTRY_STORAGE_SWIFT_PASSWORD of the secret openshift-image-registry/image-registry-private-configuration-user, one of them has to be removed",
+		},
+		{
+			name:   "application credential secret and password",
+			config: &imageregistryv1.ImageRegistryConfigStorageSwift{},
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte("secret"),
+				"REGISTRY_STORAGE_SWIFT_PASSWORD":                    []byte("password"),
+			},
+			err: "the swift application credential cannot be used together with REGISTRY_STORAGE_SWIFT_PASSWORD of the secret openshift-image-registry/image-registry-private-configuration-user, one of them has to be removed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryPrivateConfigurationUser,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: tt.data,
+			})
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Swift: tt.config,
+					},
+				},
+			}
+			err := verifyResource(cr, builder.BuildListers())
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyResourceRouteHostnames(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		routes []imageregistryv1.ImageRegistryConfigRoute
+		err    string
+	}{
+		{
+			name: "vanity hostnames",
+			routes: []imageregistryv1.ImageRegistryConfigRoute{
+				{Name: "internal", Hostname: "registry.internal.example.com", SecretName: "internal-tls"},
+				{Name: "partner", Hostname: "registry.partner.example.com", SecretName: "partner-tls"},
+				{Name: "generated"},
+				{Name: "also-generated"},
+			},
+		},
+		{
+			name: "shared hostname",
+			routes: []imageregistryv1.ImageRegistryConfigRoute{
+				{Name: "internal", Hostname: "registry.example.com"},
+				{Name: "partner", Hostname: "registry.example.com"},
+			},
+			err: "the hostname registry.example.com is used by several additional routes",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Routes: tt.routes,
+				},
+			}
+			err := verifyResource(cr, cirofake.NewFixturesBuilder().BuildListers())
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestHandlerDeleted(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.ServiceAccountName,
+		},
+	}
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.RouteName,
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		obj  interface{}
+	}{
+		{name: "service account", obj: sa},
+		{name: "service account tombstone", obj: cache.DeletedFinalStateUnknown{Key: defaults.ImageRegistryOperatorNamespace + "/" + defaults.ServiceAccountName, Obj: sa}},
+		{name: "route", obj: route},
+		{name: "route tombstone", obj: cache.DeletedFinalStateUnknown{Key: defaults.ImageRegistryOperatorNamespace + "/" + defaults.RouteName, Obj: route}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{
+				workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Changes"),
+			}
+			defer c.workqueue.ShutDown()
+
+			c.handler().OnDelete(tt.obj)
+
+			if c.workqueue.Len() != 1 {
+				t.Fatalf("expected the deletion to trigger a reconcile, got %d queued keys", c.workqueue.Len())
+			}
+			if key, _ := c.workqueue.Get(); key != workqueueKey {
+				t.Errorf("got the key %v, want %v", key, workqueueKey)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
@@ -29,6 +30,7 @@ import (
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/integrityscan"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
@@ -52,14 +54,17 @@ func NewImagePrunerController(
 	kubeInformerFactory kubeinformers.SharedInformerFactory,
 	regopInformerFactory imageregistryinformers.SharedInformerFactory,
 	imageConfigInformer configv1informers.ImageInformer,
+	overloadBackoff *regopclient.APIServerBackoff,
 ) *ImagePrunerController {
 	listers := &regopclient.ImagePrunerControllerListers{}
 	clients := &regopclient.Clients{}
 	c := &ImagePrunerController{
 		generator: resource.NewImagePrunerGenerator(clients, listers),
-		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), imagePrunerWorkQueueKey),
+		workqueue: workqueue.NewNamedRateLimitingQueue(overloadBackoff.RateLimiter(workqueue.DefaultControllerRateLimiter()), imagePrunerWorkQueueKey),
 		listers:   listers,
 		clients:   clients,
+
+		overloadBackoff: overloadBackoff,
 	}
 
 	// Initial event to bootstrap the pruner if it doesn't exist.
@@ -133,6 +138,16 @@ type ImagePrunerController struct {
 	listers      *regopclient.ImagePrunerControllerListers
 	clients      *regopclient.Clients
 	cachesToSync []cache.InformerSynced
+
+	// overloadBackoff delays the syncs while the API server is overloaded,
+	// nil if the syncs are never delayed.
+	overloadBackoff *regopclient.APIServerBackoff
+
+	// inspectedJob is the last pruner job whose logs were read, and
+	// inspectedJobStreams the unresolvable image streams they reported.
+	// The logs of a finished job don't change, they are read only once.
+	inspectedJob        types.UID
+	inspectedJobStreams []string
 }
 
 func (c *ImagePrunerController) createOrUpdateResources(cr *imageregistryv1.ImagePruner) error {
@@ -230,6 +245,7 @@ func (c *ImagePrunerController) sync() error {
 		return fmt.Errorf("failed to get pruner jobs: %s", err)
 	}
 
+	var lastPrunerJob *batchv1.Job
 	lastPrunerJobConditions := []batchv1.JobCondition{}
 	if len(prunerJobs) > 0 {
 		sort.Sort(sort.Reverse(byCreationTimestamp(prunerJobs)))
@@ -238,12 +254,33 @@ func (c *ImagePrunerController) sync() error {
 			if len(job.Status.Conditions) == 0 {
 				continue
 			}
+			lastPrunerJob = job
 			lastPrunerJobConditions = job.Status.Conditions
 			break
 		}
 	}
 
+	scanConfigMap, err := c.listers.ConfigMaps.Get(integrityscan.ConfigMapName)
+	if errors.IsNotFound(err) {
+		scanConfigMap = nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get the integrity scan status: %s", err)
+	}
+
 	c.syncPrunerStatus(pcr, applyError, prunerCronJob, lastPrunerJobConditions)
+	updatePrunerRuns(pcr, prunerJobs)
+	updateIntegrityScanStatus(pcr, scanConfigMap)
+	if lastPrunerJob != nil {
+		// The condition is left as it is until the logs can be read.
+		streams, err := c.unresolvableImageStreams(lastPrunerJob)
+		if err == errPrunerLogsGone {
+			updatePruningBlockedUnknown(pcr, lastPrunerJob)
+		} else if err != nil {
+			klog.Errorf("unable to inspect the logs of the pruner job %s: %s", lastPrunerJob.Name, err)
+		} else {
+			updatePruningBlockedCondition(pcr, lastPrunerJob, streams)
+		}
+	}
 
 	metadataChanged := strategy.Metadata(&prevPCR.ObjectMeta, &pcr.ObjectMeta)
 	specChanged := !reflect.DeepEqual(prevPCR.Spec, pcr.Spec)
@@ -315,6 +352,12 @@ func (c *ImagePrunerController) eventProcessor() {
 				return
 			}
 
+			if delay := c.overloadBackoff.Delay(); delay > 0 {
+				klog.V(1).Infof("(image pruner) the API server is overloaded, delaying the sync by %s", delay)
+				c.workqueue.AddAfter(obj, delay)
+				return
+			}
+
 			if err := c.sync(); err != nil {
 				c.workqueue.AddRateLimited(imagePrunerWorkQueueKey)
 				klog.Errorf("(image pruner) unable to sync: %s, requeuing", err)
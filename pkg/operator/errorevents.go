@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"errors"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// errorEventsDedupWindow is how long an error that was reported with an
+// event isn't reported again. The failed syncs are retried much more often.
+const errorEventsDedupWindow = 5 * time.Minute
+
+// errorEventReason returns the reason of the Warning event that reports err,
+// or false if err isn't reported with an event. Only the errors that need
+// the configuration or the permissions of the operator to be fixed are
+// reported.
+func errorEventReason(err error) (string, bool) {
+	if e, ok := err.(permanentError); ok {
+		return e.Reason, true
+	}
+	var provisioningErr *util.ProvisioningError
+	if errors.As(err, &provisioningErr) {
+		return provisioningErr.Reason, true
+	}
+	return "", false
+}
+
+// recordErrorEvent emits a Warning event on the registry config for the error
+// of the last sync, so that `oc describe config.imageregistry` shows it. The
+// same error is reported at most once per errorEventsDedupWindow.
+func (c *Controller) recordErrorEvent(cr *imageregistryv1.Config, err error) {
+	if c.recorder == nil || err == nil {
+		return
+	}
+	reason, ok := errorEventReason(err)
+	if !ok {
+		return
+	}
+
+	now := c.clock()
+	for key, recordedAt := range c.recordedErrors {
+		if now.Sub(recordedAt) >= errorEventsDedupWindow {
+			delete(c.recordedErrors, key)
+		}
+	}
+
+	key := reason + "\x00" + err.Error()
+	if _, ok := c.recordedErrors[key]; ok {
+		return
+	}
+	if c.recordedErrors == nil {
+		c.recordedErrors = map[string]time.Time{}
+	}
+	c.recordedErrors[key] = now
+
+	c.recorder.Event(cr, corev1.EventTypeWarning, reason, err.Error())
+}
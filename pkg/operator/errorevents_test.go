@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/record"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+func TestRecordErrorEvent(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		recorder: recorder,
+		clock:    func() time.Time { return now },
+	}
+	cr := &imageregistryv1.Config{}
+
+	expectEvents := func(expected ...string) {
+		t.Helper()
+		for _, e := range expected {
+			select {
+			case event := <-recorder.Events:
+				if event != e {
+					t.Errorf("expected the event %q, got %q", e, event)
+				}
+			default:
+				t.Errorf("expected the event %q, got none", e)
+			}
+		}
+		select {
+		case event := <-recorder.Events:
+			t.Errorf("unexpected event %q", event)
+		default:
+		}
+	}
+
+	bucketErr := fmt.Errorf("unable to sync storage configuration: %w", util.NewProvisioningError("BucketCreationFailed", fmt.Errorf("AccessDenied: Access Denied")))
+
+	c.recordErrorEvent(cr, bucketErr)
+	expectEvents("Warning BucketCreationFailed unable to sync storage configuration: AccessDenied: Access Denied")
+
+	// The requeued syncs fail the same way.
+	now = now.Add(time.Minute)
+	c.recordErrorEvent(cr, bucketErr)
+	c.recordErrorEvent(cr, bucketErr)
+	expectEvents()
+
+	c.recordErrorEvent(cr, newPermanentError(defaults.DegradedReasonInvalidTimeout, fmt.Errorf("requestTimeouts.read must be positive, got 0s")))
+	expectEvents("Warning InvalidTimeout requestTimeouts.read must be positive, got 0s")
+
+	// The transient errors and the successful syncs aren't reported.
+	c.recordErrorEvent(cr, fmt.Errorf("unable to get the deployment: connection refused"))
+	c.recordErrorEvent(cr, nil)
+	expectEvents()
+
+	now = now.Add(errorEventsDedupWindow)
+	c.recordErrorEvent(cr, bucketErr)
+	expectEvents("Warning BucketCreationFailed unable to sync storage configuration: AccessDenied: Access Denied")
+}
@@ -3,9 +3,9 @@ package operator
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
-	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -23,6 +23,8 @@ import (
 	configapi "github.com/openshift/api/config/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
 	configset "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
+	imageregistryv1informers "github.com/openshift/client-go/imageregistry/informers/externalversions/imageregistry/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
 	routev1informers "github.com/openshift/client-go/route/informers/externalversions/route/v1"
 	routev1lister "github.com/openshift/client-go/route/listers/route/v1"
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
@@ -31,33 +33,67 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
+const (
+	// internalHostnameCheckInterval is how often the reachability of the
+	// internal registry hostname is checked.
+	internalHostnameCheckInterval = 5 * time.Minute
+
+	// internalHostnameAttempts is how many consecutive checks of the
+	// internal hostname have to fail before it is reported as unreachable.
+	// The DNS records of a new service may take a while to propagate.
+	internalHostnameAttempts = 3
+
+	// internalHostnameTimeout bounds a single check of the internal
+	// hostname.
+	internalHostnameTimeout = 5 * time.Second
+)
+
 // ImageConfigController controls image.config.openshift.io/cluster.
 //
-// Watches for changes on image registry routes and services, updating
-// the resource status appropriately.
+// Watches for changes on the image registry config, routes and services,
+// updating the resource status appropriately.
 type ImageConfigController struct {
-	configClient   configset.ConfigV1Interface
-	operatorClient v1helpers.OperatorClient
-	routeLister    routev1lister.RouteNamespaceLister
-	serviceLister  corev1listers.ServiceNamespaceLister
-	cachesToSync   []cache.InformerSynced
-	queue          workqueue.RateLimitingInterface
+	configClient         configset.ConfigV1Interface
+	operatorClient       v1helpers.OperatorClient
+	registryConfigLister imageregistryv1listers.ConfigLister
+	routeLister          routev1lister.RouteNamespaceLister
+	serviceLister        corev1listers.ServiceNamespaceLister
+	cachesToSync         []cache.InformerSynced
+	queue                workqueue.RateLimitingInterface
+
+	// lookupHost and dial are used to check the internal hostname, they
+	// are replaced during tests.
+	lookupHost    func(ctx context.Context, host string) ([]string, error)
+	dial          func(ctx context.Context, network, address string) (net.Conn, error)
+	retryInterval time.Duration
+
+	// internalHostnameFailures is the number of consecutive failed checks
+	// of the internal hostname. It's only used by the worker.
+	internalHostnameFailures int
 }
 
 func NewImageConfigController(
 	configClient configset.ConfigV1Interface,
 	operatorClient v1helpers.OperatorClient,
+	registryConfigInformer imageregistryv1informers.ConfigInformer,
 	routeInformer routev1informers.RouteInformer,
 	serviceInformer corev1informers.ServiceInformer,
 ) *ImageConfigController {
 	icc := &ImageConfigController{
-		configClient:   configClient,
-		operatorClient: operatorClient,
-		routeLister:    routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
-		serviceLister:  serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
-		queue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageConfigController"),
+		configClient:         configClient,
+		operatorClient:       operatorClient,
+		registryConfigLister: registryConfigInformer.Lister(),
+		routeLister:          routeInformer.Lister().Routes(defaults.ImageRegistryOperatorNamespace),
+		serviceLister:        serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageConfigController"),
+		lookupHost:           net.DefaultResolver.LookupHost,
+		dial:                 (&net.Dialer{}).DialContext,
+		retryInterval:        2 * time.Second,
 	}
 
+	registryConfigInformer.Informer().AddEventHandler(icc.eventHandler())
+	icc.cachesToSync = append(icc.cachesToSync, registryConfigInformer.Informer().HasSynced)
+
 	serviceInformer.Informer().AddEventHandler(icc.eventHandler())
 	icc.cachesToSync = append(icc.cachesToSync, serviceInformer.Informer().HasSynced)
 
@@ -116,7 +152,7 @@ func (icc *ImageConfigController) processNextWorkItem() bool {
 }
 
 // sync keeps image.config.openshift.io/cluster status updated.
-func (icc *ImageConfigController) syncImageStatus() error {
+func (icc *ImageConfigController) syncImageStatus(internalHostname string) error {
 	cfg, err := icc.configClient.Images().Get(context.TODO(), defaults.ImageConfigName, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return err
@@ -141,11 +177,6 @@ func (icc *ImageConfigController) syncImageStatus() error {
 		return err
 	}
 
-	internalHostname, err := icc.getServiceHostname()
-	if err != nil {
-		return err
-	}
-
 	modified := false
 	if !reflect.DeepEqual(externalHostnames, cfg.Status.ExternalRegistryHostnames) {
 		cfg.Status.ExternalRegistryHostnames = externalHostnames
@@ -166,7 +197,10 @@ func (icc *ImageConfigController) syncImageStatus() error {
 }
 
 func (icc *ImageConfigController) sync() error {
-	err := icc.syncImageStatus()
+	internalHostname, err := icc.getServiceHostname()
+	if err == nil {
+		err = icc.syncImageStatus(internalHostname)
+	}
 	if err != nil {
 		_, _, updateError := v1helpers.UpdateStatus(icc.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
 			Type:    "ImageConfigControllerDegraded",
@@ -177,12 +211,103 @@ func (icc *ImageConfigController) sync() error {
 		return utilerrors.NewAggregate([]error{err, updateError})
 	}
 
-	_, _, err = v1helpers.UpdateStatus(icc.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
-		Type:   "ImageConfigControllerDegraded",
-		Status: operatorv1.ConditionFalse,
-		Reason: "AsExpected",
-	}))
-	return err
+	updateFuncs := []v1helpers.UpdateStatusFunc{
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:   "ImageConfigControllerDegraded",
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}),
+	}
+	reachableCond, checked := icc.internalHostnameCondition(internalHostname)
+	if checked {
+		updateFuncs = append(updateFuncs, v1helpers.UpdateConditionFn(reachableCond))
+	}
+
+	_, _, err = v1helpers.UpdateStatus(icc.operatorClient, updateFuncs...)
+	if err != nil {
+		return err
+	}
+
+	if !checked {
+		// The failed check is retried by another sync rather than
+		// blocking this one.
+		icc.queue.AddAfter("instance", icc.retryInterval)
+		return nil
+	}
+	if reachableCond.Status == operatorv1.ConditionFalse {
+		klog.Warningf("ImageConfigController: %s", reachableCond.Message)
+	}
+
+	// The hostname may become unreachable without any change to the
+	// watched resources, e.g. when the cluster DNS fails.
+	icc.queue.AddAfter("instance", internalHostnameCheckInterval)
+	return nil
+}
+
+// internalHostnameCondition returns the InternalHostnameReachable condition.
+// The hostname is resolved and connected to as the image config consumers,
+// e.g. builds, do. To tolerate DNS propagation delays, the hostname is
+// reported as unreachable only after internalHostnameAttempts consecutive
+// failed checks, false is returned for the failed checks before that and
+// the condition is left unchanged.
+func (icc *ImageConfigController) internalHostnameCondition(hostname string) (operatorv1.OperatorCondition, bool) {
+	cond := operatorv1.OperatorCondition{
+		Type: defaults.InternalHostnameReachable,
+	}
+
+	if hostname == "" {
+		icc.internalHostnameFailures = 0
+		cond.Status = operatorv1.ConditionUnknown
+		cond.Reason = "NoInternalHostname"
+		cond.Message = "The internal registry hostname is not published, the image registry service does not exist"
+		return cond, true
+	}
+
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host, port = hostname, "443"
+	}
+
+	reason, err := icc.checkHostname(host, port)
+	if err == nil {
+		icc.internalHostnameFailures = 0
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "Reachable"
+		return cond, true
+	}
+
+	icc.internalHostnameFailures++
+	klog.V(4).Infof("ImageConfigController: attempt %d to reach %s failed: %v", icc.internalHostnameFailures, hostname, err)
+	if icc.internalHostnameFailures < internalHostnameAttempts {
+		return cond, false
+	}
+
+	cond.Status = operatorv1.ConditionFalse
+	cond.Reason = reason
+	cond.Message = fmt.Sprintf("Unable to reach the internal registry hostname %s: %v", hostname, err)
+	return cond, true
+}
+
+// checkHostname resolves the host and connects to the port of the first
+// address. The reason of the failure is returned along with the error.
+func (icc *ImageConfigController) checkHostname(host, port string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), internalHostnameTimeout)
+	defer cancel()
+
+	addrs, err := icc.lookupHost(ctx, host)
+	if err != nil {
+		return "DNSLookupFailed", err
+	}
+	if len(addrs) == 0 {
+		return "DNSLookupFailed", fmt.Errorf("no addresses found for %s", host)
+	}
+
+	conn, err := icc.dial(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+	if err != nil {
+		return "ConnectionFailed", err
+	}
+	conn.Close()
+	return "", nil
 }
 
 // getServiceHostname returns the image registry internal service url if it
@@ -204,10 +329,23 @@ func (icc *ImageConfigController) getServiceHostname() (string, error) {
 	return fmt.Sprintf("%s.%s.svc%s", svc.Name, svc.Namespace, port), nil
 }
 
-// getRouteHostnames returns all image registry exposed routes.
+// getRouteHostnames returns the hostnames of the routes configured for the
+// image registry. The routes that are no longer configured, e.g. while they
+// are being removed, are not published.
 func (icc *ImageConfigController) getRouteHostnames() ([]string, error) {
 	var routeNames []string
 
+	cr, err := icc.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	configured := map[string]bool{}
+	for _, name := range resource.ConfiguredRoutes(cr) {
+		configured[name] = true
+	}
+
 	routes, err := icc.routeLister.List(labels.Everything())
 	if err != nil {
 		return nil, err
@@ -215,7 +353,7 @@ func (icc *ImageConfigController) getRouteHostnames() ([]string, error) {
 
 	defaultHost := ""
 	for _, route := range routes {
-		if !resource.RouteIsCreatedByOperator(route) {
+		if !resource.RouteIsCreatedByOperator(route) || !configured[route.Name] {
 			continue
 		}
 
@@ -225,12 +363,9 @@ func (icc *ImageConfigController) getRouteHostnames() ([]string, error) {
 				continue
 			}
 
-			defaultHostPrefix := fmt.Sprintf(
-				"%s-%s",
-				defaults.RouteName,
-				defaults.ImageRegistryOperatorNamespace,
-			)
-			if strings.HasPrefix(hostname, defaultHostPrefix) {
+			// The additional routes may have any hostname, the default
+			// route is told apart by its name.
+			if route.Name == defaults.RouteName {
 				defaultHost = hostname
 				continue
 			}
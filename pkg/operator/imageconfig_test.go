@@ -0,0 +1,240 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routev1lister "github.com/openshift/client-go/route/listers/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+func TestInternalHostnameCondition(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		hostname    string
+		lookupFails int
+		dialErr     error
+		status      operatorv1.ConditionStatus
+		reason      string
+		address     string
+	}{
+		{
+			name:   "no internal hostname",
+			status: operatorv1.ConditionUnknown,
+			reason: "NoInternalHostname",
+		},
+		{
+			name:     "reachable",
+			hostname: "image-registry.openshift-image-registry.svc:5000",
+			status:   operatorv1.ConditionTrue,
+			reason:   "Reachable",
+			address:  "172.30.0.10:5000",
+		},
+		{
+			name:     "reachable without a port",
+			hostname: "image-registry.openshift-image-registry.svc",
+			status:   operatorv1.ConditionTrue,
+			reason:   "Reachable",
+			address:  "172.30.0.10:443",
+		},
+		{
+			name:        "DNS records propagated after a retry",
+			hostname:    "image-registry.openshift-image-registry.svc:5000",
+			lookupFails: internalHostnameAttempts - 1,
+			status:      operatorv1.ConditionTrue,
+			reason:      "Reachable",
+			address:     "172.30.0.10:5000",
+		},
+		{
+			name:        "DNS lookup failed",
+			hostname:    "image-registry.openshift-image-registry.svc:5000",
+			lookupFails: internalHostnameAttempts,
+			status:      operatorv1.ConditionFalse,
+			reason:      "DNSLookupFailed",
+		},
+		{
+			name:     "connection failed",
+			hostname: "image-registry.openshift-image-registry.svc:5000",
+			dialErr:  fmt.Errorf("connection refused"),
+			status:   operatorv1.ConditionFalse,
+			reason:   "ConnectionFailed",
+			address:  "172.30.0.10:5000",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := 0
+			var dialed []string
+			icc := &ImageConfigController{
+				lookupHost: func(ctx context.Context, host string) ([]string, error) {
+					lookups++
+					if lookups <= tt.lookupFails {
+						return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+					}
+					return []string{"172.30.0.10"}, nil
+				},
+				dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					dialed = append(dialed, address)
+					if tt.dialErr != nil {
+						return nil, tt.dialErr
+					}
+					client, server := net.Pipe()
+					server.Close()
+					return client, nil
+				},
+			}
+
+			// Every sync checks the hostname once, the failed checks
+			// are retried by the next syncs.
+			var cond operatorv1.OperatorCondition
+			checks := 0
+			for checked := false; !checked; checks++ {
+				if checks == internalHostnameAttempts {
+					t.Fatalf("expected %s to be reported after %d checks", defaults.InternalHostnameReachable, internalHostnameAttempts)
+				}
+				cond, checked = icc.internalHostnameCondition(tt.hostname)
+			}
+			if cond.Type != defaults.InternalHostnameReachable {
+				t.Errorf("expected condition %s, got %s", defaults.InternalHostnameReachable, cond.Type)
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("expected %s to be %s with reason %q, got %s %q", cond.Type, tt.status, tt.reason, cond.Status, cond.Reason)
+			}
+			if tt.status != operatorv1.ConditionTrue && len(cond.Message) == 0 {
+				t.Errorf("expected %s to have a message", cond.Type)
+			}
+			if tt.address != "" && (len(dialed) == 0 || dialed[len(dialed)-1] != tt.address) {
+				t.Errorf("expected a connection to %s, got %v", tt.address, dialed)
+			}
+			if tt.hostname == "" && (lookups != 0 || len(dialed) != 0) {
+				t.Errorf("expected no check without a hostname, got %d lookups and %d connections", lookups, len(dialed))
+			}
+		})
+	}
+}
+
+func TestGetRouteHostnames(t *testing.T) {
+	route := func(name, host string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Annotations: map[string]string{
+					resource.RouteOwnerAnnotation: "true",
+				},
+			},
+			Status: routev1.RouteStatus{
+				Ingress: []routev1.RouteIngress{{Host: host}},
+			},
+		}
+	}
+	routes := []*routev1.Route{
+		route(defaults.RouteName, "default-route-openshift-image-registry.apps.example.com"),
+		route("registry", "registry.example.com"),
+		route("obsolete", "obsolete.example.com"),
+		route("internal", "registry.internal.example.com"),
+		route("partner", "default-route.partner.example.com"),
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "user-route",
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Status: routev1.RouteStatus{
+				Ingress: []routev1.RouteIngress{{Host: "user-route.example.com"}},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		spec     *imageregistryv1.ImageRegistrySpec
+		expected []string
+	}{
+		{
+			name: "no registry config",
+		},
+		{
+			name: "default and additional routes",
+			spec: &imageregistryv1.ImageRegistrySpec{
+				DefaultRoute: true,
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "registry"},
+				},
+			},
+			expected: []string{"default-route-openshift-image-registry.apps.example.com", "registry.example.com"},
+		},
+		{
+			name: "vanity hostnames",
+			spec: &imageregistryv1.ImageRegistrySpec{
+				DefaultRoute: true,
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "internal", Hostname: "registry.internal.example.com"},
+					{Name: "partner", Hostname: "default-route.partner.example.com"},
+				},
+			},
+			expected: []string{"default-route-openshift-image-registry.apps.example.com", "default-route.partner.example.com", "registry.internal.example.com"},
+		},
+		{
+			name: "default route disabled",
+			spec: &imageregistryv1.ImageRegistrySpec{
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "registry"},
+				},
+			},
+			expected: []string{"registry.example.com"},
+		},
+		{
+			name: "external routes disabled",
+			spec: &imageregistryv1.ImageRegistrySpec{
+				DisableExternalRoutes: true,
+				DefaultRoute:          true,
+				Routes: []imageregistryv1.ImageRegistryConfigRoute{
+					{Name: "registry"},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			routeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, r := range routes {
+				if err := routeIndexer.Add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			configIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.spec != nil {
+				if err := configIndexer.Add(&imageregistryv1.Config{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: defaults.ImageRegistryResourceName,
+					},
+					Spec: *tt.spec,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			icc := &ImageConfigController{
+				registryConfigLister: imageregistryv1listers.NewConfigLister(configIndexer),
+				routeLister:          routev1lister.NewRouteLister(routeIndexer).Routes(defaults.ImageRegistryOperatorNamespace),
+			}
+			hostnames, err := icc.getRouteHostnames()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(hostnames, tt.expected) {
+				t.Errorf("got %v, want %v", hostnames, tt.expected)
+			}
+		})
+	}
+}
@@ -1,34 +1,63 @@
 package operator
 
 import (
+	"context"
+	"fmt"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1informers "k8s.io/client-go/informers/apps/v1"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
 	operatorv1 "github.com/openshift/api/operator/v1"
 	configv1informers "github.com/openshift/client-go/config/informers/externalversions/config/v1"
 	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
+// serviceCARetryInterval is how often the service CA is checked again while
+// it is not available.
+const serviceCARetryInterval = 30 * time.Second
+
+// DefaultServingCertRotationThreshold is how long before its expiry the
+// registry serving certificate is rotated by default.
+const DefaultServingCertRotationThreshold = 30 * 24 * time.Hour
+
 type ImageRegistryCertificatesController struct {
 	coreClient            corev1client.CoreV1Interface
 	operatorClient        v1helpers.OperatorClient
 	configMapLister       corev1listers.ConfigMapNamespaceLister
 	serviceLister         corev1listers.ServiceNamespaceLister
+	secretLister          corev1listers.SecretNamespaceLister
+	deploymentLister      appsv1listers.DeploymentNamespaceLister
 	imageConfigLister     configv1listers.ImageLister
 	openshiftConfigLister corev1listers.ConfigMapNamespaceLister
+	recorder              events.Recorder
+
+	// rotationThreshold is how long before its expiry the serving
+	// certificate is rotated.
+	rotationThreshold time.Duration
+	clock             func() time.Time
+
+	// rotatedExpiry is the expiry of the last serving certificate the
+	// controller deleted. It's only accessed by the worker.
+	rotatedExpiry string
 
 	cachesToSync []cache.InformerSynced
 	queue        workqueue.RateLimitingInterface
@@ -37,18 +66,27 @@ type ImageRegistryCertificatesController struct {
 func NewImageRegistryCertificatesController(
 	coreClient corev1client.CoreV1Interface,
 	operatorClient v1helpers.OperatorClient,
+	recorder events.Recorder,
 	configMapInformer corev1informers.ConfigMapInformer,
 	serviceInformer corev1informers.ServiceInformer,
+	secretInformer corev1informers.SecretInformer,
+	deploymentInformer appsv1informers.DeploymentInformer,
 	imageConfigInformer configv1informers.ImageInformer,
 	openshiftConfigInformer corev1informers.ConfigMapInformer,
+	rotationThreshold time.Duration,
 ) *ImageRegistryCertificatesController {
 	c := &ImageRegistryCertificatesController{
 		coreClient:            coreClient,
 		operatorClient:        operatorClient,
 		configMapLister:       configMapInformer.Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
 		serviceLister:         serviceInformer.Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		secretLister:          secretInformer.Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		deploymentLister:      deploymentInformer.Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
 		imageConfigLister:     imageConfigInformer.Lister(),
 		openshiftConfigLister: openshiftConfigInformer.Lister().ConfigMaps(defaults.OpenShiftConfigNamespace),
+		recorder:              recorder,
+		rotationThreshold:     rotationThreshold,
+		clock:                 time.Now,
 		queue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageRegistryCertificatesController"),
 	}
 
@@ -58,6 +96,12 @@ func NewImageRegistryCertificatesController(
 	serviceInformer.Informer().AddEventHandler(c.eventHandler())
 	c.cachesToSync = append(c.cachesToSync, serviceInformer.Informer().HasSynced)
 
+	secretInformer.Informer().AddEventHandler(c.eventHandler())
+	c.cachesToSync = append(c.cachesToSync, secretInformer.Informer().HasSynced)
+
+	deploymentInformer.Informer().AddEventHandler(c.eventHandler())
+	c.cachesToSync = append(c.cachesToSync, deploymentInformer.Informer().HasSynced)
+
 	imageConfigInformer.Informer().AddEventHandler(c.eventHandler())
 	c.cachesToSync = append(c.cachesToSync, imageConfigInformer.Informer().HasSynced)
 
@@ -99,9 +143,146 @@ func (c *ImageRegistryCertificatesController) processNextWorkItem() bool {
 	return true
 }
 
+// serviceCACondition returns the ServiceCAUnavailable condition. The service
+// CA is injected into the serviceca configmap by the service-ca operator,
+// the registry serving certificate can't be trusted until it's there.
+func serviceCACondition(lister corev1listers.ConfigMapNamespaceLister) (operatorv1.OperatorCondition, error) {
+	cond := operatorv1.OperatorCondition{
+		Type: defaults.ServiceCAUnavailable,
+	}
+
+	serviceCA, err := lister.Get(defaults.ServiceCAName)
+	if errors.IsNotFound(err) {
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "NotFound"
+		cond.Message = fmt.Sprintf("The configmap %s/%s does not exist yet, the service CA can't be injected into it", defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName)
+		return cond, nil
+	} else if err != nil {
+		return cond, err
+	}
+
+	if len(serviceCA.Data["service-ca.crt"]) == 0 {
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "NotInjected"
+		cond.Message = fmt.Sprintf("The service CA has not been injected into the configmap %s/%s yet. Check that the service-ca cluster operator is available, the CA is injected once it is.", defaults.ImageRegistryOperatorNamespace, defaults.ServiceCAName)
+		return cond, nil
+	}
+
+	cond.Status = operatorv1.ConditionFalse
+	cond.Reason = "AsExpected"
+	return cond, nil
+}
+
+// servingCertExpiry returns when the serving certificate of the secret
+// expires.
+func servingCertExpiry(secret *corev1.Secret) (time.Time, error) {
+	certs, err := certutil.ParseCertsPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse the certificate of the secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return certs[0].NotAfter, nil
+}
+
+// regeneratingServingCertCondition returns the ServingCertRotated condition
+// while the service-ca operator regenerates the deleted certificate.
+func regeneratingServingCertCondition(rotatedExpiry string) *operatorv1.OperatorCondition {
+	return &operatorv1.OperatorCondition{
+		Type:    defaults.ServingCertRotated,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "Regenerating",
+		Message: fmt.Sprintf("The serving certificate expiring at %s was deleted, waiting for the service-ca operator to generate a new one", rotatedExpiry),
+	}
+}
+
+// rotateServingCert deletes the registry serving certificate when it expires
+// within the rotation threshold, so that the service-ca operator generates a
+// new one. The registry deployment depends on the secret, its pods are
+// rolled out once the new certificate is there. The expiry of the rotated
+// certificate is kept by the controller rather than on the deployment, whose
+// metadata is overwritten when it's applied, so a certificate is never
+// deleted twice even if the new one expires as soon. After a restart of the
+// operator a certificate may be rotated once more. It returns the
+// ServingCertRotated condition, or nil while the registry isn't deployed.
+func (c *ImageRegistryCertificatesController) rotateServingCert() (*operatorv1.OperatorCondition, error) {
+	_, err := c.deploymentLister.Get(defaults.ImageRegistryName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rotatedExpiry := c.rotatedExpiry
+
+	secret, err := c.secretLister.Get(defaults.ServingCertSecretName)
+	if errors.IsNotFound(err) {
+		if rotatedExpiry == "" {
+			return nil, nil
+		}
+		return regeneratingServingCertCondition(rotatedExpiry), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	expiry, err := servingCertExpiry(secret)
+	if err != nil {
+		return nil, err
+	}
+	expiryString := expiry.UTC().Format(time.RFC3339)
+
+	cond := &operatorv1.OperatorCondition{
+		Type: defaults.ServingCertRotated,
+	}
+
+	if untilRotation := expiry.Sub(c.clock()) - c.rotationThreshold; untilRotation > 0 {
+		c.queue.AddAfter(workqueueKey, untilRotation)
+
+		if rotatedExpiry == "" {
+			cond.Status = operatorv1.ConditionFalse
+			cond.Reason = "AsExpected"
+			cond.Message = fmt.Sprintf("The serving certificate expires at %s", expiryString)
+			return cond, nil
+		}
+
+		cond.Status = operatorv1.ConditionTrue
+		cond.Reason = "Rotated"
+		cond.Message = fmt.Sprintf("The serving certificate expiring at %s was rotated, the new certificate expires at %s", rotatedExpiry, expiryString)
+
+		_, status, _, err := c.operatorClient.GetOperatorState()
+		if err != nil {
+			return nil, err
+		}
+		if prev := v1helpers.FindOperatorCondition(status.Conditions, defaults.ServingCertRotated); prev == nil || prev.Message != cond.Message {
+			c.recorder.Eventf("ServingCertRotated", "The serving certificate was rotated, the new certificate expires at %s", expiryString)
+		}
+		return cond, nil
+	}
+
+	if rotatedExpiry == expiryString {
+		return regeneratingServingCertCondition(rotatedExpiry), nil
+	}
+
+	klog.Infof("ImageRegistryCertificatesController: the serving certificate expires at %s, deleting the secret %s/%s to rotate it", expiryString, secret.Namespace, secret.Name)
+	err = c.coreClient.Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to delete the serving certificate: %w", err)
+	}
+
+	c.rotatedExpiry = expiryString
+
+	c.recorder.Eventf("ServingCertRotating", "The serving certificate expires at %s, it was deleted to be regenerated by the service-ca operator", expiryString)
+
+	return regeneratingServingCertCondition(expiryString), nil
+}
+
 func (c *ImageRegistryCertificatesController) sync() error {
-	g := resource.NewGeneratorCAConfig(c.configMapLister, c.imageConfigLister, c.openshiftConfigLister, c.serviceLister, c.coreClient)
-	err := resource.ApplyMutator(g)
+	serviceCACond, err := serviceCACondition(c.configMapLister)
+	if err == nil {
+		g := resource.NewGeneratorCAConfig(c.configMapLister, c.imageConfigLister, c.openshiftConfigLister, c.serviceLister, c.coreClient)
+		err = resource.ApplyMutator(g)
+	}
+	var servingCertCond *operatorv1.OperatorCondition
+	if err == nil {
+		servingCertCond, err = c.rotateServingCert()
+	}
 	if err != nil {
 		_, _, updateError := v1helpers.UpdateStatus(c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
 			Type:    "ImageRegistryCertificatesControllerDegraded",
@@ -112,12 +293,30 @@ func (c *ImageRegistryCertificatesController) sync() error {
 		return utilerrors.NewAggregate([]error{err, updateError})
 	}
 
-	_, _, err = v1helpers.UpdateStatus(c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
-		Type:   "ImageRegistryCertificatesControllerDegraded",
-		Status: operatorv1.ConditionFalse,
-		Reason: "AsExpected",
-	}))
-	return err
+	updateFuncs := []v1helpers.UpdateStatusFunc{
+		v1helpers.UpdateConditionFn(serviceCACond),
+		v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
+			Type:   "ImageRegistryCertificatesControllerDegraded",
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}),
+	}
+	if servingCertCond != nil {
+		updateFuncs = append(updateFuncs, v1helpers.UpdateConditionFn(*servingCertCond))
+	}
+	_, _, err = v1helpers.UpdateStatus(c.operatorClient, updateFuncs...)
+	if err != nil {
+		return err
+	}
+
+	// The missing CA is not an error of this controller, the service-ca
+	// operator may just not be ready yet. Check it again later in case the
+	// configmap events are delayed.
+	if serviceCACond.Status == operatorv1.ConditionTrue {
+		klog.Infof("ImageRegistryCertificatesController: %s", serviceCACond.Message)
+		c.queue.AddAfter(workqueueKey, serviceCARetryInterval)
+	}
+	return nil
 }
 
 func (c *ImageRegistryCertificatesController) Run(stopCh <-chan struct{}) {
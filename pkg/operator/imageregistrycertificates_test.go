@@ -0,0 +1,369 @@
+package operator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestServiceCAUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		serviceCA *corev1.ConfigMap
+		status    operatorv1.ConditionStatus
+		reason    string
+	}{
+		{
+			name:   "missing configmap",
+			status: operatorv1.ConditionTrue,
+			reason: "NotFound",
+		},
+		{
+			name: "CA not injected",
+			serviceCA: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+					Name:      defaults.ServiceCAName,
+				},
+			},
+			status: operatorv1.ConditionTrue,
+			reason: "NotInjected",
+		},
+		{
+			name: "CA injected",
+			serviceCA: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+					Name:      defaults.ServiceCAName,
+				},
+				Data: map[string]string{
+					"service-ca.crt": "-----BEGIN CERTIFICATE-----",
+				},
+			},
+			status: operatorv1.ConditionFalse,
+			reason: "AsExpected",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			configMaps := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.serviceCA != nil {
+				if err := configMaps.Add(tt.serviceCA); err != nil {
+					t.Fatal(err)
+				}
+			}
+			empty := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+			operatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil)
+			c := &ImageRegistryCertificatesController{
+				coreClient:            fake.NewSimpleClientset().CoreV1(),
+				operatorClient:        operatorClient,
+				configMapLister:       corev1listers.NewConfigMapLister(configMaps).ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+				serviceLister:         corev1listers.NewServiceLister(empty).Services(defaults.ImageRegistryOperatorNamespace),
+				secretLister:          corev1listers.NewSecretLister(empty).Secrets(defaults.ImageRegistryOperatorNamespace),
+				deploymentLister:      appsv1listers.NewDeploymentLister(empty).Deployments(defaults.ImageRegistryOperatorNamespace),
+				imageConfigLister:     configv1listers.NewImageLister(empty),
+				openshiftConfigLister: corev1listers.NewConfigMapLister(empty).ConfigMaps(defaults.OpenShiftConfigNamespace),
+				recorder:              events.NewInMemoryRecorder("test"),
+				rotationThreshold:     DefaultServingCertRotationThreshold,
+				clock:                 time.Now,
+				queue:                 workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			}
+			defer c.queue.ShutDown()
+
+			// The missing CA should not make the controller fail.
+			if err := c.sync(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, status, _, err := operatorClient.GetOperatorState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cond := v1helpers.FindOperatorCondition(status.Conditions, defaults.ServiceCAUnavailable)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.ServiceCAUnavailable)
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("expected %s to be %s with reason %q, got %s %q", cond.Type, tt.status, tt.reason, cond.Status, cond.Reason)
+			}
+			if tt.status == operatorv1.ConditionTrue && len(cond.Message) == 0 {
+				t.Errorf("expected %s to have a message", cond.Type)
+			}
+			if degraded := v1helpers.FindOperatorCondition(status.Conditions, "ImageRegistryCertificatesControllerDegraded"); degraded == nil || degraded.Status != operatorv1.ConditionFalse {
+				t.Errorf("expected the controller not to be degraded, got %#v", degraded)
+			}
+		})
+	}
+}
+
+// servingCertSecret returns a serving certificate secret like the ones
+// generated by the service-ca operator.
+func servingCertSecret(t *testing.T, notAfter time.Time) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "image-registry.openshift-image-registry.svc"},
+		NotBefore:    notAfter.Add(-2 * 365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.ServingCertSecretName,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		},
+	}
+}
+
+func TestRotateServingCert(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	soon := now.Add(10 * 24 * time.Hour)
+	later := now.Add(2 * 365 * 24 * time.Hour)
+
+	for _, tt := range []struct {
+		name          string
+		noDeployment  bool
+		rotatedExpiry string
+		notAfter      time.Time
+		previous      *operatorv1.OperatorCondition
+		status        operatorv1.ConditionStatus
+		reason        string
+		message       string
+		deleted       bool
+		rotated       string
+		event         string
+	}{
+		{
+			name:         "registry not deployed",
+			noDeployment: true,
+			notAfter:     soon,
+		},
+		{
+			name:     "certificate not expiring",
+			notAfter: later,
+			status:   operatorv1.ConditionFalse,
+			reason:   "AsExpected",
+			message:  "The serving certificate expires at 2028-10-13T12:00:00Z",
+		},
+		{
+			name:     "certificate expiring",
+			notAfter: soon,
+			status:   operatorv1.ConditionTrue,
+			reason:   "Regenerating",
+			message:  "The serving certificate expiring at 2026-10-24T12:00:00Z was deleted, waiting for the service-ca operator to generate a new one",
+			deleted:  true,
+			rotated:  "2026-10-24T12:00:00Z",
+			event:    "ServingCertRotating",
+		},
+		{
+			name:          "certificate already rotated",
+			rotatedExpiry: "2026-10-24T12:00:00Z",
+			notAfter:      soon,
+			status:        operatorv1.ConditionTrue,
+			reason:        "Regenerating",
+			message:       "The serving certificate expiring at 2026-10-24T12:00:00Z was deleted, waiting for the service-ca operator to generate a new one",
+			rotated:       "2026-10-24T12:00:00Z",
+		},
+		{
+			name:          "certificate regenerating",
+			rotatedExpiry: "2026-10-24T12:00:00Z",
+			status:        operatorv1.ConditionTrue,
+			reason:        "Regenerating",
+			message:       "The serving certificate expiring at 2026-10-24T12:00:00Z was deleted, waiting for the service-ca operator to generate a new one",
+			rotated:       "2026-10-24T12:00:00Z",
+		},
+		{
+			name:          "certificate regenerated",
+			rotatedExpiry: "2026-10-24T12:00:00Z",
+			notAfter:      later,
+			status:        operatorv1.ConditionTrue,
+			reason:        "Rotated",
+			message:       "The serving certificate expiring at 2026-10-24T12:00:00Z was rotated, the new certificate expires at 2028-10-13T12:00:00Z",
+			rotated:       "2026-10-24T12:00:00Z",
+			event:         "ServingCertRotated",
+		},
+		{
+			name:          "rotation already reported",
+			rotatedExpiry: "2026-10-24T12:00:00Z",
+			notAfter:      later,
+			previous: &operatorv1.OperatorCondition{
+				Type:    defaults.ServingCertRotated,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Rotated",
+				Message: "The serving certificate expiring at 2026-10-24T12:00:00Z was rotated, the new certificate expires at 2028-10-13T12:00:00Z",
+			},
+			status:  operatorv1.ConditionTrue,
+			reason:  "Rotated",
+			message: "The serving certificate expiring at 2026-10-24T12:00:00Z was rotated, the new certificate expires at 2028-10-13T12:00:00Z",
+			rotated: "2026-10-24T12:00:00Z",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if !tt.notAfter.IsZero() {
+				secret := servingCertSecret(t, tt.notAfter)
+				objects = append(objects, secret)
+				if err := secrets.Add(secret); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deployments := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if !tt.noDeployment {
+				deploy := &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: defaults.ImageRegistryOperatorNamespace,
+						Name:      defaults.ImageRegistryName,
+					},
+				}
+				objects = append(objects, deploy)
+				if err := deployments.Add(deploy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kubeClient := fake.NewSimpleClientset(objects...)
+
+			status := &operatorv1.OperatorStatus{}
+			if tt.previous != nil {
+				status.Conditions = []operatorv1.OperatorCondition{*tt.previous}
+			}
+			recorder := events.NewInMemoryRecorder("test")
+			c := &ImageRegistryCertificatesController{
+				coreClient:        kubeClient.CoreV1(),
+				operatorClient:    v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, status, nil),
+				secretLister:      corev1listers.NewSecretLister(secrets).Secrets(defaults.ImageRegistryOperatorNamespace),
+				deploymentLister:  appsv1listers.NewDeploymentLister(deployments).Deployments(defaults.ImageRegistryOperatorNamespace),
+				recorder:          recorder,
+				rotationThreshold: DefaultServingCertRotationThreshold,
+				clock:             func() time.Time { return now },
+				queue:             workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+				rotatedExpiry:     tt.rotatedExpiry,
+			}
+			defer c.queue.ShutDown()
+
+			cond, err := c.rotateServingCert()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status == "" {
+				if cond != nil {
+					t.Errorf("expected no condition, got %#v", cond)
+				}
+			} else if cond == nil || cond.Type != defaults.ServingCertRotated || cond.Status != tt.status || cond.Reason != tt.reason || cond.Message != tt.message {
+				t.Errorf("expected %s to be %s with reason %q and message %q, got %#v", defaults.ServingCertRotated, tt.status, tt.reason, tt.message, cond)
+			}
+
+			_, err = kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ServingCertSecretName, metav1.GetOptions{})
+			if tt.deleted && !errors.IsNotFound(err) {
+				t.Errorf("expected the serving certificate to be deleted, got %v", err)
+			} else if !tt.deleted && !tt.notAfter.IsZero() && err != nil {
+				t.Errorf("expected the serving certificate to be kept, got %v", err)
+			}
+
+			if c.rotatedExpiry != tt.rotated {
+				t.Errorf("expected the rotated expiry to be %q, got %q", tt.rotated, c.rotatedExpiry)
+			}
+
+			var reasons []string
+			for _, e := range recorder.Events() {
+				reasons = append(reasons, e.Reason)
+			}
+			if got := strings.Join(reasons, ","); got != tt.event {
+				t.Errorf("expected the events %q, got %q", tt.event, got)
+			}
+		})
+	}
+}
+
+// TestRotateServingCertOnce checks that a certificate which is regenerated
+// with the same expiry is not deleted again.
+func TestRotateServingCertOnce(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	secret := servingCertSecret(t, now.Add(24*time.Hour))
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Name:      defaults.ImageRegistryName,
+		},
+	}
+	kubeClient := fake.NewSimpleClientset(secret, deploy)
+
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	deployments := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := deployments.Add(deploy); err != nil {
+		t.Fatal(err)
+	}
+	c := &ImageRegistryCertificatesController{
+		coreClient:        kubeClient.CoreV1(),
+		operatorClient:    v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+		secretLister:      corev1listers.NewSecretLister(secrets).Secrets(defaults.ImageRegistryOperatorNamespace),
+		deploymentLister:  appsv1listers.NewDeploymentLister(deployments).Deployments(defaults.ImageRegistryOperatorNamespace),
+		recorder:          events.NewInMemoryRecorder("test"),
+		rotationThreshold: DefaultServingCertRotationThreshold,
+		clock:             func() time.Time { return now },
+		queue:             workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	defer c.queue.ShutDown()
+
+	deletions := 0
+	for i := 0; i < 3; i++ {
+		// Sync the listers with the cluster, the service-ca operator
+		// regenerates the deleted secret with the same certificate.
+		if _, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), secret.Name, metav1.GetOptions{}); errors.IsNotFound(err) {
+			deletions++
+			if _, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Create(context.Background(), secret, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := secrets.Update(secret); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.rotateServingCert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), secret.Name, metav1.GetOptions{}); errors.IsNotFound(err) {
+		deletions++
+	}
+
+	if deletions != 1 {
+		t.Errorf("expected the serving certificate to be deleted once, got %d deletions", deletions)
+	}
+}
@@ -0,0 +1,146 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/dynamic"
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	routeclient "github.com/openshift/client-go/route/clientset/versioned"
+	routeinformers "github.com/openshift/client-go/route/informers/externalversions"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// RunDryRun plans a single sync of the registry configuration and writes the
+// changes the operator would make to w, one per line. Nothing is changed in
+// the cluster, and the status of the configuration is left as it is.
+func RunDryRun(ctx context.Context, kubeconfig *restclient.Config, w io.Writer) error {
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	routeClient, err := routeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
+	kubeInformersForOpenShiftConfigManaged := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigManagedNamespace))
+	kubeInformersForKubeSystem := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(kubeSystemNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, defaultResyncDuration)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, defaultResyncDuration)
+	routeInformers := routeinformers.NewSharedInformerFactoryWithOptions(routeClient, defaultResyncDuration, routeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+
+	// The controller is only used for its listers, it's never run.
+	controller := NewController(
+		kubeconfig,
+		kubeClient,
+		configClient,
+		imageregistryClient,
+		routeClient,
+		dynamicClient,
+		kubeInformers,
+		kubeInformersForOpenShiftConfig,
+		kubeInformersForOpenShiftConfigManaged,
+		kubeInformersForKubeSystem,
+		configInformers,
+		imageregistryInformers,
+		routeInformers,
+		true,
+		0,
+		nil,
+		resource.DefaultStorageConnectivityThresholds,
+	)
+
+	kubeInformers.Start(ctx.Done())
+	kubeInformersForOpenShiftConfig.Start(ctx.Done())
+	kubeInformersForOpenShiftConfigManaged.Start(ctx.Done())
+	kubeInformersForKubeSystem.Start(ctx.Done())
+	configInformers.Start(ctx.Done())
+	imageregistryInformers.Start(ctx.Done())
+	routeInformers.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), controller.cachesToSync...) {
+		return fmt.Errorf("unable to sync the caches: %s", ctx.Err())
+	}
+
+	generator, err := resource.NewPlanGenerator(kubeconfig, controller.listers)
+	if err != nil {
+		return err
+	}
+
+	changes, err := controller.plan(ctx, generator)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if _, err := fmt.Fprintln(w, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan returns the changes the next sync would make to the storage and to
+// the objects of the registry. Nothing is planned when the sync wouldn't
+// apply the configuration.
+func (c *Controller) plan(ctx context.Context, generator *resource.Generator) ([]resource.PlannedChange, error) {
+	cr, err := c.listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		klog.Infof("%q registry operator resource not found, nothing to plan", defaults.ImageRegistryResourceName)
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get %q registry operator resource: %s", defaults.ImageRegistryResourceName, err)
+	}
+	cr = cr.DeepCopy() // we don't want to change the cached version
+
+	if cr.ObjectMeta.DeletionTimestamp != nil || cr.Spec.ManagementState != operatorv1.Managed {
+		klog.Infof("the registry is not managed, nothing to plan")
+		return nil, nil
+	}
+
+	appendFinalizer(cr)
+
+	if err := verifyResource(cr, c.listers); err != nil {
+		return nil, fmt.Errorf("unable to complete resource: %s", err)
+	}
+
+	if err := applyDefaults(cr); err != nil {
+		return nil, err
+	}
+
+	if storage.ProvisioningDeferred(cr) {
+		klog.Infof("the provisioning of the storage is deferred, nothing to plan")
+		return nil, nil
+	}
+
+	return generator.Plan(ctx, cr)
+}
@@ -0,0 +1,62 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestPlanNothing(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.Config
+	}{
+		{
+			name: "no registry",
+		},
+		{
+			name: "removed",
+			config: &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: operatorv1.Removed,
+				},
+			},
+		},
+		{
+			name: "unmanaged",
+			config: &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: operatorv1.Unmanaged,
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			if tt.config != nil {
+				builder.AddRegistryOperatorConfig(tt.config)
+			}
+			c := &Controller{
+				listers: builder.BuildListers(),
+			}
+
+			// The generator isn't needed when there is nothing to plan.
+			changes, err := c.plan(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != 0 {
+				t.Errorf("expected nothing to be planned, got %v", changes)
+			}
+		})
+	}
+}
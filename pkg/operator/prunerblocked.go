@@ -0,0 +1,164 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	// prunerLogsLimitBytes is how much of the logs of a pruner job is read
+	// to find the unresolvable image streams.
+	prunerLogsLimitBytes = 1024 * 1024
+
+	// maxReportedImageStreams is the number of unresolvable image streams
+	// named in the PruningBlocked condition, the others are only counted.
+	maxReportedImageStreams = 5
+)
+
+// unresolvableImageStreamRegexp matches the errors `oc adm prune images`
+// reports for the image streams that reference images it can't resolve,
+// e.g. `ImageStream[myproject/myapp]: invalid docker image reference ...`.
+// They are printed as warnings when the invalid references are ignored, or
+// make the pruner fail otherwise.
+var unresolvableImageStreamRegexp = regexp.MustCompile(`(?i)imagestream\[([^\]\s]+/[^\]\s]+)\]: invalid `)
+
+// errPrunerLogsGone is returned when the pods of a pruner job, and so its
+// logs, are gone.
+var errPrunerLogsGone = fmt.Errorf("the pods of the job are gone")
+
+// parseUnresolvableImageStreams returns the sorted namespace/name of the
+// image streams the pruner logs report as unresolvable.
+func parseUnresolvableImageStreams(logs string) []string {
+	seen := map[string]bool{}
+	var streams []string
+	for _, match := range unresolvableImageStreamRegexp.FindAllStringSubmatch(logs, -1) {
+		if seen[match[1]] {
+			continue
+		}
+		seen[match[1]] = true
+		streams = append(streams, match[1])
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// prunerJobLogs returns the logs of the pruner container of the last pod of
+// the job.
+func (c *ImagePrunerController) prunerJobLogs(job *batchv1.Job) (string, error) {
+	pods, err := c.clients.Core.Pods(job.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "job-name=" + job.Name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list the pods: %s", err)
+	}
+	if len(pods.Items) == 0 {
+		return "", errPrunerLogsGone
+	}
+
+	pod := pods.Items[0]
+	for _, p := range pods.Items[1:] {
+		if pod.CreationTimestamp.Before(&p.CreationTimestamp) {
+			pod = p
+		}
+	}
+
+	limitBytes := int64(prunerLogsLimitBytes)
+	logs, err := c.clients.Core.Pods(job.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container:  "image-pruner",
+		LimitBytes: &limitBytes,
+	}).DoRaw(context.TODO())
+	if err != nil {
+		return "", fmt.Errorf("unable to get the logs of the pod %s: %s", pod.Name, err)
+	}
+	return string(logs), nil
+}
+
+// unresolvableImageStreams returns the image streams the finished pruner job
+// couldn't resolve. The pods of the job may already be gone, errPrunerLogsGone
+// is then returned and nothing is cached.
+func (c *ImagePrunerController) unresolvableImageStreams(job *batchv1.Job) ([]string, error) {
+	if job.UID == c.inspectedJob {
+		return c.inspectedJobStreams, nil
+	}
+
+	logs, err := c.prunerJobLogs(job)
+	if err != nil {
+		return nil, err
+	}
+
+	c.inspectedJob = job.UID
+	c.inspectedJobStreams = parseUnresolvableImageStreams(logs)
+	return c.inspectedJobStreams, nil
+}
+
+// describeImageStreams names the first image streams and counts the others.
+func describeImageStreams(streams []string) string {
+	if len(streams) <= maxReportedImageStreams {
+		return strings.Join(streams, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(streams[:maxReportedImageStreams], ", "), len(streams)-maxReportedImageStreams)
+}
+
+// updatePruningBlockedUnknown sets the PruningBlocked condition to Unknown
+// when the logs of the last finished pruner job can't be read anymore.
+func updatePruningBlockedUnknown(cr *imageregistryv1.ImagePruner, job *batchv1.Job) {
+	updatePrunerCondition(cr, defaults.PruningBlocked, operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionUnknown,
+		Reason:  "LogsUnavailable",
+		Message: fmt.Sprintf("The pods of the job %s are gone, its logs can't be inspected", job.Name),
+	})
+}
+
+// updatePruningBlockedCondition sets the PruningBlocked condition from the
+// last finished pruner job and the image streams it couldn't resolve. The
+// pruner skips the pruning when it fails on them, otherwise the images they
+// reference are kept and the pruning is only partial.
+func updatePruningBlockedCondition(cr *imageregistryv1.ImagePruner, job *batchv1.Job, streams []string) {
+	if len(streams) == 0 {
+		updatePrunerCondition(cr, defaults.PruningBlocked, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionFalse,
+			Reason:  "AsExpected",
+			Message: "The last pruner run resolved all the image streams",
+		})
+		return
+	}
+
+	failed := false
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			failed = true
+		}
+	}
+
+	if failed {
+		updatePrunerCondition(cr, defaults.PruningBlocked, operatorapiv1.OperatorCondition{
+			Status: operatorapiv1.ConditionTrue,
+			Reason: "ImageStreamsUnresolvable",
+			Message: fmt.Sprintf(
+				"Pruning was skipped by the job %s, %d image streams reference images that can't be resolved: %s. Fix the image streams, or set spec.ignoreInvalidImageReferences to prune the other images",
+				job.Name, len(streams), describeImageStreams(streams),
+			),
+		})
+	} else {
+		updatePrunerCondition(cr, defaults.PruningBlocked, operatorapiv1.OperatorCondition{
+			Status: operatorapiv1.ConditionTrue,
+			Reason: "ImageStreamsSkipped",
+			Message: fmt.Sprintf(
+				"Pruning was partial in the job %s, the images of %d image streams that reference images that can't be resolved were kept: %s",
+				job.Name, len(streams), describeImageStreams(streams),
+			),
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package operator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapiv1 "github.com/openshift/api/operator/v1"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestParseUnresolvableImageStreams(t *testing.T) {
+	logs := `Only API objects will be removed.  No modifications to the image registry will be made.
+W0101 00:00:00.000000       1 prune.go:123] ImageStream[myproject/myapp]: invalid docker image reference "registry/myapp@sha256:x": invalid reference format
+W0101 00:00:00.000000       1 prune.go:123] ImageStream[myproject/myapp]: invalid docker image reference "registry/myapp:^": invalid reference format
+W0101 00:00:00.000000       1 prune.go:123] ImageStream[another/base]: invalid docker image reference "": invalid reference format
+Deleting istags myproject/other:v1
+Summary: deleted 1 objects
+`
+
+	streams := parseUnresolvableImageStreams(logs)
+	expected := []string{"another/base", "myproject/myapp"}
+	if !reflect.DeepEqual(streams, expected) {
+		t.Errorf("got %v, want %v", streams, expected)
+	}
+
+	if streams := parseUnresolvableImageStreams("Summary: deleted 3 objects\n"); len(streams) != 0 {
+		t.Errorf("expected no unresolvable image streams, got %v", streams)
+	}
+}
+
+func TestUpdatePruningBlockedCondition(t *testing.T) {
+	finished := func(conditionType batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "image-pruner-1",
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{
+					{Type: conditionType, Status: corev1.ConditionTrue},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		job     *batchv1.Job
+		streams []string
+		status  operatorapiv1.ConditionStatus
+		reason  string
+		message string
+	}{
+		{
+			name:   "all resolved",
+			job:    finished(batchv1.JobComplete),
+			status: operatorapiv1.ConditionFalse,
+			reason: "AsExpected",
+		},
+		{
+			name:    "partial",
+			job:     finished(batchv1.JobComplete),
+			streams: []string{"a/a", "b/b"},
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "ImageStreamsSkipped",
+			message: "were kept: a/a, b/b",
+		},
+		{
+			name:    "skipped",
+			job:     finished(batchv1.JobFailed),
+			streams: []string{"a/a"},
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "ImageStreamsUnresolvable",
+			message: "1 image streams reference images that can't be resolved: a/a.",
+		},
+		{
+			name:    "many",
+			job:     finished(batchv1.JobFailed),
+			streams: []string{"a/a", "b/b", "c/c", "d/d", "e/e", "f/f", "g/g"},
+			status:  operatorapiv1.ConditionTrue,
+			reason:  "ImageStreamsUnresolvable",
+			message: "7 image streams reference images that can't be resolved: a/a, b/b, c/c, d/d, e/e and 2 more.",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.ImagePruner{}
+			updatePruningBlockedCondition(cr, tt.job, tt.streams)
+
+			if len(cr.Status.Conditions) != 1 {
+				t.Fatalf("expected the %s condition only, got %+v", defaults.PruningBlocked, cr.Status.Conditions)
+			}
+			cond := cr.Status.Conditions[0]
+			if cond.Type != defaults.PruningBlocked || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Errorf("got %s=%s (%s), want %s=%s (%s)", cond.Type, cond.Status, cond.Reason, defaults.PruningBlocked, tt.status, tt.reason)
+			}
+			if !strings.Contains(cond.Message, tt.message) {
+				t.Errorf("expected the message to contain %q, got %q", tt.message, cond.Message)
+			}
+		})
+	}
+}
+
+func TestUnresolvableImageStreamsOnce(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-pruner-1",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			UID:       "1",
+		},
+	}
+	kubeClient := kfake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-pruner-1-abcde",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Labels: map[string]string{
+				"job-name": job.Name,
+			},
+		},
+	})
+	c := &ImagePrunerController{
+		clients: &regopclient.Clients{
+			Core: kubeClient.CoreV1(),
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		streams, err := c.unresolvableImageStreams(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(streams) != 0 {
+			t.Errorf("expected no unresolvable image streams, got %v", streams)
+		}
+	}
+
+	var reads int
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "pods" {
+			reads++
+		}
+	}
+	if reads != 1 {
+		t.Errorf("expected the logs of the finished job to be read once, got %d reads", reads)
+	}
+}
+
+func TestUnresolvableImageStreamsPodsGone(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-pruner-1",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			UID:       "1",
+		},
+	}
+	kubeClient := kfake.NewSimpleClientset()
+	c := &ImagePrunerController{
+		clients: &regopclient.Clients{
+			Core: kubeClient.CoreV1(),
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.unresolvableImageStreams(job); err != errPrunerLogsGone {
+			t.Fatalf("expected %v, got %v", errPrunerLogsGone, err)
+		}
+	}
+	if c.inspectedJob != "" {
+		t.Errorf("expected nothing to be cached for the job without pods, got %s", c.inspectedJob)
+	}
+
+	cr := &imageregistryv1.ImagePruner{}
+	updatePruningBlockedUnknown(cr, job)
+	if len(cr.Status.Conditions) != 1 || cr.Status.Conditions[0].Status != operatorapiv1.ConditionUnknown || cr.Status.Conditions[0].Reason != "LogsUnavailable" {
+		t.Errorf("expected %s to be Unknown, got %+v", defaults.PruningBlocked, cr.Status.Conditions)
+	}
+}
@@ -2,10 +2,13 @@ package operator
 
 import (
 	"context"
+	"time"
 
+	"k8s.io/client-go/dynamic"
 	kubeinformers "k8s.io/client-go/informers"
 	kubeclient "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 
 	configv1 "github.com/openshift/api/config/v1"
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
@@ -19,9 +22,26 @@ import (
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
-func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
+// RunOperator starts the controllers of the operator. When disableBootstrap
+// is set, the registry custom resource is not created automatically.
+// reconcileTimeout limits how long the registry configuration can be
+// applied during a single sync, zero means no limit. The syncs are slowed
+// down for up to maxOverloadBackoff while the API server reports that it's
+// overloaded, zero disables the backoff. storageConnectivityThresholds are
+// the numbers of consecutive checks of the storage needed to change the
+// StorageConnectivity condition. The registry serving certificate is rotated
+// servingCertRotationThreshold before its expiry.
+func RunOperator(ctx context.Context, kubeconfig *restclient.Config, disableBootstrap bool, reconcileTimeout time.Duration, maxOverloadBackoff time.Duration, storageConnectivityThresholds resource.StorageConnectivityThresholds, servingCertRotationThreshold time.Duration) error {
+	var overloadBackoff *client.APIServerBackoff
+	if maxOverloadBackoff > 0 {
+		overloadBackoff = client.NewAPIServerBackoff(overloadBackoffBaseDelay, maxOverloadBackoff)
+		kubeconfig = restclient.CopyConfig(kubeconfig)
+		kubeconfig.Wrap(overloadBackoff.WrapTransport)
+	}
+
 	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
 	if err != nil {
 		return err
@@ -38,6 +58,10 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	if err != nil {
 		return err
 	}
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		return err
+	}
 
 	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
 	kubeInformersForOpenShiftConfig := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.OpenShiftConfigNamespace))
@@ -58,6 +82,7 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		configClient,
 		imageregistryClient,
 		routeClient,
+		dynamicClient,
 		kubeInformers,
 		kubeInformersForOpenShiftConfig,
 		kubeInformersForOpenShiftConfigManaged,
@@ -65,11 +90,16 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		configInformers,
 		imageregistryInformers,
 		routeInformers,
+		disableBootstrap,
+		reconcileTimeout,
+		overloadBackoff,
+		storageConnectivityThresholds,
 	)
 
 	imageConfigStatusController := NewImageConfigController(
 		configClient.ConfigV1(),
 		configOperatorClient,
+		imageregistryInformers.Imageregistry().V1().Configs(),
 		routeInformers.Route().V1().Routes(),
 		kubeInformers.Core().V1().Services(),
 	)
@@ -90,13 +120,25 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		kubeInformers.Apps().V1().Deployments(),
 	)
 
+	// Events are attached to the operator deployment, the namespace is used
+	// when it can't be found.
+	controllerRef, err := events.GetControllerReferenceForCurrentPod(kubeClient, defaults.ImageRegistryOperatorNamespace, nil)
+	if err != nil {
+		klog.Warningf("unable to get the owner reference of the operator pod, falling back to the namespace: %v", err)
+	}
+	recorder := events.NewRecorder(kubeClient.CoreV1().Events(defaults.ImageRegistryOperatorNamespace), "cluster-image-registry-operator", controllerRef)
+
 	imageRegistryCertificatesController := NewImageRegistryCertificatesController(
 		kubeClient.CoreV1(),
 		configOperatorClient,
+		recorder,
 		kubeInformers.Core().V1().ConfigMaps(),
 		kubeInformers.Core().V1().Services(),
+		kubeInformers.Core().V1().Secrets(),
+		kubeInformers.Apps().V1().Deployments(),
 		configInformers.Config().V1().Images(),
 		kubeInformersForOpenShiftConfig.Core().V1().ConfigMaps(),
+		servingCertRotationThreshold,
 	)
 
 	nodeCADaemonController := NewNodeCADaemonController(
@@ -112,6 +154,13 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 		kubeInformers,
 		imageregistryInformers,
 		configInformers.Config().V1().Images(),
+		overloadBackoff,
+	)
+
+	conditionEventsController := NewConditionEventsController(
+		recorder,
+		imageregistryInformers.Imageregistry().V1().Configs(),
+		configInformers.Config().V1().ClusterOperators(),
 	)
 
 	loggingController := loglevel.NewClusterOperatorLoggingController(
@@ -133,6 +182,7 @@ func RunOperator(ctx context.Context, kubeconfig *restclient.Config) error {
 	go imageRegistryCertificatesController.Run(ctx.Done())
 	go imageConfigStatusController.Run(ctx.Done())
 	go imagePrunerController.Run(ctx.Done())
+	go conditionEventsController.Run(ctx.Done())
 	go loggingController.Run(ctx, 1)
 
 	<-ctx.Done()
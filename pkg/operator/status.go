@@ -1,7 +1,9 @@
 package operator
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapiv1 "github.com/openshift/api/operator/v1"
@@ -17,7 +20,10 @@ import (
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/integrityscan"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
 func updateCondition(cr *imageregistryv1.Config, condtype string, condstate operatorapiv1.OperatorCondition) {
@@ -92,19 +98,75 @@ func updatePrunerCondition(cr *imageregistryv1.ImagePruner, condtype string, con
 	cr.Status.Conditions = conditions
 }
 
+// deploymentRolloutStuckTimeout is how long the registry deployment can be
+// progressing before its rollout is reported as stuck.
+const deploymentRolloutStuckTimeout = 15 * time.Minute
+
 func isDeploymentStatusAvailable(deploy *appsapi.Deployment) bool {
 	return deploy.Status.AvailableReplicas > 0
 }
 
+// isDeploymentStatusComplete returns true when the latest generation of the
+// deployment is rolled out, all the desired replicas are updated and
+// available and no replica remains from the previous generation.
 func isDeploymentStatusComplete(deploy *appsapi.Deployment) bool {
 	replicas := int32(1)
 	if deploy.Spec.Replicas != nil {
 		replicas = *(deploy.Spec.Replicas)
 	}
-	return deploy.Status.UpdatedReplicas == replicas &&
-		deploy.Status.Replicas == replicas &&
-		deploy.Status.AvailableReplicas == replicas &&
-		deploy.Status.ObservedGeneration >= deploy.Generation
+	if replicas == 0 {
+		return deploy.Status.Replicas == 0 &&
+			deploy.Status.ObservedGeneration >= deploy.Generation
+	}
+	return resource.IsDeploymentStatusAvailableAndUpdated(deploy) &&
+		deploy.Status.UpdatedReplicas == replicas &&
+		deploy.Status.AvailableReplicas == replicas
+}
+
+// deploymentImage returns the image of the registry container.
+func deploymentImage(deploy *appsapi.Deployment) string {
+	for _, container := range deploy.Spec.Template.Spec.Containers {
+		if container.Name == "registry" {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// deploymentRolloutStatus describes the progress of the rollout of the
+// deployment, the generation and the image let the administrators correlate
+// it with the changes of the deployment.
+func deploymentRolloutStatus(deploy *appsapi.Deployment) string {
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *(deploy.Spec.Replicas)
+	}
+	generation := fmt.Sprintf("generation %d (observed %d)", deploy.Generation, deploy.Status.ObservedGeneration)
+	if image := deploymentImage(deploy); len(image) != 0 {
+		generation = fmt.Sprintf("%s of the image %s", generation, image)
+	}
+	return fmt.Sprintf(
+		"%s, %d of %d replicas updated, %d available, %d ready",
+		generation,
+		deploy.Status.UpdatedReplicas,
+		replicas,
+		deploy.Status.AvailableReplicas,
+		deploy.Status.ReadyReplicas,
+	)
+}
+
+// isDeploymentRolloutStuck returns true if the registry has been reported
+// as progressing because of an incomplete rollout for longer than
+// deploymentRolloutStuckTimeout.
+func isDeploymentRolloutStuck(cr *imageregistryv1.Config) bool {
+	progressing := v1helpers.FindOperatorCondition(cr.Status.Conditions, operatorapiv1.OperatorStatusTypeProgressing)
+	if progressing == nil || progressing.Status != operatorapiv1.ConditionTrue {
+		return false
+	}
+	if progressing.Reason != "DeploymentNotCompleted" && progressing.Reason != "DeploymentRolloutStuck" {
+		return false
+	}
+	return time.Since(progressing.LastTransitionTime.Time) > deploymentRolloutStuckTimeout
 }
 
 func (c *Controller) setStatusRemoving(cr *imageregistryv1.Config) {
@@ -218,6 +280,93 @@ func (c *ImagePrunerController) syncPrunerStatus(cr *imageregistryv1.ImagePruner
 	}
 }
 
+// maxPrunerRuns is the number of pruner runs kept in the status.
+const maxPrunerRuns = 5
+
+// prunerRun returns the outcome of the job, or false if it's not finished.
+func prunerRun(job *batchv1.Job) (imageregistryv1.ImagePrunerRun, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if condition.Type != batchv1.JobComplete && condition.Type != batchv1.JobFailed {
+			continue
+		}
+
+		start := job.CreationTimestamp
+		if job.Status.StartTime != nil {
+			start = *job.Status.StartTime
+		}
+		end := condition.LastTransitionTime
+		if condition.Type == batchv1.JobComplete && job.Status.CompletionTime != nil {
+			end = *job.Status.CompletionTime
+		}
+
+		run := imageregistryv1.ImagePrunerRun{
+			JobName:   job.Name,
+			StartTime: start,
+			Succeeded: condition.Type == batchv1.JobComplete,
+		}
+		if d := end.Sub(start.Time); d > 0 {
+			run.Duration = metaapi.Duration{Duration: d}
+		}
+		if !run.Succeeded {
+			run.Message = condition.Message
+		}
+		return run, true
+	}
+	return imageregistryv1.ImagePrunerRun{}, false
+}
+
+// updatePrunerRuns adds the finished jobs to the history of the pruner runs.
+// The cron job deletes the old jobs according to its history limits, the
+// runs already recorded are kept until there are enough newer ones.
+func updatePrunerRuns(cr *imageregistryv1.ImagePruner, jobs []*batchv1.Job) {
+	runs := map[string]imageregistryv1.ImagePrunerRun{}
+	for _, run := range cr.Status.Runs {
+		runs[run.JobName] = run
+	}
+	for _, job := range jobs {
+		if run, ok := prunerRun(job); ok {
+			runs[run.JobName] = run
+		}
+	}
+
+	var history []imageregistryv1.ImagePrunerRun
+	for _, run := range runs {
+		history = append(history, run)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].StartTime.Equal(&history[j].StartTime) {
+			return history[j].StartTime.Before(&history[i].StartTime)
+		}
+		return history[i].JobName > history[j].JobName
+	})
+	if len(history) > maxPrunerRuns {
+		history = history[:maxPrunerRuns]
+	}
+	cr.Status.Runs = history
+}
+
+// updateIntegrityScanStatus copies the status reported by the integrity scan
+// job to the pruner resource. A nil config map means that no scan has
+// reported yet.
+func updateIntegrityScanStatus(cr *imageregistryv1.ImagePruner, cm *corev1.ConfigMap) {
+	if cr.Spec.IntegrityScan == nil {
+		cr.Status.IntegrityScan = nil
+		return
+	}
+	if cm == nil {
+		return
+	}
+	status, err := integrityscan.ParseStatus(cm)
+	if err != nil {
+		klog.Errorf("unable to read the integrity scan status: %s", err)
+		return
+	}
+	cr.Status.IntegrityScan = status
+}
+
 // checkRoutesStatus verifies the Admitted condition type for all provided routes,
 // returns an error if any of them was not admitted.
 func (c *Controller) checkRoutesStatus(routes []*routev1.Route) error {
@@ -250,6 +399,75 @@ func (c *Controller) checkRoutesStatus(routes []*routev1.Route) error {
 	return nil
 }
 
+// updatePermissionsCondition reports the operation the API server denied to
+// the operator. Other errors stop the apply before the denied object is
+// reached again, the condition is only cleared once all the resources are
+// applied.
+func updatePermissionsCondition(cr *imageregistryv1.Config, applyError error) {
+	var forbiddenErr *resource.ForbiddenError
+	if errors.As(applyError, &forbiddenErr) {
+		updateCondition(cr, defaults.InsufficientOperatorPermissions, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionTrue,
+			Reason:  "Forbidden",
+			Message: fmt.Sprintf("The operator is not allowed to %s %s: %s", forbiddenErr.Verb, forbiddenErr.Resource, forbiddenErr.Err),
+		})
+	} else if applyError == nil {
+		updateCondition(cr, defaults.InsufficientOperatorPermissions, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionFalse,
+			Reason:  "AsExpected",
+			Message: "The operator is allowed to manage all the resources",
+		})
+	}
+}
+
+// updateProvisioningDeferredCondition sets the StorageProvisioningDeferred
+// condition. The condition is only reported once the provisioning is
+// configured, it is kept afterwards to record the end of the deferral.
+func updateProvisioningDeferredCondition(cr *imageregistryv1.Config, deferred bool) {
+	if deferred {
+		updateCondition(cr, defaults.StorageProvisioningDeferred, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionTrue,
+			Reason:  "Deferred",
+			Message: "The storage and the registry are provisioned once spec.storage.provisioning is set to Immediate",
+		})
+	} else if len(cr.Spec.Storage.Provisioning) != 0 || v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageProvisioningDeferred) != nil {
+		updateCondition(cr, defaults.StorageProvisioningDeferred, operatorapiv1.OperatorCondition{
+			Status:  operatorapiv1.ConditionFalse,
+			Reason:  "Provisioned",
+			Message: "The storage and the registry are provisioned",
+		})
+	}
+}
+
+// updateCABundleStaleCondition sets the CABundleStale condition from the
+// dependencies checksum the registry pods were started with. The CA bundle is
+// only extracted when a pod starts, so a pod started with other dependencies
+// may trust a stale bundle. The pods without a checksum are not counted.
+func updateCABundleStaleCondition(cr *imageregistryv1.Config, depsChecksum string, pods []*corev1.Pod) {
+	var running, stale int
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		running++
+		if checksum, ok := pod.Annotations[defaults.ChecksumOperatorDepsAnnotation]; ok && checksum != depsChecksum {
+			stale++
+		}
+	}
+
+	cond := operatorapiv1.OperatorCondition{
+		Status:  operatorapiv1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: "The registry pods use the current CA bundle",
+	}
+	if stale != 0 {
+		cond.Status = operatorapiv1.ConditionTrue
+		cond.Reason = "DependenciesChanged"
+		cond.Message = fmt.Sprintf("%d of %d registry pods were started with previous dependencies, e.g. a previous CA bundle, and are replaced by the rollout of the deployment", stale, running)
+	}
+	updateCondition(cr, defaults.CABundleStale, cond)
+}
+
 func (c *Controller) syncStatus(
 	cr *imageregistryv1.Config,
 	deploy *appsapi.Deployment,
@@ -273,6 +491,10 @@ func (c *Controller) syncStatus(
 			operatorAvailable.Status = operatorapiv1.ConditionTrue
 			operatorAvailable.Message = "The registry is removed"
 			operatorAvailable.Reason = "Removed"
+		} else if storage.ProvisioningDeferred(cr) {
+			operatorAvailable.Status = operatorapiv1.ConditionTrue
+			operatorAvailable.Message = "The provisioning of the registry is deferred"
+			operatorAvailable.Reason = "ProvisioningDeferred"
 		} else {
 			operatorAvailable.Message = "The deployment does not exist"
 			operatorAvailable.Reason = "DeploymentNotFound"
@@ -319,6 +541,10 @@ func (c *Controller) syncStatus(
 		}
 		operatorProgressing.Message = fmt.Sprintf("Unable to apply resources: %s", applyError)
 		operatorProgressing.Reason = "Error"
+	} else if deploy == nil && storage.ProvisioningDeferred(cr) {
+		operatorProgressing.Status = operatorapiv1.ConditionFalse
+		operatorProgressing.Message = "The provisioning of the registry is deferred"
+		operatorProgressing.Reason = "ProvisioningDeferred"
 	} else if deploy == nil {
 		operatorProgressing.Message = "All resources are successfully applied, but the deployment does not exist"
 		operatorProgressing.Reason = "WaitingForDeployment"
@@ -326,8 +552,14 @@ func (c *Controller) syncStatus(
 		operatorProgressing.Message = "The deployment is being deleted"
 		operatorProgressing.Reason = "FinalizingDeployment"
 	} else if !isDeploymentStatusComplete(deploy) {
-		operatorProgressing.Message = "The deployment has not completed"
-		operatorProgressing.Reason = "DeploymentNotCompleted"
+		if isDeploymentRolloutStuck(cr) {
+			operatorProgressing.Message = fmt.Sprintf("The deployment has not completed for more than %s: %s", deploymentRolloutStuckTimeout, deploymentRolloutStatus(deploy))
+			operatorProgressing.Reason = "DeploymentRolloutStuck"
+			klog.Warningf("the rollout of the registry deployment is stuck: %s", deploymentRolloutStatus(deploy))
+		} else {
+			operatorProgressing.Message = fmt.Sprintf("The deployment has not completed: %s", deploymentRolloutStatus(deploy))
+			operatorProgressing.Reason = "DeploymentNotCompleted"
+		}
 	} else {
 		operatorProgressing.Status = operatorapiv1.ConditionFalse
 		operatorProgressing.Message = "The registry is ready"
@@ -352,6 +584,9 @@ func (c *Controller) syncStatus(
 	} else if cr.Spec.ManagementState == operatorapiv1.Removed {
 		operatorDegraded.Message = "The registry is removed"
 		operatorDegraded.Reason = "Removed"
+	} else if deploy == nil && storage.ProvisioningDeferred(cr) {
+		operatorDegraded.Message = "The provisioning of the registry is deferred"
+		operatorDegraded.Reason = "ProvisioningDeferred"
 	} else if operatorAvailable.Status != operatorapiv1.ConditionTrue {
 		updatedAvailableCondition := v1helpers.FindOperatorCondition(cr.Status.Conditions, operatorapiv1.OperatorStatusTypeAvailable)
 		if updatedAvailableCondition != nil && time.Since(updatedAvailableCondition.LastTransitionTime.Time) > time.Minute {
@@ -2,10 +2,12 @@ package operator
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
 	appsapi "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
@@ -13,6 +15,10 @@ import (
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorv1 "github.com/openshift/api/operator/v1"
 	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
 )
 
 func validateCondition(t *testing.T, expcond, cond operatorv1.OperatorCondition) {
@@ -217,7 +223,7 @@ func Test_syncStatus(t *testing.T) {
 					Type:    "Progressing",
 					Status:  "True",
 					Reason:  "DeploymentNotCompleted",
-					Message: "The deployment has not completed",
+					Message: "The deployment has not completed: generation 0 (observed 0), 0 of 3 replicas updated, 2 available, 0 ready",
 				},
 				{
 					Type:    "Degraded",
@@ -233,6 +239,135 @@ func Test_syncStatus(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Deployment rollout in progress",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: "Managed",
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{
+						Conditions: []operatorv1.OperatorCondition{
+							{
+								Type:               "Progressing",
+								Status:             "True",
+								Reason:             "DeploymentNotCompleted",
+								LastTransitionTime: metav1.NewTime(time.Now().Add(-5 * time.Minute)),
+							},
+						},
+					},
+				},
+			},
+			deploy: &appsapi.Deployment{
+				Spec: appsapi.DeploymentSpec{
+					Replicas: pointer.Int32Ptr(3),
+				},
+				Status: appsapi.DeploymentStatus{
+					Replicas:          4,
+					UpdatedReplicas:   1,
+					AvailableReplicas: 3,
+					ReadyReplicas:     3,
+				},
+			},
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Progressing",
+					Status:  "True",
+					Reason:  "DeploymentNotCompleted",
+					Message: "The deployment has not completed: generation 0 (observed 0), 1 of 3 replicas updated, 3 available, 3 ready",
+				},
+				{
+					Type:    "Degraded",
+					Status:  "False",
+					Reason:  "",
+					Message: "",
+				},
+			},
+		},
+		{
+			name: "Deployment rollout stuck",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: "Managed",
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{
+						Conditions: []operatorv1.OperatorCondition{
+							{
+								Type:               "Progressing",
+								Status:             "True",
+								Reason:             "DeploymentNotCompleted",
+								LastTransitionTime: metav1.NewTime(time.Now().Add(-20 * time.Minute)),
+							},
+						},
+					},
+				},
+			},
+			deploy: &appsapi.Deployment{
+				Spec: appsapi.DeploymentSpec{
+					Replicas: pointer.Int32Ptr(3),
+				},
+				Status: appsapi.DeploymentStatus{
+					Replicas:          4,
+					UpdatedReplicas:   1,
+					AvailableReplicas: 3,
+					ReadyReplicas:     3,
+				},
+			},
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Available",
+					Status:  "True",
+					Reason:  "MinimumAvailability",
+					Message: "The registry has minimum availability",
+				},
+				{
+					Type:    "Progressing",
+					Status:  "True",
+					Reason:  "DeploymentRolloutStuck",
+					Message: "The deployment has not completed for more than 15m0s: generation 0 (observed 0), 1 of 3 replicas updated, 3 available, 3 ready",
+				},
+			},
+		},
+		{
+			name: "Deployment rollout completed",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: "Managed",
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					OperatorStatus: operatorv1.OperatorStatus{
+						Conditions: []operatorv1.OperatorCondition{
+							{
+								Type:               "Progressing",
+								Status:             "True",
+								Reason:             "DeploymentRolloutStuck",
+								LastTransitionTime: metav1.NewTime(time.Now().Add(-20 * time.Minute)),
+							},
+						},
+					},
+				},
+			},
+			deploy: &appsapi.Deployment{
+				Spec: appsapi.DeploymentSpec{
+					Replicas: pointer.Int32Ptr(3),
+				},
+				Status: appsapi.DeploymentStatus{
+					Replicas:          3,
+					UpdatedReplicas:   3,
+					AvailableReplicas: 3,
+					ReadyReplicas:     3,
+				},
+			},
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Progressing",
+					Status:  "False",
+					Reason:  "Ready",
+					Message: "The registry is ready",
+				},
+			},
+		},
 		{
 			name: "Deployment lagging some replicas (progressing with random reason)",
 			cfg: &imageregistryv1.Config{
@@ -266,7 +401,7 @@ func Test_syncStatus(t *testing.T) {
 					Type:    "Progressing",
 					Status:  "True",
 					Reason:  "DeploymentNotCompleted",
-					Message: "The deployment has not completed",
+					Message: "The deployment has not completed: generation 0 (observed 0), 0 of 3 replicas updated, 2 available, 0 ready",
 				},
 				{
 					Type:    "Degraded",
@@ -320,7 +455,7 @@ func Test_syncStatus(t *testing.T) {
 					Type:    "Progressing",
 					Status:  "True",
 					Reason:  "DeploymentNotCompleted",
-					Message: "The deployment has not completed",
+					Message: "The deployment has not completed: generation 0 (observed 0), 0 of 3 replicas updated, 2 available, 0 ready",
 				},
 				{
 					Type:    "Degraded",
@@ -366,7 +501,7 @@ func Test_syncStatus(t *testing.T) {
 					Type:    "Progressing",
 					Status:  "True",
 					Reason:  "DeploymentNotCompleted",
-					Message: "The deployment has not completed",
+					Message: "The deployment has not completed: generation 0 (observed 0), 0 of 1 replicas updated, 0 available, 0 ready",
 				},
 				{
 					Type:    "Degraded",
@@ -401,7 +536,7 @@ func Test_syncStatus(t *testing.T) {
 					Type:    "Progressing",
 					Status:  "True",
 					Reason:  "DeploymentNotCompleted",
-					Message: "The deployment has not completed",
+					Message: "The deployment has not completed: generation 0 (observed 0), 0 of 1 replicas updated, 0 available, 0 ready",
 				},
 				{
 					Type:    "Degraded",
@@ -675,6 +810,68 @@ func Test_syncStatus(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "provisioning deferred without Deployment in place",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: "Managed",
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Provisioning: imageregistryv1.StorageProvisioningDeferred,
+					},
+				},
+			},
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Available",
+					Status:  "True",
+					Reason:  "ProvisioningDeferred",
+					Message: "The provisioning of the registry is deferred",
+				},
+				{
+					Type:    "Progressing",
+					Status:  "False",
+					Reason:  "ProvisioningDeferred",
+					Message: "The provisioning of the registry is deferred",
+				},
+				{
+					Type:    "Degraded",
+					Status:  "False",
+					Reason:  "ProvisioningDeferred",
+					Message: "The provisioning of the registry is deferred",
+				},
+			},
+		},
+		{
+			name: "provisioning deferred after the storage is provisioned",
+			cfg: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: "Managed",
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Provisioning: imageregistryv1.StorageProvisioningDeferred,
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						EmptyDir:        &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				},
+			},
+			expectedConditions: []operatorv1.OperatorCondition{
+				{
+					Type:    "Available",
+					Status:  "False",
+					Reason:  "DeploymentNotFound",
+					Message: "The deployment does not exist",
+				},
+				{
+					Type:    "Progressing",
+					Status:  "True",
+					Reason:  "WaitingForDeployment",
+					Message: "All resources are successfully applied, but the deployment does not exist",
+				},
+			},
+		},
 		{
 			name: "a faulty route",
 			cfg: &imageregistryv1.Config{
@@ -766,3 +963,497 @@ func Test_syncStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncStatusDeploymentRollout(t *testing.T) {
+	deploy := &appsapi.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       defaults.ImageRegistryName,
+			Namespace:  defaults.ImageRegistryOperatorNamespace,
+			Generation: 1,
+		},
+		Spec: appsapi.DeploymentSpec{
+			Replicas: pointer.Int32Ptr(2),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "registry", Image: "quay.io/openshift/registry@sha256:1111"},
+					},
+				},
+			},
+		},
+		Status: appsapi.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           2,
+			UpdatedReplicas:    2,
+			ReadyReplicas:      2,
+			AvailableReplicas:  2,
+		},
+	}
+	cfg := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			ManagementState: operatorv1.Managed,
+		},
+	}
+
+	ctrl := Controller{}
+	for _, step := range []struct {
+		name     string
+		update   func(deploy *appsapi.Deployment)
+		expected operatorv1.OperatorCondition
+	}{
+		{
+			name:   "rolled out",
+			update: func(deploy *appsapi.Deployment) {},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Ready",
+				Message: "The registry is ready",
+			},
+		},
+		{
+			name: "new generation not observed yet",
+			update: func(deploy *appsapi.Deployment) {
+				deploy.Generation = 2
+				deploy.Spec.Template.Spec.Containers[0].Image = "quay.io/openshift/registry@sha256:2222"
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "DeploymentNotCompleted",
+				Message: "The deployment has not completed: generation 2 (observed 1) of the image quay.io/openshift/registry@sha256:2222, 2 of 2 replicas updated, 2 available, 2 ready",
+			},
+		},
+		{
+			name: "surge replica created",
+			update: func(deploy *appsapi.Deployment) {
+				deploy.Status.ObservedGeneration = 2
+				deploy.Status.Replicas = 3
+				deploy.Status.UpdatedReplicas = 1
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "DeploymentNotCompleted",
+				Message: "The deployment has not completed: generation 2 (observed 2) of the image quay.io/openshift/registry@sha256:2222, 1 of 2 replicas updated, 2 available, 2 ready",
+			},
+		},
+		{
+			name: "all replicas updated, old replica terminating",
+			update: func(deploy *appsapi.Deployment) {
+				deploy.Status.UpdatedReplicas = 2
+				deploy.Status.ReadyReplicas = 3
+				deploy.Status.AvailableReplicas = 3
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "DeploymentNotCompleted",
+				Message: "The deployment has not completed: generation 2 (observed 2) of the image quay.io/openshift/registry@sha256:2222, 2 of 2 replicas updated, 3 available, 3 ready",
+			},
+		},
+		{
+			name: "updated replica not available yet",
+			update: func(deploy *appsapi.Deployment) {
+				deploy.Status.Replicas = 2
+				deploy.Status.ReadyReplicas = 1
+				deploy.Status.AvailableReplicas = 1
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "DeploymentNotCompleted",
+				Message: "The deployment has not completed: generation 2 (observed 2) of the image quay.io/openshift/registry@sha256:2222, 2 of 2 replicas updated, 1 available, 1 ready",
+			},
+		},
+		{
+			name: "rollout completed",
+			update: func(deploy *appsapi.Deployment) {
+				deploy.Status.ReadyReplicas = 2
+				deploy.Status.AvailableReplicas = 2
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Ready",
+				Message: "The registry is ready",
+			},
+		},
+	} {
+		step.update(deploy)
+		ctrl.syncStatus(cfg, deploy, nil, nil)
+
+		cond := v1helpers.FindOperatorCondition(cfg.Status.Conditions, operatorv1.OperatorStatusTypeProgressing)
+		if cond == nil {
+			t.Fatalf("%s: Progressing condition not found", step.name)
+		}
+		step.expected.Type = operatorv1.OperatorStatusTypeProgressing
+		validateCondition(t, step.expected, *cond)
+	}
+}
+
+func TestUpdatePrunerRuns(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) metav1.Time {
+		return metav1.NewTime(base.Add(time.Duration(hours) * time.Hour))
+	}
+	job := func(name string, hours int, conditions ...batchv1.JobCondition) *batchv1.Job {
+		start := at(hours)
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: start,
+			},
+			Status: batchv1.JobStatus{
+				StartTime:  &start,
+				Conditions: conditions,
+			},
+		}
+	}
+
+	cr := &imageregistryv1.ImagePruner{
+		Status: imageregistryv1.ImagePrunerStatus{
+			Runs: []imageregistryv1.ImagePrunerRun{
+				{JobName: "pruner-4", StartTime: at(4), Succeeded: true},
+				{JobName: "pruner-3", StartTime: at(3), Succeeded: true},
+				{JobName: "pruner-2", StartTime: at(2), Succeeded: true},
+				{JobName: "pruner-1", StartTime: at(1), Succeeded: true},
+			},
+		},
+	}
+
+	completed := job("pruner-5", 5, batchv1.JobCondition{
+		Type:               batchv1.JobComplete,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: at(6),
+	})
+	completion := metav1.NewTime(base.Add(5*time.Hour + 10*time.Minute))
+	completed.Status.CompletionTime = &completion
+
+	updatePrunerRuns(cr, []*batchv1.Job{
+		job("pruner-7", 7),
+		job("pruner-6", 6, batchv1.JobCondition{
+			Type:               batchv1.JobFailed,
+			Status:             corev1.ConditionTrue,
+			Message:            "Job has reached the specified backoff limit",
+			LastTransitionTime: metav1.NewTime(base.Add(6*time.Hour + time.Minute)),
+		}),
+		completed,
+		job("pruner-4", 4, batchv1.JobCondition{
+			Type:   batchv1.JobComplete,
+			Status: corev1.ConditionTrue,
+		}),
+	})
+
+	expected := []imageregistryv1.ImagePrunerRun{
+		{JobName: "pruner-6", StartTime: at(6), Duration: metav1.Duration{Duration: time.Minute}, Message: "Job has reached the specified backoff limit"},
+		{JobName: "pruner-5", StartTime: at(5), Duration: metav1.Duration{Duration: 10 * time.Minute}, Succeeded: true},
+		{JobName: "pruner-4", StartTime: at(4), Succeeded: true},
+		{JobName: "pruner-3", StartTime: at(3), Succeeded: true},
+		{JobName: "pruner-2", StartTime: at(2), Succeeded: true},
+	}
+	if !reflect.DeepEqual(cr.Status.Runs, expected) {
+		t.Errorf("unexpected runs:\n got: %#v\nwant: %#v", cr.Status.Runs, expected)
+	}
+}
+
+func TestUpdatePermissionsCondition(t *testing.T) {
+	denied := &resource.ForbiddenError{
+		Verb:     "create",
+		Resource: "routes.route.openshift.io",
+		Err:      fmt.Errorf(`routes.route.openshift.io "default-route" is forbidden`),
+	}
+
+	for _, tt := range []struct {
+		name       string
+		previous   operatorv1.ConditionStatus
+		applyError error
+		expected   operatorv1.OperatorCondition
+	}{
+		{
+			name: "applied",
+			expected: operatorv1.OperatorCondition{
+				Type:    defaults.InsufficientOperatorPermissions,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "AsExpected",
+				Message: "The operator is allowed to manage all the resources",
+			},
+		},
+		{
+			name:       "denied",
+			applyError: fmt.Errorf("unable to apply objects: failed to create object *v1.Route, Namespace=openshift-image-registry, Name=default-route: %w", denied),
+			expected: operatorv1.OperatorCondition{
+				Type:    defaults.InsufficientOperatorPermissions,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Forbidden",
+				Message: `The operator is not allowed to create routes.route.openshift.io: routes.route.openshift.io "default-route" is forbidden`,
+			},
+		},
+		{
+			name:       "denied before, other error",
+			previous:   operatorv1.ConditionTrue,
+			applyError: fmt.Errorf("unable to sync storage configuration: timeout"),
+			expected: operatorv1.OperatorCondition{
+				Type:   defaults.InsufficientOperatorPermissions,
+				Status: operatorv1.ConditionTrue,
+				Reason: "Forbidden",
+			},
+		},
+		{
+			name:       "other error",
+			applyError: fmt.Errorf("unable to sync storage configuration: timeout"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			if tt.previous != "" {
+				cr.Status.Conditions = []operatorv1.OperatorCondition{
+					{
+						Type:   defaults.InsufficientOperatorPermissions,
+						Status: tt.previous,
+						Reason: "Forbidden",
+					},
+				}
+			}
+
+			updatePermissionsCondition(cr, tt.applyError)
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.InsufficientOperatorPermissions)
+			if tt.expected.Type == "" {
+				if cond != nil {
+					t.Fatalf("unexpected condition %#v", cond)
+				}
+				return
+			}
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.InsufficientOperatorPermissions)
+			}
+			validateCondition(t, tt.expected, *cond)
+		})
+	}
+}
+
+func TestUpdateProvisioningDeferredCondition(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		provisioning string
+		previous     operatorv1.ConditionStatus
+		deferred     bool
+		expected     operatorv1.OperatorCondition
+	}{
+		{
+			name: "not configured",
+		},
+		{
+			name:         "deferred",
+			provisioning: imageregistryv1.StorageProvisioningDeferred,
+			deferred:     true,
+			expected: operatorv1.OperatorCondition{
+				Type:    defaults.StorageProvisioningDeferred,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "Deferred",
+				Message: "The storage and the registry are provisioned once spec.storage.provisioning is set to Immediate",
+			},
+		},
+		{
+			name:         "immediate",
+			provisioning: imageregistryv1.StorageProvisioningImmediate,
+			expected: operatorv1.OperatorCondition{
+				Type:    defaults.StorageProvisioningDeferred,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Provisioned",
+				Message: "The storage and the registry are provisioned",
+			},
+		},
+		{
+			name:     "unset after the deferral",
+			previous: operatorv1.ConditionTrue,
+			expected: operatorv1.OperatorCondition{
+				Type:    defaults.StorageProvisioningDeferred,
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "Provisioned",
+				Message: "The storage and the registry are provisioned",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			cr.Spec.Storage.Provisioning = tt.provisioning
+			if tt.previous != "" {
+				cr.Status.Conditions = []operatorv1.OperatorCondition{
+					{
+						Type:   defaults.StorageProvisioningDeferred,
+						Status: tt.previous,
+						Reason: "Deferred",
+					},
+				}
+			}
+
+			updateProvisioningDeferredCondition(cr, tt.deferred)
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageProvisioningDeferred)
+			if tt.expected.Type == "" {
+				if cond != nil {
+					t.Fatalf("unexpected condition %#v", cond)
+				}
+				return
+			}
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageProvisioningDeferred)
+			}
+			validateCondition(t, tt.expected, *cond)
+		})
+	}
+}
+
+func TestUpdateIntegrityScanStatus(t *testing.T) {
+	previous := &imageregistryv1.ImagePrunerIntegrityScanStatus{JobName: "image-integrity-scan-1"}
+	reported := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-registry-integrity-scan"},
+		Data: map[string]string{
+			"status.json": `{"jobName":"image-integrity-scan-2","startTime":null,"totalBlobs":3,"scannedBlobs":1,"corruptBlobCount":1,"corruptBlobs":[{"digest":"sha256:aaa","repository":"ns/app","message":"the blob is missing from the storage"}]}`,
+		},
+	}
+
+	for _, tt := range []struct {
+		name      string
+		scan      *imageregistryv1.ImagePrunerIntegrityScan
+		configMap *corev1.ConfigMap
+		expected  *imageregistryv1.ImagePrunerIntegrityScanStatus
+	}{
+		{
+			name:      "disabled",
+			configMap: reported,
+		},
+		{
+			name:     "not reported yet",
+			scan:     &imageregistryv1.ImagePrunerIntegrityScan{},
+			expected: previous,
+		},
+		{
+			name:      "reported",
+			scan:      &imageregistryv1.ImagePrunerIntegrityScan{},
+			configMap: reported,
+			expected: &imageregistryv1.ImagePrunerIntegrityScanStatus{
+				JobName:          "image-integrity-scan-2",
+				TotalBlobs:       3,
+				ScannedBlobs:     1,
+				CorruptBlobCount: 1,
+				CorruptBlobs: []imageregistryv1.ImagePrunerCorruptBlob{
+					{Digest: "sha256:aaa", Repository: "ns/app", Message: "the blob is missing from the storage"},
+				},
+			},
+		},
+		{
+			name: "invalid report",
+			scan: &imageregistryv1.ImagePrunerIntegrityScan{},
+			configMap: &corev1.ConfigMap{
+				Data: map[string]string{"status.json": "{"},
+			},
+			expected: previous,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.ImagePruner{
+				Spec:   imageregistryv1.ImagePrunerSpec{IntegrityScan: tt.scan},
+				Status: imageregistryv1.ImagePrunerStatus{IntegrityScan: previous},
+			}
+			updateIntegrityScanStatus(cr, tt.configMap)
+			if !reflect.DeepEqual(cr.Status.IntegrityScan, tt.expected) {
+				t.Errorf("unexpected status:\n got: %#v\nwant: %#v", cr.Status.IntegrityScan, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateCABundleStaleCondition(t *testing.T) {
+	pod := func(name, checksum string, phase corev1.PodPhase) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+				Labels:    defaults.DeploymentLabels,
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+			},
+		}
+		if checksum != "" {
+			p.Annotations = map[string]string{
+				defaults.ChecksumOperatorDepsAnnotation: checksum,
+			}
+		}
+		return p
+	}
+	terminating := pod("terminating", "old", corev1.PodRunning)
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	for _, tt := range []struct {
+		name     string
+		pods     []*corev1.Pod
+		expected operatorv1.OperatorCondition
+	}{
+		{
+			name: "no pods",
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "AsExpected",
+				Message: "The registry pods use the current CA bundle",
+			},
+		},
+		{
+			name: "current bundle",
+			pods: []*corev1.Pod{
+				pod("a", "current", corev1.PodRunning),
+				pod("b", "current", corev1.PodPending),
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "AsExpected",
+				Message: "The registry pods use the current CA bundle",
+			},
+		},
+		{
+			name: "stale bundle",
+			pods: []*corev1.Pod{
+				pod("a", "old", corev1.PodRunning),
+				pod("b", "current", corev1.PodRunning),
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "DependenciesChanged",
+				Message: "1 of 2 registry pods were started with previous dependencies, e.g. a previous CA bundle, and are replaced by the rollout of the deployment",
+			},
+		},
+		{
+			name: "stale pods gone",
+			pods: []*corev1.Pod{
+				terminating,
+				pod("completed", "old", corev1.PodSucceeded),
+				pod("b", "current", corev1.PodRunning),
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "AsExpected",
+				Message: "The registry pods use the current CA bundle",
+			},
+		},
+		{
+			name: "pods without checksum",
+			pods: []*corev1.Pod{
+				pod("a", "", corev1.PodRunning),
+			},
+			expected: operatorv1.OperatorCondition{
+				Status:  operatorv1.ConditionFalse,
+				Reason:  "AsExpected",
+				Message: "The registry pods use the current CA bundle",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			updateCABundleStaleCondition(cr, "current", tt.pods)
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.CABundleStale)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.CABundleStale)
+			}
+			tt.expected.Type = defaults.CABundleStale
+			validateCondition(t, tt.expected, *cond)
+		})
+	}
+}
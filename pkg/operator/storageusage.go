@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// storageUsageTimeout limits how long the storage can be measured.
+const storageUsageTimeout = time.Minute
+
+// storageBackend returns the value of the backend label of the storage
+// usage metrics.
+func storageBackend(cfg *imageregistryv1.ImageRegistryConfigStorage) string {
+	switch {
+	case cfg.EmptyDir != nil:
+		return "emptydir"
+	case cfg.S3 != nil:
+		return "s3"
+	case cfg.Swift != nil:
+		return "swift"
+	case cfg.GCS != nil:
+		return "gcs"
+	case cfg.PVC != nil:
+		return "pvc"
+	case cfg.Azure != nil:
+		return "azure"
+	case cfg.OCI != nil:
+		return "oci"
+	case cfg.Filesystem != nil:
+		return "filesystem"
+	}
+	return ""
+}
+
+// storageUsage measures the provisioned storage of the registry. The backend
+// is empty when the storage isn't measured, i.e. when the registry has no
+// storage or when its driver can't measure it.
+func (c *Controller) storageUsage() (backend string, used int64, capacity int64, err error) {
+	cr, err := c.listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return "", 0, 0, nil
+	} else if err != nil {
+		return "", 0, 0, err
+	}
+
+	if cr.Spec.ManagementState == operatorv1.Removed {
+		return "", 0, 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageUsageTimeout)
+	defer cancel()
+
+	driver, err := storage.NewDriver(ctx, &cr.Status.Storage, c.kubeconfig, c.listers)
+	if err == storage.ErrStorageNotConfigured {
+		return "", 0, 0, nil
+	} else if err != nil {
+		return "", 0, 0, err
+	}
+
+	reporter, ok := driver.(storage.UsageReporter)
+	if !ok {
+		return "", 0, 0, nil
+	}
+
+	used, capacity, err = reporter.StorageUsage()
+	if err == util.ErrStorageUsageNotSupported {
+		return "", 0, 0, nil
+	} else if err != nil {
+		return "", 0, 0, fmt.Errorf("unable to measure the %s storage: %w", storageBackend(&cr.Status.Storage), err)
+	}
+
+	return storageBackend(&cr.Status.Storage), used, capacity, nil
+}
+
+// collectStorageUsage updates the storage usage metrics. Nothing is reported
+// for the storages that can't be measured.
+func (c *Controller) collectStorageUsage() {
+	backend, used, capacity, err := c.storageUsage()
+	if err != nil {
+		klog.Warningf("unable to collect the storage usage: %s", err)
+		metrics.ResetStorageUsage()
+		return
+	}
+	if backend == "" {
+		metrics.ResetStorageUsage()
+		return
+	}
+	metrics.StorageUsage(backend, used, capacity)
+}
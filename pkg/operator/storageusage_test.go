@@ -0,0 +1,89 @@
+package operator
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestStorageBackend(t *testing.T) {
+	for _, tt := range []struct {
+		storage  imageregistryv1.ImageRegistryConfigStorage
+		expected string
+	}{
+		{storage: imageregistryv1.ImageRegistryConfigStorage{}, expected: ""},
+		{storage: imageregistryv1.ImageRegistryConfigStorage{S3: &imageregistryv1.ImageRegistryConfigStorageS3{}}, expected: "s3"},
+		{storage: imageregistryv1.ImageRegistryConfigStorage{PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{}}, expected: "pvc"},
+		{storage: imageregistryv1.ImageRegistryConfigStorage{Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{}}, expected: "azure"},
+	} {
+		if backend := storageBackend(&tt.storage); backend != tt.expected {
+			t.Errorf("%#v: got %q, want %q", tt.storage, backend, tt.expected)
+		}
+	}
+}
+
+func TestStorageUsageNotMeasured(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.Config
+	}{
+		{
+			name: "no registry",
+		},
+		{
+			name: "storage not provisioned",
+			config: &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+			},
+		},
+		{
+			name: "removed",
+			config: &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					ManagementState: operatorv1.Removed,
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{Bucket: "registry"},
+					},
+				},
+			},
+		},
+		{
+			name: "unsupported backend",
+			config: &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{Name: defaults.ImageRegistryResourceName},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			if tt.config != nil {
+				builder.AddRegistryOperatorConfig(tt.config)
+			}
+			c := &Controller{
+				listers: builder.BuildListers(),
+			}
+
+			backend, _, _, err := c.storageUsage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backend != "" {
+				t.Errorf("expected the storage not to be measured, got the backend %q", backend)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package operator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeinformers "k8s.io/client-go/informers"
+	kubeclient "k8s.io/client-go/kubernetes"
+	kappslisters "k8s.io/client-go/listers/apps/v1"
+	kbatchlisters "k8s.io/client-go/listers/batch/v1"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
+	kpolicylisters "k8s.io/client-go/listers/policy/v1"
+	restclient "k8s.io/client-go/rest"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	configclient "github.com/openshift/client-go/config/clientset/versioned"
+	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryclient "github.com/openshift/client-go/imageregistry/clientset/versioned"
+	imageregistryinformers "github.com/openshift/client-go/imageregistry/informers/externalversions"
+	regoplisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routeclient "github.com/openshift/client-go/route/clientset/versioned"
+	routeinformers "github.com/openshift/client-go/route/informers/externalversions"
+	routelisters "github.com/openshift/client-go/route/listers/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+// operatorMetricsPrefix is the prefix of the metrics exposed by the operator
+// that are kept in the support bundle.
+const operatorMetricsPrefix = "image_registry_operator_"
+
+// SupportBundleListers holds the listers the support bundle is gathered
+// from. The namespaced listers are scoped to the operator namespace.
+type SupportBundleListers struct {
+	RegistryConfigs      regoplisters.ConfigLister
+	ImagePruners         regoplisters.ImagePrunerLister
+	ClusterOperators     configlisters.ClusterOperatorLister
+	Deployments          kappslisters.DeploymentNamespaceLister
+	DaemonSets           kappslisters.DaemonSetNamespaceLister
+	Services             kcorelisters.ServiceNamespaceLister
+	Secrets              kcorelisters.SecretNamespaceLister
+	ConfigMaps           kcorelisters.ConfigMapNamespaceLister
+	ServiceAccounts      kcorelisters.ServiceAccountNamespaceLister
+	PodDisruptionBudgets kpolicylisters.PodDisruptionBudgetNamespaceLister
+	Routes               routelisters.RouteNamespaceLister
+	CronJobs             kbatchlisters.CronJobNamespaceLister
+}
+
+// NewSupportBundleListers starts the informers the operator uses for the
+// objects of the support bundle and returns their listers once the caches
+// are synced.
+func NewSupportBundleListers(ctx context.Context, kubeconfig *restclient.Config) (*SupportBundleListers, error) {
+	kubeClient, err := kubeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	configClient, err := configclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	imageregistryClient, err := imageregistryclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	routeClient, err := routeclient.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeInformers := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncDuration, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	configInformers := configinformers.NewSharedInformerFactory(configClient, defaultResyncDuration)
+	imageregistryInformers := imageregistryinformers.NewSharedInformerFactory(imageregistryClient, defaultResyncDuration)
+	routeInformers := routeinformers.NewSharedInformerFactoryWithOptions(routeClient, defaultResyncDuration, routeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+
+	listers := &SupportBundleListers{
+		RegistryConfigs:      imageregistryInformers.Imageregistry().V1().Configs().Lister(),
+		ImagePruners:         imageregistryInformers.Imageregistry().V1().ImagePruners().Lister(),
+		ClusterOperators:     configInformers.Config().V1().ClusterOperators().Lister(),
+		Deployments:          kubeInformers.Apps().V1().Deployments().Lister().Deployments(defaults.ImageRegistryOperatorNamespace),
+		DaemonSets:           kubeInformers.Apps().V1().DaemonSets().Lister().DaemonSets(defaults.ImageRegistryOperatorNamespace),
+		Services:             kubeInformers.Core().V1().Services().Lister().Services(defaults.ImageRegistryOperatorNamespace),
+		Secrets:              kubeInformers.Core().V1().Secrets().Lister().Secrets(defaults.ImageRegistryOperatorNamespace),
+		ConfigMaps:           kubeInformers.Core().V1().ConfigMaps().Lister().ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		ServiceAccounts:      kubeInformers.Core().V1().ServiceAccounts().Lister().ServiceAccounts(defaults.ImageRegistryOperatorNamespace),
+		PodDisruptionBudgets: kubeInformers.Policy().V1().PodDisruptionBudgets().Lister().PodDisruptionBudgets(defaults.ImageRegistryOperatorNamespace),
+		Routes:               routeInformers.Route().V1().Routes().Lister().Routes(defaults.ImageRegistryOperatorNamespace),
+		CronJobs:             kubeInformers.Batch().V1().CronJobs().Lister().CronJobs(defaults.ImageRegistryOperatorNamespace),
+	}
+
+	kubeInformers.Start(ctx.Done())
+	configInformers.Start(ctx.Done())
+	imageregistryInformers.Start(ctx.Done())
+	routeInformers.Start(ctx.Done())
+
+	synced := map[string]bool{}
+	for informer, ok := range kubeInformers.WaitForCacheSync(ctx.Done()) {
+		synced[informer.String()] = ok
+	}
+	for informer, ok := range configInformers.WaitForCacheSync(ctx.Done()) {
+		synced[informer.String()] = ok
+	}
+	for informer, ok := range imageregistryInformers.WaitForCacheSync(ctx.Done()) {
+		synced[informer.String()] = ok
+	}
+	for informer, ok := range routeInformers.WaitForCacheSync(ctx.Done()) {
+		synced[informer.String()] = ok
+	}
+	for informer, ok := range synced {
+		if !ok {
+			return nil, fmt.Errorf("unable to sync the cache of %s: %s", informer, ctx.Err())
+		}
+	}
+
+	return listers, nil
+}
+
+// SupportBundleCondition is a condition of the registry config, the image
+// pruner or the cluster operator in a common form.
+type SupportBundleCondition struct {
+	Source             string      `json:"source"`
+	Type               string      `json:"type"`
+	Status             string      `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// SupportBundle is the state of the operator gathered for support cases.
+type SupportBundle struct {
+	// Files maps the paths of the files in the bundle to their content.
+	Files map[string][]byte
+}
+
+// GatherSupportBundle collects the registry config, the image pruner, the
+// cluster operator, their conditions and the objects in the operator
+// namespace. The values of secrets, the HTTP secret of the registry and the
+// private keys of the routes are redacted. metrics is the text exposition of
+// the metrics served by the operator, only the metrics of the operator are
+// kept. It may be nil.
+func GatherSupportBundle(listers *SupportBundleListers, metrics []byte) (*SupportBundle, error) {
+	b := &SupportBundle{
+		Files: map[string][]byte{},
+	}
+	var conditions []SupportBundleCondition
+
+	cr, err := listers.RegistryConfigs.Get(defaults.ImageRegistryResourceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get the registry config: %s", err)
+	} else if err == nil {
+		cr = cr.DeepCopy()
+		if cr.Spec.HTTPSecret != "" {
+			cr.Spec.HTTPSecret = resource.RedactedValue
+		}
+		if err := b.addObject("config.yaml", cr, imageregistryv1.SchemeGroupVersion.WithKind("Config")); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, operatorConditions("Config", cr.Status.Conditions)...)
+	}
+
+	pruner, err := listers.ImagePruners.Get(defaults.ImageRegistryImagePrunerResourceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get the image pruner: %s", err)
+	} else if err == nil {
+		if err := b.addObject("imagepruner.yaml", pruner.DeepCopy(), imageregistryv1.SchemeGroupVersion.WithKind("ImagePruner")); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, operatorConditions("ImagePruner", pruner.Status.Conditions)...)
+	}
+
+	co, err := listers.ClusterOperators.Get(defaults.ImageRegistryClusterOperatorResourceName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get the cluster operator: %s", err)
+	} else if err == nil {
+		if err := b.addObject("clusteroperator.yaml", co.DeepCopy(), configv1.GroupVersion.WithKind("ClusterOperator")); err != nil {
+			return nil, err
+		}
+		for _, cond := range co.Status.Conditions {
+			conditions = append(conditions, SupportBundleCondition{
+				Source:             "ClusterOperator",
+				Type:               string(cond.Type),
+				Status:             string(cond.Status),
+				Reason:             cond.Reason,
+				Message:            cond.Message,
+				LastTransitionTime: cond.LastTransitionTime,
+			})
+		}
+	}
+
+	buf, err := yaml.Marshal(conditions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal the conditions: %s", err)
+	}
+	b.Files["conditions.yaml"] = buf
+
+	if err := b.addNamespacedObjects(listers); err != nil {
+		return nil, err
+	}
+
+	if metrics != nil {
+		b.Files["metrics.txt"] = operatorMetrics(metrics)
+	}
+
+	return b, nil
+}
+
+func (b *SupportBundle) addNamespacedObjects(listers *SupportBundleListers) error {
+	deployments, err := listers.Deployments.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range deployments {
+		o = o.DeepCopy()
+		redactContainersEnv(o.Spec.Template.Spec.Containers)
+		if err := b.addNamespacedObject("deployments", o, appsv1.SchemeGroupVersion.WithKind("Deployment")); err != nil {
+			return err
+		}
+	}
+
+	daemonSets, err := listers.DaemonSets.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range daemonSets {
+		if err := b.addNamespacedObject("daemonsets", o.DeepCopy(), appsv1.SchemeGroupVersion.WithKind("DaemonSet")); err != nil {
+			return err
+		}
+	}
+
+	services, err := listers.Services.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range services {
+		if err := b.addNamespacedObject("services", o.DeepCopy(), corev1.SchemeGroupVersion.WithKind("Service")); err != nil {
+			return err
+		}
+	}
+
+	secrets, err := listers.Secrets.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range secrets {
+		o = o.DeepCopy()
+		resource.RedactSecret(o)
+		if err := b.addNamespacedObject("secrets", o, corev1.SchemeGroupVersion.WithKind("Secret")); err != nil {
+			return err
+		}
+	}
+
+	configMaps, err := listers.ConfigMaps.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range configMaps {
+		if err := b.addNamespacedObject("configmaps", o.DeepCopy(), corev1.SchemeGroupVersion.WithKind("ConfigMap")); err != nil {
+			return err
+		}
+	}
+
+	serviceAccounts, err := listers.ServiceAccounts.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range serviceAccounts {
+		if err := b.addNamespacedObject("serviceaccounts", o.DeepCopy(), corev1.SchemeGroupVersion.WithKind("ServiceAccount")); err != nil {
+			return err
+		}
+	}
+
+	pdbs, err := listers.PodDisruptionBudgets.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range pdbs {
+		if err := b.addNamespacedObject("poddisruptionbudgets", o.DeepCopy(), policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget")); err != nil {
+			return err
+		}
+	}
+
+	routes, err := listers.Routes.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range routes {
+		o = o.DeepCopy()
+		if o.Spec.TLS != nil && o.Spec.TLS.Key != "" {
+			o.Spec.TLS.Key = resource.RedactedValue
+		}
+		if err := b.addNamespacedObject("routes", o, routev1.GroupVersion.WithKind("Route")); err != nil {
+			return err
+		}
+	}
+
+	cronJobs, err := listers.CronJobs.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, o := range cronJobs {
+		o = o.DeepCopy()
+		redactContainersEnv(o.Spec.JobTemplate.Spec.Template.Spec.Containers)
+		if err := b.addNamespacedObject("cronjobs", o, batchv1.SchemeGroupVersion.WithKind("CronJob")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *SupportBundle) addNamespacedObject(resourceName string, obj runtime.Object, gvk schema.GroupVersionKind) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	return b.addObject(filepath.Join("namespaces", accessor.GetNamespace(), resourceName, accessor.GetName()+".yaml"), obj, gvk)
+}
+
+// addObject adds obj to the bundle. obj is modified, it must not be shared
+// with an informer cache.
+func (b *SupportBundle) addObject(path string, obj runtime.Object, gvk schema.GroupVersionKind) error {
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	buf, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("unable to marshal %s: %s", path, err)
+	}
+	b.Files[path] = buf
+	return nil
+}
+
+// paths returns the paths of the files in the bundle in lexical order.
+func (b *SupportBundle) paths() []string {
+	var paths []string
+	for path := range b.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// WriteDir writes the files of the bundle into dir.
+func (b *SupportBundle) WriteDir(dir string) error {
+	for _, path := range b.paths() {
+		filename := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, b.Files[path], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the files of the bundle to w as a YAML stream, every document
+// starts with a comment with the path of the file. The metrics are emitted
+// as a literal block.
+func (b *SupportBundle) Write(w io.Writer) error {
+	for i, path := range b.paths() {
+		content := b.Files[path]
+		if filepath.Ext(path) != ".yaml" {
+			buf, err := yaml.Marshal(map[string]string{"content": string(content)})
+			if err != nil {
+				return fmt.Errorf("unable to marshal %s: %s", path, err)
+			}
+			content = buf
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n", path); err != nil {
+			return err
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func operatorConditions(source string, conds []operatorv1.OperatorCondition) []SupportBundleCondition {
+	var conditions []SupportBundleCondition
+	for _, cond := range conds {
+		conditions = append(conditions, SupportBundleCondition{
+			Source:             source,
+			Type:               cond.Type,
+			Status:             string(cond.Status),
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+			LastTransitionTime: cond.LastTransitionTime,
+		})
+	}
+	return conditions
+}
+
+// redactContainersEnv redacts the HTTP secret of the registry, the other
+// sensitive values are referenced from secrets.
+func redactContainersEnv(containers []corev1.Container) {
+	for i := range containers {
+		for j := range containers[i].Env {
+			if containers[i].Env[j].Name == "REGISTRY_HTTP_SECRET" && containers[i].Env[j].Value != "" {
+				containers[i].Env[j].Value = resource.RedactedValue
+			}
+		}
+	}
+}
+
+// operatorMetrics returns the samples and the metadata of the operator
+// metrics from a text exposition.
+func operatorMetrics(metrics []byte) []byte {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	for scanner.Scan() {
+		line := scanner.Text()
+		name := line
+		if strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			name = line[len("# HELP "):]
+		}
+		if strings.HasPrefix(name, operatorMetricsPrefix) {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
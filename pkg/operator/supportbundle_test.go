@@ -0,0 +1,280 @@
+package operator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kappslisters "k8s.io/client-go/listers/apps/v1"
+	kbatchlisters "k8s.io/client-go/listers/batch/v1"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
+	kpolicylisters "k8s.io/client-go/listers/policy/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	regoplisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routelisters "github.com/openshift/client-go/route/listers/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource"
+)
+
+func newTestSupportBundleListers(t *testing.T, objs ...interface{}) *SupportBundleListers {
+	t.Helper()
+
+	indexer := func() cache.Indexer {
+		return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	}
+	configs, pruners, clusterOperators := indexer(), indexer(), indexer()
+	deployments, daemonSets, services, secrets, configMaps := indexer(), indexer(), indexer(), indexer(), indexer()
+	serviceAccounts, pdbs, routes, cronJobs := indexer(), indexer(), indexer(), indexer()
+
+	for _, obj := range objs {
+		var err error
+		switch obj.(type) {
+		case *imageregistryv1.Config:
+			err = configs.Add(obj)
+		case *imageregistryv1.ImagePruner:
+			err = pruners.Add(obj)
+		case *configv1.ClusterOperator:
+			err = clusterOperators.Add(obj)
+		case *appsv1.Deployment:
+			err = deployments.Add(obj)
+		case *corev1.Secret:
+			err = secrets.Add(obj)
+		case *corev1.ConfigMap:
+			err = configMaps.Add(obj)
+		case *routev1.Route:
+			err = routes.Add(obj)
+		default:
+			t.Fatalf("unexpected object %T", obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ns := defaults.ImageRegistryOperatorNamespace
+	return &SupportBundleListers{
+		RegistryConfigs:      regoplisters.NewConfigLister(configs),
+		ImagePruners:         regoplisters.NewImagePrunerLister(pruners),
+		ClusterOperators:     configlisters.NewClusterOperatorLister(clusterOperators),
+		Deployments:          kappslisters.NewDeploymentLister(deployments).Deployments(ns),
+		DaemonSets:           kappslisters.NewDaemonSetLister(daemonSets).DaemonSets(ns),
+		Services:             kcorelisters.NewServiceLister(services).Services(ns),
+		Secrets:              kcorelisters.NewSecretLister(secrets).Secrets(ns),
+		ConfigMaps:           kcorelisters.NewConfigMapLister(configMaps).ConfigMaps(ns),
+		ServiceAccounts:      kcorelisters.NewServiceAccountLister(serviceAccounts).ServiceAccounts(ns),
+		PodDisruptionBudgets: kpolicylisters.NewPodDisruptionBudgetLister(pdbs).PodDisruptionBudgets(ns),
+		Routes:               routelisters.NewRouteLister(routes).Routes(ns),
+		CronJobs:             kbatchlisters.NewCronJobLister(cronJobs).CronJobs(ns),
+	}
+}
+
+func TestGatherSupportBundle(t *testing.T) {
+	ns := defaults.ImageRegistryOperatorNamespace
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			HTTPSecret: "http-secret",
+		},
+		Status: imageregistryv1.ImageRegistryStatus{
+			OperatorStatus: operatorv1.OperatorStatus{
+				Conditions: []operatorv1.OperatorCondition{
+					{Type: "Available", Status: operatorv1.ConditionTrue, Reason: "Ready"},
+				},
+			},
+		},
+	}
+	co := &configv1.ClusterOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryClusterOperatorResourceName,
+		},
+		Status: configv1.ClusterOperatorStatus{
+			Conditions: []configv1.ClusterOperatorStatusCondition{
+				{Type: configv1.OperatorDegraded, Status: configv1.ConditionFalse},
+			},
+		},
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryName,
+			Namespace: ns,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "registry",
+							Env: []corev1.EnvVar{
+								{Name: "REGISTRY_HTTP_SECRET", Value: "http-secret"},
+								{Name: "REGISTRY_STORAGE", Value: "s3"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfiguration,
+			Namespace: ns,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("access-key"),
+		},
+	}
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "public",
+			Namespace: ns,
+		},
+		Spec: routev1.RouteSpec{
+			TLS: &routev1.TLSConfig{
+				Certificate: "certificate",
+				Key:         "private-key",
+			},
+		},
+	}
+	metrics := []byte(`# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 42
+# HELP image_registry_operator_storage_reconfigured_total Total times the image registry's storage was reconfigured.
+# TYPE image_registry_operator_storage_reconfigured_total counter
+image_registry_operator_storage_reconfigured_total 3
+`)
+
+	listers := newTestSupportBundleListers(t, cr, co, deploy, secret, route)
+	bundle, err := GatherSupportBundle(listers, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPaths := []string{
+		"clusteroperator.yaml",
+		"conditions.yaml",
+		"config.yaml",
+		"metrics.txt",
+		"namespaces/openshift-image-registry/deployments/image-registry.yaml",
+		"namespaces/openshift-image-registry/routes/public.yaml",
+		"namespaces/openshift-image-registry/secrets/image-registry-private-configuration.yaml",
+	}
+	if got := bundle.paths(); strings.Join(got, ",") != strings.Join(expectedPaths, ",") {
+		t.Fatalf("expected files %v, got %v", expectedPaths, got)
+	}
+
+	for path, content := range bundle.Files {
+		for _, value := range []string{"http-secret", "access-key", "private-key"} {
+			if bytes.Contains(content, []byte(value)) {
+				t.Errorf("%s: expected %q to be redacted:\n%s", path, value, content)
+			}
+		}
+	}
+
+	gotConfig := &imageregistryv1.Config{}
+	if err := yaml.Unmarshal(bundle.Files["config.yaml"], gotConfig); err != nil {
+		t.Fatal(err)
+	}
+	if gotConfig.Kind != "Config" || gotConfig.Spec.HTTPSecret != resource.RedactedValue {
+		t.Errorf("unexpected config: %#v", gotConfig)
+	}
+	if cr.Spec.HTTPSecret != "http-secret" {
+		t.Errorf("the config from the lister has been modified")
+	}
+
+	gotDeploy := &appsv1.Deployment{}
+	if err := yaml.Unmarshal(bundle.Files["namespaces/openshift-image-registry/deployments/image-registry.yaml"], gotDeploy); err != nil {
+		t.Fatal(err)
+	}
+	if env := gotDeploy.Spec.Template.Spec.Containers[0].Env; env[1].Value != "s3" {
+		t.Errorf("expected the other environment variables to be kept, got %#v", env)
+	}
+
+	var conditions []SupportBundleCondition
+	if err := yaml.Unmarshal(bundle.Files["conditions.yaml"], &conditions); err != nil {
+		t.Fatal(err)
+	}
+	if len(conditions) != 2 ||
+		conditions[0].Source != "Config" || conditions[0].Type != "Available" || conditions[0].Status != "True" || conditions[0].Reason != "Ready" ||
+		conditions[1].Source != "ClusterOperator" || conditions[1].Type != "Degraded" || conditions[1].Status != "False" {
+		t.Errorf("unexpected conditions: %#v", conditions)
+	}
+
+	expectedMetrics := `# HELP image_registry_operator_storage_reconfigured_total Total times the image registry's storage was reconfigured.
+# TYPE image_registry_operator_storage_reconfigured_total counter
+image_registry_operator_storage_reconfigured_total 3
+`
+	if got := string(bundle.Files["metrics.txt"]); got != expectedMetrics {
+		t.Errorf("expected metrics:\n%s\ngot:\n%s", expectedMetrics, got)
+	}
+}
+
+func TestGatherSupportBundleWithoutConfig(t *testing.T) {
+	bundle, err := GatherSupportBundle(newTestSupportBundleListers(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bundle.paths(); len(got) != 1 || got[0] != "conditions.yaml" {
+		t.Errorf("expected only the conditions, got %v", got)
+	}
+}
+
+func TestSupportBundleWrite(t *testing.T) {
+	bundle := &SupportBundle{
+		Files: map[string][]byte{
+			"config.yaml": []byte("kind: Config\n"),
+			"metrics.txt": []byte("image_registry_operator_storage_reconfigured_total 3\n"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# config.yaml
+kind: Config
+---
+# metrics.txt
+content: |
+  image_registry_operator_storage_reconfigured_total 3
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	dir, err := ioutil.TempDir("", "supportbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle.Files["namespaces/openshift-image-registry/secrets/image-registry-tls.yaml"] = []byte("kind: Secret\n")
+	if err := bundle.WriteDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range bundle.Files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s: expected %q, got %q", path, content, got)
+		}
+	}
+}
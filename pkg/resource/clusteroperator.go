@@ -110,6 +110,49 @@ func unionCondition(unionConditionType string, normalStatus operatorv1.Condition
 	return unionCondition
 }
 
+// nonBlockingReasonPrefix prefixes the reasons of the Degraded conditions
+// that are not reported as degraded on the ClusterOperator.
+const nonBlockingReasonPrefix = "NonBlocking"
+
+// isNonBlockingDegraded returns true if the condition is a Degraded condition
+// the configuration allows to not block upgrades.
+func isNonBlockingDegraded(cr *imageregistryv1.Config, condition operatorv1.OperatorCondition) bool {
+	if !strings.HasSuffix(condition.Type, "Degraded") || condition.Status != operatorv1.ConditionTrue {
+		return false
+	}
+	switch condition.Reason {
+	case defaults.DegradedReasonVerificationFailed, defaults.DegradedReasonStorageNotConfigured, defaults.DegradedReasonInvalidTimeout:
+		return false
+	}
+	for _, reason := range cr.Spec.NonBlockingDegradedReasons {
+		if condition.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// reclassifyNonBlockingDegraded reports the Degraded conditions that don't
+// block upgrades as not degraded, their reason is prefixed with
+// nonBlockingReasonPrefix so that the failure remains visible.
+func reclassifyNonBlockingDegraded(cr *imageregistryv1.Config, conditions []operatorv1.OperatorCondition) []operatorv1.OperatorCondition {
+	out := make([]operatorv1.OperatorCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		if isNonBlockingDegraded(cr, condition) {
+			out = append(out, operatorv1.OperatorCondition{
+				Type:               condition.Type,
+				Status:             operatorv1.ConditionFalse,
+				LastTransitionTime: condition.LastTransitionTime,
+				Reason:             nonBlockingReasonPrefix + condition.Reason,
+				Message:            condition.Message,
+			})
+			continue
+		}
+		out = append(out, condition)
+	}
+	return out
+}
+
 var _ Mutator = &generatorClusterOperator{}
 
 type generatorClusterOperator struct {
@@ -217,6 +260,7 @@ func (gco *generatorClusterOperator) syncConditions(op *configv1.ClusterOperator
 	if gco.imagePruner != nil {
 		conditions = append(conditions, prefixConditions(gco.imagePruner.Status.Conditions, "ImagePruner")...)
 	}
+	conditions = reclassifyNonBlockingDegraded(gco.cr, conditions)
 
 	oldStatus := op.Status.DeepCopy()
 	configv1helpers.SetStatusCondition(&op.Status.Conditions, unionCondition("Available", operatorv1.ConditionTrue, conditions))
@@ -225,11 +269,11 @@ func (gco *generatorClusterOperator) syncConditions(op *configv1.ClusterOperator
 	return !equality.Semantic.DeepEqual(oldStatus, &op.Status)
 }
 
-// isDeploymentStatusAvailableAndUpdated returns true when at least one
+// IsDeploymentStatusAvailableAndUpdated returns true when at least one
 // replica instance exists and all replica instances are current,
 // there are no replica instances remaining from the previous deployment.
 // There may still be additional replica instances being created.
-func isDeploymentStatusAvailableAndUpdated(deploy *appsapi.Deployment) bool {
+func IsDeploymentStatusAvailableAndUpdated(deploy *appsapi.Deployment) bool {
 	return deploy.Status.AvailableReplicas > 0 &&
 		deploy.Status.ObservedGeneration >= deploy.Generation &&
 		deploy.Status.UpdatedReplicas == deploy.Status.Replicas
@@ -254,7 +298,7 @@ func (gco *generatorClusterOperator) syncVersions(op *configv1.ClusterOperator)
 			return false, err
 		}
 
-		if !isDeploymentStatusAvailableAndUpdated(deploy) {
+		if !IsDeploymentStatusAvailableAndUpdated(deploy) {
 			return false, nil
 		}
 
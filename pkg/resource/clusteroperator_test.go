@@ -278,3 +278,110 @@ func TestSyncVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestSyncConditionsNonBlockingDegraded(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		nonBlocking      []string
+		conditions       []operatorapi.OperatorCondition
+		pruner           []operatorapi.OperatorCondition
+		expectedDegraded cfgapi.ConditionStatus
+		expectedReason   string
+	}{
+		{
+			name: "degraded blocks upgrades by default",
+			conditions: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionTrue, Reason: "RouteDegraded"},
+				{Type: "Progressing", Status: operatorapi.ConditionFalse, Reason: "Ready"},
+			},
+			expectedDegraded: cfgapi.ConditionTrue,
+			expectedReason:   "RouteDegraded",
+		},
+		{
+			name:        "non-blocking reason",
+			nonBlocking: []string{"RouteDegraded"},
+			conditions: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionTrue, Reason: "RouteDegraded"},
+				{Type: "Progressing", Status: operatorapi.ConditionFalse, Reason: "Ready"},
+			},
+			expectedDegraded: cfgapi.ConditionFalse,
+			expectedReason:   "NonBlockingRouteDegraded",
+		},
+		{
+			name:        "other reasons keep blocking",
+			nonBlocking: []string{"RouteDegraded"},
+			conditions: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionTrue, Reason: "ProgressDeadlineExceeded"},
+				{Type: "Progressing", Status: operatorapi.ConditionFalse, Reason: "Ready"},
+			},
+			expectedDegraded: cfgapi.ConditionTrue,
+			expectedReason:   "ProgressDeadlineExceeded",
+		},
+		{
+			name:        "hard failures always block",
+			nonBlocking: []string{defaults.DegradedReasonStorageNotConfigured},
+			conditions: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionTrue, Reason: defaults.DegradedReasonStorageNotConfigured},
+				{Type: "Progressing", Status: operatorapi.ConditionFalse},
+			},
+			expectedDegraded: cfgapi.ConditionTrue,
+			expectedReason:   "StorageNotConfigured",
+		},
+		{
+			name:        "pruner job failure",
+			nonBlocking: []string{"JobFailed"},
+			conditions: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionFalse},
+				{Type: "Progressing", Status: operatorapi.ConditionFalse, Reason: "Ready"},
+			},
+			pruner: []operatorapi.OperatorCondition{
+				{Type: "Degraded", Status: operatorapi.ConditionTrue, Reason: "JobFailed"},
+			},
+			expectedDegraded: cfgapi.ConditionFalse,
+			expectedReason:   "ImagePrunerNonBlockingJobFailed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imregv1.Config{
+				Spec: imregv1.ImageRegistrySpec{
+					NonBlockingDegradedReasons: tt.nonBlocking,
+				},
+				Status: imregv1.ImageRegistryStatus{
+					OperatorStatus: operatorapi.OperatorStatus{
+						Conditions: tt.conditions,
+					},
+				},
+			}
+			var pruner *imregv1.ImagePruner
+			if tt.pruner != nil {
+				pruner = &imregv1.ImagePruner{
+					Status: imregv1.ImagePrunerStatus{
+						Conditions: tt.pruner,
+					},
+				}
+			}
+
+			gen := NewGeneratorClusterOperator(deployLister{}, nil, nil, cr, pruner, nil)
+			co := &cfgapi.ClusterOperator{}
+			gen.syncConditions(co)
+
+			found := false
+			for _, cond := range co.Status.Conditions {
+				switch cond.Type {
+				case cfgapi.OperatorDegraded:
+					found = true
+					if cond.Status != tt.expectedDegraded || cond.Reason != tt.expectedReason {
+						t.Errorf("expected Degraded to be %s (%s), got %s (%s)", tt.expectedDegraded, tt.expectedReason, cond.Status, cond.Reason)
+					}
+				case cfgapi.OperatorProgressing:
+					if cond.Status != cfgapi.ConditionFalse {
+						t.Errorf("expected Progressing to be False, got %s (%s)", cond.Status, cond.Reason)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s condition not found", cfgapi.OperatorDegraded)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package resource
+
+import (
+	"fmt"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// StorageConnectivityThresholds are the numbers of consecutive failed and
+// successful checks of the storage that are needed to mark the storage as
+// unreachable or reachable again. Thresholds lower than 1 are handled as 1.
+type StorageConnectivityThresholds struct {
+	Failures  int
+	Successes int
+}
+
+// DefaultStorageConnectivityThresholds tolerate a couple of transient
+// failures of the storage before the condition changes.
+var DefaultStorageConnectivityThresholds = StorageConnectivityThresholds{
+	Failures:  3,
+	Successes: 3,
+}
+
+// storageConnectivity adds hysteresis to the StorageConnectivity condition,
+// so that intermittent failures of the storage don't flip it on every sync.
+type storageConnectivity struct {
+	thresholds StorageConnectivityThresholds
+
+	// failures and successes are the numbers of consecutive failed and
+	// successful checks, at most one of them is non-zero.
+	failures  int
+	successes int
+
+	// flaps is how many times the result of the checks changed since the
+	// operator started.
+	flaps int
+}
+
+func newStorageConnectivity(thresholds StorageConnectivityThresholds) *storageConnectivity {
+	if thresholds.Failures < 1 {
+		thresholds.Failures = 1
+	}
+	if thresholds.Successes < 1 {
+		thresholds.Successes = 1
+	}
+	return &storageConnectivity{
+		thresholds: thresholds,
+	}
+}
+
+// observe records the result of a check of the storage and updates the
+// StorageConnectivity condition. The condition is set right away when it's not
+// there yet, otherwise its status changes only once the threshold of
+// consecutive results is reached. The message always reflects the latest
+// checks and the number of flaps.
+func (c *storageConnectivity) observe(cr *imageregistryv1.Config, err error) {
+	if err != nil {
+		if c.successes > 0 {
+			c.flaps++
+		}
+		c.successes = 0
+		c.failures++
+	} else {
+		if c.failures > 0 {
+			c.flaps++
+		}
+		c.failures = 0
+		c.successes++
+	}
+
+	reachable := err == nil
+	for _, cond := range cr.Status.Conditions {
+		if cond.Type != defaults.StorageConnectivity {
+			continue
+		}
+		switch {
+		case cond.Status == operatorapi.ConditionTrue && c.failures > 0 && c.failures < c.thresholds.Failures:
+			reachable = true
+		case cond.Status == operatorapi.ConditionFalse && c.successes > 0 && c.successes < c.thresholds.Successes:
+			reachable = false
+		}
+	}
+
+	flaps := fmt.Sprintf("%d flaps since the operator started", c.flaps)
+	switch {
+	case reachable && err == nil:
+		util.UpdateCondition(cr, defaults.StorageConnectivity, operatorapi.ConditionTrue, "StorageReachable", fmt.Sprintf("The storage is reachable (%s)", flaps))
+	case reachable:
+		util.UpdateCondition(cr, defaults.StorageConnectivity, operatorapi.ConditionTrue, "StorageReachable", fmt.Sprintf("The storage is reachable, %d of the %d consecutive failed checks needed to mark it unreachable happened (%s): %s", c.failures, c.thresholds.Failures, flaps, err))
+	case err != nil:
+		util.UpdateCondition(cr, defaults.StorageConnectivity, operatorapi.ConditionFalse, "StorageUnreachable", fmt.Sprintf("The storage is unreachable after %d consecutive failed checks (%s): %s", c.failures, flaps, err))
+	default:
+		util.UpdateCondition(cr, defaults.StorageConnectivity, operatorapi.ConditionFalse, "StorageUnreachable", fmt.Sprintf("The storage is unreachable, %d of the %d consecutive successful checks needed to mark it reachable happened (%s)", c.successes, c.thresholds.Successes, flaps))
+	}
+}
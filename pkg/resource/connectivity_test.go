@@ -0,0 +1,95 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestStorageConnectivityHysteresis(t *testing.T) {
+	errUnreachable := fmt.Errorf("dial tcp: i/o timeout")
+
+	type step struct {
+		err             error
+		expectedStatus  operatorv1.ConditionStatus
+		expectedMessage string
+	}
+	for _, tt := range []struct {
+		name       string
+		thresholds StorageConnectivityThresholds
+		steps      []step
+	}{
+		{
+			name:       "first check sets the condition",
+			thresholds: StorageConnectivityThresholds{Failures: 3, Successes: 3},
+			steps: []step{
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionFalse, expectedMessage: "after 1 consecutive failed checks (0 flaps"},
+			},
+		},
+		{
+			name:       "transient failures",
+			thresholds: StorageConnectivityThresholds{Failures: 3, Successes: 3},
+			steps: []step{
+				{expectedStatus: operatorv1.ConditionTrue, expectedMessage: "(0 flaps"},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionTrue, expectedMessage: "1 of the 3 consecutive failed checks"},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionTrue, expectedMessage: "2 of the 3 consecutive failed checks"},
+				{expectedStatus: operatorv1.ConditionTrue, expectedMessage: "(2 flaps"},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionTrue, expectedMessage: "(3 flaps"},
+				{expectedStatus: operatorv1.ConditionTrue, expectedMessage: "(4 flaps"},
+			},
+		},
+		{
+			name:       "outage and recovery",
+			thresholds: StorageConnectivityThresholds{Failures: 2, Successes: 3},
+			steps: []step{
+				{expectedStatus: operatorv1.ConditionTrue},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionTrue},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionFalse, expectedMessage: "after 2 consecutive failed checks (1 flaps since the operator started): dial tcp: i/o timeout"},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionFalse, expectedMessage: "after 3 consecutive failed checks"},
+				{expectedStatus: operatorv1.ConditionFalse, expectedMessage: "1 of the 3 consecutive successful checks"},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionFalse, expectedMessage: "(3 flaps"},
+				{expectedStatus: operatorv1.ConditionFalse},
+				{expectedStatus: operatorv1.ConditionFalse},
+				{expectedStatus: operatorv1.ConditionTrue, expectedMessage: "The storage is reachable (4 flaps since the operator started)"},
+			},
+		},
+		{
+			name:       "thresholds lower than one",
+			thresholds: StorageConnectivityThresholds{},
+			steps: []step{
+				{expectedStatus: operatorv1.ConditionTrue},
+				{err: errUnreachable, expectedStatus: operatorv1.ConditionFalse},
+				{expectedStatus: operatorv1.ConditionTrue},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			c := newStorageConnectivity(tt.thresholds)
+			for i, s := range tt.steps {
+				c.observe(cr, s.err)
+
+				var cond *operatorv1.OperatorCondition
+				for j := range cr.Status.Conditions {
+					if cr.Status.Conditions[j].Type == defaults.StorageConnectivity {
+						cond = &cr.Status.Conditions[j]
+					}
+				}
+				if cond == nil {
+					t.Fatalf("step %d: condition %s not found", i, defaults.StorageConnectivity)
+				}
+				if cond.Status != s.expectedStatus {
+					t.Errorf("step %d: got status %s, want %s", i, cond.Status, s.expectedStatus)
+				}
+				if !strings.Contains(cond.Message, s.expectedMessage) {
+					t.Errorf("step %d: got message %q, want it to contain %q", i, cond.Message, s.expectedMessage)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	credentialsRequestNamespace  = "openshift-cloud-credential-operator"
+	credentialsRequestAPIVersion = "cloudcredential.openshift.io/v1"
+)
+
+var (
+	credentialsRequestGVR = schema.GroupVersionResource{
+		Group:    "cloudcredential.openshift.io",
+		Version:  "v1",
+		Resource: "credentialsrequests",
+	}
+	cloudCredentialGVR = schema.GroupVersionResource{
+		Group:    "operator.openshift.io",
+		Version:  "v1",
+		Resource: "cloudcredentials",
+	}
+)
+
+var _ Mutator = &generatorCredentialsRequest{}
+
+// generatorCredentialsRequest manages the CredentialsRequest that makes the
+// cloud-credential-operator provision the storage credentials into the
+// installer-cloud-credentials secret. The names match the CredentialsRequests
+// shipped with the release payload, so the operator can take over them.
+type generatorCredentialsRequest struct {
+	client   dynamic.Interface
+	platform configv1.PlatformType
+}
+
+func newGeneratorCredentialsRequest(client dynamic.Interface, platform configv1.PlatformType) *generatorCredentialsRequest {
+	return &generatorCredentialsRequest{
+		client:   client,
+		platform: platform,
+	}
+}
+
+// credentialsRequestSupported returns true if the cloud-credential-operator
+// can provision storage credentials on the platform.
+func credentialsRequestSupported(platform configv1.PlatformType) bool {
+	return credentialsRequestProviderSpec(platform) != nil
+}
+
+// credentialsRequestProviderSpec returns the permissions the registry needs
+// on the platform, or nil if there are no credentials to request.
+func credentialsRequestProviderSpec(platform configv1.PlatformType) map[string]interface{} {
+	switch platform {
+	case configv1.AWSPlatformType:
+		return map[string]interface{}{
+			"apiVersion": credentialsRequestAPIVersion,
+			"kind":       "AWSProviderSpec",
+			"statementEntries": []interface{}{
+				map[string]interface{}{
+					"effect": "Allow",
+					"action": []interface{}{
+						"s3:CreateBucket",
+						"s3:DeleteBucket",
+						"s3:PutBucketTagging",
+						"s3:GetBucketTagging",
+						"s3:PutBucketPublicAccessBlock",
+						"s3:GetBucketPublicAccessBlock",
+						"s3:PutEncryptionConfiguration",
+						"s3:GetEncryptionConfiguration",
+						"s3:GetBucketPolicy",
+						"s3:PutLifecycleConfiguration",
+						"s3:GetLifecycleConfiguration",
+						"s3:PutBucketObjectLockConfiguration",
+						"s3:GetBucketObjectLockConfiguration",
+						"s3:PutBucketVersioning",
+						"s3:GetBucketLocation",
+						"s3:ListBucket",
+						"s3:GetObject",
+						"s3:PutObject",
+						"s3:DeleteObject",
+						"s3:ListBucketMultipartUploads",
+						"s3:AbortMultipartUpload",
+						"s3:ListMultipartUploadParts",
+						"cloudwatch:GetMetricStatistics",
+					},
+					"resource": "*",
+				},
+			},
+		}
+	case configv1.AzurePlatformType:
+		return map[string]interface{}{
+			"apiVersion": credentialsRequestAPIVersion,
+			"kind":       "AzureProviderSpec",
+			"roleBindings": []interface{}{
+				map[string]interface{}{
+					"role": "Contributor",
+				},
+			},
+		}
+	case configv1.GCPPlatformType:
+		return map[string]interface{}{
+			"apiVersion": credentialsRequestAPIVersion,
+			"kind":       "GCPProviderSpec",
+			"predefinedRoles": []interface{}{
+				"roles/storage.admin",
+				"roles/iam.serviceAccountUser",
+			},
+			"skipServiceCheck": true,
+		}
+	case configv1.OpenStackPlatformType:
+		return map[string]interface{}{
+			"apiVersion": credentialsRequestAPIVersion,
+			"kind":       "OpenStackProviderSpec",
+		}
+	}
+	return nil
+}
+
+func (gcr *generatorCredentialsRequest) Type() runtime.Object {
+	return &unstructured.Unstructured{}
+}
+
+func (gcr *generatorCredentialsRequest) GetNamespace() string {
+	return credentialsRequestNamespace
+}
+
+func (gcr *generatorCredentialsRequest) GetName() string {
+	switch gcr.platform {
+	case configv1.AzurePlatformType:
+		return "openshift-image-registry-azure"
+	case configv1.GCPPlatformType:
+		return "openshift-image-registry-gcs"
+	case configv1.OpenStackPlatformType:
+		return "openshift-image-registry-openstack"
+	}
+	return "openshift-image-registry"
+}
+
+func (gcr *generatorCredentialsRequest) expected() (runtime.Object, error) {
+	providerSpec := credentialsRequestProviderSpec(gcr.platform)
+	if providerSpec == nil {
+		return nil, fmt.Errorf("credentials requests are not supported on platform %q", gcr.platform)
+	}
+
+	cr := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": credentialsRequestAPIVersion,
+			"kind":       "CredentialsRequest",
+			"metadata": map[string]interface{}{
+				"name":      gcr.GetName(),
+				"namespace": gcr.GetNamespace(),
+			},
+			"spec": map[string]interface{}{
+				"secretRef": map[string]interface{}{
+					"name":      defaults.CloudCredentialsName,
+					"namespace": defaults.ImageRegistryOperatorNamespace,
+				},
+				"providerSpec": providerSpec,
+				"serviceAccountNames": []interface{}{
+					"cluster-image-registry-operator",
+					defaults.ServiceAccountName,
+				},
+			},
+		},
+	}
+
+	dgst, err := strategy.Checksum(cr.Object["spec"])
+	if err != nil {
+		return nil, err
+	}
+	cr.SetAnnotations(map[string]string{
+		defaults.ChecksumOperatorAnnotation: dgst,
+	})
+
+	return cr, nil
+}
+
+func (gcr *generatorCredentialsRequest) Get() (runtime.Object, error) {
+	return gcr.client.Resource(credentialsRequestGVR).Namespace(gcr.GetNamespace()).Get(
+		context.TODO(), gcr.GetName(), metav1.GetOptions{},
+	)
+}
+
+func (gcr *generatorCredentialsRequest) Create() (runtime.Object, error) {
+	n, err := gcr.expected()
+	if err != nil {
+		return n, err
+	}
+	return gcr.client.Resource(credentialsRequestGVR).Namespace(gcr.GetNamespace()).Create(
+		context.TODO(), n.(*unstructured.Unstructured), metav1.CreateOptions{},
+	)
+}
+
+// Update replaces the spec of the CredentialsRequest when it doesn't match
+// the expected one. strategy.Override cannot be used here as it only knows
+// how to handle typed objects.
+func (gcr *generatorCredentialsRequest) Update(o runtime.Object) (runtime.Object, bool, error) {
+	n, err := gcr.expected()
+	if err != nil {
+		return o, false, err
+	}
+
+	current := o.(*unstructured.Unstructured)
+	expected := n.(*unstructured.Unstructured)
+
+	dgst := expected.GetAnnotations()[defaults.ChecksumOperatorAnnotation]
+	if current.GetAnnotations()[defaults.ChecksumOperatorAnnotation] == dgst {
+		return o, false, nil
+	}
+
+	annotations := current.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[defaults.ChecksumOperatorAnnotation] = dgst
+	current.SetAnnotations(annotations)
+	current.Object["spec"] = expected.Object["spec"]
+
+	u, err := gcr.client.Resource(credentialsRequestGVR).Namespace(gcr.GetNamespace()).Update(
+		context.TODO(), current, metav1.UpdateOptions{},
+	)
+	return u, true, err
+}
+
+func (gcr *generatorCredentialsRequest) Delete(opts metav1.DeleteOptions) error {
+	return gcr.client.Resource(credentialsRequestGVR).Namespace(gcr.GetNamespace()).Delete(
+		context.TODO(), gcr.GetName(), opts,
+	)
+}
+
+func (gcr *generatorCredentialsRequest) Owned() bool {
+	return true
+}
+
+// credentialsMode returns the mode the cloud-credential-operator is
+// configured to run in.
+func credentialsMode(dynamicClient dynamic.Interface) (operatorv1.CloudCredentialsMode, error) {
+	cc, err := dynamicClient.Resource(cloudCredentialGVR).Get(
+		context.TODO(), "cluster", metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return operatorv1.CloudCredentialsModeDefault, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	mode, _, err := unstructured.NestedString(cc.Object, "spec", "credentialsMode")
+	if err != nil {
+		return "", err
+	}
+	return operatorv1.CloudCredentialsMode(mode), nil
+}
+
+// updateCredentialsCondition reports whether the credentials requested from
+// the cloud-credential-operator have been provisioned.
+func updateCredentialsCondition(cr *imageregistryv1.Config, mode operatorv1.CloudCredentialsMode, secretExists bool) {
+	switch {
+	case secretExists && mode == operatorv1.CloudCredentialsModeManual:
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionTrue, "Manual", fmt.Sprintf("Secret %s has been provided by the administrator", defaults.CloudCredentialsName))
+	case secretExists:
+		reason := string(mode)
+		if reason == "" {
+			reason = "Provisioned"
+		}
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionTrue, reason, fmt.Sprintf("Secret %s has been provisioned by the cloud-credential-operator", defaults.CloudCredentialsName))
+	case mode == operatorv1.CloudCredentialsModeManual:
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionFalse, "Manual", fmt.Sprintf("The cloud-credential-operator runs in manual mode, secret %s must be created by the administrator", defaults.CloudCredentialsName))
+	default:
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionFalse, "Pending", fmt.Sprintf("Waiting for the cloud-credential-operator to provision secret %s", defaults.CloudCredentialsName))
+	}
+}
+
+// syncCredentialsRequest makes sure the cloud-credential-operator is asked
+// for the storage credentials, if the operator is configured to do so, and
+// reports their state.
+func (g *Generator) syncCredentialsRequest(cr *imageregistryv1.Config) error {
+	if !client.ManageCredentialsRequest() {
+		return nil
+	}
+
+	// With Workload Identity the storage is accessed without the
+	// credentials of the cloud-credential-operator, they aren't requested.
+	if gcs := cr.Spec.Storage.GCS; gcs != nil && len(gcs.WorkloadIdentityServiceAccount) != 0 {
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionTrue, "WorkloadIdentity", fmt.Sprintf("Authenticating via Workload Identity as the service account %s", gcs.WorkloadIdentityServiceAccount))
+		return nil
+	}
+
+	infra, err := util.GetInfrastructure(g.listers)
+	if err != nil {
+		return err
+	}
+	if infra.Status.PlatformStatus == nil || !credentialsRequestSupported(infra.Status.PlatformStatus.Type) {
+		return nil
+	}
+
+	mode, err := credentialsMode(g.clients.Dynamic)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return fmt.Errorf("unable to get the cloud credentials mode: %s", err)
+	}
+
+	// In manual mode the cloud-credential-operator ignores
+	// CredentialsRequests, the administrator provides the secret.
+	if mode != operatorv1.CloudCredentialsModeManual {
+		if err := ApplyMutator(newGeneratorCredentialsRequest(g.clients.Dynamic, infra.Status.PlatformStatus.Type)); err != nil {
+			util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionFalse, "Unknown Error Occurred", err.Error())
+			return err
+		}
+	} else {
+		klog.V(4).Infof("cloud credentials are in manual mode, not creating the credentials request")
+	}
+
+	_, err = g.listers.Secrets.Get(defaults.CloudCredentialsName)
+	if err != nil && !errors.IsNotFound(err) {
+		util.UpdateCondition(cr, defaults.StorageCredentialsProvisioned, operatorv1.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+	updateCredentialsCondition(cr, mode, err == nil)
+
+	return nil
+}
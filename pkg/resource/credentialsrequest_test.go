@@ -0,0 +1,269 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestCredentialsRequestGeneration(t *testing.T) {
+	for _, tt := range []struct {
+		platform configv1.PlatformType
+		name     string
+		kind     string
+	}{
+		{
+			platform: configv1.AWSPlatformType,
+			name:     "openshift-image-registry",
+			kind:     "AWSProviderSpec",
+		},
+		{
+			platform: configv1.AzurePlatformType,
+			name:     "openshift-image-registry-azure",
+			kind:     "AzureProviderSpec",
+		},
+		{
+			platform: configv1.GCPPlatformType,
+			name:     "openshift-image-registry-gcs",
+			kind:     "GCPProviderSpec",
+		},
+		{
+			platform: configv1.OpenStackPlatformType,
+			name:     "openshift-image-registry-openstack",
+			kind:     "OpenStackProviderSpec",
+		},
+	} {
+		t.Run(string(tt.platform), func(t *testing.T) {
+			if !credentialsRequestSupported(tt.platform) {
+				t.Fatalf("expected credentials requests to be supported on %s", tt.platform)
+			}
+
+			o, err := newGeneratorCredentialsRequest(nil, tt.platform).expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr := o.(*unstructured.Unstructured)
+
+			if cr.GetKind() != "CredentialsRequest" {
+				t.Errorf("unexpected kind %q", cr.GetKind())
+			}
+			if cr.GetName() != tt.name || cr.GetNamespace() != credentialsRequestNamespace {
+				t.Errorf("unexpected name %s/%s", cr.GetNamespace(), cr.GetName())
+			}
+			if cr.GetAnnotations()[defaults.ChecksumOperatorAnnotation] == "" {
+				t.Errorf("expected checksum annotation to be set")
+			}
+
+			kind, _, _ := unstructured.NestedString(cr.Object, "spec", "providerSpec", "kind")
+			if kind != tt.kind {
+				t.Errorf("provider spec kind: got %q, want %q", kind, tt.kind)
+			}
+
+			secretName, _, _ := unstructured.NestedString(cr.Object, "spec", "secretRef", "name")
+			secretNamespace, _, _ := unstructured.NestedString(cr.Object, "spec", "secretRef", "namespace")
+			if secretName != defaults.CloudCredentialsName || secretNamespace != defaults.ImageRegistryOperatorNamespace {
+				t.Errorf("unexpected secret reference %s/%s", secretNamespace, secretName)
+			}
+
+			serviceAccounts, _, _ := unstructured.NestedStringSlice(cr.Object, "spec", "serviceAccountNames")
+			if len(serviceAccounts) != 2 || serviceAccounts[1] != defaults.ServiceAccountName {
+				t.Errorf("unexpected service accounts %v", serviceAccounts)
+			}
+		})
+	}
+}
+
+// TestCredentialsRequestManifests keeps the CredentialsRequests the operator
+// creates in sync with the ones shipped with the release payload.
+func TestCredentialsRequestManifests(t *testing.T) {
+	for _, tt := range []struct {
+		platform configv1.PlatformType
+		manifest string
+	}{
+		{
+			platform: configv1.AWSPlatformType,
+			manifest: "01-registry-credentials-request.yaml",
+		},
+		{
+			platform: configv1.AzurePlatformType,
+			manifest: "01-registry-credentials-request-azure.yaml",
+		},
+		{
+			platform: configv1.GCPPlatformType,
+			manifest: "01-registry-credentials-request-gcs.yaml",
+		},
+		{
+			platform: configv1.OpenStackPlatformType,
+			manifest: "01-registry-credentials-request-openstack.yaml",
+		},
+	} {
+		t.Run(string(tt.platform), func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "manifests", tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifest := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(data, &manifest.Object); err != nil {
+				t.Fatal(err)
+			}
+
+			o, err := newGeneratorCredentialsRequest(nil, tt.platform).expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cr := o.(*unstructured.Unstructured)
+
+			if cr.GetName() != manifest.GetName() || cr.GetNamespace() != manifest.GetNamespace() {
+				t.Errorf("got %s/%s, want %s/%s", cr.GetNamespace(), cr.GetName(), manifest.GetNamespace(), manifest.GetName())
+			}
+			if diff := cmp.Diff(manifest.Object["spec"], cr.Object["spec"]); diff != "" {
+				t.Errorf("the spec differs from %s (-manifest +generated):\n%s", tt.manifest, diff)
+			}
+		})
+	}
+}
+
+func TestCredentialsRequestUnsupportedPlatform(t *testing.T) {
+	for _, platform := range []configv1.PlatformType{
+		configv1.BareMetalPlatformType,
+		configv1.NonePlatformType,
+		configv1.VSpherePlatformType,
+	} {
+		if credentialsRequestSupported(platform) {
+			t.Errorf("expected credentials requests not to be supported on %s", platform)
+		}
+		if _, err := newGeneratorCredentialsRequest(nil, platform).expected(); err == nil {
+			t.Errorf("%s: expected an error", platform)
+		}
+	}
+}
+
+func TestCredentialsRequestUpToDate(t *testing.T) {
+	gen := newGeneratorCredentialsRequest(nil, configv1.AWSPlatformType)
+	o, err := gen.expected()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, updated, err := gen.Update(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Errorf("expected the credentials request not to be updated")
+	}
+}
+
+func TestUpdateCredentialsCondition(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		mode           operatorv1.CloudCredentialsMode
+		secretExists   bool
+		expectedStatus operatorv1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "default mode, provisioned",
+			mode:           operatorv1.CloudCredentialsModeDefault,
+			secretExists:   true,
+			expectedStatus: operatorv1.ConditionTrue,
+			expectedReason: "Provisioned",
+		},
+		{
+			name:           "mint mode, provisioned",
+			mode:           operatorv1.CloudCredentialsModeMint,
+			secretExists:   true,
+			expectedStatus: operatorv1.ConditionTrue,
+			expectedReason: "Mint",
+		},
+		{
+			name:           "passthrough mode, provisioned",
+			mode:           operatorv1.CloudCredentialsModePassthrough,
+			secretExists:   true,
+			expectedStatus: operatorv1.ConditionTrue,
+			expectedReason: "Passthrough",
+		},
+		{
+			name:           "mint mode, pending",
+			mode:           operatorv1.CloudCredentialsModeMint,
+			expectedStatus: operatorv1.ConditionFalse,
+			expectedReason: "Pending",
+		},
+		{
+			name:           "manual mode, provided",
+			mode:           operatorv1.CloudCredentialsModeManual,
+			secretExists:   true,
+			expectedStatus: operatorv1.ConditionTrue,
+			expectedReason: "Manual",
+		},
+		{
+			name:           "manual mode, missing",
+			mode:           operatorv1.CloudCredentialsModeManual,
+			expectedStatus: operatorv1.ConditionFalse,
+			expectedReason: "Manual",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+			updateCredentialsCondition(cr, tt.mode, tt.secretExists)
+
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageCredentialsProvisioned {
+					continue
+				}
+				if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+					t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+				}
+				return
+			}
+			t.Errorf("%s condition not found", defaults.StorageCredentialsProvisioned)
+		})
+	}
+}
+
+func TestSyncCredentialsRequestWorkloadIdentity(t *testing.T) {
+	os.Setenv(client.ManageCredentialsRequestEnvVar, "true")
+	defer os.Unsetenv(client.ManageCredentialsRequestEnvVar)
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					WorkloadIdentityServiceAccount: "registry@my-project.iam.gserviceaccount.com",
+				},
+			},
+		},
+	}
+
+	// The credentials aren't requested, the generator has no client to
+	// request them with.
+	if err := (&Generator{}).syncCredentialsRequest(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cond := range cr.Status.Conditions {
+		if cond.Type != defaults.StorageCredentialsProvisioned {
+			continue
+		}
+		if cond.Status != operatorv1.ConditionTrue || cond.Reason != "WorkloadIdentity" {
+			t.Errorf("expected %s/%s, got %s/%s", operatorv1.ConditionTrue, "WorkloadIdentity", cond.Status, cond.Reason)
+		}
+		if expected := "Authenticating via Workload Identity as the service account registry@my-project.iam.gserviceaccount.com"; cond.Message != expected {
+			t.Errorf("expected the message %q, got %q", expected, cond.Message)
+		}
+		return
+	}
+	t.Errorf("%s condition not found", defaults.StorageCredentialsProvisioned)
+}
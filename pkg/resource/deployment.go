@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 
 	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -13,6 +16,7 @@ import (
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -24,6 +28,7 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 var _ Mutator = &generatorDeployment{}
@@ -94,6 +99,12 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 	}
 	podTemplateSpec.Annotations[defaults.ChecksumOperatorDepsAnnotation] = depsChecksum
 
+	storageChecksum, err := storageSecretChecksum(gd.driver)
+	if err != nil {
+		return nil, err
+	}
+	podTemplateSpec.Annotations[defaults.ChecksumStorageSecretAnnotation] = storageChecksum
+
 	var rollingUpdate *appsapi.RollingUpdateDeployment
 	if gd.cr.Spec.Replicas == 2 {
 		maxUnavailable := intstr.Parse("1")
@@ -120,8 +131,12 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 			},
 		},
 		Spec: appsapi.DeploymentSpec{
-			ProgressDeadlineSeconds: pointer.Int32Ptr(60),
+			// The progress deadline has to be greater than
+			// minReadySeconds, extend it so that the warm up time
+			// doesn't count against it.
+			ProgressDeadlineSeconds: pointer.Int32Ptr(60 + gd.cr.Spec.MinReadySeconds),
 			Replicas:                &gd.cr.Spec.Replicas,
+			MinReadySeconds:         gd.cr.Spec.MinReadySeconds,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: defaults.DeploymentLabels,
 			},
@@ -142,6 +157,112 @@ func (gd *generatorDeployment) expected() (runtime.Object, error) {
 	return deploy, nil
 }
 
+// isExternallyScaled returns true when the replicas of the deployment are
+// managed by an autoscaler, either a HorizontalPodAutoscaler owning the
+// deployment or one declared with the ExternallyScaledAnnotation.
+func isExternallyScaled(deploy *appsapi.Deployment) bool {
+	if deploy.Annotations[defaults.ExternallyScaledAnnotation] == "true" {
+		return true
+	}
+	for _, ref := range deploy.OwnerReferences {
+		if ref.Kind == "HorizontalPodAutoscaler" && strings.HasPrefix(ref.APIVersion, "autoscaling/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ownershipConflict returns why the existing deployment is claimed by
+// another controller, or an empty string when the operator owns it. The
+// deployment is claimed when it has a controller owner reference, the
+// HorizontalPodAutoscalers aside, or when the labels the operator selects
+// the pods with are set to other values.
+func ownershipConflict(deploy *appsapi.Deployment) string {
+	for _, ref := range deploy.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		if ref.Kind == "HorizontalPodAutoscaler" && strings.HasPrefix(ref.APIVersion, "autoscaling/") {
+			continue
+		}
+		return fmt.Sprintf("the deployment is controlled by %s %s (%s)", ref.Kind, ref.Name, ref.APIVersion)
+	}
+	for key, value := range defaults.DeploymentLabels {
+		if current, ok := deploy.Labels[key]; ok && current != value {
+			return fmt.Sprintf("the label %s of the deployment is set to %q instead of %q", key, current, value)
+		}
+	}
+	return ""
+}
+
+// keepExternalReplicas makes the replicas of the existing deployment
+// authoritative when it is scaled by an autoscaler, so that the operator
+// doesn't fight it. The operator checksum still depends on the replicas of
+// the registry config, scaling the deployment doesn't count as a change of
+// the configuration.
+func keepExternalReplicas(existing, required *appsapi.Deployment) {
+	if !isExternallyScaled(existing) || existing.Spec.Replicas == nil {
+		return
+	}
+	required.Spec.Replicas = pointer.Int32Ptr(*existing.Spec.Replicas)
+}
+
+// storageEnv returns the environment variables of the registry container
+// that configure the storage.
+func storageEnv(deploy *appsapi.Deployment) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		for _, e := range c.Env {
+			if strings.HasPrefix(e.Name, "REGISTRY_STORAGE") {
+				env = append(env, e)
+			}
+		}
+	}
+	return env
+}
+
+// changeCause summarizes the changes the operator makes when it updates the
+// existing deployment to the required one.
+func changeCause(existing, required *appsapi.Deployment) string {
+	var causes []string
+	if !reflect.DeepEqual(existing.Spec.Replicas, required.Spec.Replicas) {
+		causes = append(causes, "replicas changed")
+	}
+	if !reflect.DeepEqual(storageEnv(existing), storageEnv(required)) ||
+		existing.Spec.Template.Annotations[defaults.ChecksumStorageSecretAnnotation] != required.Spec.Template.Annotations[defaults.ChecksumStorageSecretAnnotation] {
+		causes = append(causes, "storage config changed")
+	}
+	if existing.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation] != required.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation] {
+		causes = append(causes, "dependencies changed")
+	}
+	if len(existing.Spec.Template.Spec.Containers) == 0 ||
+		existing.Spec.Template.Spec.Containers[0].Image != required.Spec.Template.Spec.Containers[0].Image {
+		causes = append(causes, "image changed")
+	}
+	if len(causes) == 0 {
+		return "registry config changed"
+	}
+	return strings.Join(causes, ", ")
+}
+
+// setChangeCause sets the change-cause annotation of the required
+// deployment. The annotation of the existing deployment is kept as long as
+// the operator doesn't change the deployment, so that reconciling it
+// doesn't cause extra updates.
+func setChangeCause(existing, required *appsapi.Deployment) {
+	if existing == nil {
+		required.Annotations[defaults.ChangeCauseAnnotation] = "deployment created"
+		return
+	}
+	if existing.Annotations[defaults.ChecksumOperatorAnnotation] == required.Annotations[defaults.ChecksumOperatorAnnotation] {
+		if cause, ok := existing.Annotations[defaults.ChangeCauseAnnotation]; ok {
+			required.Annotations[defaults.ChangeCauseAnnotation] = cause
+		}
+		return
+	}
+	required.Annotations[defaults.ChangeCauseAnnotation] = changeCause(existing, required)
+}
+
 func (gd *generatorDeployment) Get() (runtime.Object, error) {
 	return gd.lister.Get(gd.GetName())
 }
@@ -151,6 +272,7 @@ func (gd *generatorDeployment) Create() (runtime.Object, error) {
 	if err != nil {
 		return nil, err
 	}
+	setChangeCause(nil, exp.(*appsapi.Deployment))
 
 	dep, _, err := resourceapply.ApplyDeployment(
 		gd.client, gd.recorder, exp.(*appsapi.Deployment), -1,
@@ -164,10 +286,21 @@ func (gd *generatorDeployment) Create() (runtime.Object, error) {
 }
 
 func (gd *generatorDeployment) Update(o runtime.Object) (runtime.Object, bool, error) {
+	// Updating a deployment claimed by another controller would make them
+	// fight over it, it is left alone until the conflict is resolved.
+	if conflict := ownershipConflict(o.(*appsapi.Deployment)); conflict != "" {
+		klog.Warningf("the registry deployment is not reconciled: %s", conflict)
+		util.UpdateCondition(gd.cr, defaults.DeploymentOwnershipConflict, operatorv1.ConditionTrue, "OwnershipConflict", fmt.Sprintf("The deployment is not reconciled until the conflict is resolved: %s", conflict))
+		return o, false, nil
+	}
+	util.UpdateCondition(gd.cr, defaults.DeploymentOwnershipConflict, operatorv1.ConditionFalse, "AsExpected", "")
+
 	exp, err := gd.expected()
 	if err != nil {
 		return o, false, err
 	}
+	keepExternalReplicas(o.(*appsapi.Deployment), exp.(*appsapi.Deployment))
+	setChangeCause(o.(*appsapi.Deployment), exp.(*appsapi.Deployment))
 
 	dep, updated, err := resourceapply.ApplyDeployment(
 		gd.client, gd.recorder, exp.(*appsapi.Deployment), gd.LastGeneration(),
@@ -3,6 +3,7 @@ package resource
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,11 +15,15 @@ import (
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/pointer"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 	fakeconfig "github.com/openshift/client-go/config/clientset/versioned/fake"
 	configinformers "github.com/openshift/client-go/config/informers/externalversions"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
 )
@@ -154,6 +159,577 @@ func TestChecksum(t *testing.T) {
 	}
 }
 
+type storageSecretTestDriver struct {
+	testDriver
+	accessKey string
+}
+
+func (d *storageSecretTestDriver) ConfigEnv() (envvar.List, error) {
+	return envvar.List{
+		{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", Value: d.accessKey, Secret: true},
+	}, nil
+}
+
+func TestStorageSecretChecksum(t *testing.T) {
+	annotatedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}
+	fixture := cirofake.NewFixturesBuilder().AddNamespaces(annotatedNamespace).Build()
+
+	generate := func(accessKey string) *appsapi.Deployment {
+		gd := &generatorDeployment{
+			driver:          &storageSecretTestDriver{accessKey: accessKey},
+			coreClient:      fixture.KubeClient.CoreV1(),
+			proxyLister:     fixture.Listers.ProxyConfigs,
+			cr:              &imageregistryv1.Config{},
+			configMapLister: fixture.Listers.ConfigMaps,
+			secretLister:    fixture.Listers.Secrets,
+		}
+		obj, err := gd.expected()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return obj.(*appsapi.Deployment)
+	}
+
+	orig := generate("access")
+	origChecksum := orig.Spec.Template.Annotations[defaults.ChecksumStorageSecretAnnotation]
+	if origChecksum == "" {
+		t.Fatalf("expected the pod template to have the %s annotation", defaults.ChecksumStorageSecretAnnotation)
+	}
+
+	same := generate("access")
+	if checksum := same.Spec.Template.Annotations[defaults.ChecksumStorageSecretAnnotation]; checksum != origChecksum {
+		t.Errorf("checksum unexpectedly changed from %s to %s", origChecksum, checksum)
+	}
+
+	// The secret in the lister is never updated, the new checksum has to
+	// come from the data the secret is expected to hold.
+	updated := generate("rotated")
+	if checksum := updated.Spec.Template.Annotations[defaults.ChecksumStorageSecretAnnotation]; checksum == origChecksum {
+		t.Errorf("checksum unexpectedly didn't change from %s", origChecksum)
+	}
+	if orig.Annotations[defaults.ChecksumOperatorAnnotation] == updated.Annotations[defaults.ChecksumOperatorAnnotation] {
+		t.Errorf("expected the deployment to be rolled out after the storage secret change")
+	}
+}
+
+func TestDependenciesChecksumCABundle(t *testing.T) {
+	annotatedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}
+
+	generate := func(trustedCA string) *appsapi.Deployment {
+		fixture := cirofake.NewFixturesBuilder().AddNamespaces(annotatedNamespace).AddConfigMaps(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryCertificatesName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string]string{
+					"image-registry.openshift-image-registry.svc..5000": "service ca",
+				},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.TrustedCAName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string]string{
+					"ca-bundle.crt": trustedCA,
+				},
+			},
+		).Build()
+
+		gd := &generatorDeployment{
+			driver:          &testDriver{},
+			coreClient:      fixture.KubeClient.CoreV1(),
+			proxyLister:     fixture.Listers.ProxyConfigs,
+			cr:              &imageregistryv1.Config{},
+			configMapLister: fixture.Listers.ConfigMaps,
+			secretLister:    fixture.Listers.Secrets,
+		}
+		obj, err := gd.expected()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		return obj.(*appsapi.Deployment)
+	}
+
+	existing := generate("original bundle")
+	if existing.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation] == "" {
+		t.Fatalf("expected the pod template to have the %s annotation", defaults.ChecksumOperatorDepsAnnotation)
+	}
+
+	same := generate("original bundle")
+	if same.Annotations[defaults.ChecksumOperatorAnnotation] != existing.Annotations[defaults.ChecksumOperatorAnnotation] {
+		t.Errorf("expected the deployment not to be rolled out when the CA bundle doesn't change")
+	}
+
+	rotated := generate("rotated bundle")
+	if rotated.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation] == existing.Spec.Template.Annotations[defaults.ChecksumOperatorDepsAnnotation] {
+		t.Errorf("expected the dependencies checksum to change after the rotation")
+	}
+	if rotated.Annotations[defaults.ChecksumOperatorAnnotation] == existing.Annotations[defaults.ChecksumOperatorAnnotation] {
+		t.Errorf("expected the deployment to be rolled out after the CA bundle rotation")
+	}
+
+	setChangeCause(existing, rotated)
+	if cause := rotated.Annotations[defaults.ChangeCauseAnnotation]; !strings.Contains(cause, "dependencies changed") {
+		t.Errorf("expected the change cause to mention the dependencies, got %q", cause)
+	}
+}
+
+func TestMinReadySeconds(t *testing.T) {
+	annotatedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}
+	fixture := cirofake.NewFixturesBuilder().AddNamespaces(annotatedNamespace).Build()
+
+	for _, tt := range []struct {
+		name             string
+		minReadySeconds  int32
+		progressDeadline int32
+	}{
+		{
+			name:             "default",
+			progressDeadline: 60,
+		},
+		{
+			name:             "warm up",
+			minReadySeconds:  90,
+			progressDeadline: 150,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gd := &generatorDeployment{
+				driver:      &testDriver{},
+				coreClient:  fixture.KubeClient.CoreV1(),
+				proxyLister: fixture.Listers.ProxyConfigs,
+				cr: &imageregistryv1.Config{
+					Spec: imageregistryv1.ImageRegistrySpec{
+						MinReadySeconds: tt.minReadySeconds,
+					},
+				},
+				configMapLister: fixture.Listers.ConfigMaps,
+				secretLister:    fixture.Listers.Secrets,
+			}
+			obj, err := gd.expected()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			deploy := obj.(*appsapi.Deployment)
+
+			if deploy.Spec.MinReadySeconds != tt.minReadySeconds {
+				t.Errorf("expected minReadySeconds to be %d, got %d", tt.minReadySeconds, deploy.Spec.MinReadySeconds)
+			}
+			if deploy.Spec.ProgressDeadlineSeconds == nil || *deploy.Spec.ProgressDeadlineSeconds != tt.progressDeadline {
+				t.Errorf("expected progressDeadlineSeconds to be %d, got %v", tt.progressDeadline, deploy.Spec.ProgressDeadlineSeconds)
+			}
+		})
+	}
+}
+
+func TestChangeCause(t *testing.T) {
+	annotatedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}
+	fixture := cirofake.NewFixturesBuilder().AddNamespaces(annotatedNamespace).Build()
+
+	generate := func(replicas int32, accessKey string) *appsapi.Deployment {
+		gd := &generatorDeployment{
+			driver:      &storageSecretTestDriver{accessKey: accessKey},
+			coreClient:  fixture.KubeClient.CoreV1(),
+			proxyLister: fixture.Listers.ProxyConfigs,
+			cr: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Replicas: replicas,
+				},
+			},
+			configMapLister: fixture.Listers.ConfigMaps,
+			secretLister:    fixture.Listers.Secrets,
+		}
+		obj, err := gd.expected()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return obj.(*appsapi.Deployment)
+	}
+
+	existing := generate(1, "access")
+	setChangeCause(nil, existing)
+	if cause := existing.Annotations[defaults.ChangeCauseAnnotation]; cause != "deployment created" {
+		t.Errorf("unexpected change cause for a new deployment: %q", cause)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		replicas  int32
+		accessKey string
+		cause     string
+	}{
+		{
+			name:      "no changes",
+			replicas:  1,
+			accessKey: "access",
+			cause:     "deployment created",
+		},
+		{
+			name:      "replicas",
+			replicas:  2,
+			accessKey: "access",
+			cause:     "replicas changed",
+		},
+		{
+			name:      "storage",
+			replicas:  1,
+			accessKey: "rotated",
+			cause:     "storage config changed",
+		},
+		{
+			name:      "replicas and storage",
+			replicas:  3,
+			accessKey: "rotated",
+			cause:     "replicas changed, storage config changed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			required := generate(tt.replicas, tt.accessKey)
+			setChangeCause(existing, required)
+			if cause := required.Annotations[defaults.ChangeCauseAnnotation]; cause != tt.cause {
+				t.Errorf("expected change cause %q, got %q", tt.cause, cause)
+			}
+
+			// Reconciling the updated deployment keeps its change cause.
+			again := generate(tt.replicas, tt.accessKey)
+			setChangeCause(required, again)
+			if !reflect.DeepEqual(again.Annotations, required.Annotations) {
+				t.Errorf("expected the annotations not to change, got %v, want %v", again.Annotations, required.Annotations)
+			}
+		})
+	}
+}
+
+func TestStableSelector(t *testing.T) {
+	annotatedNamespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}
+	fixture := cirofake.NewFixturesBuilder().AddNamespaces(annotatedNamespace).Build()
+
+	for _, spec := range []imageregistryv1.ImageRegistrySpec{
+		{Replicas: 1},
+		{Replicas: 3, MinReadySeconds: 30, RolloutStrategy: string(appsapi.RecreateDeploymentStrategyType)},
+	} {
+		gd := &generatorDeployment{
+			driver:          &testDriver{},
+			coreClient:      fixture.KubeClient.CoreV1(),
+			proxyLister:     fixture.Listers.ProxyConfigs,
+			cr:              &imageregistryv1.Config{Spec: spec},
+			configMapLister: fixture.Listers.ConfigMaps,
+			secretLister:    fixture.Listers.Secrets,
+		}
+		obj, err := gd.expected()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		deploy := obj.(*appsapi.Deployment)
+
+		// The selector is immutable and used by autoscalers through the
+		// scale subresource, it must not depend on the configuration.
+		if deploy.Spec.Selector == nil || !reflect.DeepEqual(deploy.Spec.Selector.MatchLabels, defaults.DeploymentLabels) || len(deploy.Spec.Selector.MatchExpressions) != 0 {
+			t.Errorf("expected the selector to match %v, got %#v", defaults.DeploymentLabels, deploy.Spec.Selector)
+		}
+		for k, v := range deploy.Spec.Selector.MatchLabels {
+			if deploy.Spec.Template.Labels[k] != v {
+				t.Errorf("expected the pod template to have the label %s=%s, got %v", k, v, deploy.Spec.Template.Labels)
+			}
+		}
+	}
+}
+
+func TestHorizontalPodAutoscalerCoexistence(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		annotations      map[string]string
+		ownerReferences  []metav1.OwnerReference
+		expectedReplicas int32
+		replicasChanged  bool
+	}{
+		{
+			name:             "not scaled externally",
+			expectedReplicas: 2,
+			replicasChanged:  true,
+		},
+		{
+			name:             "annotated",
+			annotations:      map[string]string{defaults.ExternallyScaledAnnotation: "true"},
+			expectedReplicas: 5,
+		},
+		{
+			name:             "annotation disabled",
+			annotations:      map[string]string{defaults.ExternallyScaledAnnotation: "false"},
+			expectedReplicas: 2,
+			replicasChanged:  true,
+		},
+		{
+			name: "owned by a HorizontalPodAutoscaler",
+			ownerReferences: []metav1.OwnerReference{
+				{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler", Name: "image-registry", UID: "1"},
+			},
+			expectedReplicas: 5,
+		},
+		{
+			name: "owned by something else",
+			ownerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "HorizontalPodAutoscaler", Name: "image-registry", UID: "1"},
+			},
+			expectedReplicas: 2,
+			replicasChanged:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas := int32(5)
+			existing := &appsapi.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            defaults.ImageRegistryName,
+					Namespace:       defaults.ImageRegistryOperatorNamespace,
+					Annotations:     tt.annotations,
+					OwnerReferences: tt.ownerReferences,
+					Generation:      3,
+				},
+				Spec: appsapi.DeploymentSpec{
+					Replicas: &replicas,
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "registry"}},
+						},
+					},
+				},
+			}
+			fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1/2",
+					},
+				},
+			}).AddDeployments(existing).Build()
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Replicas: 2,
+				},
+			}
+			gd := newGeneratorDeployment(fixture.Listers.Deployments, fixture.Listers.ConfigMaps, fixture.Listers.Secrets, fixture.Listers.ProxyConfigs, fixture.KubeClient.CoreV1(), fixture.KubeClient.AppsV1(), &testDriver{}, cr)
+
+			obj, _, err := gd.Update(existing.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			deploy := obj.(*appsapi.Deployment)
+			if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != tt.expectedReplicas {
+				t.Errorf("expected %d replicas, got %v", tt.expectedReplicas, deploy.Spec.Replicas)
+			}
+			if cause := deploy.Annotations[defaults.ChangeCauseAnnotation]; strings.Contains(cause, "replicas changed") != tt.replicasChanged {
+				t.Errorf("unexpected change cause %q", cause)
+			}
+			if cr.Spec.Replicas != 2 {
+				t.Errorf("expected the replicas of the config to be kept, got %d", cr.Spec.Replicas)
+			}
+		})
+	}
+}
+
+func TestDeploymentOwnershipConflict(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		labels          map[string]string
+		ownerReferences []metav1.OwnerReference
+		expectedStatus  operatorv1.ConditionStatus
+	}{
+		{
+			name:           "owned by the operator",
+			labels:         map[string]string{"docker-registry": "default"},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "controlled by a HorizontalPodAutoscaler",
+			ownerReferences: []metav1.OwnerReference{
+				{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler", Name: "image-registry", UID: "1", Controller: pointer.BoolPtr(true)},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "referenced by something else",
+			ownerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Example", Name: "image-registry", UID: "1"},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "controlled by something else",
+			ownerReferences: []metav1.OwnerReference{
+				{APIVersion: "example.com/v1", Kind: "Example", Name: "image-registry", UID: "1", Controller: pointer.BoolPtr(true)},
+			},
+			expectedStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:           "label changed",
+			labels:         map[string]string{"docker-registry": "example"},
+			expectedStatus: operatorv1.ConditionTrue,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas := int32(5)
+			existing := &appsapi.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            defaults.ImageRegistryName,
+					Namespace:       defaults.ImageRegistryOperatorNamespace,
+					Labels:          tt.labels,
+					OwnerReferences: tt.ownerReferences,
+					Generation:      3,
+				},
+				Spec: appsapi.DeploymentSpec{
+					Replicas: &replicas,
+				},
+			}
+			fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1/2",
+					},
+				},
+			}).AddDeployments(existing).Build()
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Replicas: 2,
+				},
+			}
+			gd := newGeneratorDeployment(fixture.Listers.Deployments, fixture.Listers.ConfigMaps, fixture.Listers.Secrets, fixture.Listers.ProxyConfigs, fixture.KubeClient.CoreV1(), fixture.KubeClient.AppsV1(), &testDriver{}, cr)
+
+			obj, updated, err := gd.Update(existing.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.DeploymentOwnershipConflict)
+			if cond == nil {
+				t.Fatalf("expected the %s condition to be set", defaults.DeploymentOwnershipConflict)
+			}
+			if cond.Status != tt.expectedStatus {
+				t.Errorf("expected the condition status %s, got %s: %s", tt.expectedStatus, cond.Status, cond.Message)
+			}
+
+			conflict := tt.expectedStatus == operatorv1.ConditionTrue
+			if updated == conflict {
+				t.Errorf("expected updated to be %t, got %t", !conflict, updated)
+			}
+			if deploy := obj.(*appsapi.Deployment); conflict && !reflect.DeepEqual(deploy, existing) {
+				t.Errorf("expected the deployment to be left alone, got %#+v", deploy)
+			}
+		})
+	}
+}
+
+func TestDeploymentTolerationsAndNodeSelector(t *testing.T) {
+	fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1/2",
+			},
+		},
+	}).Build()
+
+	tolerations := []corev1.Toleration{
+		{
+			Key:               "node-role.kubernetes.io/infra",
+			Operator:          corev1.TolerationOpExists,
+			Effect:            corev1.TaintEffectNoExecute,
+			TolerationSeconds: pointer.Int64Ptr(300),
+		},
+		{
+			Key:      "node-role.kubernetes.io/infra",
+			Operator: corev1.TolerationOpExists,
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Replicas:     2,
+			Tolerations:  tolerations,
+			NodeSelector: map[string]string{"node-role.kubernetes.io/infra": ""},
+		},
+	}
+	gd := newGeneratorDeployment(fixture.Listers.Deployments, fixture.Listers.ConfigMaps, fixture.Listers.Secrets, fixture.Listers.ProxyConfigs, fixture.KubeClient.CoreV1(), fixture.KubeClient.AppsV1(), &testDriver{}, cr)
+
+	obj, err := gd.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy, err := fixture.KubeClient.AppsV1().Deployments(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), obj.(*appsapi.Deployment).Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deploy.Spec.Template.Spec.Tolerations, tolerations) {
+		t.Errorf("expected the tolerations %#+v, got %#+v", tolerations, deploy.Spec.Template.Spec.Tolerations)
+	}
+	expectedNodeSelector := map[string]string{
+		"node-role.kubernetes.io/infra": "",
+		"kubernetes.io/os":              "linux",
+	}
+	if !reflect.DeepEqual(deploy.Spec.Template.Spec.NodeSelector, expectedNodeSelector) {
+		t.Errorf("expected the node selector %v, got %v", expectedNodeSelector, deploy.Spec.Template.Spec.NodeSelector)
+	}
+
+	// The pod template must not share the toleration seconds with the
+	// config, and changing them must roll the deployment.
+	*cr.Spec.Tolerations[0].TolerationSeconds = 600
+	if seconds := deploy.Spec.Template.Spec.Tolerations[0].TolerationSeconds; *seconds != 300 {
+		t.Errorf("expected the deployment to keep its toleration seconds, got %d", *seconds)
+	}
+
+	obj, updated, err := gd.Update(deploy.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("expected the deployment to be updated")
+	}
+	deploy = obj.(*appsapi.Deployment)
+	if seconds := deploy.Spec.Template.Spec.Tolerations[0].TolerationSeconds; seconds == nil || *seconds != 600 {
+		t.Errorf("expected the toleration seconds to be updated to 600, got %v", seconds)
+	}
+}
+
 func testSecret(sData map[string][]byte) *corev1.Secret {
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -207,7 +783,7 @@ func (d *testDriver) StorageExists(*imageregistryv1.Config) (bool, error) {
 }
 
 func (d *testDriver) VolumeSecrets() (map[string]string, error) {
-	panic("VolumeSecrets not implemented")
+	return nil, nil
 }
 
 func (d *testDriver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
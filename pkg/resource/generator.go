@@ -15,12 +15,15 @@ import (
 	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/metrics"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func ApplyMutator(gen Mutator) error {
@@ -28,12 +31,12 @@ func ApplyMutator(gen Mutator) error {
 		o, err := gen.Get()
 		if err != nil {
 			if !errors.IsNotFound(err) {
-				return fmt.Errorf("failed to get object %s: %s", Name(gen), err)
+				return fmt.Errorf("failed to get object %s: %w", Name(gen), forbidden("get", gen, err))
 			}
 
 			n, err := gen.Create()
 			if err != nil {
-				return fmt.Errorf("failed to create object %s: %s", Name(gen), err)
+				return fmt.Errorf("failed to create object %s: %w", Name(gen), forbidden("create", gen, err))
 			}
 
 			str, err := object.DumpString(n)
@@ -50,7 +53,7 @@ func ApplyMutator(gen Mutator) error {
 			if errors.IsConflict(err) {
 				return err
 			}
-			return fmt.Errorf("failed to update object %s: %s", Name(gen), err)
+			return fmt.Errorf("failed to update object %s: %w", Name(gen), forbidden("update", gen, err))
 		}
 		if updated {
 			difference, err := object.DiffString(o, n)
@@ -68,30 +71,55 @@ func NewGenerator(kubeconfig *rest.Config, clients *client.Clients, listers *cli
 		kubeconfig: kubeconfig,
 		listers:    listers,
 		clients:    clients,
+		clock:      time.Now,
+
+		storageConnectivity: newStorageConnectivity(DefaultStorageConnectivityThresholds),
 	}
 }
 
+// SetStorageConnectivityThresholds changes how many consecutive checks of the
+// storage are needed to change the StorageConnectivity condition.
+func (g *Generator) SetStorageConnectivityThresholds(thresholds StorageConnectivityThresholds) {
+	g.storageConnectivity = newStorageConnectivity(thresholds)
+}
+
 type Generator struct {
 	kubeconfig *rest.Config
 	listers    *client.Listers
 	clients    *client.Clients
+
+	// storageProvisioningStart is when the operator first tried to create
+	// the storage that is being provisioned.
+	storageProvisioningStart time.Time
+	clock                    func() time.Time
+
+	// storageConnectivity tracks the consecutive results of the checks of
+	// the storage.
+	storageConnectivity *storageConnectivity
+
+	// dryRun is set when the API server discards the writes of the
+	// clients, only such a generator can plan the changes.
+	dryRun bool
 }
 
 func (g *Generator) listRoutes(cr *imageregistryv1.Config) []Mutator {
 	var mutators []Mutator
+	if cr.Spec.DisableExternalRoutes {
+		return nil
+	}
 	if cr.Spec.DefaultRoute {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, imageregistryv1.ImageRegistryConfigRoute{
+		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.listers.OpenShiftConfigSecrets, g.clients.Route, cr, imageregistryv1.ImageRegistryConfigRoute{
 			Name: defaults.RouteName,
 		}))
 	}
 	for _, route := range cr.Spec.Routes {
-		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.clients.Route, cr, route))
+		mutators = append(mutators, newGeneratorRoute(g.listers.Routes, g.listers.Secrets, g.listers.OpenShiftConfigSecrets, g.clients.Route, cr, route))
 	}
 	return mutators
 }
 
-func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
-	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, g.listers)
+func (g *Generator) List(ctx context.Context, cr *imageregistryv1.Config) ([]Mutator, error) {
+	driver, err := storage.NewDriver(ctx, &cr.Spec.Storage, g.kubeconfig, g.listers)
 	if err != nil && err != storage.ErrStorageNotConfigured {
 		return nil, err
 	} else if err == storage.ErrStorageNotConfigured {
@@ -101,12 +129,15 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 	var mutators []Mutator
 	mutators = append(mutators, newGeneratorClusterRole(g.listers.ClusterRoles, g.clients.RBAC))
 	mutators = append(mutators, newGeneratorClusterRoleBinding(g.listers.ClusterRoleBindings, g.clients.RBAC))
-	mutators = append(mutators, newGeneratorServiceAccount(g.listers.ServiceAccounts, g.clients.Core))
+	mutators = append(mutators, newGeneratorServiceAccount(g.listers.ServiceAccounts, g.clients.Core, cr))
 	mutators = append(mutators, newGeneratorPullSecret(g.clients.Core))
 	mutators = append(mutators, newGeneratorSecret(g.listers.Secrets, g.clients.Core, driver))
-	mutators = append(mutators, newGeneratorService(g.listers.Services, g.clients.Core))
+	mutators = append(mutators, newGeneratorService(g.listers.Services, g.listers.NetworkConfigs, g.clients.Core))
 	mutators = append(mutators, newGeneratorDeployment(g.listers.Deployments, g.listers.ConfigMaps, g.listers.Secrets, g.listers.ProxyConfigs, g.clients.Core, g.clients.Apps, driver, cr))
 	mutators = append(mutators, newGeneratorPodDisruptionBudget(g.listers.PodDisruptionBudgets, g.clients.Kube.PolicyV1(), cr))
+	if cr.Spec.NetworkPolicy != nil {
+		mutators = append(mutators, newGeneratorNetworkPolicy(g.listers.NetworkPolicies, g.clients.Kube.NetworkingV1(), cr))
+	}
 	mutators = append(mutators, g.listRoutes(cr)...)
 
 	return mutators, nil
@@ -117,25 +148,40 @@ func (g *Generator) List(cr *imageregistryv1.Config) ([]Mutator, error) {
 // 2.)  to see if the storage medium name changed and we need to:
 //      a.) check to make sure that we can access the storage or
 //      b.) see if we need to try to create the new storage
-func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
+func (g *Generator) syncStorage(ctx context.Context, cr *imageregistryv1.Config) error {
 	var runCreate bool
+	var detected bool
 	// Create a driver with the current configuration
-	driver, err := storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, g.listers)
+	driver, err := storage.NewDriver(ctx, &cr.Spec.Storage, g.kubeconfig, g.listers)
 	if err == storage.ErrStorageNotConfigured {
 		cr.Spec.Storage, _, err = storage.GetPlatformStorage(g.listers)
 		if err != nil {
 			return fmt.Errorf("unable to get storage configuration from cluster install config: %s", err)
 		}
-		driver, err = storage.NewDriver(&cr.Spec.Storage, g.kubeconfig, g.listers)
+		detected = true
+		driver, err = storage.NewDriver(ctx, &cr.Spec.Storage, g.kubeconfig, g.listers)
 	}
 	if err != nil {
 		return err
 	}
 
+	if err := g.updateStorageSourceCondition(cr, detected); err != nil {
+		return err
+	}
+
+	updateEphemeralFallbackCondition(cr, isEphemeralFallback(cr))
+
+	storageRegion, clusterRegion, err := storage.RegionMismatch(&cr.Spec.Storage, g.listers)
+	if err != nil {
+		return err
+	}
+	updateStorageRegionMismatchCondition(cr, storageRegion, clusterRegion)
+
 	if driver.StorageChanged(cr) {
 		runCreate = true
 	} else {
 		exists, err := driver.StorageExists(cr)
+		g.storageConnectivity.observe(cr, err)
 		if err != nil {
 			return err
 		}
@@ -145,30 +191,131 @@ func (g *Generator) syncStorage(cr *imageregistryv1.Config) error {
 	}
 
 	if runCreate {
-		reconf := g.storageReconfigured(cr, g.kubeconfig, g.listers)
+		reconf := g.storageReconfigured(ctx, cr, g.kubeconfig, g.listers)
+		if reconf {
+			cr.Status.StorageProvisioningDuration = nil
+		}
+		if g.storageProvisioningStart.IsZero() {
+			g.storageProvisioningStart = g.clock()
+		}
 		if err := driver.CreateStorage(cr); err != nil {
 			return err
 		}
+		if cr.Status.StorageProvisioningDuration == nil {
+			cr.Status.StorageProvisioningDuration = &metaapi.Duration{
+				Duration: g.clock().Sub(g.storageProvisioningStart).Round(time.Millisecond),
+			}
+		}
+		g.storageProvisioningStart = time.Time{}
 		if reconf {
 			metrics.StorageReconfigured()
 		}
 	}
 
+	if cr.Status.StorageProvisioningDuration != nil {
+		metrics.StorageProvisioningDuration(cr.Status.StorageProvisioningDuration.Duration)
+	}
+
+	return nil
+}
+
+// isEphemeralFallback returns true if the registry uses the emptyDir storage
+// that the platform defaults fall back to, and not an emptyDir storage chosen
+// by the administrator.
+func isEphemeralFallback(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.EmptyDir == nil {
+		return false
+	}
+	cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageConfigurationSource)
+	return cond != nil && cond.Reason == defaults.StorageSourceDefault
+}
+
+// updateEphemeralFallbackCondition warns admins through the
+// StorageUsingEphemeralFallback condition that the registry data is not
+// durable when emptyDir is used only because there was no storage to fall
+// back to.
+func updateEphemeralFallbackCondition(cr *imageregistryv1.Config, fallback bool) {
+	if fallback {
+		util.UpdateCondition(cr, defaults.StorageUsingEphemeralFallback, operatorapi.ConditionTrue, "EmptyDirFallback", "No persistent storage is configured, the registry uses emptyDir storage and its data is lost when the registry pods are restarted")
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageUsingEphemeralFallback, operatorapi.ConditionFalse, "StorageConfigured", "")
+}
+
+// updateStorageRegionMismatchCondition warns admins through the
+// StorageRegionMismatch condition that the registry traffic crosses regions,
+// which adds latency and egress costs. The storage is still used.
+func updateStorageRegionMismatchCondition(cr *imageregistryv1.Config, storageRegion, clusterRegion string) {
+	if len(storageRegion) != 0 {
+		util.UpdateCondition(cr, defaults.StorageRegionMismatch, operatorapi.ConditionTrue, "RegionMismatch", fmt.Sprintf("The storage is in the region %s, but the cluster is in the region %s: the registry traffic crosses regions, which adds latency and egress costs", storageRegion, clusterRegion))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageRegionMismatch, operatorapi.ConditionFalse, "AsExpected", "")
+}
+
+// storageWithoutManagementState returns a copy of cfg that can be compared
+// with the storage status, which never has the management state.
+func storageWithoutManagementState(cfg imageregistryv1.ImageRegistryConfigStorage) imageregistryv1.ImageRegistryConfigStorage {
+	cfg = *cfg.DeepCopy()
+	cfg.ManagementState = ""
+	return cfg
+}
+
+// updateStorageSourceCondition records through the StorageConfigurationSource
+// condition whether the storage configuration was set by the administrator or
+// detected from the platform. detected is true when the configuration has
+// just been filled from the platform.
+//
+// The bootstrapped config already has the platform storage, it is
+// recognized as long as it's unchanged. Once the driver has completed the
+// configuration, it's still considered detected while the spec matches the
+// status, i.e. until someone edits it. A configuration the administrator has
+// set stays configured by the administrator, even when it matches the
+// platform storage.
+func (g *Generator) updateStorageSourceCondition(cr *imageregistryv1.Config, detected bool) error {
+	platformStorage, _, err := storage.GetPlatformStorage(g.listers)
+	if err != nil {
+		return err
+	}
+
+	spec := storageWithoutManagementState(cr.Spec.Storage)
+	previous := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StorageConfigurationSource)
+	if !detected && (previous == nil || previous.Reason != defaults.StorageSourceUserConfigured) {
+		detected = reflect.DeepEqual(spec, platformStorage)
+	}
+	if !detected {
+		for _, cond := range cr.Status.Conditions {
+			if cond.Type != defaults.StorageConfigurationSource || cond.Reason == defaults.StorageSourceUserConfigured {
+				continue
+			}
+			detected = reflect.DeepEqual(spec, storageWithoutManagementState(cr.Status.Storage))
+		}
+	}
+
+	switch {
+	case !detected:
+		util.UpdateCondition(cr, defaults.StorageConfigurationSource, operatorapi.ConditionTrue, defaults.StorageSourceUserConfigured, "The storage is configured by the administrator")
+	case platformStorage.EmptyDir != nil:
+		util.UpdateCondition(cr, defaults.StorageConfigurationSource, operatorapi.ConditionTrue, defaults.StorageSourceDefault, "The platform doesn't provide persistent storage, the default emptyDir storage is used")
+	default:
+		util.UpdateCondition(cr, defaults.StorageConfigurationSource, operatorapi.ConditionTrue, defaults.StorageSourcePlatformDetected, "The storage is configured based on the platform of the cluster")
+	}
 	return nil
 }
 
 // storageReconfigured returns true if we are, based on the provided config,
 // starting to use a different underlying storage location.
 func (g *Generator) storageReconfigured(
+	ctx context.Context,
 	regCfg *imageregistryv1.Config,
 	restCfg *rest.Config,
 	listers *client.Listers,
 ) bool {
-	prev, err := storage.NewDriver(&regCfg.Status.Storage, restCfg, listers)
+	prev, err := storage.NewDriver(ctx, &regCfg.Status.Storage, restCfg, listers)
 	if err != nil {
 		return false
 	}
-	cur, err := storage.NewDriver(&regCfg.Spec.Storage, restCfg, listers)
+	cur, err := storage.NewDriver(ctx, &regCfg.Spec.Storage, restCfg, listers)
 	if err != nil {
 		return false
 	}
@@ -180,7 +327,7 @@ func (g *Generator) storageReconfigured(
 	return prev.ID() != cur.ID()
 }
 
-func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
+func (g *Generator) removeObsoleteRoutes(ctx context.Context, cr *imageregistryv1.Config) error {
 	routes, err := g.listers.Routes.List(labels.Everything())
 	if err != nil {
 		return fmt.Errorf("failed to list routes: %s", err)
@@ -206,7 +353,7 @@ func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
 			continue
 		}
 		err = g.clients.Route.Routes(defaults.ImageRegistryOperatorNamespace).Delete(
-			context.TODO(), route.Name, opts,
+			ctx, route.Name, opts,
 		)
 		if err != nil {
 			return err
@@ -215,12 +362,19 @@ func (g *Generator) removeObsoleteRoutes(cr *imageregistryv1.Config) error {
 	return nil
 }
 
-func (g *Generator) Apply(cr *imageregistryv1.Config) error {
-	err := g.syncStorage(cr)
+// Apply reconciles the storage and the objects of the registry. The calls to
+// the storage drivers and to the routes API are bound to ctx, Apply returns
+// early with the error of ctx when it's done.
+func (g *Generator) Apply(ctx context.Context, cr *imageregistryv1.Config) error {
+	if err := g.syncCredentialsRequest(cr); err != nil {
+		return fmt.Errorf("unable to sync credentials request: %s", err)
+	}
+
+	err := g.syncStorage(ctx, cr)
 	if err == storage.ErrStorageNotConfigured {
 		return err
 	} else if err != nil {
-		return fmt.Errorf("unable to sync storage configuration: %s", err)
+		return fmt.Errorf("unable to sync storage configuration: %w", err)
 	}
 
 	// XXX https://bugzilla.redhat.com/show_bug.cgi?id=1833109
@@ -239,28 +393,56 @@ func (g *Generator) Apply(cr *imageregistryv1.Config) error {
 	cr.Status.StorageManaged = cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged
 	cr.Status.Storage.ManagementState = cr.Spec.Storage.ManagementState
 
-	generators, err := g.List(cr)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	generators, err := g.List(ctx, cr)
 	if err != nil {
 		return fmt.Errorf("unable to get generators: %s", err)
 	}
 
 	for _, gen := range generators {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err = ApplyMutator(gen)
 		if err != nil {
-			return fmt.Errorf("unable to apply objects: %s", err)
+			return fmt.Errorf("unable to apply objects: %w", err)
 		}
 	}
 
-	err = g.removeObsoleteRoutes(cr)
+	err = g.removeObsoleteRoutes(ctx, cr)
 	if err != nil {
 		return fmt.Errorf("unable to remove obsolete routes: %s", err)
 	}
 
+	if cr.Spec.NetworkPolicy == nil {
+		if err := g.removeNetworkPolicy(cr); err != nil {
+			return fmt.Errorf("unable to remove the network policy: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// removeNetworkPolicy deletes the network policy of the registry once
+// spec.networkPolicy is unset.
+func (g *Generator) removeNetworkPolicy(cr *imageregistryv1.Config) error {
+	gen := newGeneratorNetworkPolicy(g.listers.NetworkPolicies, g.clients.Kube.NetworkingV1(), cr)
+	if _, err := gen.Get(); err == nil {
+		if err := gen.Delete(metaapi.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete object %s: %s", Name(gen), err)
+		}
+		klog.Infof("object %s deleted", Name(gen))
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get object %s: %s", Name(gen), err)
+	}
 	return nil
 }
 
 func (g *Generator) Remove(cr *imageregistryv1.Config) error {
-	generators, err := g.List(cr)
+	generators, err := g.List(context.TODO(), cr)
 	if err != nil {
 		return fmt.Errorf("unable to get generators: %s", err)
 	}
@@ -284,13 +466,23 @@ func (g *Generator) Remove(cr *imageregistryv1.Config) error {
 		klog.Infof("object %s deleted", Name(gen))
 	}
 
-	driver, err := storage.NewDriver(&cr.Status.Storage, g.kubeconfig, g.listers)
+	driver, err := storage.NewDriver(context.TODO(), &cr.Status.Storage, g.kubeconfig, g.listers)
 	if err == storage.ErrStorageNotConfigured {
 		return nil
 	} else if err != nil {
 		return err
 	}
 
+	// The operator-owned objects are gone, but the bucket, the container
+	// or the claim is kept with the images in it when the user asked the
+	// operator not to manage it.
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		klog.Infof("the storage is not managed by the operator, it is retained")
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Storage Retained", "Storage retained by user request")
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{}
+		return nil
+	}
+
 	var derr error
 	var retriable bool
 	err = wait.PollImmediate(1*time.Second, 5*time.Minute, func() (stop bool, err error) {
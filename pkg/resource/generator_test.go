@@ -0,0 +1,570 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+func TestSyncStorageEphemeralFallback(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		platform       configv1.PlatformType
+		storage        imageregistryv1.ImageRegistryConfigStorage
+		previousReason string
+		expectedStatus operatorv1.ConditionStatus
+	}{
+		{
+			name:           "no storage on a platform without persistent storage",
+			platform:       configv1.LibvirtPlatformType,
+			expectedStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:     "platform default storage",
+			platform: configv1.KubevirtPlatformType,
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			expectedStatus: operatorv1.ConditionTrue,
+		},
+		{
+			name:     "emptyDir configured by the administrator",
+			platform: configv1.NonePlatformType,
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name:     "emptyDir chosen by the administrator on a platform without persistent storage",
+			platform: configv1.LibvirtPlatformType,
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			previousReason: defaults.StorageSourceUserConfigured,
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryResourceName,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: tt.storage,
+				},
+			}
+			if tt.previousReason != "" {
+				cr.Status.Conditions = append(cr.Status.Conditions, operatorv1.OperatorCondition{
+					Type:   defaults.StorageConfigurationSource,
+					Status: operatorv1.ConditionTrue,
+					Reason: tt.previousReason,
+				})
+			}
+
+			listers := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: tt.platform,
+					},
+				},
+			}).BuildListers()
+
+			g := NewGenerator(nil, &client.Clients{}, listers)
+			if err := g.syncStorage(context.Background(), cr); err != nil {
+				t.Fatal(err)
+			}
+
+			if cr.Spec.Storage.EmptyDir == nil {
+				t.Fatalf("expected emptyDir storage to be used, got %#v", cr.Spec.Storage)
+			}
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageUsingEphemeralFallback {
+					continue
+				}
+				if cond.Status != tt.expectedStatus {
+					t.Errorf("expected %s to be %s, got %s", cond.Type, tt.expectedStatus, cond.Status)
+				}
+				return
+			}
+			t.Errorf("%s condition not found", defaults.StorageUsingEphemeralFallback)
+		})
+	}
+}
+
+func TestStorageRegionMismatch(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		platformStatus  configv1.PlatformStatus
+		storage         imageregistryv1.ImageRegistryConfigStorage
+		expectedStatus  operatorv1.ConditionStatus
+		expectedMessage string
+	}{
+		{
+			name: "S3 bucket in the cluster region",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS:  &configv1.AWSPlatformStatus{Region: "us-east-1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{Region: "us-east-1"},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "S3 bucket in another region",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS:  &configv1.AWSPlatformStatus{Region: "us-east-1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{Region: "eu-west-1"},
+			},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedMessage: "The storage is in the region eu-west-1, but the cluster is in the region us-east-1",
+		},
+		{
+			name: "S3 bucket behind a custom endpoint",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS:  &configv1.AWSPlatformStatus{Region: "us-east-1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Region:         "minio",
+					RegionEndpoint: "https://s3.example.com",
+				},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "GCS bucket in another region",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{Region: "us-central1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{Region: "europe-west1"},
+			},
+			expectedStatus:  operatorv1.ConditionTrue,
+			expectedMessage: "The storage is in the region europe-west1, but the cluster is in the region us-central1",
+		},
+		{
+			name: "GCS multi-region bucket",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.GCPPlatformType,
+				GCP:  &configv1.GCPPlatformStatus{Region: "us-central1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{Region: "US"},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+		{
+			name: "storage without a region",
+			platformStatus: configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS:  &configv1.AWSPlatformStatus{Region: "us-east-1"},
+			},
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{},
+			},
+			expectedStatus: operatorv1.ConditionFalse,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &tt.platformStatus,
+				},
+			}).BuildListers()
+
+			storageRegion, clusterRegion, err := storage.RegionMismatch(&tt.storage, listers)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cr := &imageregistryv1.Config{}
+			updateStorageRegionMismatchCondition(cr, storageRegion, clusterRegion)
+			if len(cr.Status.Conditions) != 1 {
+				t.Fatalf("expected the %s condition only, got %+v", defaults.StorageRegionMismatch, cr.Status.Conditions)
+			}
+			cond := cr.Status.Conditions[0]
+			if cond.Type != defaults.StorageRegionMismatch || cond.Status != tt.expectedStatus {
+				t.Errorf("got %s=%s, want %s=%s", cond.Type, cond.Status, defaults.StorageRegionMismatch, tt.expectedStatus)
+			}
+			if !strings.HasPrefix(cond.Message, tt.expectedMessage) {
+				t.Errorf("expected the message to start with %q, got %q", tt.expectedMessage, cond.Message)
+			}
+		})
+	}
+}
+
+func TestStorageConfigurationSource(t *testing.T) {
+	pvc := func(claim string) imageregistryv1.ImageRegistryConfigStorage {
+		return imageregistryv1.ImageRegistryConfigStorage{
+			PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+				Claim: claim,
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name           string
+		platform       configv1.PlatformType
+		detected       bool
+		spec           imageregistryv1.ImageRegistryConfigStorage
+		status         imageregistryv1.ImageRegistryConfigStorage
+		previousReason string
+		expectedReason string
+	}{
+		{
+			name:     "emptyDir filled from a platform without persistent storage",
+			platform: configv1.LibvirtPlatformType,
+			detected: true,
+			spec: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			expectedReason: defaults.StorageSourceDefault,
+		},
+		{
+			name:     "emptyDir configured by the administrator",
+			platform: configv1.NonePlatformType,
+			spec: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			expectedReason: defaults.StorageSourceUserConfigured,
+		},
+		{
+			name:           "bootstrapped platform storage",
+			platform:       configv1.OvirtPlatformType,
+			spec:           pvc(defaults.PVCImageRegistryName),
+			expectedReason: defaults.StorageSourcePlatformDetected,
+		},
+		{
+			name:           "claim configured by the administrator",
+			platform:       configv1.OvirtPlatformType,
+			spec:           pvc("custom"),
+			expectedReason: defaults.StorageSourceUserConfigured,
+		},
+		{
+			name:           "detected storage completed by the driver",
+			platform:       configv1.OvirtPlatformType,
+			spec:           pvc("completed"),
+			status:         pvc("completed"),
+			previousReason: defaults.StorageSourcePlatformDetected,
+			expectedReason: defaults.StorageSourcePlatformDetected,
+		},
+		{
+			name:           "detected storage changed by the administrator",
+			platform:       configv1.OvirtPlatformType,
+			spec:           pvc("custom"),
+			status:         pvc("completed"),
+			previousReason: defaults.StorageSourcePlatformDetected,
+			expectedReason: defaults.StorageSourceUserConfigured,
+		},
+		{
+			name:     "platform storage configured by the administrator before",
+			platform: configv1.LibvirtPlatformType,
+			spec: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+			previousReason: defaults.StorageSourceUserConfigured,
+			expectedReason: defaults.StorageSourceUserConfigured,
+		},
+		{
+			name:           "storage configured by the administrator before",
+			platform:       configv1.OvirtPlatformType,
+			spec:           pvc("custom"),
+			status:         pvc("custom"),
+			previousReason: defaults.StorageSourceUserConfigured,
+			expectedReason: defaults.StorageSourceUserConfigured,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: tt.spec,
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: tt.status,
+				},
+			}
+			if tt.previousReason != "" {
+				cr.Status.Conditions = append(cr.Status.Conditions, operatorv1.OperatorCondition{
+					Type:   defaults.StorageConfigurationSource,
+					Status: operatorv1.ConditionTrue,
+					Reason: tt.previousReason,
+				})
+			}
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+
+			listers := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: tt.platform,
+					},
+				},
+			}).BuildListers()
+
+			g := NewGenerator(nil, &client.Clients{}, listers)
+			if err := g.updateStorageSourceCondition(cr, tt.detected); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageConfigurationSource {
+					continue
+				}
+				if cond.Reason != tt.expectedReason {
+					t.Errorf("expected %s reason to be %s, got %s", cond.Type, tt.expectedReason, cond.Reason)
+				}
+				return
+			}
+			t.Errorf("%s condition not found", defaults.StorageConfigurationSource)
+		})
+	}
+}
+
+func TestSyncStorageProvisioningDuration(t *testing.T) {
+	if ns, ok := os.LookupEnv("WATCH_NAMESPACE"); ok {
+		defer os.Setenv("WATCH_NAMESPACE", ns)
+	} else {
+		defer os.Unsetenv("WATCH_NAMESPACE")
+	}
+	os.Setenv("WATCH_NAMESPACE", defaults.ImageRegistryOperatorNamespace)
+
+	listers := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NonePlatformType,
+			},
+		},
+	}).BuildListers()
+
+	now := time.Now()
+	g := NewGenerator(&rest.Config{}, &client.Clients{}, listers)
+	g.clock = func() time.Time {
+		now = now.Add(3 * time.Second)
+		return now
+	}
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+
+	expectDuration := func(step string, expected time.Duration) {
+		t.Helper()
+		if cr.Status.StorageProvisioningDuration == nil {
+			t.Fatalf("%s: expected the provisioning duration to be recorded", step)
+		}
+		if d := cr.Status.StorageProvisioningDuration.Duration; d != expected {
+			t.Fatalf("%s: expected the provisioning duration to be %s, got %s", step, expected, d)
+		}
+	}
+
+	if err := g.syncStorage(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+	expectDuration("first provisioning", 3*time.Second)
+
+	if err := g.syncStorage(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+	expectDuration("provisioned storage", 3*time.Second)
+
+	// The storage applied earlier was a volume claim, switching to emptyDir
+	// is a reconfiguration.
+	cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+		PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+			Claim: "image-registry-storage",
+		},
+	}
+	cr.Status.StorageProvisioningDuration = &metav1.Duration{Duration: time.Hour}
+	if err := g.syncStorage(context.Background(), cr); err != nil {
+		t.Fatal(err)
+	}
+	expectDuration("reconfigured storage", 3*time.Second)
+}
+
+func TestApplyCancelled(t *testing.T) {
+	listers := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NonePlatformType,
+			},
+		},
+	}).BuildListers()
+
+	cr := &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The generator has no clients, applying any object would panic.
+	g := NewGenerator(nil, &client.Clients{}, listers)
+	if err := g.Apply(ctx, cr); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestRemoveStorageManagementState(t *testing.T) {
+	if ns, ok := os.LookupEnv("WATCH_NAMESPACE"); ok {
+		defer os.Setenv("WATCH_NAMESPACE", ns)
+	} else {
+		defer os.Unsetenv("WATCH_NAMESPACE")
+	}
+	os.Setenv("WATCH_NAMESPACE", defaults.ImageRegistryOperatorNamespace)
+
+	for _, tt := range []struct {
+		name            string
+		managementState string
+		removed         bool
+	}{
+		{
+			name:            "managed",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			removed:         true,
+		},
+		{
+			name:            "unmanaged",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The claim is removed by the storage driver through the
+			// API server, the other objects through the clients.
+			var mu sync.Mutex
+			var deletes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Method == http.MethodDelete {
+					deletes = append(deletes, r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+			}))
+			defer server.Close()
+
+			kubeClient := kfake.NewSimpleClientset(&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+			})
+			g := NewGenerator(&rest.Config{Host: server.URL}, &client.Clients{
+				Kube: kubeClient,
+				Core: kubeClient.CoreV1(),
+				Apps: kubeClient.AppsV1(),
+				RBAC: kubeClient.RbacV1(),
+			}, cirofake.NewFixturesBuilder().BuildListers())
+
+			claim := &imageregistryv1.ImageRegistryConfigStoragePVC{
+				Claim: defaults.PVCImageRegistryName,
+			}
+			cr := &imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryResourceName,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC:             claim,
+						ManagementState: tt.managementState,
+					},
+				},
+				Status: imageregistryv1.ImageRegistryStatus{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC:             claim,
+						ManagementState: tt.managementState,
+					},
+				},
+			}
+
+			if err := g.Remove(cr); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := kubeClient.AppsV1().Deployments(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), defaults.ImageRegistryName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("expected the deployment to be removed, got %v", err)
+			}
+			if cr.Status.Storage.PVC != nil {
+				t.Errorf("expected the storage to be cleared from the status, got %+v", cr.Status.Storage)
+			}
+
+			claimPath := "/api/v1/namespaces/" + defaults.ImageRegistryOperatorNamespace + "/persistentvolumeclaims/" + defaults.PVCImageRegistryName
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.removed {
+				if len(deletes) != 1 || deletes[0] != claimPath {
+					t.Errorf("expected the claim to be removed, got the deletions %v", deletes)
+				}
+				return
+			}
+
+			if len(deletes) != 0 {
+				t.Errorf("expected the claim to be retained, got the deletions %v", deletes)
+			}
+			var retained bool
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type == defaults.StorageExists && cond.Status == operatorv1.ConditionTrue && cond.Message == "Storage retained by user request" {
+					retained = true
+				}
+			}
+			if !retained {
+				t.Errorf("expected the %s condition to note that the storage is retained, got %+v", defaults.StorageExists, cr.Status.Conditions)
+			}
+		})
+	}
+}
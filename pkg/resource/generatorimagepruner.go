@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"context"
 	"fmt"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -10,6 +11,8 @@ import (
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/integrityscan"
 )
 
 func NewImagePrunerGenerator(clients *client.Clients, listers *client.ImagePrunerControllerListers) *ImagePrunerGenerator {
@@ -29,7 +32,10 @@ func (g *ImagePrunerGenerator) List(cr *imageregistryv1.ImagePruner) ([]Mutator,
 	mutators = append(mutators, newGeneratorPrunerClusterRoleBinding(g.listers.ClusterRoleBindings, g.clients.RBAC))
 	mutators = append(mutators, newGeneratorPrunerServiceAccount(g.listers.ServiceAccounts, g.clients.Core))
 	mutators = append(mutators, newGeneratorServiceCA(g.listers.ConfigMaps, g.clients.Core))
-	mutators = append(mutators, newGeneratorPrunerCronJob(g.listers.CronJobs, g.clients.Batch, g.listers.ImagePrunerConfigs, g.listers.ImageConfigs))
+	mutators = append(mutators, newGeneratorPrunerCronJob(g.listers.CronJobs, g.clients.Batch, g.listers.ImagePrunerConfigs, g.listers.RegistryConfigs, g.listers.ImageConfigs))
+	if cr.Spec.IntegrityScan != nil {
+		mutators = append(mutators, newGeneratorIntegrityScanCronJob(g.listers.CronJobs, g.clients.Batch, g.listers.ImagePrunerConfigs, g.listers.ImageConfigs))
+	}
 
 	return mutators, nil
 }
@@ -47,6 +53,38 @@ func (g *ImagePrunerGenerator) Apply(pcr *imageregistryv1.ImagePruner) error {
 		}
 	}
 
+	if pcr.Spec.IntegrityScan == nil {
+		if err := g.removeIntegrityScan(); err != nil {
+			return fmt.Errorf("unable to remove the integrity scan: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// removeIntegrityScan deletes the cron job and the results of the integrity
+// scan once it is disabled.
+func (g *ImagePrunerGenerator) removeIntegrityScan() error {
+	gen := newGeneratorIntegrityScanCronJob(g.listers.CronJobs, g.clients.Batch, g.listers.ImagePrunerConfigs, g.listers.ImageConfigs)
+	if _, err := gen.Get(); err == nil {
+		propagationPolicy := metaapi.DeletePropagationBackground
+		if err := gen.Delete(metaapi.DeleteOptions{PropagationPolicy: &propagationPolicy}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete object %s: %s", Name(gen), err)
+		}
+		klog.Infof("object %s deleted", Name(gen))
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get object %s: %s", Name(gen), err)
+	}
+
+	if _, err := g.listers.ConfigMaps.Get(integrityscan.ConfigMapName); err == nil {
+		err := g.clients.Core.ConfigMaps(defaults.ImageRegistryOperatorNamespace).Delete(context.TODO(), integrityscan.ConfigMapName, metaapi.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete the config map %s: %s", integrityscan.ConfigMapName, err)
+		}
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the config map %s: %s", integrityscan.ConfigMapName, err)
+	}
+
 	return nil
 }
 
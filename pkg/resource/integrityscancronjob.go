@@ -0,0 +1,193 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	batchapi "k8s.io/api/batch/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	kcorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchset "k8s.io/client-go/kubernetes/typed/batch/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// defaultIntegrityScanSchedule runs the scan weekly, outside of the window
+// of the pruner.
+var defaultIntegrityScanSchedule = "0 3 * * 0"
+
+var _ Mutator = &generatorIntegrityScanCronJob{}
+
+// generatorIntegrityScanCronJob generates the cron job verifying the blobs
+// of the images. It runs with the service account and the placement of the
+// pruner.
+type generatorIntegrityScanCronJob struct {
+	lister            batchlisters.CronJobNamespaceLister
+	client            batchset.BatchV1Interface
+	prunerLister      imageregistryv1listers.ImagePrunerLister
+	imageConfigLister configv1listers.ImageLister
+	pruner            *generatorPrunerCronJob
+}
+
+func newGeneratorIntegrityScanCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, imageConfigLister configv1listers.ImageLister) *generatorIntegrityScanCronJob {
+	return &generatorIntegrityScanCronJob{
+		lister:            lister,
+		client:            client,
+		prunerLister:      prunerLister,
+		imageConfigLister: imageConfigLister,
+		pruner:            &generatorPrunerCronJob{},
+	}
+}
+
+func (gcj *generatorIntegrityScanCronJob) Type() runtime.Object {
+	return &batchapi.CronJob{}
+}
+
+func (gcj *generatorIntegrityScanCronJob) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gcj *generatorIntegrityScanCronJob) GetName() string {
+	return "image-integrity-scan"
+}
+
+func (gcj *generatorIntegrityScanCronJob) expected() (runtime.Object, error) {
+	cr, err := gcj.prunerLister.Get(defaults.ImageRegistryImagePrunerResourceName)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Spec.IntegrityScan == nil {
+		return nil, fmt.Errorf("the integrity scan is not enabled")
+	}
+
+	imageConfig, err := gcj.imageConfigLister.Get(defaults.ImageConfigName)
+	if err != nil {
+		return nil, err
+	}
+	if imageConfig.Status.InternalRegistryHostname == "" {
+		return nil, fmt.Errorf("the internal registry hostname is not set, the blobs can't be verified")
+	}
+
+	suspend := defaultSuspend
+	if cr.Spec.IntegrityScan.Suspend != nil {
+		suspend = *cr.Spec.IntegrityScan.Suspend
+	}
+	schedule := defaultIntegrityScanSchedule
+	if len(cr.Spec.IntegrityScan.Schedule) != 0 {
+		schedule = cr.Spec.IntegrityScan.Schedule
+	}
+
+	backoffLimit := int32(0)
+	historyLimit := int32(1)
+	cj := &batchapi.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gcj.GetName(),
+			Namespace: gcj.GetNamespace(),
+		},
+		Spec: batchapi.CronJobSpec{
+			Suspend:                    &suspend,
+			Schedule:                   schedule,
+			ConcurrencyPolicy:          batchapi.ForbidConcurrent,
+			FailedJobsHistoryLimit:     &historyLimit,
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			StartingDeadlineSeconds:    &defaultStartingDeadlineSeconds,
+			JobTemplate: batchapi.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: kcorev1.PodTemplateSpec{
+						Spec: kcorev1.PodSpec{
+							RestartPolicy:      kcorev1.RestartPolicyNever,
+							ServiceAccountName: "pruner",
+							PriorityClassName:  "system-cluster-critical",
+							Affinity:           gcj.pruner.getAffinity(cr),
+							NodeSelector:       gcj.pruner.getNodeSelector(cr),
+							Tolerations:        gcj.pruner.getTolerations(cr),
+							Volumes: []kcorev1.Volume{
+								{
+									Name: "serviceca",
+									VolumeSource: kcorev1.VolumeSource{
+										ConfigMap: &kcorev1.ConfigMapVolumeSource{
+											LocalObjectReference: kcorev1.LocalObjectReference{
+												Name: "serviceca",
+											},
+										},
+									},
+								},
+							},
+							Containers: []kcorev1.Container{
+								{
+									Image:                    os.Getenv("OPERATOR_IMAGE"),
+									Resources:                gcj.pruner.getResourceRequirements(cr),
+									TerminationMessagePolicy: kcorev1.TerminationMessageFallbackToLogsOnError,
+									Name:                     gcj.GetName(),
+									Command:                  []string{"cluster-image-registry-operator"},
+									Args: []string{
+										"integrity-scan",
+										"--certificate-authority=/var/run/configmaps/serviceca/service-ca.crt",
+										fmt.Sprintf("--registry-url=https://%s", imageConfig.Status.InternalRegistryHostname),
+									},
+									Env: []kcorev1.EnvVar{
+										{
+											Name: "JOB_NAME",
+											ValueFrom: &kcorev1.EnvVarSource{
+												FieldRef: &kcorev1.ObjectFieldSelector{
+													FieldPath: "metadata.labels['job-name']",
+												},
+											},
+										},
+									},
+									VolumeMounts: []kcorev1.VolumeMount{
+										{
+											Name:      "serviceca",
+											MountPath: "/var/run/configmaps/serviceca",
+											ReadOnly:  true,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	cj.Spec.JobTemplate.Labels = map[string]string{"created-by": gcj.GetName()}
+	return cj, nil
+}
+
+func (gcj *generatorIntegrityScanCronJob) Get() (runtime.Object, error) {
+	return gcj.lister.Get(gcj.GetName())
+}
+
+func (gcj *generatorIntegrityScanCronJob) Create() (runtime.Object, error) {
+	return commonCreate(gcj, func(obj runtime.Object) (runtime.Object, error) {
+		return gcj.client.CronJobs(gcj.GetNamespace()).Create(
+			context.TODO(), obj.(*batchapi.CronJob), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gcj *generatorIntegrityScanCronJob) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gcj, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gcj.client.CronJobs(gcj.GetNamespace()).Update(
+			context.TODO(), obj.(*batchapi.CronJob), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gcj *generatorIntegrityScanCronJob) Delete(opts metav1.DeleteOptions) error {
+	return gcj.client.CronJobs(gcj.GetNamespace()).Delete(
+		context.TODO(), gcj.GetName(), opts,
+	)
+}
+
+func (gcj *generatorIntegrityScanCronJob) Owned() bool {
+	return true
+}
@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestIntegrityScanCronJob(t *testing.T) {
+	suspend := true
+
+	testCases := []struct {
+		name     string
+		scan     *imageregistryv1.ImagePrunerIntegrityScan
+		hostname string
+		schedule string
+		suspend  bool
+		err      string
+	}{
+		{
+			name:     "defaults",
+			scan:     &imageregistryv1.ImagePrunerIntegrityScan{},
+			hostname: "image-registry.openshift-image-registry.svc:5000",
+			schedule: "0 3 * * 0",
+		},
+		{
+			name: "custom schedule",
+			scan: &imageregistryv1.ImagePrunerIntegrityScan{
+				Schedule: "0 4 * * *",
+				Suspend:  &suspend,
+			},
+			hostname: "image-registry.openshift-image-registry.svc:5000",
+			schedule: "0 4 * * *",
+			suspend:  true,
+		},
+		{
+			name: "disabled",
+			err:  "the integrity scan is not enabled",
+		},
+		{
+			name: "no internal hostname",
+			scan: &imageregistryv1.ImagePrunerIntegrityScan{},
+			err:  "the internal registry hostname is not set, the blobs can't be verified",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pruners := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := pruners.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryImagePrunerResourceName,
+				},
+				Spec: imageregistryv1.ImagePrunerSpec{
+					IntegrityScan: tc.scan,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigs.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageConfigName,
+				},
+				Status: configv1.ImageStatus{
+					InternalRegistryHostname: tc.hostname,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			g := newGeneratorIntegrityScanCronJob(nil, nil, imageregistryv1listers.NewImagePrunerLister(pruners), configv1listers.NewImageLister(imageConfigs))
+			obj, err := g.expected()
+			if len(tc.err) != 0 {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cj := obj.(*batchv1.CronJob)
+			if cj.Spec.Schedule != tc.schedule {
+				t.Errorf("expected schedule %q, got %q", tc.schedule, cj.Spec.Schedule)
+			}
+			if *cj.Spec.Suspend != tc.suspend {
+				t.Errorf("expected suspend %t, got %t", tc.suspend, *cj.Spec.Suspend)
+			}
+			container := cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+			if url := "--registry-url=https://" + tc.hostname; container.Args[len(container.Args)-1] != url {
+				t.Errorf("expected %s, got %v", url, container.Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	networkingset "k8s.io/client-go/kubernetes/typed/networking/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	// namespaceNameLabel is set by the API server on every namespace.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	// hostNetworkPolicyGroupLabel selects the host network, where the
+	// kubelets pulling the images come from.
+	hostNetworkPolicyGroupLabel = "policy-group.network.openshift.io/host-network"
+
+	// ingressPolicyGroupLabel selects the namespaces of the ingress
+	// controllers, which serve the routes of the registry.
+	ingressPolicyGroupLabel = "policy-group.network.openshift.io/ingress"
+
+	// monitoringNamespace is where the registry metrics are scraped from.
+	monitoringNamespace = "openshift-monitoring"
+)
+
+var _ Mutator = &generatorNetworkPolicy{}
+
+// generatorNetworkPolicy generates the network policy restricting the
+// ingress of the registry pods to the sources of spec.networkPolicy.
+type generatorNetworkPolicy struct {
+	lister networkinglisters.NetworkPolicyNamespaceLister
+	client networkingset.NetworkingV1Interface
+	cr     *imageregistryv1.Config
+}
+
+func newGeneratorNetworkPolicy(lister networkinglisters.NetworkPolicyNamespaceLister, client networkingset.NetworkingV1Interface, cr *imageregistryv1.Config) *generatorNetworkPolicy {
+	return &generatorNetworkPolicy{
+		lister: lister,
+		client: client,
+		cr:     cr,
+	}
+}
+
+func (gnp *generatorNetworkPolicy) Type() runtime.Object {
+	return &networkingv1.NetworkPolicy{}
+}
+
+func (gnp *generatorNetworkPolicy) GetNamespace() string {
+	return defaults.ImageRegistryOperatorNamespace
+}
+
+func (gnp *generatorNetworkPolicy) GetName() string {
+	return defaults.ImageRegistryName
+}
+
+func (gnp *generatorNetworkPolicy) expected() (runtime.Object, error) {
+	config := gnp.cr.Spec.NetworkPolicy
+	if config == nil {
+		return nil, fmt.Errorf("the network policy is not enabled")
+	}
+
+	// The operator namespace covers the node-ca daemon set, the pruner and
+	// the integrity scan.
+	namespaces := []string{defaults.ImageRegistryOperatorNamespace, monitoringNamespace}
+	for _, ns := range config.AllowedNamespaces {
+		if len(ns) == 0 {
+			return nil, fmt.Errorf("networkPolicy: allowedNamespaces must not contain empty names")
+		}
+		namespaces = append(namespaces, ns)
+	}
+
+	peers := []networkingv1.NetworkPolicyPeer{
+		{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      namespaceNameLabel,
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   namespaces,
+					},
+				},
+			},
+		},
+		{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					hostNetworkPolicyGroupLabel: "",
+				},
+			},
+		},
+	}
+	if len(ConfiguredRoutes(gnp.cr)) != 0 {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					ingressPolicyGroupLabel: "",
+				},
+			},
+		})
+	}
+	for _, cidr := range config.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("networkPolicy: allowedCIDRs: %q is not a valid CIDR: %v", cidr, err)
+		}
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{
+				CIDR: cidr,
+			},
+		})
+	}
+
+	protocol := corev1.ProtocolTCP
+	port := intstr.FromInt(defaults.ContainerPort)
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gnp.GetName(),
+			Namespace: gnp.GetNamespace(),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: defaults.DeploymentLabels,
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &protocol,
+							Port:     &port,
+						},
+					},
+					From: peers,
+				},
+			},
+		},
+	}
+
+	return np, nil
+}
+
+func (gnp *generatorNetworkPolicy) Get() (runtime.Object, error) {
+	return gnp.lister.Get(gnp.GetName())
+}
+
+func (gnp *generatorNetworkPolicy) Create() (runtime.Object, error) {
+	return commonCreate(gnp, func(obj runtime.Object) (runtime.Object, error) {
+		return gnp.client.NetworkPolicies(gnp.GetNamespace()).Create(
+			context.TODO(), obj.(*networkingv1.NetworkPolicy), metav1.CreateOptions{},
+		)
+	})
+}
+
+func (gnp *generatorNetworkPolicy) Update(o runtime.Object) (runtime.Object, bool, error) {
+	return commonUpdate(gnp, o, func(obj runtime.Object) (runtime.Object, error) {
+		return gnp.client.NetworkPolicies(gnp.GetNamespace()).Update(
+			context.TODO(), obj.(*networkingv1.NetworkPolicy), metav1.UpdateOptions{},
+		)
+	})
+}
+
+func (gnp *generatorNetworkPolicy) Delete(opts metav1.DeleteOptions) error {
+	return gnp.client.NetworkPolicies(gnp.GetNamespace()).Delete(
+		context.TODO(), gnp.GetName(), opts,
+	)
+}
+
+func (gnp *generatorNetworkPolicy) Owned() bool {
+	return true
+}
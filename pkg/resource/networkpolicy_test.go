@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	hostNetwork := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"policy-group.network.openshift.io/host-network": ""},
+		},
+	}
+	ingress := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"policy-group.network.openshift.io/ingress": ""},
+		},
+	}
+	namespaces := func(names ...string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      "kubernetes.io/metadata.name",
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   names,
+					},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name          string
+		networkPolicy *imageregistryv1.ImageRegistryConfigNetworkPolicy
+		defaultRoute  bool
+		expectedPeers []networkingv1.NetworkPolicyPeer
+		err           string
+	}{
+		{
+			name:          "no allowed sources",
+			networkPolicy: &imageregistryv1.ImageRegistryConfigNetworkPolicy{},
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				namespaces("openshift-image-registry", "openshift-monitoring"),
+				hostNetwork,
+			},
+		},
+		{
+			name: "allowed namespaces and CIDRs",
+			networkPolicy: &imageregistryv1.ImageRegistryConfigNetworkPolicy{
+				AllowedNamespaces: []string{"ci", "builds"},
+				AllowedCIDRs:      []string{"10.0.0.0/16", "fd00::/8"},
+			},
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				namespaces("openshift-image-registry", "openshift-monitoring", "ci", "builds"),
+				hostNetwork,
+				{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16"}},
+				{IPBlock: &networkingv1.IPBlock{CIDR: "fd00::/8"}},
+			},
+		},
+		{
+			name:          "routes enabled",
+			networkPolicy: &imageregistryv1.ImageRegistryConfigNetworkPolicy{},
+			defaultRoute:  true,
+			expectedPeers: []networkingv1.NetworkPolicyPeer{
+				namespaces("openshift-image-registry", "openshift-monitoring"),
+				hostNetwork,
+				ingress,
+			},
+		},
+		{
+			name: "invalid CIDR",
+			networkPolicy: &imageregistryv1.ImageRegistryConfigNetworkPolicy{
+				AllowedCIDRs: []string{"10.0.0.1"},
+			},
+			err: `networkPolicy: allowedCIDRs: "10.0.0.1" is not a valid CIDR: invalid CIDR address: 10.0.0.1`,
+		},
+		{
+			name: "empty namespace",
+			networkPolicy: &imageregistryv1.ImageRegistryConfigNetworkPolicy{
+				AllowedNamespaces: []string{""},
+			},
+			err: "networkPolicy: allowedNamespaces must not contain empty names",
+		},
+		{
+			name: "disabled",
+			err:  "the network policy is not enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					NetworkPolicy: tt.networkPolicy,
+					DefaultRoute:  tt.defaultRoute,
+				},
+			}
+
+			obj, err := newGeneratorNetworkPolicy(nil, nil, cr).expected()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			np := obj.(*networkingv1.NetworkPolicy)
+			if np.Name != "image-registry" || np.Namespace != defaults.ImageRegistryOperatorNamespace {
+				t.Errorf("unexpected network policy %s/%s", np.Namespace, np.Name)
+			}
+			if !reflect.DeepEqual(np.Spec.PodSelector.MatchLabels, defaults.DeploymentLabels) {
+				t.Errorf("expected the registry pods to be selected, got %v", np.Spec.PodSelector)
+			}
+			if !reflect.DeepEqual(np.Spec.PolicyTypes, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}) {
+				t.Errorf("expected an ingress policy, got %v", np.Spec.PolicyTypes)
+			}
+			if len(np.Spec.Ingress) != 1 {
+				t.Fatalf("expected 1 ingress rule, got %d", len(np.Spec.Ingress))
+			}
+			rule := np.Spec.Ingress[0]
+			if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != defaults.ContainerPort {
+				t.Errorf("expected the rule to allow the port %d, got %v", defaults.ContainerPort, rule.Ports)
+			}
+			if !reflect.DeepEqual(rule.From, tt.expectedPeers) {
+				t.Errorf("unexpected peers: got %#v, want %#v", rule.From, tt.expectedPeers)
+			}
+		})
+	}
+}
+
+func TestRemoveNetworkPolicy(t *testing.T) {
+	fixtures := cirofake.NewFixturesBuilder().AddNetworkPolicies(&networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "image-registry",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+	}).Build()
+
+	g := NewGenerator(nil, &client.Clients{Kube: fixtures.KubeClient}, fixtures.Listers)
+	if err := g.removeNetworkPolicy(&imageregistryv1.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := fixtures.KubeClient.NetworkingV1().NetworkPolicies(defaults.ImageRegistryOperatorNamespace).Get(context.Background(), "image-registry", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the network policy to be deleted, got %v", err)
+	}
+
+	// The policy is already gone from the API, the lister still has it.
+	if err := g.removeNetworkPolicy(&imageregistryv1.Config{}); err != nil {
+		t.Errorf("expected a missing network policy to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	kubeclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	routeclient "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/object"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// PlanAction is what Apply would do to the storage or to an object of the
+// registry.
+type PlanAction string
+
+const (
+	PlanActionCreate    PlanAction = "Create"
+	PlanActionUpdate    PlanAction = "Update"
+	PlanActionUnchanged PlanAction = "Unchanged"
+)
+
+// PlannedChange is a change Apply would make. Diff is the dump of the object
+// that would be created, or its difference with the current object when it
+// would be updated.
+type PlannedChange struct {
+	Action PlanAction
+	Object string
+	Diff   string
+}
+
+func (c PlannedChange) String() string {
+	if c.Diff == "" {
+		return fmt.Sprintf("%s %s", c.Action, c.Object)
+	}
+	return fmt.Sprintf("%s %s: %s", c.Action, c.Object, c.Diff)
+}
+
+// NewPlanGenerator returns a generator that can only plan the changes, its
+// clients are built from kubeconfig with a transport that makes the API
+// server discard the writes.
+func NewPlanGenerator(kubeconfig *rest.Config, listers *client.Listers) (*Generator, error) {
+	dryRunConfig := rest.CopyConfig(kubeconfig)
+	dryRunConfig.Wrap(client.DryRunTransport)
+
+	kubeClient, err := kubeclient.NewForConfig(dryRunConfig)
+	if err != nil {
+		return nil, err
+	}
+	routeClient, err := routeclient.NewForConfig(dryRunConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := &client.Clients{
+		Kube:  kubeClient,
+		Core:  kubeClient.CoreV1(),
+		Apps:  kubeClient.AppsV1(),
+		RBAC:  kubeClient.RbacV1(),
+		Route: routeClient.RouteV1(),
+		Batch: kubeClient.BatchV1(),
+	}
+
+	g := NewGenerator(kubeconfig, clients, listers)
+	g.dryRun = true
+	return g, nil
+}
+
+// planStorage returns whether the storage would be provisioned. The driver
+// is only asked whether the storage exists, the storage and the credentials
+// are left as they are.
+func (g *Generator) planStorage(ctx context.Context, cr *imageregistryv1.Config) (PlannedChange, error) {
+	change := PlannedChange{
+		Object: "Storage",
+	}
+
+	driver, err := storage.NewDriver(ctx, &cr.Spec.Storage, g.kubeconfig, g.listers)
+	if err == storage.ErrStorageNotConfigured {
+		cr.Spec.Storage, _, err = storage.GetPlatformStorage(g.listers)
+		if err != nil {
+			return change, fmt.Errorf("unable to get storage configuration from cluster install config: %s", err)
+		}
+		driver, err = storage.NewDriver(ctx, &cr.Spec.Storage, g.kubeconfig, g.listers)
+	}
+	if err != nil {
+		return change, err
+	}
+
+	create := driver.StorageChanged(cr)
+	if !create {
+		exists, err := driver.StorageExists(cr)
+		if err != nil {
+			return change, err
+		}
+		create = !exists
+	}
+	if !create {
+		change.Action = PlanActionUnchanged
+		return change, nil
+	}
+
+	change.Action = PlanActionCreate
+	change.Diff, err = object.DiffString(cr.Status.Storage, storageWithoutManagementState(cr.Spec.Storage))
+	return change, err
+}
+
+// planMutator runs the mutator like ApplyMutator and returns the change it
+// made, the clients of the mutator must not persist it.
+func planMutator(gen Mutator) (PlannedChange, error) {
+	change := PlannedChange{
+		Object: Name(gen),
+	}
+
+	o, err := gen.Get()
+	if errors.IsNotFound(err) {
+		n, err := gen.Create()
+		if err != nil {
+			return change, fmt.Errorf("failed to create object %s: %w", Name(gen), err)
+		}
+		change.Action = PlanActionCreate
+		change.Diff, err = object.DumpString(n)
+		return change, err
+	} else if err != nil {
+		return change, fmt.Errorf("failed to get object %s: %w", Name(gen), err)
+	}
+
+	n, updated, err := gen.Update(o.DeepCopyObject())
+	if err != nil {
+		return change, fmt.Errorf("failed to update object %s: %w", Name(gen), err)
+	}
+	if !updated {
+		change.Action = PlanActionUnchanged
+		return change, nil
+	}
+	change.Action = PlanActionUpdate
+	change.Diff, err = object.DiffString(o, n)
+	return change, err
+}
+
+// Plan returns the changes Apply would make to the storage and to the
+// objects of the registry, the storage first. The objects go through the
+// same mutators as in Apply, but the writes are discarded by the API server,
+// so the generator must come from NewPlanGenerator. The credentials request
+// and the obsolete objects that Apply would delete are not planned.
+func (g *Generator) Plan(ctx context.Context, cr *imageregistryv1.Config) ([]PlannedChange, error) {
+	if !g.dryRun {
+		return nil, fmt.Errorf("the generator would persist the changes, it can't be used to plan them")
+	}
+	cr = cr.DeepCopy()
+
+	storageChange, err := g.planStorage(ctx, cr)
+	if err == storage.ErrStorageNotConfigured {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to plan storage configuration: %s", err)
+	}
+	changes := []PlannedChange{storageChange}
+
+	if cr.Spec.Storage.ManagementState == "" {
+		if cr.Status.StorageManaged {
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+		} else {
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+		}
+	}
+
+	generators, err := g.List(ctx, cr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get generators: %s", err)
+	}
+
+	for _, gen := range generators {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		change, err := planMutator(gen)
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan objects: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,171 @@
+package resource
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// newPlanTestGenerator returns a plan generator backed by in-memory clients
+// that see the services.
+func newPlanTestGenerator(services ...*corev1.Service) *Generator {
+	fixture := cirofake.NewFixturesBuilder().
+		AddInfraConfig(&configv1.Infrastructure{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "cluster",
+			},
+			Status: configv1.InfrastructureStatus{
+				PlatformStatus: &configv1.PlatformStatus{
+					Type: configv1.NonePlatformType,
+				},
+			},
+		}).
+		AddNamespaces(&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: defaults.ImageRegistryOperatorNamespace,
+				Annotations: map[string]string{
+					defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+				},
+			},
+		}).
+		AddServices(services...).
+		Build()
+
+	kubeClient := fixture.KubeClient
+	g := NewGenerator(&rest.Config{}, &client.Clients{
+		Kube: kubeClient,
+		Core: kubeClient.CoreV1(),
+		Apps: kubeClient.AppsV1(),
+		RBAC: kubeClient.RbacV1(),
+	}, fixture.Listers)
+	g.dryRun = true
+	return g
+}
+
+func planTestConfig() *imageregistryv1.Config {
+	return &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Replicas: 1,
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	}
+}
+
+func findPlannedChange(changes []PlannedChange, prefix string) *PlannedChange {
+	for i := range changes {
+		if strings.HasPrefix(changes[i].Object, prefix) {
+			return &changes[i]
+		}
+	}
+	return nil
+}
+
+func TestPlanRequiresDryRun(t *testing.T) {
+	g := NewGenerator(&rest.Config{}, &client.Clients{}, cirofake.NewFixturesBuilder().BuildListers())
+	if _, err := g.Plan(context.Background(), planTestConfig()); err == nil {
+		t.Fatal("expected a generator with clients that persist the changes to refuse to plan them")
+	}
+}
+
+func TestPlanCreate(t *testing.T) {
+	g := newPlanTestGenerator()
+
+	changes, err := g.Plan(context.Background(), planTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) == 0 || changes[0].Object != "Storage" || changes[0].Action != PlanActionCreate {
+		t.Errorf("expected the storage to be planned first for creation, got %v", changes)
+	}
+	for _, prefix := range []string{
+		"*v1.ClusterRole, Name=system:registry",
+		"*v1.ClusterRoleBinding, Name=registry-registry-role",
+		"*v1.ServiceAccount, Namespace=openshift-image-registry, Name=registry",
+		"*v1.Secret, Namespace=openshift-image-registry, Name=installation-pull-secrets",
+		"*v1.Service, Namespace=openshift-image-registry, Name=image-registry",
+		"*v1.Deployment, Namespace=openshift-image-registry, Name=image-registry",
+	} {
+		change := findPlannedChange(changes, prefix)
+		if change == nil {
+			t.Errorf("%s: not planned", prefix)
+			continue
+		}
+		if change.Action != PlanActionCreate {
+			t.Errorf("%s: got the action %s, want %s", prefix, change.Action, PlanActionCreate)
+		}
+		if change.Diff == "" {
+			t.Errorf("%s: expected the dump of the object", prefix)
+		}
+	}
+}
+
+func TestPlanUpdate(t *testing.T) {
+	// The current service is the one the operator would create.
+	scratch := newPlanTestGenerator()
+	gen := newGeneratorService(scratch.listers.Services, scratch.listers.NetworkConfigs, scratch.clients.Core)
+	o, err := gen.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := o.(*corev1.Service)
+
+	for _, tt := range []struct {
+		name   string
+		mutate func(svc *corev1.Service)
+		action PlanAction
+		diff   string
+	}{
+		{
+			name:   "unchanged",
+			mutate: func(svc *corev1.Service) {},
+			action: PlanActionUnchanged,
+		},
+		{
+			name: "written by another version",
+			mutate: func(svc *corev1.Service) {
+				svc.Annotations[defaults.ChecksumOperatorAnnotation] = "sha256:stale"
+				svc.Spec.Ports[0].Port = 5001
+			},
+			action: PlanActionUpdate,
+			diff:   "spec.ports.0.port",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := current.DeepCopy()
+			tt.mutate(svc)
+
+			changes, err := newPlanTestGenerator(svc).Plan(context.Background(), planTestConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			change := findPlannedChange(changes, "*v1.Service, ")
+			if change == nil {
+				t.Fatalf("the service is not planned: %v", changes)
+			}
+			if change.Action != tt.action {
+				t.Errorf("got the action %s, want %s: %s", change.Action, tt.action, change)
+			}
+			if !strings.Contains(change.Diff, tt.diff) {
+				t.Errorf("expected the diff to mention %q, got %q", tt.diff, change.Diff)
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package resource
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -51,6 +54,37 @@ func generateReadinessProbeConfig() *corev1.Probe {
 	return generateProbeConfig()
 }
 
+// generateStartupProbeConfig returns the startup probe of the registry
+// container, or nil if no startup probe is configured.
+func generateStartupProbeConfig(cr *v1.Config) (*corev1.Probe, error) {
+	startup := cr.Spec.Probes.Startup
+	if startup == nil {
+		return nil, nil
+	}
+
+	switch {
+	case startup.InitialDelaySeconds < 0:
+		return nil, fmt.Errorf("Probes.Startup.InitialDelaySeconds must be greater than or equal to 0")
+	case startup.PeriodSeconds < 0:
+		return nil, fmt.Errorf("Probes.Startup.PeriodSeconds must be greater than or equal to 0, 0 selects the default of 10")
+	case startup.FailureThreshold < 0:
+		return nil, fmt.Errorf("Probes.Startup.FailureThreshold must be greater than or equal to 0, 0 selects the default of 30")
+	}
+
+	probeConfig := generateProbeConfig()
+	probeConfig.InitialDelaySeconds = startup.InitialDelaySeconds
+	probeConfig.PeriodSeconds = startup.PeriodSeconds
+	if probeConfig.PeriodSeconds == 0 {
+		probeConfig.PeriodSeconds = 10
+	}
+	probeConfig.FailureThreshold = startup.FailureThreshold
+	if probeConfig.FailureThreshold == 0 {
+		probeConfig.FailureThreshold = 30
+	}
+
+	return probeConfig, nil
+}
+
 func generateProbeConfig() *corev1.Probe {
 	return &corev1.Probe{
 		TimeoutSeconds: int32(defaults.HealthzTimeoutSeconds),
@@ -92,6 +126,258 @@ func generateSecurityContext(coreClient coreset.CoreV1Interface, namespace strin
 	}, nil
 }
 
+// tlsMinVersions maps the TLS versions accepted in the registry config to
+// the values understood by the registry.
+var tlsMinVersions = map[string]string{
+	"VersionTLS10": "tls1.0",
+	"VersionTLS11": "tls1.1",
+	"VersionTLS12": "tls1.2",
+	"VersionTLS13": "tls1.3",
+}
+
+// generateTLSEnv returns the environment variables that configure the TLS
+// settings of the registry's HTTPS endpoint.
+func generateTLSEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	var env []corev1.EnvVar
+
+	if cr.Spec.TLS.MinVersion != "" {
+		version, ok := tlsMinVersions[cr.Spec.TLS.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("TLS.MinVersion: unsupported TLS version %q", cr.Spec.TLS.MinVersion)
+		}
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_TLS_MINIMUMTLS", Value: version})
+	}
+
+	if len(cr.Spec.TLS.CipherSuites) != 0 {
+		secure := map[string]bool{}
+		for _, c := range tls.CipherSuites() {
+			secure[c.Name] = true
+		}
+		for _, name := range cr.Spec.TLS.CipherSuites {
+			if !secure[name] {
+				return nil, fmt.Errorf("TLS.CipherSuites: unsupported or insecure cipher suite %q", name)
+			}
+		}
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_TLS_CIPHERSUITES", Value: "[" + strings.Join(cr.Spec.TLS.CipherSuites, ", ") + "]"})
+	}
+
+	return env, nil
+}
+
+// generateServerEnv returns the environment variables that configure the
+// registry's HTTP server.
+func generateServerEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	var env []corev1.EnvVar
+
+	switch cr.Spec.Server.HTTP2 {
+	case "", "Enabled":
+	case "Disabled":
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_HTTP2_DISABLED", Value: "true"})
+	default:
+		return nil, fmt.Errorf("Server.HTTP2: unsupported value %q, valid values are Enabled, Disabled", cr.Spec.Server.HTTP2)
+	}
+
+	// The registry has no worker pool of its own, requests are served by
+	// goroutines scheduled on GOMAXPROCS threads.
+	if cr.Spec.Server.Workers < 0 {
+		return nil, fmt.Errorf("Server.Workers: must not be negative, got %d", cr.Spec.Server.Workers)
+	}
+	if cr.Spec.Server.Workers > 0 {
+		env = append(env, corev1.EnvVar{Name: "GOMAXPROCS", Value: fmt.Sprintf("%d", cr.Spec.Server.Workers)})
+	}
+
+	return env, nil
+}
+
+// generateAuditEnv returns the environment variables that enable the access
+// log of the registry when audit logging is enabled. The access log has no
+// formatter of its own, the formatter of the registry applies to all its
+// logs and is left unchanged.
+func generateAuditEnv(cr *v1.Config) []corev1.EnvVar {
+	if !cr.Spec.Audit.Enabled {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{Name: "REGISTRY_LOG_ACCESSLOG_DISABLED", Value: "false"},
+	}
+}
+
+// generateCacheEnv returns the environment variables that configure the blob
+// descriptor cache of the registry. The cache is validated together with the
+// storage: a cache shared between the replicas would advertise blobs that are
+// only present in the emptyDir volume of another replica.
+func generateCacheEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	cache := cr.Spec.Cache
+	switch cache.BlobDescriptor {
+	case "", "InMemory":
+		if cache.Redis != nil {
+			return nil, fmt.Errorf("Cache.Redis: must not be set unless Cache.BlobDescriptor is Redis")
+		}
+		return []corev1.EnvVar{
+			{Name: "REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR", Value: "inmemory"},
+		}, nil
+	case "Redis":
+	default:
+		return nil, fmt.Errorf("Cache.BlobDescriptor: unsupported value %q, valid values are InMemory, Redis", cache.BlobDescriptor)
+	}
+
+	if cache.Redis == nil || cache.Redis.Address == "" {
+		return nil, fmt.Errorf("Cache.Redis.Address: must be set when Cache.BlobDescriptor is Redis")
+	}
+	if cache.Redis.DB < 0 {
+		return nil, fmt.Errorf("Cache.Redis.DB: must not be negative, got %d", cache.Redis.DB)
+	}
+	if cr.Spec.Storage.EmptyDir != nil {
+		return nil, fmt.Errorf("Cache.BlobDescriptor: Redis cannot be used with emptyDir storage, the blobs are not shared between the replicas")
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR", Value: "redis"},
+		{Name: "REGISTRY_REDIS_ADDR", Value: cache.Redis.Address},
+		{Name: "REGISTRY_REDIS_DB", Value: fmt.Sprintf("%d", cache.Redis.DB)},
+	}
+	if cache.Redis.PasswordSecret != "" {
+		env = append(env, corev1.EnvVar{
+			Name: "REGISTRY_REDIS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: cache.Redis.PasswordSecret,
+					},
+					Key: "password",
+				},
+			},
+		})
+	}
+	return env, nil
+}
+
+// mirrorCredentialsEnv returns the environment variable name of the registry
+// and the key of the credentials secret for one of the credentials of the
+// remote registry.
+func mirrorCredentialsEnv(name, secret, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secret,
+				},
+				Key: key,
+			},
+		},
+	}
+}
+
+// generateRequestTimeoutsEnv returns the environment variables that set the
+// timeouts of the registry connections. Nothing is set by default and the
+// registry keeps its connections open as long as the clients do.
+func generateRequestTimeoutsEnv(cr *v1.Config) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	timeouts := cr.Spec.RequestTimeouts
+	if timeouts.Read != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_TIMEOUT_READ", Value: timeouts.Read.Duration.String()})
+	}
+	if timeouts.Write != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_TIMEOUT_WRITE", Value: timeouts.Write.Duration.String()})
+	}
+	if timeouts.Idle != nil {
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_HTTP_TIMEOUT_IDLE", Value: timeouts.Idle.Duration.String()})
+	}
+	return env
+}
+
+// generateMirrorRegistryEnv returns the environment variables that make the
+// registry a pull-through cache of the remote registry.
+func generateMirrorRegistryEnv(cr *v1.Config) ([]corev1.EnvVar, error) {
+	mirror := cr.Spec.MirrorRegistry
+	if mirror == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(mirror.RemoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("MirrorRegistry.RemoteURL: %s", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("MirrorRegistry.RemoteURL: must be an https URL, got %q", mirror.RemoteURL)
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "REGISTRY_PROXY_REMOTEURL", Value: mirror.RemoteURL},
+	}
+	if mirror.CredentialsSecret != "" {
+		env = append(env,
+			mirrorCredentialsEnv("REGISTRY_PROXY_USERNAME", mirror.CredentialsSecret, "username"),
+			mirrorCredentialsEnv("REGISTRY_PROXY_PASSWORD", mirror.CredentialsSecret, "password"),
+		)
+	}
+	if mirror.TTL != nil {
+		if mirror.TTL.Duration <= 0 {
+			return nil, fmt.Errorf("MirrorRegistry.TTL: must be positive, got %s", mirror.TTL.Duration)
+		}
+		env = append(env, corev1.EnvVar{Name: "REGISTRY_PROXY_TTL", Value: mirror.TTL.Duration.String()})
+	}
+	return env, nil
+}
+
+// defaultUploadsBufferDirectory is where the scratch volume is mounted when
+// bufferMode is Disk and no directory is configured.
+const defaultUploadsBufferDirectory = "/var/lib/registry-uploads"
+
+// mountsOverlap returns true if one of the paths is the other one or one of
+// its parents.
+func mountsOverlap(a, b string) bool {
+	a, b = path.Clean(a), path.Clean(b)
+	return a == b || strings.HasPrefix(a, strings.TrimSuffix(b, "/")+"/") || strings.HasPrefix(b, strings.TrimSuffix(a, "/")+"/")
+}
+
+// generateUploadsConfig returns the environment variable, the volume and the
+// mount that move the temporary files of the registry to a scratch volume.
+// Only TMPDIR changes, the storage drivers keep buffering the chunks of the
+// uploads as they do without it. The scratch volume must not overlap with the
+// other mounts of the registry container, otherwise the temporary files would
+// be written to the storage or to a read-only volume.
+func generateUploadsConfig(cr *v1.Config, mounts []corev1.VolumeMount) ([]corev1.EnvVar, []corev1.Volume, []corev1.VolumeMount, error) {
+	uploads := cr.Spec.Uploads
+	switch uploads.BufferMode {
+	case "", "Memory":
+		if uploads.BufferDirectory != "" {
+			return nil, nil, nil, fmt.Errorf("Uploads.BufferDirectory: must not be set unless Uploads.BufferMode is Disk")
+		}
+		return nil, nil, nil, nil
+	case "Disk":
+	default:
+		return nil, nil, nil, fmt.Errorf("Uploads.BufferMode: unsupported value %q, valid values are Memory, Disk", uploads.BufferMode)
+	}
+
+	dir := uploads.BufferDirectory
+	if dir == "" {
+		dir = defaultUploadsBufferDirectory
+	}
+	if !path.IsAbs(dir) || path.Clean(dir) == "/" {
+		return nil, nil, nil, fmt.Errorf("Uploads.BufferDirectory: must be an absolute path other than /, got %q", dir)
+	}
+	dir = path.Clean(dir)
+	for _, m := range mounts {
+		if mountsOverlap(dir, m.MountPath) {
+			return nil, nil, nil, fmt.Errorf("Uploads.BufferDirectory: %s overlaps with the %s volume mounted at %s", dir, m.Name, m.MountPath)
+		}
+	}
+
+	vol := corev1.Volume{
+		Name: "registry-uploads",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	mount := corev1.VolumeMount{Name: vol.Name, MountPath: dir}
+	env := []corev1.EnvVar{
+		{Name: "TMPDIR", Value: dir},
+	}
+	return env, []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
+}
+
 func storageConfigure(driver storage.Driver) (envs []corev1.EnvVar, volumes []corev1.Volume, mounts []corev1.VolumeMount, err error) {
 	configenvs, err := driver.ConfigEnv()
 	if err != nil {
@@ -155,8 +441,32 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		corev1.EnvVar{Name: "REGISTRY_HTTP_SECRET", Value: cr.Spec.HTTPSecret},
 		corev1.EnvVar{Name: "REGISTRY_LOG_LEVEL", Value: generateLogLevel(cr)},
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_QUOTA_ENABLED", Value: "true"},
-		corev1.EnvVar{Name: "REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR", Value: "inmemory"},
-		corev1.EnvVar{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: "true"},
+	)
+
+	cacheEnv, err := generateCacheEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, cacheEnv...)
+	if cr.Spec.Cache.Redis != nil && cr.Spec.Cache.Redis.PasswordSecret != "" {
+		deps.AddSecret(cr.Spec.Cache.Redis.PasswordSecret)
+	}
+
+	mirrorEnv, err := generateMirrorRegistryEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, mirrorEnv...)
+	if cr.Spec.MirrorRegistry != nil && cr.Spec.MirrorRegistry.CredentialsSecret != "" {
+		deps.AddSecret(cr.Spec.MirrorRegistry.CredentialsSecret)
+	}
+
+	// The blobs can't be deleted from a storage with object lock before the
+	// end of their retention.
+	deleteEnabled := cr.Spec.Storage.S3 == nil || cr.Spec.Storage.S3.ObjectLock == nil
+
+	env = append(env,
+		corev1.EnvVar{Name: "REGISTRY_STORAGE_DELETE_ENABLED", Value: fmt.Sprintf("%t", deleteEnabled)},
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_METRICS_ENABLED", Value: "true"},
 		// TODO(dmage): sync with InternalRegistryHostname in origin
 		corev1.EnvVar{Name: "REGISTRY_OPENSHIFT_SERVER_ADDR", Value: fmt.Sprintf("%s.%s.svc:%d", defaults.ServiceName, defaults.ImageRegistryOperatorNamespace, defaults.ContainerPort)},
@@ -216,6 +526,15 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		)
 	}
 
+	if len(cr.Spec.TerminationMessagePath) != 0 && !path.IsAbs(cr.Spec.TerminationMessagePath) {
+		return corev1.PodTemplateSpec{}, deps, fmt.Errorf("TerminationMessagePath must be an absolute path")
+	}
+
+	startupProbe, err := generateStartupProbeConfig(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+
 	securityContext, err := generateSecurityContext(coreClient, defaults.ImageRegistryOperatorNamespace)
 	if err != nil {
 		return corev1.PodTemplateSpec{}, deps, fmt.Errorf("generate security context for deployment config: %s", err)
@@ -246,6 +565,21 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		corev1.EnvVar{Name: "REGISTRY_HTTP_TLS_KEY", Value: "/etc/secrets/tls.key"},
 	)
 
+	tlsEnv, err := generateTLSEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, tlsEnv...)
+
+	serverEnv, err := generateServerEnv(cr)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, serverEnv...)
+	env = append(env, generateRequestTimeoutsEnv(cr)...)
+
+	env = append(env, generateAuditEnv(cr)...)
+
 	volumes = append(volumes, corev1.Volume{
 		Name: "ca-trust-extracted",
 		VolumeSource: corev1.VolumeSource{
@@ -355,6 +689,14 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 	}
 	mounts = append(mounts, saMount)
 
+	uploadsEnv, uploadsVolumes, uploadsMounts, err := generateUploadsConfig(cr, mounts)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, deps, err
+	}
+	env = append(env, uploadsEnv...)
+	volumes = append(volumes, uploadsVolumes...)
+	mounts = append(mounts, uploadsMounts...)
+
 	image := os.Getenv("IMAGE")
 
 	resources := corev1.ResourceRequirements{
@@ -417,13 +759,27 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 		nodeSelectors["kubernetes.io/os"] = "linux"
 	}
 
+	// The tolerations are copied too, tolerationSeconds is a pointer into
+	// the config otherwise.
+	var tolerations []corev1.Toleration
+	for _, toleration := range cr.Spec.Tolerations {
+		tolerations = append(tolerations, *toleration.DeepCopy())
+	}
+
+	// The annotations are extended by the deployment generator, copy them
+	// so that the defaults are not modified.
+	annotations := map[string]string{}
+	for k, v := range defaults.DeploymentAnnotations {
+		annotations[k] = v
+	}
+
 	spec := corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      defaults.DeploymentLabels,
-			Annotations: defaults.DeploymentAnnotations,
+			Annotations: annotations,
 		},
 		Spec: corev1.PodSpec{
-			Tolerations:       cr.Spec.Tolerations,
+			Tolerations:       tolerations,
 			NodeSelector:      nodeSelectors,
 			PriorityClassName: "system-cluster-critical",
 			Containers: []corev1.Container{
@@ -445,7 +801,11 @@ func makePodTemplateSpec(coreClient coreset.CoreV1Interface, proxyLister configl
 					VolumeMounts:   mounts,
 					LivenessProbe:  generateLivenessProbeConfig(),
 					ReadinessProbe: generateReadinessProbeConfig(),
+					StartupProbe:   startupProbe,
 					Resources:      resources,
+
+					TerminationMessagePath:   cr.Spec.TerminationMessagePath,
+					TerminationMessagePolicy: cr.Spec.TerminationMessagePolicy,
 				},
 			},
 			Volumes:            volumes,
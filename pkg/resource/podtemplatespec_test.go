@@ -1,16 +1,22 @@
 package resource
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	configv1 "github.com/openshift/api/config/v1"
 	v1 "github.com/openshift/api/imageregistry/v1"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/filesystem"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
 )
 
 type volumeMount struct {
@@ -235,3 +241,1055 @@ func verifyMount(mount corev1.VolumeMount, expected *volumeMount, t *testing.T)
 		t.Errorf("expected mount path to be %s, got %s", expected.mountPath, mount.MountPath)
 	}
 }
+
+// makeTestPodTemplateSpec generates the pod template for config using an
+// emptyDir storage and a minimal set of fixtures.
+func makeTestPodTemplateSpec(t *testing.T, config *v1.Config) (corev1.PodTemplateSpec, error) {
+	t.Helper()
+
+	if config.Spec.Storage.EmptyDir == nil {
+		config.Spec.Storage.EmptyDir = &v1.ImageRegistryConfigStorageEmptyDir{}
+	}
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddRegistryOperatorConfig(config)
+	testBuilder.AddNamespaces(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+			},
+		},
+	})
+
+	fixture := testBuilder.Build()
+	driver := emptydir.NewDriver(config.Spec.Storage.EmptyDir, fixture.Listers)
+	pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+	return pod, err
+}
+
+// findContainerEnv returns the environment variable name from the registry
+// container, or nil if it is not set.
+func findContainerEnv(pod corev1.PodTemplateSpec, name string) *corev1.EnvVar {
+	for i, env := range pod.Spec.Containers[0].Env {
+		if env.Name == name {
+			return &pod.Spec.Containers[0].Env[i]
+		}
+	}
+	return nil
+}
+
+func TestMakePodTemplateSpecFilesystem(t *testing.T) {
+	config := &v1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Spec: v1.ImageRegistrySpec{
+			Storage: v1.ImageRegistryConfigStorage{
+				Filesystem: &v1.ImageRegistryConfigStorageFilesystem{
+					CSI: &corev1.CSIVolumeSource{
+						Driver: "webdav.csi.example.com",
+						VolumeAttributes: map[string]string{
+							"url": "https://webdav.example.com/registry",
+						},
+					},
+					RootDirectory: "docker",
+				},
+			},
+		},
+	}
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddRegistryOperatorConfig(config)
+	testBuilder.AddNamespaces(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+			},
+		},
+	})
+	fixture := testBuilder.Build()
+
+	driver := filesystem.NewDriver(config.Spec.Storage.Filesystem)
+	pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var volume *corev1.Volume
+	for i, vol := range pod.Spec.Volumes {
+		if vol.Name == "registry-storage" {
+			volume = &pod.Spec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.CSI == nil || volume.CSI.Driver != "webdav.csi.example.com" {
+		t.Fatalf("expected a registry-storage CSI volume, got %#v", volume)
+	}
+
+	var mount *corev1.VolumeMount
+	for i, m := range pod.Spec.Containers[0].VolumeMounts {
+		if m.Name == volume.Name {
+			mount = &pod.Spec.Containers[0].VolumeMounts[i]
+		}
+	}
+	if mount == nil || mount.MountPath != "/registry" {
+		t.Errorf("expected %s to be mounted at /registry, got %#v", volume.Name, mount)
+	}
+
+	for name, value := range map[string]string{
+		"REGISTRY_STORAGE":                          "filesystem",
+		"REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY": "/registry/docker",
+	} {
+		env := findContainerEnv(pod, name)
+		if env == nil {
+			t.Errorf("envvar %s not found", name)
+		} else if env.Value != value {
+			t.Errorf("%s: got %q, want %q", name, env.Value, value)
+		}
+	}
+}
+
+func TestMakePodTemplateSpecTLS(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		tls     v1.ImageRegistryConfigTLS
+		env     map[string]string
+		missing []string
+		err     string
+	}{
+		{
+			name:    "defaults",
+			missing: []string{"REGISTRY_HTTP_TLS_MINIMUMTLS", "REGISTRY_HTTP_TLS_CIPHERSUITES"},
+		},
+		{
+			name: "min version",
+			tls: v1.ImageRegistryConfigTLS{
+				MinVersion: "VersionTLS12",
+			},
+			env: map[string]string{
+				"REGISTRY_HTTP_TLS_MINIMUMTLS": "tls1.2",
+			},
+			missing: []string{"REGISTRY_HTTP_TLS_CIPHERSUITES"},
+		},
+		{
+			name: "cipher suites",
+			tls: v1.ImageRegistryConfigTLS{
+				MinVersion: "VersionTLS13",
+				CipherSuites: []string{
+					"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+					"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+				},
+			},
+			env: map[string]string{
+				"REGISTRY_HTTP_TLS_MINIMUMTLS":   "tls1.3",
+				"REGISTRY_HTTP_TLS_CIPHERSUITES": "[TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384]",
+			},
+		},
+		{
+			name: "invalid min version",
+			tls: v1.ImageRegistryConfigTLS{
+				MinVersion: "TLSv1.2",
+			},
+			err: `TLS.MinVersion: unsupported TLS version "TLSv1.2"`,
+		},
+		{
+			name: "insecure cipher suite",
+			tls: v1.ImageRegistryConfigTLS{
+				CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			},
+			err: `TLS.CipherSuites: unsupported or insecure cipher suite "TLS_RSA_WITH_RC4_128_SHA"`,
+		},
+		{
+			name: "unknown cipher suite",
+			tls: v1.ImageRegistryConfigTLS{
+				CipherSuites: []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+			},
+			err: `TLS.CipherSuites: unsupported or insecure cipher suite "ECDHE-RSA-AES128-GCM-SHA256"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					TLS: tt.tls,
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, value := range tt.env {
+				env := findContainerEnv(pod, name)
+				if env == nil {
+					t.Errorf("envvar %s not found", name)
+				} else if env.Value != value {
+					t.Errorf("%s: got %q, want %q", name, env.Value, value)
+				}
+			}
+			for _, name := range tt.missing {
+				if env := findContainerEnv(pod, name); env != nil {
+					t.Errorf("unexpected envvar %s=%q", name, env.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecHTTP2(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		http2    string
+		disabled bool
+		err      string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:  "enabled",
+			http2: "Enabled",
+		},
+		{
+			name:     "disabled",
+			http2:    "Disabled",
+			disabled: true,
+		},
+		{
+			name:  "invalid",
+			http2: "Off",
+			err:   `Server.HTTP2: unsupported value "Off", valid values are Enabled, Disabled`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Server: v1.ImageRegistryConfigServer{
+						HTTP2: tt.http2,
+					},
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env := findContainerEnv(pod, "REGISTRY_HTTP_HTTP2_DISABLED")
+			if tt.disabled {
+				if env == nil || env.Value != "true" {
+					t.Errorf("expected REGISTRY_HTTP_HTTP2_DISABLED=true, got %#v", env)
+				}
+			} else if env != nil {
+				t.Errorf("unexpected envvar %s=%q", env.Name, env.Value)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecWorkers(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		workers    int32
+		gomaxprocs string
+		err        string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:       "configured",
+			workers:    4,
+			gomaxprocs: "4",
+		},
+		{
+			name:    "negative",
+			workers: -1,
+			err:     "Server.Workers: must not be negative, got -1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Server: v1.ImageRegistryConfigServer{
+						HTTP2:   "Disabled",
+						Workers: tt.workers,
+					},
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if env := findContainerEnv(pod, "REGISTRY_HTTP_HTTP2_DISABLED"); env == nil || env.Value != "true" {
+				t.Errorf("expected REGISTRY_HTTP_HTTP2_DISABLED=true, got %#v", env)
+			}
+			env := findContainerEnv(pod, "GOMAXPROCS")
+			if tt.gomaxprocs != "" {
+				if env == nil || env.Value != tt.gomaxprocs {
+					t.Errorf("expected GOMAXPROCS=%s, got %#v", tt.gomaxprocs, env)
+				}
+			} else if env != nil {
+				t.Errorf("unexpected envvar %s=%q", env.Name, env.Value)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecRequestTimeouts(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		timeouts v1.ImageRegistryConfigRequestTimeouts
+		expected map[string]string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "configured",
+			timeouts: v1.ImageRegistryConfigRequestTimeouts{
+				Read:  &metav1.Duration{Duration: 5 * time.Minute},
+				Write: &metav1.Duration{Duration: 10 * time.Minute},
+				Idle:  &metav1.Duration{Duration: 90 * time.Second},
+			},
+			expected: map[string]string{
+				"REGISTRY_HTTP_TIMEOUT_READ":  "5m0s",
+				"REGISTRY_HTTP_TIMEOUT_WRITE": "10m0s",
+				"REGISTRY_HTTP_TIMEOUT_IDLE":  "1m30s",
+			},
+		},
+		{
+			name: "idle only",
+			timeouts: v1.ImageRegistryConfigRequestTimeouts{
+				Idle: &metav1.Duration{Duration: 30 * time.Second},
+			},
+			expected: map[string]string{
+				"REGISTRY_HTTP_TIMEOUT_IDLE": "30s",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					RequestTimeouts: tt.timeouts,
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range []string{"REGISTRY_HTTP_TIMEOUT_READ", "REGISTRY_HTTP_TIMEOUT_WRITE", "REGISTRY_HTTP_TIMEOUT_IDLE"} {
+				env := findContainerEnv(pod, name)
+				if value, ok := tt.expected[name]; ok {
+					if env == nil || env.Value != value {
+						t.Errorf("expected %s=%s, got %#v", name, value, env)
+					}
+				} else if env != nil {
+					t.Errorf("unexpected envvar %s=%q", env.Name, env.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecAudit(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		audit     v1.ImageRegistryConfigAudit
+		accessLog bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:      "enabled",
+			audit:     v1.ImageRegistryConfigAudit{Enabled: true},
+			accessLog: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Audit: tt.audit,
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			accessLog := findContainerEnv(pod, "REGISTRY_LOG_ACCESSLOG_DISABLED")
+			formatter := findContainerEnv(pod, "REGISTRY_LOG_FORMATTER")
+			// The audit settings must not change the format of the
+			// other registry logs.
+			if formatter != nil {
+				t.Errorf("unexpected envvar %s=%q", formatter.Name, formatter.Value)
+			}
+			if !tt.accessLog {
+				if accessLog != nil {
+					t.Errorf("unexpected envvar %s=%q", accessLog.Name, accessLog.Value)
+				}
+				return
+			}
+			if accessLog == nil || accessLog.Value != "false" {
+				t.Errorf("expected REGISTRY_LOG_ACCESSLOG_DISABLED=false, got %#v", accessLog)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecTerminationMessage(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		path           string
+		policy         corev1.TerminationMessagePolicy
+		expectedPath   string
+		expectedPolicy corev1.TerminationMessagePolicy
+		err            string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:           "fallback to logs on error",
+			policy:         corev1.TerminationMessageFallbackToLogsOnError,
+			expectedPolicy: corev1.TerminationMessageFallbackToLogsOnError,
+		},
+		{
+			name:           "custom path",
+			path:           "/var/log/registry/termination-log",
+			policy:         corev1.TerminationMessageReadFile,
+			expectedPath:   "/var/log/registry/termination-log",
+			expectedPolicy: corev1.TerminationMessageReadFile,
+		},
+		{
+			name: "relative path",
+			path: "termination-log",
+			err:  "TerminationMessagePath must be an absolute path",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					TerminationMessagePath:   tt.path,
+					TerminationMessagePolicy: tt.policy,
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			container := pod.Spec.Containers[0]
+			if container.TerminationMessagePath != tt.expectedPath {
+				t.Errorf("terminationMessagePath: got %q, want %q", container.TerminationMessagePath, tt.expectedPath)
+			}
+			if container.TerminationMessagePolicy != tt.expectedPolicy {
+				t.Errorf("terminationMessagePolicy: got %q, want %q", container.TerminationMessagePolicy, tt.expectedPolicy)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecStartupProbe(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		startup  *v1.ImageRegistryConfigStartupProbe
+		expected *corev1.Probe
+		err      string
+	}{
+		{
+			name: "no startup probe",
+		},
+		{
+			name:    "defaults",
+			startup: &v1.ImageRegistryConfigStartupProbe{},
+			expected: &corev1.Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 30,
+			},
+		},
+		{
+			name: "custom timing",
+			startup: &v1.ImageRegistryConfigStartupProbe{
+				InitialDelaySeconds: 5,
+				PeriodSeconds:       20,
+				FailureThreshold:    90,
+			},
+			expected: &corev1.Probe{
+				InitialDelaySeconds: 5,
+				PeriodSeconds:       20,
+				FailureThreshold:    90,
+			},
+		},
+		{
+			name: "negative period",
+			startup: &v1.ImageRegistryConfigStartupProbe{
+				PeriodSeconds: -10,
+			},
+			err: "Probes.Startup.PeriodSeconds must be greater than or equal to 0, 0 selects the default of 10",
+		},
+		{
+			name: "negative failure threshold",
+			startup: &v1.ImageRegistryConfigStartupProbe{
+				FailureThreshold: -1,
+			},
+			err: "Probes.Startup.FailureThreshold must be greater than or equal to 0, 0 selects the default of 30",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Probes: v1.ImageRegistryConfigProbes{
+						Startup: tt.startup,
+					},
+				},
+			}
+
+			pod, err := makeTestPodTemplateSpec(t, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			probe := pod.Spec.Containers[0].StartupProbe
+			if tt.expected == nil {
+				if probe != nil {
+					t.Errorf("unexpected startup probe %#v", probe)
+				}
+				return
+			}
+			if probe == nil {
+				t.Fatal("expected a startup probe")
+			}
+			if probe.InitialDelaySeconds != tt.expected.InitialDelaySeconds || probe.PeriodSeconds != tt.expected.PeriodSeconds || probe.FailureThreshold != tt.expected.FailureThreshold {
+				t.Errorf("unexpected startup probe timing: initialDelaySeconds=%d periodSeconds=%d failureThreshold=%d", probe.InitialDelaySeconds, probe.PeriodSeconds, probe.FailureThreshold)
+			}
+			if probe.HTTPGet == nil || probe.HTTPGet.Path != defaults.HealthzRoute {
+				t.Errorf("expected the startup probe to check %s, got %#v", defaults.HealthzRoute, probe.Handler)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecCache(t *testing.T) {
+	s3Storage := v1.ImageRegistryConfigStorage{
+		S3: &v1.ImageRegistryConfigStorageS3{
+			Bucket: "registry",
+			Region: "us-east-1",
+		},
+	}
+	emptyDirStorage := v1.ImageRegistryConfigStorage{
+		EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+	}
+
+	for _, tt := range []struct {
+		name           string
+		storage        v1.ImageRegistryConfigStorage
+		cache          v1.ImageRegistryConfigCache
+		expectedEnv    map[string]string
+		passwordSecret string
+		err            string
+	}{
+		{
+			name:        "defaults",
+			storage:     s3Storage,
+			expectedEnv: map[string]string{"REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR": "inmemory"},
+		},
+		{
+			name:    "redis with s3 storage",
+			storage: s3Storage,
+			cache: v1.ImageRegistryConfigCache{
+				BlobDescriptor: "Redis",
+				Redis: &v1.ImageRegistryConfigCacheRedis{
+					Address:        "redis.example.com:6379",
+					DB:             2,
+					PasswordSecret: "redis-password",
+				},
+			},
+			expectedEnv: map[string]string{
+				"REGISTRY_STORAGE":                      "s3",
+				"REGISTRY_STORAGE_S3_BUCKET":            "registry",
+				"REGISTRY_STORAGE_CACHE_BLOBDESCRIPTOR": "redis",
+				"REGISTRY_REDIS_ADDR":                   "redis.example.com:6379",
+				"REGISTRY_REDIS_DB":                     "2",
+			},
+			passwordSecret: "redis-password",
+		},
+		{
+			name:    "redis without address",
+			storage: s3Storage,
+			cache:   v1.ImageRegistryConfigCache{BlobDescriptor: "Redis"},
+			err:     "Cache.Redis.Address: must be set when Cache.BlobDescriptor is Redis",
+		},
+		{
+			name:    "redis settings with in-memory cache",
+			storage: s3Storage,
+			cache: v1.ImageRegistryConfigCache{
+				Redis: &v1.ImageRegistryConfigCacheRedis{Address: "redis.example.com:6379"},
+			},
+			err: "Cache.Redis: must not be set unless Cache.BlobDescriptor is Redis",
+		},
+		{
+			name:    "redis with emptyDir storage",
+			storage: emptyDirStorage,
+			cache: v1.ImageRegistryConfigCache{
+				BlobDescriptor: "Redis",
+				Redis:          &v1.ImageRegistryConfigCacheRedis{Address: "redis.example.com:6379"},
+			},
+			err: "Cache.BlobDescriptor: Redis cannot be used with emptyDir storage, the blobs are not shared between the replicas",
+		},
+		{
+			name:    "invalid",
+			storage: s3Storage,
+			cache:   v1.ImageRegistryConfigCache{BlobDescriptor: "Memcached"},
+			err:     `Cache.BlobDescriptor: unsupported value "Memcached", valid values are InMemory, Redis`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: tt.storage,
+					Cache:   tt.cache,
+				},
+			}
+
+			fixture := cirofake.NewFixturesBuilder().AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-1",
+						},
+					},
+				},
+			}).AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+					},
+				},
+			}).Build()
+
+			var driver storage.Driver
+			if tt.storage.S3 != nil {
+				driver = s3.NewDriver(context.Background(), tt.storage.S3, fixture.Listers)
+			} else {
+				driver = emptydir.NewDriver(tt.storage.EmptyDir, fixture.Listers)
+			}
+
+			pod, deps, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, value := range tt.expectedEnv {
+				env := findContainerEnv(pod, name)
+				if env == nil || env.Value != value {
+					t.Errorf("expected %s=%s, got %#v", name, value, env)
+				}
+			}
+
+			password := findContainerEnv(pod, "REGISTRY_REDIS_PASSWORD")
+			if tt.passwordSecret == "" {
+				if password != nil {
+					t.Errorf("unexpected envvar %s", password.Name)
+				}
+				return
+			}
+			if password == nil || password.ValueFrom == nil || password.ValueFrom.SecretKeyRef == nil ||
+				password.ValueFrom.SecretKeyRef.Name != tt.passwordSecret || password.ValueFrom.SecretKeyRef.Key != "password" {
+				t.Fatalf("expected REGISTRY_REDIS_PASSWORD from the secret %s, got %#v", tt.passwordSecret, password)
+			}
+			if _, ok := deps.secrets[tt.passwordSecret]; !ok {
+				t.Errorf("expected the deployment to depend on the secret %s", tt.passwordSecret)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecMirrorRegistry(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		mirror            *v1.ImageRegistryConfigMirrorRegistry
+		expectedEnv       map[string]string
+		credentialsSecret string
+		err               string
+	}{
+		{
+			name: "not a mirror",
+		},
+		{
+			name:   "anonymous",
+			mirror: &v1.ImageRegistryConfigMirrorRegistry{RemoteURL: "https://registry-1.docker.io"},
+			expectedEnv: map[string]string{
+				"REGISTRY_PROXY_REMOTEURL": "https://registry-1.docker.io",
+			},
+		},
+		{
+			name: "with credentials",
+			mirror: &v1.ImageRegistryConfigMirrorRegistry{
+				RemoteURL:         "https://registry-1.docker.io",
+				CredentialsSecret: "docker-io-credentials",
+			},
+			expectedEnv: map[string]string{
+				"REGISTRY_PROXY_REMOTEURL": "https://registry-1.docker.io",
+			},
+			credentialsSecret: "docker-io-credentials",
+		},
+		{
+			name:   "http",
+			mirror: &v1.ImageRegistryConfigMirrorRegistry{RemoteURL: "http://registry-1.docker.io"},
+			err:    `MirrorRegistry.RemoteURL: must be an https URL, got "http://registry-1.docker.io"`,
+		},
+		{
+			name:   "without host",
+			mirror: &v1.ImageRegistryConfigMirrorRegistry{RemoteURL: "registry-1.docker.io"},
+			err:    `MirrorRegistry.RemoteURL: must be an https URL, got "registry-1.docker.io"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: v1.ImageRegistryConfigStorage{
+						EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+					},
+					MirrorRegistry: tt.mirror,
+				},
+			}
+
+			fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+					},
+				},
+			}).Build()
+
+			driver := emptydir.NewDriver(config.Spec.Storage.EmptyDir, fixture.Listers)
+
+			pod, deps, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.mirror == nil {
+				if env := findContainerEnv(pod, "REGISTRY_PROXY_REMOTEURL"); env != nil {
+					t.Errorf("unexpected envvar %s", env.Name)
+				}
+			}
+			for name, value := range tt.expectedEnv {
+				env := findContainerEnv(pod, name)
+				if env == nil || env.Value != value {
+					t.Errorf("expected %s=%s, got %#v", name, value, env)
+				}
+			}
+
+			// The credentials are read from the username and password keys
+			// of the secret.
+			for name, key := range map[string]string{
+				"REGISTRY_PROXY_USERNAME": "username",
+				"REGISTRY_PROXY_PASSWORD": "password",
+			} {
+				env := findContainerEnv(pod, name)
+				if tt.credentialsSecret == "" {
+					if env != nil {
+						t.Errorf("unexpected envvar %s", env.Name)
+					}
+					continue
+				}
+				if env == nil || env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil ||
+					env.ValueFrom.SecretKeyRef.Name != tt.credentialsSecret || env.ValueFrom.SecretKeyRef.Key != key {
+					t.Errorf("expected %s from the key %s of the secret %s, got %#v", name, key, tt.credentialsSecret, env)
+				}
+			}
+			if tt.credentialsSecret != "" {
+				if _, ok := deps.secrets[tt.credentialsSecret]; !ok {
+					t.Errorf("expected the deployment to depend on the secret %s", tt.credentialsSecret)
+				}
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecMirrorRegistryTTL(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		ttl         *metav1.Duration
+		expectedTTL string
+		err         string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:        "ttl",
+			ttl:         &metav1.Duration{Duration: 12 * time.Hour},
+			expectedTTL: "12h0m0s",
+		},
+		{
+			name: "zero ttl",
+			ttl:  &metav1.Duration{},
+			err:  "MirrorRegistry.TTL: must be positive, got 0s",
+		},
+		{
+			name: "negative ttl",
+			ttl:  &metav1.Duration{Duration: -time.Hour},
+			err:  "MirrorRegistry.TTL: must be positive, got -1h0m0s",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: v1.ImageRegistryConfigStorage{
+						EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+					},
+					MirrorRegistry: &v1.ImageRegistryConfigMirrorRegistry{
+						RemoteURL: "https://registry-1.docker.io",
+						TTL:       tt.ttl,
+					},
+				},
+			}
+
+			fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+					},
+				},
+			}).Build()
+
+			driver := emptydir.NewDriver(config.Spec.Storage.EmptyDir, fixture.Listers)
+
+			pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env := findContainerEnv(pod, "REGISTRY_PROXY_TTL")
+			if tt.expectedTTL == "" {
+				if env != nil {
+					t.Errorf("unexpected envvar %s=%s", env.Name, env.Value)
+				}
+			} else if env == nil || env.Value != tt.expectedTTL {
+				t.Errorf("expected REGISTRY_PROXY_TTL=%s, got %#v", tt.expectedTTL, env)
+			}
+		})
+	}
+}
+
+func TestMakePodTemplateSpecUploads(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		uploads       v1.ImageRegistryConfigUploads
+		expectedMount string
+		err           string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:    "memory",
+			uploads: v1.ImageRegistryConfigUploads{BufferMode: "Memory"},
+		},
+		{
+			name:          "disk",
+			uploads:       v1.ImageRegistryConfigUploads{BufferMode: "Disk"},
+			expectedMount: "/var/lib/registry-uploads",
+		},
+		{
+			name:          "disk with directory",
+			uploads:       v1.ImageRegistryConfigUploads{BufferMode: "Disk", BufferDirectory: "/scratch/uploads/"},
+			expectedMount: "/scratch/uploads",
+		},
+		{
+			name:    "unsupported mode",
+			uploads: v1.ImageRegistryConfigUploads{BufferMode: "Tmpfs"},
+			err:     `Uploads.BufferMode: unsupported value "Tmpfs", valid values are Memory, Disk`,
+		},
+		{
+			name:    "directory in memory mode",
+			uploads: v1.ImageRegistryConfigUploads{BufferDirectory: "/scratch"},
+			err:     "Uploads.BufferDirectory: must not be set unless Uploads.BufferMode is Disk",
+		},
+		{
+			name:    "relative directory",
+			uploads: v1.ImageRegistryConfigUploads{BufferMode: "Disk", BufferDirectory: "scratch"},
+			err:     `Uploads.BufferDirectory: must be an absolute path other than /, got "scratch"`,
+		},
+		{
+			name:    "directory in the storage",
+			uploads: v1.ImageRegistryConfigUploads{BufferMode: "Disk", BufferDirectory: "/registry/uploads"},
+			err:     "Uploads.BufferDirectory: /registry/uploads overlaps with the registry-storage volume mounted at /registry",
+		},
+		{
+			name:    "directory containing the certificates",
+			uploads: v1.ImageRegistryConfigUploads{BufferMode: "Disk", BufferDirectory: "/etc"},
+			err:     "Uploads.BufferDirectory: /etc overlaps with the registry-tls volume mounted at /etc/secrets",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &v1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Spec: v1.ImageRegistrySpec{
+					Storage: v1.ImageRegistryConfigStorage{
+						EmptyDir: &v1.ImageRegistryConfigStorageEmptyDir{},
+					},
+					Uploads: tt.uploads,
+				},
+			}
+
+			fixture := cirofake.NewFixturesBuilder().AddNamespaces(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						defaults.SupplementalGroupsAnnotation: "1000430000/10000",
+					},
+				},
+			}).Build()
+
+			driver := emptydir.NewDriver(config.Spec.Storage.EmptyDir, fixture.Listers)
+
+			pod, _, err := makePodTemplateSpec(fixture.KubeClient.CoreV1(), fixture.Listers.ProxyConfigs, driver, config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var volume *corev1.Volume
+			for i := range pod.Spec.Volumes {
+				if pod.Spec.Volumes[i].Name == "registry-uploads" {
+					volume = &pod.Spec.Volumes[i]
+				}
+			}
+			var mount *corev1.VolumeMount
+			for i, m := range pod.Spec.Containers[0].VolumeMounts {
+				if m.Name == "registry-uploads" {
+					mount = &pod.Spec.Containers[0].VolumeMounts[i]
+				}
+			}
+
+			if tt.expectedMount == "" {
+				if volume != nil || mount != nil {
+					t.Errorf("unexpected scratch volume %#v mounted at %#v", volume, mount)
+				}
+				if env := findContainerEnv(pod, "TMPDIR"); env != nil {
+					t.Errorf("unexpected envvar %s", env.Name)
+				}
+				return
+			}
+
+			if volume == nil || volume.EmptyDir == nil {
+				t.Fatalf("expected an emptyDir scratch volume, got %#v", volume)
+			}
+			if mount == nil || mount.MountPath != tt.expectedMount {
+				t.Fatalf("expected the scratch volume to be mounted at %s, got %#v", tt.expectedMount, mount)
+			}
+			if env := findContainerEnv(pod, "TMPDIR"); env == nil || env.Value != tt.expectedMount {
+				t.Errorf("expected TMPDIR=%s, got %#v", tt.expectedMount, env)
+			}
+			for _, name := range []string{"REGISTRY_OPENSHIFT_UPLOADS_BUFFER", "REGISTRY_OPENSHIFT_UPLOADS_BUFFERDIRECTORY"} {
+				if env := findContainerEnv(pod, name); env != nil {
+					t.Errorf("unexpected envvar %s", env.Name)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	batchapi "k8s.io/api/batch/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	kcorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -41,21 +42,27 @@ var (
 	defaultAffinity kcorev1.Affinity
 )
 
+// maxPrunerParallelism is the highest number of workers the pruner is
+// allowed to use, more workers would overload the registry and the API.
+const maxPrunerParallelism = 16
+
 var _ Mutator = &generatorPrunerCronJob{}
 
 type generatorPrunerCronJob struct {
-	lister            batchlisters.CronJobNamespaceLister
-	client            batchset.BatchV1Interface
-	prunerLister      imageregistryv1listers.ImagePrunerLister
-	imageConfigLister configv1listers.ImageLister
+	lister               batchlisters.CronJobNamespaceLister
+	client               batchset.BatchV1Interface
+	prunerLister         imageregistryv1listers.ImagePrunerLister
+	registryConfigLister imageregistryv1listers.ConfigLister
+	imageConfigLister    configv1listers.ImageLister
 }
 
-func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, imageConfigLister configv1listers.ImageLister) *generatorPrunerCronJob {
+func newGeneratorPrunerCronJob(lister batchlisters.CronJobNamespaceLister, client batchset.BatchV1Interface, prunerLister imageregistryv1listers.ImagePrunerLister, registryConfigLister imageregistryv1listers.ConfigLister, imageConfigLister configv1listers.ImageLister) *generatorPrunerCronJob {
 	return &generatorPrunerCronJob{
-		lister:            lister,
-		client:            client,
-		prunerLister:      prunerLister,
-		imageConfigLister: imageConfigLister,
+		lister:               lister,
+		client:               client,
+		prunerLister:         prunerLister,
+		registryConfigLister: registryConfigLister,
+		imageConfigLister:    imageConfigLister,
 	}
 }
 
@@ -94,7 +101,22 @@ func (gcj *generatorPrunerCronJob) expected() (runtime.Object, error) {
 		fmt.Sprintf("--loglevel=%d", gcj.getLogLevel(cr)),
 	}
 
-	if imageConfig.Status.InternalRegistryHostname != "" {
+	parallelism, err := gcj.getParallelism(cr)
+	if err != nil {
+		return nil, err
+	}
+	if parallelism != 0 {
+		args = append(args, fmt.Sprintf("--num-workers=%d", parallelism))
+	}
+
+	objectLocked, err := gcj.storageObjectLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	// The blobs of a storage with object lock can't be deleted, only the
+	// image objects are pruned.
+	if imageConfig.Status.InternalRegistryHostname != "" && !objectLocked {
 		args = append(args,
 			"--prune-registry=true",
 			fmt.Sprintf("--registry-url=https://%s", imageConfig.Status.InternalRegistryHostname),
@@ -239,6 +261,30 @@ func (gcj *generatorPrunerCronJob) getKeepYoungerThan(cr *imageregistryapiv1.Ima
 	return defaultKeepYoungerThan
 }
 
+// getParallelism returns the number of workers for the prune command, 0 means
+// that the default of the command is used.
+func (gcj *generatorPrunerCronJob) getParallelism(cr *imageregistryapiv1.ImagePruner) (int32, error) {
+	if cr.Spec.Parallelism == nil {
+		return 0, nil
+	}
+	if p := *cr.Spec.Parallelism; p < 1 || p > maxPrunerParallelism {
+		return 0, fmt.Errorf("parallelism must be between 1 and %d, got %d", maxPrunerParallelism, p)
+	}
+	return *cr.Spec.Parallelism, nil
+}
+
+// storageObjectLocked returns whether object lock (WORM) is enabled on the
+// storage of the registry.
+func (gcj *generatorPrunerCronJob) storageObjectLocked() (bool, error) {
+	cr, err := gcj.registryConfigLister.Get(defaults.ImageRegistryResourceName)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return cr.Spec.Storage.S3 != nil && cr.Spec.Storage.S3.ObjectLock != nil, nil
+}
+
 func (gcj *generatorPrunerCronJob) getLogLevel(cr *imageregistryapiv1.ImagePruner) int {
 	level := loglevel.LogLevelToVerbosity(cr.Spec.LogLevel)
 	if level == 2 {
@@ -1,12 +1,20 @@
 package resource
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 
+	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	configv1listers "github.com/openshift/client-go/config/listers/config/v1"
+	imageregistryv1listers "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
 func TestGetKeepYoungerThan(t *testing.T) {
@@ -90,3 +98,159 @@ func TestLogLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestParallelism(t *testing.T) {
+	int32p := func(i int32) *int32 { return &i }
+
+	testCases := []struct {
+		name        string
+		parallelism *int32
+		want        string
+		err         string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:        "several workers",
+			parallelism: int32p(4),
+			want:        "--num-workers=4",
+		},
+		{
+			name:        "no workers",
+			parallelism: int32p(0),
+			err:         "parallelism must be between 1 and 16, got 0",
+		},
+		{
+			name:        "too many workers",
+			parallelism: int32p(100),
+			err:         "parallelism must be between 1 and 16, got 100",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pruners := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := pruners.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryImagePrunerResourceName,
+				},
+				Spec: imageregistryv1.ImagePrunerSpec{
+					Parallelism: tc.parallelism,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigs.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageConfigName,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			registryConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+			g := newGeneratorPrunerCronJob(nil, nil, imageregistryv1listers.NewImagePrunerLister(pruners), imageregistryv1listers.NewConfigLister(registryConfigs), configv1listers.NewImageLister(imageConfigs))
+			obj, err := g.expected()
+			if len(tc.err) != 0 {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var workers []string
+			for _, arg := range obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args {
+				if strings.HasPrefix(arg, "--num-workers=") {
+					workers = append(workers, arg)
+				}
+			}
+			if len(tc.want) == 0 {
+				if len(workers) != 0 {
+					t.Errorf("expected no workers flag, got %v", workers)
+				}
+			} else if len(workers) != 1 || workers[0] != tc.want {
+				t.Errorf("expected %s, got %v", tc.want, workers)
+			}
+		})
+	}
+}
+
+func TestPruneRegistryObjectLock(t *testing.T) {
+	testCases := []struct {
+		name       string
+		objectLock *imageregistryv1.ImageRegistryConfigStorageS3ObjectLock
+		want       string
+	}{
+		{
+			name: "no object lock",
+			want: "--prune-registry=true",
+		},
+		{
+			name: "object lock",
+			objectLock: &imageregistryv1.ImageRegistryConfigStorageS3ObjectLock{
+				Mode:          "Compliance",
+				RetentionDays: 30,
+			},
+			want: "--prune-registry=false",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pruners := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := pruners.Add(&imageregistryv1.ImagePruner{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryImagePrunerResourceName,
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			registryConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := registryConfigs.Add(&imageregistryv1.Config{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageRegistryResourceName,
+				},
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							ObjectLock: tc.objectLock,
+						},
+					},
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			imageConfigs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := imageConfigs.Add(&configv1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: defaults.ImageConfigName,
+				},
+				Status: configv1.ImageStatus{
+					InternalRegistryHostname: "image-registry.openshift-image-registry.svc:5000",
+				},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			g := newGeneratorPrunerCronJob(nil, nil, imageregistryv1listers.NewImagePrunerLister(pruners), imageregistryv1listers.NewConfigLister(registryConfigs), configv1listers.NewImageLister(imageConfigs))
+			obj, err := g.expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var pruneRegistry []string
+			for _, arg := range obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec.Containers[0].Args {
+				if strings.HasPrefix(arg, "--prune-registry=") {
+					pruneRegistry = append(pruneRegistry, arg)
+				}
+			}
+			if len(pruneRegistry) != 1 || pruneRegistry[0] != tc.want {
+				t.Errorf("expected %s, got %v", tc.want, pruneRegistry)
+			}
+		})
+	}
+}
@@ -76,6 +76,12 @@ func (gs *generatorPullSecret) Create() (runtime.Object, error) {
 }
 
 func (gs *generatorPullSecret) Update(o runtime.Object) (runtime.Object, bool, error) {
+	n, err := gs.expected()
+	if err != nil {
+		return o, false, err
+	}
+	forgetChecksumOnDrift(o.(*corev1.Secret), n.(*corev1.Secret))
+
 	return commonUpdate(gs, o, func(obj runtime.Object) (runtime.Object, error) {
 		return gs.client.Secrets(gs.GetNamespace()).Update(
 			context.TODO(), obj.(*corev1.Secret), metav1.UpdateOptions{},
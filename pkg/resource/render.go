@@ -0,0 +1,331 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+
+	appsapi "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	routeapi "github.com/openshift/api/route/v1"
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
+	regoplisters "github.com/openshift/client-go/imageregistry/listers/imageregistry/v1"
+	routelisters "github.com/openshift/client-go/route/listers/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
+)
+
+// RedactedValue replaces the values of the rendered storage secret.
+const RedactedValue = "<redacted>"
+
+// RenderInputs holds the cluster state used by Render in place of an API
+// server.
+type RenderInputs struct {
+	Config         *imageregistryv1.Config
+	Infrastructure *configv1.Infrastructure
+	Proxy          *configv1.Proxy
+	// Namespace is the operator namespace. A namespace with the default
+	// supplemental groups range is used when it is nil.
+	Namespace  *corev1.Namespace
+	Secrets    []*corev1.Secret
+	ConfigMaps []*corev1.ConfigMap
+}
+
+// Render writes the Deployment, Service, Routes and storage Secret that the
+// operator would apply for the given inputs as a YAML stream. The objects are
+// generated by the same generators the operator uses, backed by in-memory
+// clients, so no API server or storage provider is contacted. The objects are
+// validated before they are written, see validateRendered. Values of the
+// storage secret and route private keys are redacted.
+func Render(w io.Writer, in *RenderInputs) error {
+	if in.Config == nil {
+		return fmt.Errorf("no image registry configuration provided")
+	}
+	cr := in.Config.DeepCopy()
+
+	namespace := in.Namespace
+	if namespace == nil {
+		namespace = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: defaults.ImageRegistryOperatorNamespace,
+				Annotations: map[string]string{
+					defaults.SupplementalGroupsAnnotation: "1000000000/10000",
+				},
+			},
+		}
+	}
+	listers, err := newRenderListers(in, cr)
+	if err != nil {
+		return err
+	}
+	coreClient := &renderCoreClient{namespace: namespace}
+
+	// The kubeconfig is only used by drivers to build clients for
+	// managing the storage, which never happens while rendering.
+	kubeconfig := &rest.Config{}
+	driver, err := storage.NewDriver(context.TODO(), &cr.Spec.Storage, kubeconfig, listers)
+	if err == storage.ErrStorageNotConfigured {
+		cr.Spec.Storage, _, err = storage.GetPlatformStorage(listers)
+		if err != nil {
+			return fmt.Errorf("unable to get storage configuration from the infrastructure: %s", err)
+		}
+		driver, err = storage.NewDriver(context.TODO(), &cr.Spec.Storage, kubeconfig, listers)
+	}
+	if err != nil {
+		return err
+	}
+
+	deploy, err := newGeneratorDeployment(listers.Deployments, listers.ConfigMaps, listers.Secrets, listers.ProxyConfigs, coreClient, nil, driver, cr).expected()
+	if err != nil {
+		return fmt.Errorf("unable to render deployment: %s", err)
+	}
+	deploy.GetObjectKind().SetGroupVersionKind(appsapi.SchemeGroupVersion.WithKind("Deployment"))
+
+	svc, err := newGeneratorService(listers.Services, listers.NetworkConfigs, coreClient).expected()
+	if err != nil {
+		return fmt.Errorf("unable to render service: %s", err)
+	}
+	svc.GetObjectKind().SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+
+	objs := []runtime.Object{deploy, svc}
+
+	var routes []*routeapi.Route
+	g := NewGenerator(kubeconfig, &client.Clients{}, listers)
+	for _, gen := range g.listRoutes(cr) {
+		o, err := gen.(*generatorRoute).expected()
+		if err != nil {
+			return fmt.Errorf("unable to render route %s: %s", gen.GetName(), err)
+		}
+		route := o.(*routeapi.Route)
+		if tls := route.Spec.TLS; tls != nil && tls.Key != "" {
+			tls.Key = RedactedValue
+		}
+		route.GetObjectKind().SetGroupVersionKind(routeapi.GroupVersion.WithKind("Route"))
+		routes = append(routes, route)
+		objs = append(objs, route)
+	}
+
+	sec, err := newGeneratorSecret(listers.Secrets, coreClient, driver).expected()
+	if err != nil {
+		return fmt.Errorf("unable to render storage secret: %s", err)
+	}
+	RedactSecret(sec.(*corev1.Secret))
+	sec.GetObjectKind().SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+	objs = append(objs, sec)
+
+	if err := validateRendered(deploy.(*appsapi.Deployment), svc, routes, sec.(*corev1.Secret)); err != nil {
+		return fmt.Errorf("rendered manifests are invalid: %s", err)
+	}
+
+	for i, o := range objs {
+		buf, err := yaml.Marshal(o)
+		if err != nil {
+			return fmt.Errorf("unable to marshal %s: %s", o.GetObjectKind().GroupVersionKind().Kind, err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedactSecret replaces the values of the secret with RedactedValue.
+func RedactSecret(sec *corev1.Secret) {
+	for k := range sec.StringData {
+		sec.StringData[k] = RedactedValue
+	}
+	for k := range sec.Data {
+		sec.Data[k] = []byte(RedactedValue)
+	}
+}
+
+// newRenderListers builds listers backed by in-memory indexers that only hold
+// the objects of the render inputs.
+func newRenderListers(in *RenderInputs, cr *imageregistryv1.Config) (*client.Listers, error) {
+	newIndexer := func(objs ...interface{}) (cache.Indexer, error) {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, o := range objs {
+			if err := indexer.Add(o); err != nil {
+				return nil, err
+			}
+		}
+		return indexer, nil
+	}
+
+	var secrets, configMaps, infrastructures, proxies []interface{}
+	for _, sec := range in.Secrets {
+		secrets = append(secrets, sec)
+	}
+	for _, cm := range in.ConfigMaps {
+		configMaps = append(configMaps, cm)
+	}
+	if in.Infrastructure != nil {
+		infrastructures = append(infrastructures, in.Infrastructure)
+	}
+	if in.Proxy != nil {
+		proxies = append(proxies, in.Proxy)
+	}
+
+	secretsIndexer, err := newIndexer(secrets...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add secrets: %s", err)
+	}
+	configMapsIndexer, err := newIndexer(configMaps...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add config maps: %s", err)
+	}
+	registryConfigsIndexer, err := newIndexer(cr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add the image registry configuration: %s", err)
+	}
+	infrastructuresIndexer, err := newIndexer(infrastructures...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add the infrastructure: %s", err)
+	}
+	proxiesIndexer, err := newIndexer(proxies...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add the proxy: %s", err)
+	}
+	empty, _ := newIndexer()
+
+	secretsLister := corelisters.NewSecretLister(secretsIndexer)
+	configMapsLister := corelisters.NewConfigMapLister(configMapsIndexer)
+	return &client.Listers{
+		Deployments:            appslisters.NewDeploymentLister(empty).Deployments(defaults.ImageRegistryOperatorNamespace),
+		Services:               corelisters.NewServiceLister(empty).Services(defaults.ImageRegistryOperatorNamespace),
+		Secrets:                secretsLister.Secrets(defaults.ImageRegistryOperatorNamespace),
+		ConfigMaps:             configMapsLister.ConfigMaps(defaults.ImageRegistryOperatorNamespace),
+		ServiceAccounts:        corelisters.NewServiceAccountLister(empty).ServiceAccounts(defaults.ImageRegistryOperatorNamespace),
+		PodDisruptionBudgets:   policylisters.NewPodDisruptionBudgetLister(empty).PodDisruptionBudgets(defaults.ImageRegistryOperatorNamespace),
+		NetworkPolicies:        networkinglisters.NewNetworkPolicyLister(empty).NetworkPolicies(defaults.ImageRegistryOperatorNamespace),
+		Routes:                 routelisters.NewRouteLister(empty).Routes(defaults.ImageRegistryOperatorNamespace),
+		ClusterRoles:           rbaclisters.NewClusterRoleLister(empty),
+		ClusterRoleBindings:    rbaclisters.NewClusterRoleBindingLister(empty),
+		OpenShiftConfig:        configMapsLister.ConfigMaps(defaults.OpenShiftConfigNamespace),
+		OpenShiftConfigManaged: configMapsLister.ConfigMaps(defaults.OpenShiftConfigManagedNamespace),
+		OpenShiftConfigSecrets: secretsLister.Secrets(defaults.OpenShiftConfigNamespace),
+		RegistryConfigs:        regoplisters.NewConfigLister(registryConfigsIndexer),
+		InstallerConfigMaps:    configMapsLister.ConfigMaps("kube-system"),
+		ProxyConfigs:           configlisters.NewProxyLister(proxiesIndexer),
+		Infrastructures:        configlisters.NewInfrastructureLister(infrastructuresIndexer),
+		NetworkConfigs:         configlisters.NewNetworkLister(empty),
+	}, nil
+}
+
+// renderCoreClient serves the only API call the generators make while
+// rendering, the lookup of the operator namespace. Any other call panics.
+type renderCoreClient struct {
+	coreset.CoreV1Interface
+	namespace *corev1.Namespace
+}
+
+func (c *renderCoreClient) Namespaces() coreset.NamespaceInterface {
+	return &renderNamespaces{namespace: c.namespace}
+}
+
+type renderNamespaces struct {
+	coreset.NamespaceInterface
+	namespace *corev1.Namespace
+}
+
+func (n *renderNamespaces) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Namespace, error) {
+	if name != n.namespace.Name {
+		return nil, errors.NewNotFound(corev1.Resource("namespaces"), name)
+	}
+	return n.namespace.DeepCopy(), nil
+}
+
+// validateRendered checks that the rendered objects are consistent with each
+// other and would be accepted by the API server.
+func validateRendered(deploy *appsapi.Deployment, svc *corev1.Service, routes []*routeapi.Route, sec *corev1.Secret) error {
+	var errs []error
+
+	objs := []metav1.Object{deploy, svc, sec}
+	for _, route := range routes {
+		objs = append(objs, route)
+	}
+	for _, o := range objs {
+		for _, msg := range validation.IsDNS1123Subdomain(o.GetName()) {
+			errs = append(errs, fmt.Errorf("invalid name %q: %s", o.GetName(), msg))
+		}
+	}
+
+	podLabels := labels.Set(deploy.Spec.Template.Labels)
+	selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("deployment %s: invalid selector: %s", deploy.Name, err))
+	} else if selector.Empty() || !selector.Matches(podLabels) {
+		errs = append(errs, fmt.Errorf("deployment %s: the selector does not match the labels of the pod template", deploy.Name))
+	}
+
+	volumes := map[string]corev1.Volume{}
+	for _, v := range deploy.Spec.Template.Spec.Volumes {
+		if _, ok := volumes[v.Name]; ok {
+			errs = append(errs, fmt.Errorf("deployment %s: duplicate volume %s", deploy.Name, v.Name))
+		}
+		volumes[v.Name] = v
+		if v.Secret != nil && v.Secret.SecretName == sec.Name {
+			for _, item := range v.Secret.Items {
+				if _, ok := sec.Data[item.Key]; !ok {
+					errs = append(errs, fmt.Errorf("deployment %s: volume %s uses the key %s that the secret %s does not have", deploy.Name, v.Name, item.Key, sec.Name))
+				}
+			}
+		}
+	}
+
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		env := map[string]struct{}{}
+		for _, e := range c.Env {
+			for _, msg := range validation.IsEnvVarName(e.Name) {
+				errs = append(errs, fmt.Errorf("container %s: invalid environment variable %q: %s", c.Name, e.Name, msg))
+			}
+			if _, ok := env[e.Name]; ok {
+				errs = append(errs, fmt.Errorf("container %s: duplicate environment variable %s", c.Name, e.Name))
+			}
+			env[e.Name] = struct{}{}
+		}
+		for _, m := range c.VolumeMounts {
+			if _, ok := volumes[m.Name]; !ok {
+				errs = append(errs, fmt.Errorf("container %s: volume mount %s refers to an undefined volume", c.Name, m.Name))
+			}
+		}
+	}
+
+	if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(podLabels) {
+		errs = append(errs, fmt.Errorf("service %s: the selector does not match the pods of the deployment %s", svc.Name, deploy.Name))
+	}
+
+	for _, route := range routes {
+		if route.Spec.To.Name != svc.Name {
+			errs = append(errs, fmt.Errorf("route %s: points to the service %s instead of %s", route.Name, route.Spec.To.Name, svc.Name))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,314 @@
+package resource
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the render tests")
+
+func renderInfrastructure(platform configv1.PlatformType) *configv1.Infrastructure {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: platform,
+			},
+		},
+	}
+	if platform == configv1.AWSPlatformType {
+		infra.Status.PlatformStatus.AWS = &configv1.AWSPlatformStatus{
+			Region: "us-east-1",
+		}
+	}
+	return infra
+}
+
+func renderConfig(spec imageregistryv1.ImageRegistrySpec) *imageregistryv1.Config {
+	spec.ManagementState = operatorv1.Managed
+	spec.HTTPSecret = "secret"
+	return &imageregistryv1.Config{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ImageRegistryResourceName,
+		},
+		Spec: spec,
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, env := range []string{"IMAGE", "RELEASE_VERSION", "WATCH_NAMESPACE"} {
+		old, ok := os.LookupEnv(env)
+		if ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+	os.Setenv("IMAGE", "registry.example.com/openshift/image-registry:latest")
+	os.Setenv("RELEASE_VERSION", "4.8.0")
+	os.Setenv("WATCH_NAMESPACE", defaults.ImageRegistryOperatorNamespace)
+
+	awsCredentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	}
+
+	for _, tt := range []struct {
+		name string
+		in   *RenderInputs
+	}{
+		{
+			name: "emptydir",
+			in: &RenderInputs{
+				Config: renderConfig(imageregistryv1.ImageRegistrySpec{
+					Replicas: 1,
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+					},
+				}),
+				Infrastructure: renderInfrastructure(configv1.NonePlatformType),
+			},
+		},
+		{
+			name: "s3",
+			in: &RenderInputs{
+				Config: renderConfig(imageregistryv1.ImageRegistrySpec{
+					Replicas:     2,
+					DefaultRoute: true,
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket:  "registry-bucket",
+							Encrypt: true,
+						},
+					},
+				}),
+				Infrastructure: renderInfrastructure(configv1.AWSPlatformType),
+				Secrets:        []*corev1.Secret{awsCredentials},
+			},
+		},
+		{
+			name: "platform-storage",
+			in: &RenderInputs{
+				Config: renderConfig(imageregistryv1.ImageRegistrySpec{
+					Replicas: 2,
+				}),
+				Infrastructure: renderInfrastructure(configv1.AWSPlatformType),
+				Secrets:        []*corev1.Secret{awsCredentials},
+			},
+		},
+		{
+			name: "pvc-routes",
+			in: &RenderInputs{
+				Config: renderConfig(imageregistryv1.ImageRegistrySpec{
+					Replicas: 1,
+					Routes: []imageregistryv1.ImageRegistryConfigRoute{
+						{
+							Name:       "public-registry",
+							Hostname:   "registry.apps.example.com",
+							SecretName: "public-registry-tls",
+						},
+					},
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+							Claim: defaults.PVCImageRegistryName,
+						},
+					},
+				}),
+				Infrastructure: renderInfrastructure(configv1.OvirtPlatformType),
+				Secrets: []*corev1.Secret{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "public-registry-tls",
+							Namespace: defaults.ImageRegistryOperatorNamespace,
+						},
+						Data: map[string][]byte{
+							"tls.crt": []byte("certificate"),
+							"tls.key": []byte("key"),
+						},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := Render(buf, tt.in); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "render", tt.name+".yaml")
+			if *updateGolden {
+				if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(expected), buf.String()); diff != "" {
+				t.Errorf("rendered manifests differ from %s (-want +got), run the tests with -update to regenerate it:\n%s", golden, diff)
+			}
+
+			if strings.Contains(buf.String(), "aws_secret_access_key = secret") {
+				t.Errorf("storage credentials were not redacted")
+			}
+		})
+	}
+}
+
+func TestRenderWithoutStorage(t *testing.T) {
+	in := &RenderInputs{
+		Config: renderConfig(imageregistryv1.ImageRegistrySpec{
+			Replicas: 1,
+		}),
+		Infrastructure: renderInfrastructure(configv1.NonePlatformType),
+	}
+	if err := Render(ioutil.Discard, in); err == nil {
+		t.Errorf("expected an error when no storage can be configured")
+	}
+}
+
+func TestValidateRendered(t *testing.T) {
+	newObjects := func() (*appsv1.Deployment, *corev1.Service, []*routev1.Route, *corev1.Secret) {
+		podLabels := map[string]string{"docker-registry": "default"}
+		deploy := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "image-registry"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "registry",
+								Env: []corev1.EnvVar{
+									{Name: "REGISTRY_STORAGE", Value: "s3"},
+								},
+								VolumeMounts: []corev1.VolumeMount{
+									{Name: "image-registry-private-configuration", MountPath: "/etc/secrets"},
+								},
+							},
+						},
+						Volumes: []corev1.Volume{
+							{
+								Name: "image-registry-private-configuration",
+								VolumeSource: corev1.VolumeSource{
+									Secret: &corev1.SecretVolumeSource{
+										SecretName: "image-registry-private-configuration",
+										Items:      []corev1.KeyToPath{{Key: "credentials", Path: "credentials"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "image-registry"},
+			Spec:       corev1.ServiceSpec{Selector: podLabels},
+		}
+		routes := []*routev1.Route{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "default-route"},
+				Spec:       routev1.RouteSpec{To: routev1.RouteTargetReference{Name: "image-registry"}},
+			},
+		}
+		sec := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "image-registry-private-configuration"},
+			Data:       map[string][]byte{"credentials": []byte(RedactedValue)},
+		}
+		return deploy, svc, routes, sec
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(*appsv1.Deployment, *corev1.Service, []*routev1.Route, *corev1.Secret)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(*appsv1.Deployment, *corev1.Service, []*routev1.Route, *corev1.Secret) {},
+		},
+		{
+			name: "duplicate environment variable",
+			modify: func(deploy *appsv1.Deployment, _ *corev1.Service, _ []*routev1.Route, _ *corev1.Secret) {
+				c := &deploy.Spec.Template.Spec.Containers[0]
+				c.Env = append(c.Env, corev1.EnvVar{Name: "REGISTRY_STORAGE", Value: "azure"})
+			},
+			err: "container registry: duplicate environment variable REGISTRY_STORAGE",
+		},
+		{
+			name: "undefined volume",
+			modify: func(deploy *appsv1.Deployment, _ *corev1.Service, _ []*routev1.Route, _ *corev1.Secret) {
+				deploy.Spec.Template.Spec.Volumes = nil
+			},
+			err: "container registry: volume mount image-registry-private-configuration refers to an undefined volume",
+		},
+		{
+			name: "missing secret key",
+			modify: func(_ *appsv1.Deployment, _ *corev1.Service, _ []*routev1.Route, sec *corev1.Secret) {
+				sec.Data = nil
+			},
+			err: "deployment image-registry: volume image-registry-private-configuration uses the key credentials that the secret image-registry-private-configuration does not have",
+		},
+		{
+			name: "service selector",
+			modify: func(_ *appsv1.Deployment, svc *corev1.Service, _ []*routev1.Route, _ *corev1.Secret) {
+				svc.Spec.Selector = map[string]string{"app": "registry"}
+			},
+			err: "service image-registry: the selector does not match the pods of the deployment image-registry",
+		},
+		{
+			name: "route target",
+			modify: func(_ *appsv1.Deployment, _ *corev1.Service, routes []*routev1.Route, _ *corev1.Secret) {
+				routes[0].Spec.To.Name = "registry"
+			},
+			err: "route default-route: points to the service registry instead of image-registry",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			deploy, svc, routes, sec := newObjects()
+			tt.modify(deploy, svc, routes, sec)
+
+			err := validateRendered(deploy, svc, routes, sec)
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package resource
 import (
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metaapi "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -38,6 +39,45 @@ func Name(o Getter) string {
 	return name
 }
 
+// ForbiddenError is returned when the API server denied the operator an
+// operation on one of the objects it manages, which means that the RBAC of
+// the operator is incomplete.
+type ForbiddenError struct {
+	Verb     string
+	Resource string
+	Err      error
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return e.Err
+}
+
+// forbidden wraps err into a ForbiddenError if the API server denied verb on
+// the object of gen, other errors are returned as is.
+func forbidden(verb string, gen Getter, err error) error {
+	if !errors.IsForbidden(err) {
+		return err
+	}
+
+	resource := fmt.Sprintf("%T", gen.Type())
+	if status, ok := err.(errors.APIStatus); ok && status.Status().Details != nil {
+		details := status.Status().Details
+		resource = details.Kind
+		if details.Group != "" {
+			resource += "." + details.Group
+		}
+	}
+	return &ForbiddenError{
+		Verb:     verb,
+		Resource: resource,
+		Err:      err,
+	}
+}
+
 type expecter interface {
 	Type() runtime.Object
 	expected() (runtime.Object, error)
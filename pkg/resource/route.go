@@ -2,7 +2,10 @@ package resource
 
 import (
 	"context"
+	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -17,6 +20,49 @@ import (
 
 const RouteOwnerAnnotation = "imageregistry.openshift.io"
 
+const (
+	routeBalanceAnnotation        = "haproxy.router.openshift.io/balance"
+	routeDisableCookiesAnnotation = "haproxy.router.openshift.io/disable_cookies"
+	routeCookieNameAnnotation     = "router.openshift.io/cookie_name"
+)
+
+// stickySessionsAnnotations returns the annotations that make the router
+// send the requests of a client to the same registry pod.
+func stickySessionsAnnotations(route imageregistryv1.ImageRegistryConfigRoute) (map[string]string, error) {
+	switch route.StickySessions {
+	case "", "None":
+		return nil, nil
+	case "Source":
+		// The router would still prefer its cookie, which most registry
+		// clients don't keep.
+		return map[string]string{
+			routeBalanceAnnotation:        "source",
+			routeDisableCookiesAnnotation: "true",
+		}, nil
+	case "Cookie":
+		return map[string]string{
+			routeCookieNameAnnotation: route.Name,
+		}, nil
+	}
+	return nil, fmt.Errorf("Routes[%s].StickySessions: unsupported value %q, valid values are None, Source, Cookie", route.Name, route.StickySessions)
+}
+
+// ConfiguredRoutes returns the names of the routes the operator creates for
+// the registry, none when the external routes are disabled.
+func ConfiguredRoutes(cr *imageregistryv1.Config) []string {
+	if cr.Spec.DisableExternalRoutes {
+		return nil
+	}
+	var names []string
+	if cr.Spec.DefaultRoute {
+		names = append(names, defaults.RouteName)
+	}
+	for _, route := range cr.Spec.Routes {
+		names = append(names, route.Name)
+	}
+	return names
+}
+
 func RouteIsCreatedByOperator(route *routeapi.Route) bool {
 	_, ok := route.Annotations[RouteOwnerAnnotation]
 	return ok
@@ -25,22 +71,24 @@ func RouteIsCreatedByOperator(route *routeapi.Route) bool {
 var _ Mutator = &generatorRoute{}
 
 type generatorRoute struct {
-	lister       routelisters.RouteNamespaceLister
-	secretLister corelisters.SecretNamespaceLister
-	client       routeset.RouteV1Interface
-	namespace    string
-	serviceName  string
-	route        imageregistryv1.ImageRegistryConfigRoute
+	lister             routelisters.RouteNamespaceLister
+	secretLister       corelisters.SecretNamespaceLister
+	configSecretLister corelisters.SecretNamespaceLister
+	client             routeset.RouteV1Interface
+	namespace          string
+	serviceName        string
+	route              imageregistryv1.ImageRegistryConfigRoute
 }
 
-func newGeneratorRoute(lister routelisters.RouteNamespaceLister, secretLister corelisters.SecretNamespaceLister, client routeset.RouteV1Interface, cr *imageregistryv1.Config, route imageregistryv1.ImageRegistryConfigRoute) *generatorRoute {
+func newGeneratorRoute(lister routelisters.RouteNamespaceLister, secretLister corelisters.SecretNamespaceLister, configSecretLister corelisters.SecretNamespaceLister, client routeset.RouteV1Interface, cr *imageregistryv1.Config, route imageregistryv1.ImageRegistryConfigRoute) *generatorRoute {
 	return &generatorRoute{
-		lister:       lister,
-		secretLister: secretLister,
-		client:       client,
-		namespace:    defaults.ImageRegistryOperatorNamespace,
-		serviceName:  defaults.ServiceName,
-		route:        route,
+		lister:             lister,
+		secretLister:       secretLister,
+		configSecretLister: configSecretLister,
+		client:             client,
+		namespace:          defaults.ImageRegistryOperatorNamespace,
+		serviceName:        defaults.ServiceName,
+		route:              route,
 	}
 }
 
@@ -57,6 +105,11 @@ func (gr *generatorRoute) GetName() string {
 }
 
 func (gr *generatorRoute) expected() (runtime.Object, error) {
+	stickySessions, err := stickySessionsAnnotations(gr.route)
+	if err != nil {
+		return nil, err
+	}
+
 	r := &routeapi.Route{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        gr.GetName(),
@@ -72,11 +125,15 @@ func (gr *generatorRoute) expected() (runtime.Object, error) {
 		},
 	}
 
+	for k, v := range stickySessions {
+		r.Annotations[k] = v
+	}
+
 	r.Spec.TLS = &routeapi.TLSConfig{}
 	r.Spec.TLS.Termination = routeapi.TLSTerminationReencrypt
 
 	if len(gr.route.SecretName) > 0 {
-		secret, err := gr.secretLister.Get(gr.route.SecretName)
+		secret, err := gr.routeSecret()
 		if err != nil {
 			return nil, err
 		}
@@ -93,6 +150,22 @@ func (gr *generatorRoute) expected() (runtime.Object, error) {
 	return r, nil
 }
 
+// routeSecret returns the secret with the certificates of the route. It is
+// looked up in the namespace of the registry first, where it has always been
+// expected, and then in openshift-config, where the cluster certificates are
+// usually kept.
+func (gr *generatorRoute) routeSecret() (*corev1.Secret, error) {
+	secret, err := gr.secretLister.Get(gr.route.SecretName)
+	if !errors.IsNotFound(err) {
+		return secret, err
+	}
+	secret, err = gr.configSecretLister.Get(gr.route.SecretName)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("Routes[%s].SecretName: secret %q not found in the namespaces %s and %s", gr.route.Name, gr.route.SecretName, gr.namespace, defaults.OpenShiftConfigNamespace)
+	}
+	return secret, err
+}
+
 func (gr *generatorRoute) Get() (runtime.Object, error) {
 	return gr.lister.Get(gr.GetName())
 }
@@ -0,0 +1,359 @@
+package resource
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	routev1 "github.com/openshift/api/route/v1"
+	routeset "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+// fakeRoutes keeps routes in memory, only the calls made by the route
+// generator are implemented.
+type fakeRoutes struct {
+	routeset.RouteV1Interface
+	routeset.RouteInterface
+
+	routes  map[string]*routev1.Route
+	created int
+
+	// denied is the verb the API server forbids to the operator.
+	denied string
+}
+
+func (f *fakeRoutes) Routes(namespace string) routeset.RouteInterface {
+	return f
+}
+
+func (f *fakeRoutes) Create(ctx context.Context, route *routev1.Route, opts metav1.CreateOptions) (*routev1.Route, error) {
+	if f.denied == "create" {
+		return nil, errors.NewForbidden(routev1.Resource("routes"), route.Name, fmt.Errorf(`User "system:serviceaccount:openshift-image-registry:cluster-image-registry-operator" cannot create resource "routes"`))
+	}
+	if _, ok := f.routes[route.Name]; ok {
+		return nil, errors.NewAlreadyExists(routev1.Resource("routes"), route.Name)
+	}
+	f.routes[route.Name] = route
+	f.created++
+	return route, nil
+}
+
+func (f *fakeRoutes) Update(ctx context.Context, route *routev1.Route, opts metav1.UpdateOptions) (*routev1.Route, error) {
+	if f.denied == "update" {
+		return nil, errors.NewForbidden(routev1.Resource("routes"), route.Name, fmt.Errorf(`User "system:serviceaccount:openshift-image-registry:cluster-image-registry-operator" cannot update resource "routes"`))
+	}
+	if _, ok := f.routes[route.Name]; !ok {
+		return nil, errors.NewNotFound(routev1.Resource("routes"), route.Name)
+	}
+	f.routes[route.Name] = route
+	return route, nil
+}
+
+func TestApplyRouteDeletedRoute(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			DefaultRoute: true,
+		},
+	}
+	routeConfig := imageregistryv1.ImageRegistryConfigRoute{
+		Name: defaults.RouteName,
+	}
+
+	// The route that was deleted manually, it is still in the lister
+	// cache because the deletion hasn't been observed yet.
+	stale := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.RouteName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+	}
+
+	for _, tt := range []struct {
+		name            string
+		cached          []*routev1.Route
+		expectedCreated int
+	}{
+		{
+			name:            "deletion observed",
+			expectedCreated: 1,
+		},
+		{
+			// The route is recreated by the sync triggered by the
+			// deletion event.
+			name:   "deletion not observed yet",
+			cached: []*routev1.Route{stale},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().AddRoutes(tt.cached...).BuildListers()
+			client := &fakeRoutes{routes: map[string]*routev1.Route{}}
+
+			gen := newGeneratorRoute(listers.Routes, listers.Secrets, listers.OpenShiftConfigSecrets, client, cr, routeConfig)
+			err := ApplyMutator(gen)
+			if client.created != tt.expectedCreated {
+				t.Fatalf("expected the route to be created %d times, got %d", tt.expectedCreated, client.created)
+			}
+			if tt.expectedCreated == 0 {
+				if !errors.IsNotFound(err) {
+					t.Errorf("expected the update of the deleted route to fail with a not found error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route, ok := client.routes[defaults.RouteName]
+			if !ok {
+				t.Fatalf("route %s was not created", defaults.RouteName)
+			}
+			if !RouteIsCreatedByOperator(route) {
+				t.Errorf("expected the route to be owned by the operator, got annotations %v", route.Annotations)
+			}
+		})
+	}
+}
+
+func TestRouteStickySessions(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+
+	for _, tt := range []struct {
+		name           string
+		stickySessions string
+		annotations    map[string]string
+		err            string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:           "none",
+			stickySessions: "None",
+		},
+		{
+			name:           "source",
+			stickySessions: "Source",
+			annotations: map[string]string{
+				"haproxy.router.openshift.io/balance":         "source",
+				"haproxy.router.openshift.io/disable_cookies": "true",
+			},
+		},
+		{
+			name:           "cookie",
+			stickySessions: "Cookie",
+			annotations: map[string]string{
+				"router.openshift.io/cookie_name": "registry",
+			},
+		},
+		{
+			name:           "unsupported",
+			stickySessions: "Random",
+			err:            `Routes[registry].StickySessions: unsupported value "Random", valid values are None, Source, Cookie`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The existing route has the annotations of another mode, they
+			// are expected to be reconciled.
+			existing := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "registry",
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+					Annotations: map[string]string{
+						RouteOwnerAnnotation:              "true",
+						"router.openshift.io/cookie_name": "stale",
+					},
+				},
+			}
+			listers := cirofake.NewFixturesBuilder().AddRoutes(existing.DeepCopy()).BuildListers()
+			client := &fakeRoutes{routes: map[string]*routev1.Route{existing.Name: existing.DeepCopy()}}
+
+			gen := newGeneratorRoute(listers.Routes, listers.Secrets, listers.OpenShiftConfigSecrets, client, cr, imageregistryv1.ImageRegistryConfigRoute{
+				Name:           "registry",
+				StickySessions: tt.stickySessions,
+			})
+			err := ApplyMutator(gen)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route := client.routes["registry"]
+			for _, key := range []string{
+				"haproxy.router.openshift.io/balance",
+				"haproxy.router.openshift.io/disable_cookies",
+				"router.openshift.io/cookie_name",
+			} {
+				value, ok := route.Annotations[key]
+				expected, expectedOK := tt.annotations[key]
+				if ok != expectedOK || value != expected {
+					t.Errorf("annotation %s: expected %q (set=%t), got %q (set=%t)", key, expected, expectedOK, value, ok)
+				}
+			}
+			if !RouteIsCreatedByOperator(route) {
+				t.Errorf("expected the route to be owned by the operator, got annotations %v", route.Annotations)
+			}
+		})
+	}
+}
+
+func TestApplyMutatorForbidden(t *testing.T) {
+	cr := &imageregistryv1.Config{}
+	existing := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "registry",
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+			Annotations: map[string]string{
+				RouteOwnerAnnotation: "true",
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name      string
+		cached    []*routev1.Route
+		route     imageregistryv1.ImageRegistryConfigRoute
+		denied    string
+		forbidden bool
+	}{
+		{
+			name:      "create denied",
+			route:     imageregistryv1.ImageRegistryConfigRoute{Name: "registry"},
+			denied:    "create",
+			forbidden: true,
+		},
+		{
+			name:   "update denied",
+			cached: []*routev1.Route{existing},
+			// The annotations of the existing route differ from the
+			// generated ones, the update can't be skipped.
+			route:     imageregistryv1.ImageRegistryConfigRoute{Name: "registry", StickySessions: "Source"},
+			denied:    "update",
+			forbidden: true,
+		},
+		{
+			name:   "other verb denied",
+			route:  imageregistryv1.ImageRegistryConfigRoute{Name: "registry"},
+			denied: "update",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var cached []*routev1.Route
+			routes := map[string]*routev1.Route{}
+			for _, route := range tt.cached {
+				cached = append(cached, route.DeepCopy())
+				routes[route.Name] = route.DeepCopy()
+			}
+			listers := cirofake.NewFixturesBuilder().AddRoutes(cached...).BuildListers()
+			client := &fakeRoutes{routes: routes, denied: tt.denied}
+
+			gen := newGeneratorRoute(listers.Routes, listers.Secrets, listers.OpenShiftConfigSecrets, client, cr, tt.route)
+			err := ApplyMutator(gen)
+
+			var forbiddenErr *ForbiddenError
+			if !tt.forbidden {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !goerrors.As(err, &forbiddenErr) {
+				t.Fatalf("expected a forbidden error, got %#v", err)
+			}
+			if forbiddenErr.Verb != tt.denied || forbiddenErr.Resource != "routes.route.openshift.io" {
+				t.Errorf("expected %s routes.route.openshift.io to be denied, got %s %s", tt.denied, forbiddenErr.Verb, forbiddenErr.Resource)
+			}
+			if !errors.IsForbidden(err) {
+				t.Errorf("expected the API error to be kept, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRouteSecret(t *testing.T) {
+	secret := func(namespace, cert string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "registry-tls",
+				Namespace: namespace,
+			},
+			Data: map[string][]byte{
+				"tls.crt": []byte(cert),
+				"tls.key": []byte("key"),
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		secrets []*corev1.Secret
+		cert    string
+		err     string
+	}{
+		{
+			name:    "registry namespace",
+			secrets: []*corev1.Secret{secret(defaults.ImageRegistryOperatorNamespace, "registry")},
+			cert:    "registry",
+		},
+		{
+			name:    "openshift-config",
+			secrets: []*corev1.Secret{secret(defaults.OpenShiftConfigNamespace, "config")},
+			cert:    "config",
+		},
+		{
+			name: "both namespaces",
+			secrets: []*corev1.Secret{
+				secret(defaults.ImageRegistryOperatorNamespace, "registry"),
+				secret(defaults.OpenShiftConfigNamespace, "config"),
+			},
+			cert: "registry",
+		},
+		{
+			name: "missing",
+			err:  `Routes[partner].SecretName: secret "registry-tls" not found in the namespaces openshift-image-registry and openshift-config`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().AddSecrets(tt.secrets...).BuildListers()
+			client := &fakeRoutes{routes: map[string]*routev1.Route{}}
+
+			gen := newGeneratorRoute(listers.Routes, listers.Secrets, listers.OpenShiftConfigSecrets, client, &imageregistryv1.Config{}, imageregistryv1.ImageRegistryConfigRoute{
+				Name:       "partner",
+				Hostname:   "registry.partner.example.com",
+				SecretName: "registry-tls",
+			})
+			err := ApplyMutator(gen)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route := client.routes["partner"]
+			if route.Spec.Host != "registry.partner.example.com" {
+				t.Errorf("expected the hostname registry.partner.example.com, got %q", route.Spec.Host)
+			}
+			if route.Spec.TLS == nil || route.Spec.TLS.Certificate != tt.cert || route.Spec.TLS.Key != "key" {
+				t.Errorf("expected the certificate %q, got %+v", tt.cert, route.Spec.TLS)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -9,8 +10,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage"
 )
 
@@ -95,6 +98,12 @@ func (gs *generatorSecret) Create() (runtime.Object, error) {
 }
 
 func (gs *generatorSecret) Update(o runtime.Object) (runtime.Object, bool, error) {
+	n, err := gs.expected()
+	if err != nil {
+		return o, false, err
+	}
+	forgetChecksumOnDrift(o.(*corev1.Secret), n.(*corev1.Secret))
+
 	return commonUpdate(gs, o, func(obj runtime.Object) (runtime.Object, error) {
 		return gs.client.Secrets(gs.GetNamespace()).Update(
 			context.TODO(), obj.(*corev1.Secret), metav1.UpdateOptions{},
@@ -111,3 +120,56 @@ func (gs *generatorSecret) Delete(opts metav1.DeleteOptions) error {
 func (g *generatorSecret) Owned() bool {
 	return true
 }
+
+// secretDataDrifted reports whether the data stored in the current secret
+// differs from the data the operator expects it to have. StringData is
+// merged into Data by the API server, so both fields of the expected secret
+// are considered.
+func secretDataDrifted(current, expected *corev1.Secret) bool {
+	want := map[string][]byte{}
+	for k, v := range expected.Data {
+		want[k] = v
+	}
+	for k, v := range expected.StringData {
+		want[k] = []byte(v)
+	}
+
+	if len(current.Data) != len(want) {
+		return true
+	}
+	for k, v := range want {
+		cur, ok := current.Data[k]
+		if !ok || !bytes.Equal(cur, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetChecksumOnDrift drops the checksum annotation from the current secret
+// if its data was modified by someone else. Without it the secret would be
+// considered up to date as long as the expected object didn't change.
+//
+// Only secrets fully owned by the operator go through this path. The serving
+// certificate is managed by service-ca and is never reconciled here.
+func forgetChecksumOnDrift(current, expected *corev1.Secret) {
+	if _, ok := current.Annotations[defaults.ChecksumOperatorAnnotation]; !ok {
+		return
+	}
+	if secretDataDrifted(current, expected) {
+		klog.Infof("secret %s/%s has been modified, restoring its data", current.Namespace, current.Name)
+		delete(current.Annotations, defaults.ChecksumOperatorAnnotation)
+	}
+}
+
+// storageSecretChecksum returns the checksum of the data the storage secret
+// is expected to hold. Unlike the dependencies checksum it doesn't wait for
+// the updated secret to be observed, so the registry is rolled out in the
+// same sync that changes the secret.
+func storageSecretChecksum(driver storage.Driver) (string, error) {
+	sec, err := newGeneratorSecret(nil, nil, driver).expected()
+	if err != nil {
+		return "", err
+	}
+	return strategy.Checksum(sec.(*corev1.Secret).StringData)
+}
@@ -0,0 +1,132 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+)
+
+type secretTestDriver struct {
+	testDriver
+}
+
+func (d *secretTestDriver) ConfigEnv() (envvar.List, error) {
+	return envvar.List{
+		{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", Value: "access", Secret: true},
+	}, nil
+}
+
+func (d *secretTestDriver) VolumeSecrets() (map[string]string, error) {
+	return map[string]string{"keyfile": "key"}, nil
+}
+
+// storedSecret mimics the API server by merging StringData into Data.
+func storedSecret(sec *corev1.Secret) *corev1.Secret {
+	sec = sec.DeepCopy()
+	if sec.Data == nil {
+		sec.Data = map[string][]byte{}
+	}
+	for k, v := range sec.StringData {
+		sec.Data[k] = []byte(v)
+	}
+	sec.StringData = nil
+	return sec
+}
+
+func TestSecretDriftIsReverted(t *testing.T) {
+	tests := []struct {
+		name          string
+		mutate        func(*corev1.Secret)
+		expectUpdated bool
+	}{
+		{
+			name:          "unmodified",
+			mutate:        func(*corev1.Secret) {},
+			expectUpdated: false,
+		},
+		{
+			name: "value changed",
+			mutate: func(sec *corev1.Secret) {
+				sec.Data["REGISTRY_STORAGE_S3_ACCESSKEY"] = []byte("tampered")
+			},
+			expectUpdated: true,
+		},
+		{
+			name: "key removed",
+			mutate: func(sec *corev1.Secret) {
+				delete(sec.Data, "keyfile")
+			},
+			expectUpdated: true,
+		},
+		{
+			name: "key added",
+			mutate: func(sec *corev1.Secret) {
+				sec.Data["extra"] = []byte("value")
+			},
+			expectUpdated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			gen := newGeneratorSecret(nil, kubeClient.CoreV1(), &secretTestDriver{})
+
+			created, err := gen.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			current := storedSecret(created.(*corev1.Secret))
+			test.mutate(current)
+
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(current); err != nil {
+				t.Fatal(err)
+			}
+			gen.lister = corelisters.NewSecretLister(indexer).Secrets(defaults.ImageRegistryOperatorNamespace)
+
+			o, err := gen.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n, updated, err := gen.Update(o.DeepCopyObject())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated != test.expectUpdated {
+				t.Fatalf("updated: got %t, want %t", updated, test.expectUpdated)
+			}
+			if !updated {
+				return
+			}
+
+			restored := storedSecret(n.(*corev1.Secret))
+			if secretDataDrifted(restored, created.(*corev1.Secret)) {
+				t.Errorf("secret data was not restored: %v", restored.Data)
+			}
+			if restored.Annotations[defaults.ChecksumOperatorAnnotation] != created.(*corev1.Secret).Annotations[defaults.ChecksumOperatorAnnotation] {
+				t.Errorf("checksum annotation was not restored")
+			}
+
+			stored, err := kubeClient.CoreV1().Secrets(defaults.ImageRegistryOperatorNamespace).Get(
+				context.TODO(), defaults.ImageRegistryPrivateConfiguration, metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secretDataDrifted(storedSecret(stored), created.(*corev1.Secret)) {
+				t.Errorf("stored secret data was not restored: %v", stored.Data)
+			}
+		})
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	utilnet "k8s.io/utils/net"
+
+	configlisters "github.com/openshift/client-go/config/listers/config/v1"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/resource/strategy"
@@ -18,24 +22,26 @@ import (
 var _ Mutator = &generatorService{}
 
 type generatorService struct {
-	lister     corelisters.ServiceNamespaceLister
-	client     coreset.CoreV1Interface
-	name       string
-	namespace  string
-	labels     map[string]string
-	port       int
-	secretName string
+	lister        corelisters.ServiceNamespaceLister
+	networkLister configlisters.NetworkLister
+	client        coreset.CoreV1Interface
+	name          string
+	namespace     string
+	labels        map[string]string
+	port          int
+	secretName    string
 }
 
-func newGeneratorService(lister corelisters.ServiceNamespaceLister, client coreset.CoreV1Interface) *generatorService {
+func newGeneratorService(lister corelisters.ServiceNamespaceLister, networkLister configlisters.NetworkLister, client coreset.CoreV1Interface) *generatorService {
 	return &generatorService{
-		lister:     lister,
-		client:     client,
-		name:       defaults.ServiceName,
-		namespace:  defaults.ImageRegistryOperatorNamespace,
-		labels:     defaults.DeploymentLabels,
-		port:       defaults.ContainerPort,
-		secretName: defaults.ImageRegistryName + "-tls",
+		lister:        lister,
+		networkLister: networkLister,
+		client:        client,
+		name:          defaults.ServiceName,
+		namespace:     defaults.ImageRegistryOperatorNamespace,
+		labels:        defaults.DeploymentLabels,
+		port:          defaults.ContainerPort,
+		secretName:    defaults.ImageRegistryName + "-tls",
 	}
 }
 
@@ -51,7 +57,41 @@ func (gs *generatorService) GetName() string {
 	return gs.name
 }
 
-func (gs *generatorService) expected() *corev1.Service {
+// ipFamilies returns the IP families of the service network of the cluster,
+// the primary one first, or nil if the cluster is single-stack.
+func (gs *generatorService) ipFamilies() ([]corev1.IPFamily, error) {
+	network, err := gs.networkLister.Get(defaults.ClusterNetworkResourceName)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get the cluster network config: %s", err)
+	}
+
+	serviceNetwork := network.Status.ServiceNetwork
+	if len(serviceNetwork) == 0 {
+		serviceNetwork = network.Spec.ServiceNetwork
+	}
+	if dualStack, err := utilnet.IsDualStackCIDRStrings(serviceNetwork); err != nil || !dualStack {
+		return nil, err
+	}
+
+	var families []corev1.IPFamily
+	for _, cidr := range serviceNetwork {
+		family := corev1.IPv4Protocol
+		if utilnet.IsIPv6CIDRString(cidr) {
+			family = corev1.IPv6Protocol
+		}
+		if len(families) == 0 || families[0] != family {
+			families = append(families, family)
+		}
+		if len(families) == 2 {
+			break
+		}
+	}
+	return families, nil
+}
+
+func (gs *generatorService) expected() (*corev1.Service, error) {
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      gs.GetName(),
@@ -75,7 +115,19 @@ func (gs *generatorService) expected() *corev1.Service {
 		"service.alpha.openshift.io/serving-cert-secret-name": gs.secretName,
 	}
 
-	return svc
+	// The service is reachable from the nodes of both families on
+	// dual-stack clusters, the single-stack ones keep the defaults.
+	families, err := gs.ipFamilies()
+	if err != nil {
+		return nil, err
+	}
+	if len(families) != 0 {
+		policy := corev1.IPFamilyPolicyPreferDualStack
+		svc.Spec.IPFamilyPolicy = &policy
+		svc.Spec.IPFamilies = families
+	}
+
+	return svc, nil
 }
 
 func (gs *generatorService) Get() (runtime.Object, error) {
@@ -84,9 +136,12 @@ func (gs *generatorService) Get() (runtime.Object, error) {
 
 func (gs *generatorService) Create() (runtime.Object, error) {
 	svc := &corev1.Service{}
-	n := gs.expected()
+	n, err := gs.expected()
+	if err != nil {
+		return svc, err
+	}
 
-	_, err := strategy.Service(svc, n)
+	_, err = strategy.Service(svc, n)
 	if err != nil {
 		return svc, err
 	}
@@ -98,7 +153,10 @@ func (gs *generatorService) Create() (runtime.Object, error) {
 
 func (gs *generatorService) Update(o runtime.Object) (runtime.Object, bool, error) {
 	svc := o.(*corev1.Service)
-	n := gs.expected()
+	n, err := gs.expected()
+	if err != nil {
+		return o, false, err
+	}
 
 	updated, err := strategy.Service(svc, n)
 	if !updated || err != nil {
@@ -0,0 +1,119 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	configv1 "github.com/openshift/api/config/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestServiceIPFamilies(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		serviceNetwork   []string
+		expectedFamilies []corev1.IPFamily
+	}{
+		{
+			name: "no network config",
+		},
+		{
+			name:           "IPv4",
+			serviceNetwork: []string{"172.30.0.0/16"},
+		},
+		{
+			name:           "IPv6",
+			serviceNetwork: []string{"fd02::/112"},
+		},
+		{
+			name:             "dual-stack",
+			serviceNetwork:   []string{"172.30.0.0/16", "fd02::/112"},
+			expectedFamilies: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+		},
+		{
+			name:             "dual-stack with IPv6 primary",
+			serviceNetwork:   []string{"fd02::/112", "172.30.0.0/16"},
+			expectedFamilies: []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			if tt.serviceNetwork != nil {
+				builder.AddNetworkConfig(&configv1.Network{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: defaults.ClusterNetworkResourceName,
+					},
+					Status: configv1.NetworkStatus{
+						ServiceNetwork: tt.serviceNetwork,
+					},
+				})
+			}
+			listers := builder.BuildListers()
+
+			svc, err := newGeneratorService(listers.Services, listers.NetworkConfigs, nil).expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.expectedFamilies == nil {
+				if svc.Spec.IPFamilyPolicy != nil || svc.Spec.IPFamilies != nil {
+					t.Errorf("expected the IP families to be left to the defaults, got %v %v", svc.Spec.IPFamilyPolicy, svc.Spec.IPFamilies)
+				}
+				return
+			}
+			if svc.Spec.IPFamilyPolicy == nil || *svc.Spec.IPFamilyPolicy != corev1.IPFamilyPolicyPreferDualStack {
+				t.Errorf("expected the IP family policy %s, got %v", corev1.IPFamilyPolicyPreferDualStack, svc.Spec.IPFamilyPolicy)
+			}
+			if !reflect.DeepEqual(svc.Spec.IPFamilies, tt.expectedFamilies) {
+				t.Errorf("got the IP families %v, want %v", svc.Spec.IPFamilies, tt.expectedFamilies)
+			}
+		})
+	}
+}
+
+func TestServiceUpdateDualStack(t *testing.T) {
+	singleStack := corev1.IPFamilyPolicySingleStack
+	current := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ServiceName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Spec: corev1.ServiceSpec{
+			IPFamilyPolicy: &singleStack,
+			IPFamilies:     []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+	}
+
+	listers := cirofake.NewFixturesBuilder().AddNetworkConfig(&configv1.Network{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaults.ClusterNetworkResourceName,
+		},
+		Status: configv1.NetworkStatus{
+			ServiceNetwork: []string{"172.30.0.0/16", "fd02::/112"},
+		},
+	}).BuildListers()
+	client := fake.NewSimpleClientset(current)
+
+	o, updated, err := newGeneratorService(listers.Services, listers.NetworkConfigs, client.CoreV1()).Update(current.DeepCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("expected the service to be updated")
+	}
+
+	svc := o.(*corev1.Service)
+	if svc.Spec.IPFamilyPolicy == nil || *svc.Spec.IPFamilyPolicy != corev1.IPFamilyPolicyPreferDualStack {
+		t.Errorf("expected the IP family policy %s, got %v", corev1.IPFamilyPolicyPreferDualStack, svc.Spec.IPFamilyPolicy)
+	}
+	expectedFamilies := []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+	if !reflect.DeepEqual(svc.Spec.IPFamilies, expectedFamilies) {
+		t.Errorf("got the IP families %v, want %v", svc.Spec.IPFamilies, expectedFamilies)
+	}
+}
@@ -2,14 +2,21 @@ package resource
 
 import (
 	"context"
+	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 var _ Mutator = &generatorServiceAccount{}
@@ -19,14 +26,16 @@ type generatorServiceAccount struct {
 	client    coreset.CoreV1Interface
 	name      string
 	namespace string
+	cr        *imageregistryv1.Config
 }
 
-func newGeneratorServiceAccount(lister corelisters.ServiceAccountNamespaceLister, client coreset.CoreV1Interface) *generatorServiceAccount {
+func newGeneratorServiceAccount(lister corelisters.ServiceAccountNamespaceLister, client coreset.CoreV1Interface, cr *imageregistryv1.Config) *generatorServiceAccount {
 	return &generatorServiceAccount{
 		lister:    lister,
 		client:    client,
 		name:      defaults.ServiceAccountName,
 		namespace: defaults.ImageRegistryOperatorNamespace,
+		cr:        cr,
 	}
 }
 
@@ -50,6 +59,19 @@ func (gsa *generatorServiceAccount) expected() (runtime.Object, error) {
 		},
 	}
 
+	// The role is annotated for the pod identity webhook of EKS-style
+	// clusters, it injects the web identity credentials into the registry.
+	if s3 := gsa.cr.Spec.Storage.S3; s3 != nil && len(s3.RoleARN) != 0 {
+		sa.Annotations = map[string]string{
+			defaults.RoleARNAnnotation: s3.RoleARN,
+		}
+	}
+	if gcs := gsa.cr.Spec.Storage.GCS; gcs != nil && len(gcs.WorkloadIdentityServiceAccount) != 0 {
+		sa.Annotations = map[string]string{
+			defaults.GCPServiceAccountAnnotation: gcs.WorkloadIdentityServiceAccount,
+		}
+	}
+
 	return sa, nil
 }
 
@@ -57,15 +79,30 @@ func (gsa *generatorServiceAccount) Get() (runtime.Object, error) {
 	return gsa.lister.Get(gsa.GetName())
 }
 
+// Create creates the service account. The ServiceAccountRecreated condition
+// is only set once the service account has been seen, so a service account
+// created for the first time is not reported as recreated.
 func (gsa *generatorServiceAccount) Create() (runtime.Object, error) {
-	return commonCreate(gsa, func(obj runtime.Object) (runtime.Object, error) {
+	o, err := commonCreate(gsa, func(obj runtime.Object) (runtime.Object, error) {
 		return gsa.client.ServiceAccounts(gsa.GetNamespace()).Create(
 			context.TODO(), obj.(*corev1.ServiceAccount), metav1.CreateOptions{},
 		)
 	})
+	if err != nil {
+		return o, err
+	}
+
+	if v1helpers.FindOperatorCondition(gsa.cr.Status.Conditions, defaults.ServiceAccountRecreated) == nil {
+		util.UpdateCondition(gsa.cr, defaults.ServiceAccountRecreated, operatorv1.ConditionFalse, "Created", "")
+		return o, nil
+	}
+	klog.Warningf("the service account %s/%s was missing and has been recreated", gsa.GetNamespace(), gsa.GetName())
+	util.UpdateCondition(gsa.cr, defaults.ServiceAccountRecreated, operatorv1.ConditionTrue, "Recreated", fmt.Sprintf("The service account %s was missing and has been recreated, the registry pods couldn't be created without it", gsa.GetName()))
+	return o, nil
 }
 
 func (gsa *generatorServiceAccount) Update(o runtime.Object) (runtime.Object, bool, error) {
+	util.UpdateCondition(gsa.cr, defaults.ServiceAccountRecreated, operatorv1.ConditionFalse, "AsExpected", "")
 	return commonUpdate(gsa, o, func(obj runtime.Object) (runtime.Object, error) {
 		return gsa.client.ServiceAccounts(gsa.GetNamespace()).Update(
 			context.TODO(), obj.(*corev1.ServiceAccount), metav1.UpdateOptions{},
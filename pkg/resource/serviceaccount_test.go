@@ -0,0 +1,158 @@
+package resource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestServiceAccountRoleARN(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		storage  imageregistryv1.ImageRegistryConfigStorage
+		expected map[string]string
+	}{
+		{
+			name: "static credentials",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{},
+			},
+		},
+		{
+			name: "web identity",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					RoleARN: "arn:aws:iam::123456789012:role/image-registry",
+				},
+			},
+			expected: map[string]string{
+				defaults.RoleARNAnnotation: "arn:aws:iam::123456789012:role/image-registry",
+			},
+		},
+		{
+			name: "workload identity",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				GCS: &imageregistryv1.ImageRegistryConfigStorageGCS{
+					WorkloadIdentityServiceAccount: "registry@my-project.iam.gserviceaccount.com",
+				},
+			},
+			expected: map[string]string{
+				defaults.GCPServiceAccountAnnotation: "registry@my-project.iam.gserviceaccount.com",
+			},
+		},
+		{
+			name: "other storage",
+			storage: imageregistryv1.ImageRegistryConfigStorage{
+				EmptyDir: &imageregistryv1.ImageRegistryConfigStorageEmptyDir{},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: tt.storage,
+				},
+			}
+
+			obj, err := newGeneratorServiceAccount(nil, nil, cr).expected()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sa := obj.(*corev1.ServiceAccount)
+			if len(sa.Annotations) != len(tt.expected) {
+				t.Fatalf("expected annotations %v, got %v", tt.expected, sa.Annotations)
+			}
+			for k, v := range tt.expected {
+				if sa.Annotations[k] != v {
+					t.Errorf("expected annotation %s=%q, got %q", k, v, sa.Annotations[k])
+				}
+			}
+		})
+	}
+}
+
+func TestServiceAccountRecreated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubeClient := fake.NewSimpleClientset()
+	kubeInformer := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace(defaults.ImageRegistryOperatorNamespace))
+	informer := kubeInformer.Core().V1().ServiceAccounts()
+	lister := informer.Lister().ServiceAccounts(defaults.ImageRegistryOperatorNamespace)
+	informer.Informer()
+	kubeInformer.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		t.Fatal("caches not syncing")
+	}
+
+	cr := &imageregistryv1.Config{}
+	gen := newGeneratorServiceAccount(lister, kubeClient.CoreV1(), cr)
+
+	// waitForLister waits until the lister has seen that the service
+	// account exists or not.
+	waitForLister := func(exists bool) {
+		err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			_, err := lister.Get(defaults.ServiceAccountName)
+			if errors.IsNotFound(err) {
+				return !exists, nil
+			}
+			return exists, err
+		})
+		if err != nil {
+			t.Fatalf("the lister has not caught up: %v", err)
+		}
+	}
+	expectCondition := func(status operatorv1.ConditionStatus, reason string) {
+		t.Helper()
+		cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.ServiceAccountRecreated)
+		if cond == nil || cond.Status != status || cond.Reason != reason {
+			t.Errorf("expected the %s condition to be %s/%s, got %#v", defaults.ServiceAccountRecreated, status, reason, cond)
+		}
+	}
+
+	// The first service account isn't reported as recreated.
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+	expectCondition(operatorv1.ConditionFalse, "Created")
+	waitForLister(true)
+
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+	expectCondition(operatorv1.ConditionFalse, "AsExpected")
+
+	if err := kubeClient.CoreV1().ServiceAccounts(defaults.ImageRegistryOperatorNamespace).Delete(ctx, defaults.ServiceAccountName, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForLister(false)
+
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeClient.CoreV1().ServiceAccounts(defaults.ImageRegistryOperatorNamespace).Get(ctx, defaults.ServiceAccountName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the service account to be recreated: %v", err)
+	}
+	expectCondition(operatorv1.ConditionTrue, "Recreated")
+
+	// The condition is cleared once the service account is back.
+	waitForLister(true)
+	if err := ApplyMutator(gen); err != nil {
+		t.Fatal(err)
+	}
+	expectCondition(operatorv1.ConditionFalse, "AsExpected")
+}
@@ -20,6 +20,12 @@ func Service(o, n *corev1.Service) (bool, error) {
 	o.Spec.Selector = n.Spec.Selector
 	o.Spec.Type = n.Spec.Type
 	o.Spec.Ports = n.Spec.Ports
+	// The IP families are defaulted by the API server, they are only
+	// changed when the operator asks for specific ones.
+	if n.Spec.IPFamilyPolicy != nil {
+		o.Spec.IPFamilyPolicy = n.Spec.IPFamilyPolicy
+		o.Spec.IPFamilies = n.Spec.IPFamilies
+	}
 
 	if o.Annotations == nil {
 		o.Annotations = map[string]string{}
@@ -2,7 +2,9 @@ package azure
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -14,6 +16,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-04-01/storage"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/Azure/go-autorest/autorest/to"
@@ -21,6 +24,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kcorelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 
@@ -43,6 +47,23 @@ const (
 	storageExistsReasonContainerExists   = "ContainerExists"
 	storageExistsReasonContainerDeleted  = "ContainerDeleted"
 	storageExistsReasonAccountDeleted    = "AccountDeleted"
+	storageExistsReasonAccountSKUChanged = "AccountSKUChanged"
+
+	sasTokenReasonValid        = "Valid"
+	sasTokenReasonExpiringSoon = "ExpiringSoon"
+	sasTokenReasonExpired      = "Expired"
+	sasTokenReasonInvalid      = "Invalid"
+
+	storageEncryptedReasonEncryptedAtRest = "EncryptedAtRest"
+
+	privateEndpointReasonDNSLookupFailed  = "DNSLookupFailed"
+	privateEndpointReasonPublicAddress    = "PublicAddress"
+	privateEndpointReasonConnectionFailed = "ConnectionFailed"
+	privateEndpointReasonReachable        = "Reachable"
+
+	// sasTokenExpiryWarning is how long before the expiry of a shared access
+	// signature the operator starts warning about it.
+	sasTokenExpiryWarning = 7 * 24 * time.Hour
 )
 
 var (
@@ -67,6 +88,31 @@ type Azure struct {
 
 	// UPI
 	AccountKey string
+	SASToken   string
+
+	// ManagedIdentityClientID is the client ID of the user-assigned managed
+	// identity the blobs are accessed with, no secret is read then.
+	ManagedIdentityClientID string
+}
+
+// credentials holds the secret used to authenticate against the blob
+// service, either a storage account access key or a shared access
+// signature, or the client ID of the managed identity the Azure AD tokens
+// are requested for.
+type credentials struct {
+	accountKey string
+	sasToken   string
+	clientID   string
+}
+
+// errAccountSKUChanged is returned when the requested SKU doesn't match the
+// SKU of an existing storage account.
+type errAccountSKUChanged struct {
+	Err error
+}
+
+func (e *errAccountSKUChanged) Error() string {
+	return e.Err.Error()
 }
 
 type errDoesNotExist struct {
@@ -103,6 +149,16 @@ func GetConfig(secLister kcorelisters.SecretNamespaceLister) (*Azure, error) {
 		}, nil
 	}
 
+	// loads user provided shared access signature, the operator prefers it
+	// over the account key as it is the more restricted one. The registry
+	// can only authenticate with the account key, it is loaded as well.
+	if token := string(sec.Data["REGISTRY_STORAGE_AZURE_SASTOKEN"]); token != "" {
+		return &Azure{
+			AccountKey: string(sec.Data["REGISTRY_STORAGE_AZURE_ACCOUNTKEY"]),
+			SASToken:   token,
+		}, nil
+	}
+
 	// loads user provided account key.
 	key, err := util.GetValueFromSecret(sec, "REGISTRY_STORAGE_AZURE_ACCOUNTKEY")
 	if err != nil {
@@ -120,6 +176,56 @@ func GetConfig(secLister kcorelisters.SecretNamespaceLister) (*Azure, error) {
 	}, nil
 }
 
+// VerifyManagedIdentity rejects the configuration when the registry would be
+// given both the managed identity of clientID and the shared credentials of
+// the image-registry-private-configuration-user secret.
+func VerifyManagedIdentity(c *imageregistryv1.ImageRegistryConfigStorageAzure, secLister kcorelisters.SecretNamespaceLister) error {
+	if c == nil || c.ClientID == "" {
+		return nil
+	}
+
+	sec, err := secLister.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get user provided secrets: %s", err)
+	}
+
+	for _, key := range []string{"REGISTRY_STORAGE_AZURE_ACCOUNTKEY", "REGISTRY_STORAGE_AZURE_SASTOKEN"} {
+		if len(sec.Data[key]) != 0 {
+			return fmt.Errorf("storage.azure.clientID cannot be used together with %s of the secret %s/%s, one of them has to be removed", key, sec.Namespace, sec.Name)
+		}
+	}
+	return nil
+}
+
+// getConfig reads the configuration of the driver. With a managed identity
+// the credentials secrets are neither required nor read.
+func (d *driver) getConfig() (*Azure, error) {
+	if d.Config == nil || d.Config.ClientID == "" {
+		return GetConfig(d.Listers.Secrets)
+	}
+	return &Azure{
+		ManagedIdentityClientID: d.Config.ClientID,
+	}, nil
+}
+
+// managedIdentityToken requests an Azure AD token for resource from the
+// instance metadata service of the node, on behalf of the user-assigned
+// managed identity clientID.
+func managedIdentityToken(ctx context.Context, resource, clientID string) (string, error) {
+	spt, err := adal.NewServicePrincipalTokenFromManagedIdentity(resource, &adal.ManagedIdentityOptions{
+		ClientID: clientID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := spt.EnsureFreshWithContext(ctx); err != nil {
+		return "", fmt.Errorf("unable to get a token for the managed identity %s: %w", clientID, err)
+	}
+	return spt.OAuthToken(), nil
+}
+
 func getEnvironmentByName(name string) (autorestazure.Environment, error) {
 	if name == "" {
 		return autorestazure.PublicCloud, nil
@@ -139,10 +245,79 @@ func generateAccountName(infrastructureName string) string {
 	return strings.ToLower(prefix)
 }
 
-func getBlobServiceURL(environment autorestazure.Environment, accountName string) (*url.URL, error) {
+// getBlobServiceURL returns the URL of the blob service of the storage
+// account, privateEndpointSuffix replaces the public blob endpoint of the
+// environment when it is set.
+func getBlobServiceURL(environment autorestazure.Environment, accountName, privateEndpointSuffix string) (*url.URL, error) {
+	if privateEndpointSuffix != "" {
+		return url.Parse("https://" + accountName + "." + privateEndpointSuffix)
+	}
 	return url.Parse("https://" + accountName + ".blob." + environment.StorageEndpointSuffix)
 }
 
+// validatePrivateEndpointSuffix verifies that suffix is a DNS name that can
+// be appended to the name of the storage account.
+func validatePrivateEndpointSuffix(suffix string) error {
+	if suffix == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(suffix); len(errs) != 0 {
+		return fmt.Errorf("invalid privateEndpointSuffix %q: %s", suffix, strings.Join(errs, ", "))
+	}
+	if !strings.Contains(suffix, ".") {
+		return fmt.Errorf("invalid privateEndpointSuffix %q: it must be a fully qualified domain name", suffix)
+	}
+	return nil
+}
+
+// parseSASToken verifies that token looks like a shared access signature and
+// returns its expiry time.
+func parseSASToken(token string) (time.Time, error) {
+	values, err := url.ParseQuery(strings.TrimPrefix(token, "?"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse shared access signature: %s", err)
+	}
+	if values.Get("sig") == "" {
+		return time.Time{}, fmt.Errorf("shared access signature does not contain a signature (sig)")
+	}
+
+	se := values.Get("se")
+	if se == "" {
+		return time.Time{}, fmt.Errorf("shared access signature does not contain an expiry time (se)")
+	}
+	// Azure accepts any of the ISO 8601 formats below.
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if expiry, err := time.Parse(layout, se); err == nil {
+			return expiry, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("shared access signature has invalid expiry time %q", se)
+}
+
+// checkSASToken validates the shared access signature provided by the user
+// and reflects its state in the StorageSASTokenValid condition.
+func checkSASToken(cr *imageregistryv1.Config, token string, now time.Time) error {
+	expiry, err := parseSASToken(token)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageSASTokenValid, operatorapiv1.ConditionFalse, sasTokenReasonInvalid, err.Error())
+		return err
+	}
+
+	if !now.Before(expiry) {
+		err := fmt.Errorf("shared access signature expired at %s", expiry.Format(time.RFC3339))
+		util.UpdateCondition(cr, defaults.StorageSASTokenValid, operatorapiv1.ConditionFalse, sasTokenReasonExpired, err.Error())
+		return err
+	}
+
+	if expiry.Sub(now) < sasTokenExpiryWarning {
+		util.UpdateCondition(cr, defaults.StorageSASTokenValid, operatorapiv1.ConditionTrue, sasTokenReasonExpiringSoon, fmt.Sprintf("Shared access signature expires at %s and should be rotated", expiry.Format(time.RFC3339)))
+		return nil
+	}
+
+	util.UpdateCondition(cr, defaults.StorageSASTokenValid, operatorapiv1.ConditionTrue, sasTokenReasonValid, fmt.Sprintf("Shared access signature expires at %s", expiry.Format(time.RFC3339)))
+	return nil
+}
+
 func (d *driver) accountExists(storageAccountsClient storage.AccountsClient, accountName string) (storage.CheckNameAvailabilityResult, error) {
 	return storageAccountsClient.CheckNameAvailability(
 		d.Context,
@@ -153,35 +328,125 @@ func (d *driver) accountExists(storageAccountsClient storage.AccountsClient, acc
 	)
 }
 
+// accountSKU returns the SKU for the storage account and the kind of account
+// it requires.
+func (d *driver) accountSKU() (storage.SkuName, storage.Kind, error) {
+	if d.Config.AccountSKU == "" {
+		return storage.StandardLRS, storage.StorageV2, nil
+	}
+	for _, sku := range storage.PossibleSkuNameValues() {
+		if string(sku) != d.Config.AccountSKU {
+			continue
+		}
+		// Premium block blobs are only available for BlockBlobStorage
+		// accounts.
+		if strings.HasPrefix(string(sku), "Premium_") {
+			return sku, storage.BlockBlobStorage, nil
+		}
+		return sku, storage.StorageV2, nil
+	}
+	return "", "", fmt.Errorf("unsupported account SKU %q", d.Config.AccountSKU)
+}
+
+// validateSoftDeleteDays returns an error when the retention of deleted blobs
+// is out of the range accepted by Azure.
+func (d *driver) validateSoftDeleteDays() error {
+	if d.Config.SoftDeleteDays < 0 || d.Config.SoftDeleteDays > 365 {
+		return fmt.Errorf("softDeleteDays must be between 1 and 365, got %d", d.Config.SoftDeleteDays)
+	}
+	return nil
+}
+
+// assureSoftDelete enables the soft delete of blobs on the storage account
+// with the requested retention. The other properties of the blob service
+// are preserved.
+func (d *driver) assureSoftDelete(blobServicesClient storage.BlobServicesClient, resourceGroupName, accountName string) error {
+	if d.Config.SoftDeleteDays == 0 {
+		return nil
+	}
+
+	props, err := blobServicesClient.GetServiceProperties(d.Context, resourceGroupName, accountName)
+	if err != nil {
+		return fmt.Errorf("failed to get the blob service properties of the storage account %s: %w", accountName, err)
+	}
+	if props.BlobServicePropertiesProperties == nil {
+		props.BlobServicePropertiesProperties = &storage.BlobServicePropertiesProperties{}
+	}
+
+	policy := props.DeleteRetentionPolicy
+	if policy != nil && to.Bool(policy.Enabled) && to.Int32(policy.Days) == d.Config.SoftDeleteDays {
+		return nil
+	}
+
+	klog.Infof("enabling the soft delete of blobs on the azure storage account %s (days=%d)", accountName, d.Config.SoftDeleteDays)
+
+	props.DeleteRetentionPolicy = &storage.DeleteRetentionPolicy{
+		Enabled: to.BoolPtr(true),
+		Days:    to.Int32Ptr(d.Config.SoftDeleteDays),
+	}
+	if _, err := blobServicesClient.SetServiceProperties(d.Context, resourceGroupName, accountName, storage.BlobServiceProperties{
+		BlobServicePropertiesProperties: props.BlobServicePropertiesProperties,
+	}); err != nil {
+		return fmt.Errorf("failed to enable the soft delete of blobs on the storage account %s: %w", accountName, err)
+	}
+	return nil
+}
+
+// checkAccountSKU returns an error if an existing storage account doesn't
+// have the requested SKU. Changing the SKU may require to recreate the
+// account, which is never done by the operator.
+func (d *driver) checkAccountSKU(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName string) error {
+	if d.Config.AccountSKU == "" {
+		return nil
+	}
+
+	account, err := storageAccountsClient.GetProperties(d.Context, resourceGroupName, accountName, "")
+	if err != nil {
+		klog.Warningf("unable to get the properties of the storage account %s: %s", accountName, err)
+		return nil
+	}
+	if account.Sku != nil && string(account.Sku.Name) != d.Config.AccountSKU {
+		return &errAccountSKUChanged{
+			Err: fmt.Errorf("the storage account %s has the SKU %s, it can't be changed to %s by the operator, the account needs to be recreated", accountName, account.Sku.Name, d.Config.AccountSKU),
+		}
+	}
+	return nil
+}
+
 func (d *driver) createStorageAccount(storageAccountsClient storage.AccountsClient, resourceGroupName, accountName, location string) error {
-	klog.Infof("attempt to create azure storage account %s (resourceGroup=%q, location=%q)...", accountName, resourceGroupName, location)
+	sku, kind, err := d.accountSKU()
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("attempt to create azure storage account %s (resourceGroup=%q, location=%q, sku=%q)...", accountName, resourceGroupName, location, sku)
 
 	future, err := storageAccountsClient.Create(
 		d.Context,
 		resourceGroupName,
 		accountName,
 		storage.AccountCreateParameters{
-			Kind:     storage.StorageV2,
+			Kind:     kind,
 			Location: to.StringPtr(location),
 			Sku: &storage.Sku{
-				Name: storage.StandardLRS,
+				Name: sku,
 			},
 			AccountPropertiesCreateParameters: &storage.AccountPropertiesCreateParameters{},
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to start creating storage account: %s", err)
+		return fmt.Errorf("failed to start creating storage account: %w", err)
 	}
 
 	// TODO: this may take up to 10 minutes
 	err = future.WaitForCompletionRef(d.Context, storageAccountsClient.Client)
 	if err != nil {
-		return fmt.Errorf("failed to finish creating storage account: %s", err)
+		return fmt.Errorf("failed to finish creating storage account: %w", err)
 	}
 
 	_, err = future.Result(storageAccountsClient)
 	if err != nil {
-		return fmt.Errorf("failed to create storage account: %s", err)
+		return fmt.Errorf("failed to create storage account: %w", err)
 	}
 
 	klog.Infof("azure storage account %s has been created", accountName)
@@ -204,10 +469,23 @@ func (d *driver) getAccountPrimaryKey(storageAccountsClient storage.AccountsClie
 	return key, nil
 }
 
-func (d *driver) getStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) (azblob.ContainerURL, error) {
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
-	if err != nil {
-		return azblob.ContainerURL{}, err
+func (d *driver) getServiceURL(environment autorestazure.Environment, accountName string, creds credentials) (azblob.ServiceURL, error) {
+	var c azblob.Credential
+	if creds.sasToken != "" {
+		c = azblob.NewAnonymousCredential()
+	} else if creds.clientID != "" {
+		// The driver is recreated for every sync, the token outlives it.
+		token, err := d.identityToken(d.Context, environment.ResourceIdentifiers.Storage, creds.clientID)
+		if err != nil {
+			return azblob.ServiceURL{}, err
+		}
+		c = azblob.NewTokenCredential(token, nil)
+	} else {
+		var err error
+		c, err = azblob.NewSharedKeyCredential(accountName, creds.accountKey)
+		if err != nil {
+			return azblob.ServiceURL{}, err
+		}
 	}
 
 	p := azblob.NewPipeline(c, azblob.PipelineOptions{
@@ -215,17 +493,31 @@ func (d *driver) getStorageContainer(environment autorestazure.Environment, acco
 		HTTPSender: d.httpSender,
 	})
 
-	u, err := getBlobServiceURL(environment, accountName)
+	var privateEndpointSuffix string
+	if d.Config != nil {
+		privateEndpointSuffix = d.Config.PrivateEndpointSuffix
+	}
+	u, err := getBlobServiceURL(environment, accountName, privateEndpointSuffix)
 	if err != nil {
-		return azblob.ContainerURL{}, err
+		return azblob.ServiceURL{}, err
+	}
+	if creds.sasToken != "" {
+		u.RawQuery = strings.TrimPrefix(creds.sasToken, "?")
 	}
 
-	service := azblob.NewServiceURL(*u, p)
+	return azblob.NewServiceURL(*u, p), nil
+}
+
+func (d *driver) getStorageContainer(environment autorestazure.Environment, accountName string, creds credentials, containerName string) (azblob.ContainerURL, error) {
+	service, err := d.getServiceURL(environment, accountName, creds)
+	if err != nil {
+		return azblob.ContainerURL{}, err
+	}
 	return service.NewContainerURL(containerName), nil
 }
 
-func (d *driver) createStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
+func (d *driver) createStorageContainer(environment autorestazure.Environment, accountName string, creds credentials, containerName string) error {
+	container, err := d.getStorageContainer(environment, accountName, creds, containerName)
 	if err != nil {
 		return err
 	}
@@ -234,8 +526,8 @@ func (d *driver) createStorageContainer(environment autorestazure.Environment, a
 	return err
 }
 
-func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName, key, containerName string) error {
-	container, err := d.getStorageContainer(environment, accountName, key, containerName)
+func (d *driver) deleteStorageContainer(environment autorestazure.Environment, accountName string, creds credentials, containerName string) error {
+	container, err := d.getStorageContainer(environment, accountName, creds, containerName)
 	if err != nil {
 		return err
 	}
@@ -267,26 +559,36 @@ type driver struct {
 	// httpSender is for Azure Pipeline.
 	// Added as a member to the struct to allow injection for testing.
 	httpSender pipeline.Factory
+
+	// lookupHost and dial are used to check the private endpoint, they are
+	// replaced during tests.
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	dial       func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// identityToken gets the Azure AD tokens of the managed identity, it is
+	// replaced during tests.
+	identityToken func(ctx context.Context, resource, clientID string) (string, error)
 }
 
 // NewDriver creates a new storage driver for Azure Blob Storage.
 func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorageAzure, listers *regopclient.Listers) *driver {
 	return &driver{
-		Context: ctx,
-		Config:  c,
-		Listers: listers,
+		Context:       ctx,
+		Config:        c,
+		Listers:       listers,
+		lookupHost:    net.DefaultResolver.LookupHost,
+		dial:          (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		identityToken: managedIdentityToken,
 	}
 }
 
-func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Environment) (storage.AccountsClient, error) {
-	storageAccountsClient := storage.NewAccountsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
-	storageAccountsClient.PollingDelay = 10 * time.Second
-	storageAccountsClient.PollingDuration = 3 * time.Minute
-	storageAccountsClient.RetryAttempts = 1
-	_ = storageAccountsClient.AddToUserAgent(defaults.UserAgent)
+// configureClient sets up the authentication of an Azure autorest generated
+// client.
+func (d *driver) configureClient(client *autorest.Client, cfg *Azure, environment autorestazure.Environment) error {
+	_ = client.AddToUserAgent(defaults.UserAgent)
 
 	if d.authorizer != nil {
-		storageAccountsClient.Authorizer = d.authorizer
+		client.Authorizer = d.authorizer
 	} else {
 		clientCredentialsConfig := auth.NewClientCredentialsConfig(cfg.ClientID, cfg.ClientSecret, cfg.TenantID)
 		clientCredentialsConfig.Resource = environment.ResourceManagerEndpoint
@@ -294,41 +596,71 @@ func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Env
 
 		auth, err := clientCredentialsConfig.Authorizer()
 		if err != nil {
-			return storage.AccountsClient{}, err
+			return err
 		}
 
-		storageAccountsClient.Authorizer = auth
+		client.Authorizer = auth
 	}
 
 	if d.sender != nil {
-		storageAccountsClient.Sender = d.sender
+		client.Sender = d.sender
+	}
+
+	return nil
+}
+
+func (d *driver) storageAccountsClient(cfg *Azure, environment autorestazure.Environment) (storage.AccountsClient, error) {
+	storageAccountsClient := storage.NewAccountsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	storageAccountsClient.PollingDelay = 10 * time.Second
+	storageAccountsClient.PollingDuration = 3 * time.Minute
+	storageAccountsClient.RetryAttempts = 1
+
+	if err := d.configureClient(&storageAccountsClient.Client, cfg, environment); err != nil {
+		return storage.AccountsClient{}, err
 	}
 
 	return storageAccountsClient, nil
 }
 
-func (d *driver) getKey(cfg *Azure, environment autorestazure.Environment) (string, error) {
+func (d *driver) blobServicesClient(cfg *Azure, environment autorestazure.Environment) (storage.BlobServicesClient, error) {
+	blobServicesClient := storage.NewBlobServicesClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	blobServicesClient.RetryAttempts = 1
+
+	if err := d.configureClient(&blobServicesClient.Client, cfg, environment); err != nil {
+		return storage.BlobServicesClient{}, err
+	}
+
+	return blobServicesClient, nil
+}
+
+func (d *driver) getCredentials(cfg *Azure, environment autorestazure.Environment) (credentials, error) {
+	if cfg.ManagedIdentityClientID != "" {
+		return credentials{clientID: cfg.ManagedIdentityClientID}, nil
+	}
+	if cfg.SASToken != "" {
+		return credentials{sasToken: cfg.SASToken}, nil
+	}
 	if cfg.AccountKey != "" {
-		return cfg.AccountKey, nil
+		return credentials{accountKey: cfg.AccountKey}, nil
 	}
 
 	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
 	if err != nil {
-		return "", err
+		return credentials{}, err
 	}
 
 	key, err := d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
 	if err != nil {
-		return "", err
+		return credentials{}, err
 	}
 
-	return key, nil
+	return credentials{accountKey: key}, nil
 }
 
 // ConfigEnv configures the environment variables that will be used in the
 // image registry deployment.
 func (d *driver) ConfigEnv() (envs envvar.List, err error) {
-	cfg, err := GetConfig(d.Listers.Secrets)
+	cfg, err := d.getConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -338,30 +670,50 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		return nil, err
 	}
 
-	key := cfg.AccountKey
-	if key == "" {
-		storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-		if err != nil {
-			return nil, err
-		}
-
-		key, err = d.getAccountPrimaryKey(storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName)
-		if err != nil {
-			return nil, err
-		}
+	creds, err := d.getCredentials(cfg, environment)
+	if err != nil {
+		return nil, err
 	}
 
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "azure"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_CONTAINER", Value: d.Config.Container},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTNAME", Value: d.Config.AccountName},
-		envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: key, Secret: true},
 	)
 
+	if creds.clientID != "" {
+		// The registry gets its tokens from the default Azure credential
+		// chain, which uses the managed identity of AZURE_CLIENT_ID.
+		envs = append(envs,
+			envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE", Value: "default_credentials"},
+			envvar.EnvVar{Name: "AZURE_CLIENT_ID", Value: creds.clientID},
+		)
+	} else if creds.sasToken != "" {
+		// The Azure driver of the registry has no support for shared access
+		// signatures, the token is only used by the operator.
+		if cfg.AccountKey == "" {
+			return nil, fmt.Errorf("the registry cannot authenticate with a shared access signature, the secret %s/%s must also contain REGISTRY_STORAGE_AZURE_ACCOUNTKEY", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser)
+		}
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: cfg.AccountKey, Secret: true})
+	} else {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_ACCOUNTKEY", Value: creds.accountKey, Secret: true})
+	}
+
 	if d.Config.CloudName != "" {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_REALM", Value: environment.StorageEndpointSuffix})
 	}
 
+	if d.Config.PrivateEndpointSuffix != "" {
+		if err := validatePrivateEndpointSuffix(d.Config.PrivateEndpointSuffix); err != nil {
+			return nil, err
+		}
+		u, err := getBlobServiceURL(environment, d.Config.AccountName, d.Config.PrivateEndpointSuffix)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_AZURE_SERVICEURL", Value: u.String()})
+	}
+
 	return
 }
 
@@ -373,29 +725,36 @@ func (d *driver) VolumeSecrets() (map[string]string, error) {
 	return nil, nil
 }
 
+// isCloudAPIUnavailable returns true when the Azure Resource Manager or the
+// blob service responded with a server error. The errors of the management
+// API are wrapped while the storage account is provisioned.
+func isCloudAPIUnavailable(err error) bool {
+	var detailedErr autorest.DetailedError
+	if goerrors.As(err, &detailedErr) {
+		if detailedErr.Response != nil {
+			return detailedErr.Response.StatusCode >= http.StatusInternalServerError
+		}
+		code, ok := detailedErr.StatusCode.(int)
+		return ok && code >= http.StatusInternalServerError
+	}
+	var storageErr azblob.StorageError
+	if goerrors.As(err, &storageErr) {
+		return storageErr.Response() != nil && storageErr.Response().StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
 // containerExists determines whether or not an azure container exists
-func (d *driver) containerExists(ctx context.Context, environment autorestazure.Environment, accountName, key, containerName string) (bool, error) {
+func (d *driver) containerExists(ctx context.Context, environment autorestazure.Environment, accountName string, creds credentials, containerName string) (bool, error) {
 	if accountName == "" || containerName == "" {
 		return false, nil
 	}
 
-	c, err := azblob.NewSharedKeyCredential(accountName, key)
+	container, err := d.getStorageContainer(environment, accountName, creds, containerName)
 	if err != nil {
 		return false, err
 	}
 
-	u, err := getBlobServiceURL(environment, accountName)
-	if err != nil {
-		return false, err
-	}
-
-	p := azblob.NewPipeline(c, azblob.PipelineOptions{
-		Telemetry:  azblob.TelemetryOptions{Value: defaults.UserAgent},
-		HTTPSender: d.httpSender,
-	})
-
-	service := azblob.NewServiceURL(*u, p)
-	container := service.NewContainerURL(containerName)
 	_, err = container.GetProperties(ctx, azblob.LeaseAccessConditions{})
 	if e, ok := err.(azblob.StorageError); ok {
 		if e.ServiceCode() == azblob.ServiceCodeContainerNotFound {
@@ -403,20 +762,99 @@ func (d *driver) containerExists(ctx context.Context, environment autorestazure.
 		}
 	}
 	if err != nil {
-		return false, fmt.Errorf("unable to get the storage container %s: %s", containerName, err)
+		return false, fmt.Errorf("unable to get the storage container %s: %w", containerName, err)
 	}
 
 	return true, nil
 }
 
-// StorageExists checks if the storage container exists and is accessible.
+// StorageExists checks whether the storage exists and is accessible, and
+// reports through the CloudAPIUnavailable condition whether Azure
+// answered.
 func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+	exists, err := d.storageExists(cr)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	d.checkPrivateEndpoint(cr)
+	return exists, err
+}
+
+// privateNetworks are the RFC 1918 IPv4 networks and the IPv6 unique local
+// addresses the private endpoints are allocated from.
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPrivateIP returns true if ip belongs to one of the privateNetworks.
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrivateEndpoint sets the StoragePrivateEndpointReachable condition
+// when the storage account is reached through privateEndpointSuffix. The
+// name of the account has to resolve to private addresses, otherwise the
+// private DNS zone of the endpoint is likely not linked to the network of
+// the cluster and the requests go to the public endpoint.
+func (d *driver) checkPrivateEndpoint(cr *imageregistryv1.Config) {
+	if d.Config == nil || d.Config.PrivateEndpointSuffix == "" || d.Config.AccountName == "" {
+		return
+	}
+	if err := validatePrivateEndpointSuffix(d.Config.PrivateEndpointSuffix); err != nil {
+		util.UpdateCondition(cr, defaults.StoragePrivateEndpointReachable, operatorapiv1.ConditionFalse, storageExistsReasonConfigError, err.Error())
+		return
+	}
+
+	host := d.Config.AccountName + "." + d.Config.PrivateEndpointSuffix
+
+	ctx, cancel := context.WithTimeout(d.Context, 10*time.Second)
+	defer cancel()
+
+	addrs, err := d.lookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StoragePrivateEndpointReachable, operatorapiv1.ConditionFalse, privateEndpointReasonDNSLookupFailed, fmt.Sprintf("Unable to resolve %s: %s", host, err))
+		return
+	}
+
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip == nil || !isPrivateIP(ip) {
+			util.UpdateCondition(cr, defaults.StoragePrivateEndpointReachable, operatorapiv1.ConditionFalse, privateEndpointReasonPublicAddress, fmt.Sprintf("%s resolves to the public address %s, the private DNS zone of the endpoint may not be linked to the cluster network", host, addr))
+			return
+		}
+	}
+
+	conn, err := d.dial(ctx, "tcp", net.JoinHostPort(addrs[0], "443"))
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StoragePrivateEndpointReachable, operatorapiv1.ConditionFalse, privateEndpointReasonConnectionFailed, fmt.Sprintf("Unable to connect to %s: %s", host, err))
+		return
+	}
+	conn.Close()
+
+	util.UpdateCondition(cr, defaults.StoragePrivateEndpointReachable, operatorapiv1.ConditionTrue, privateEndpointReasonReachable, fmt.Sprintf("%s is reachable at the private address %s", host, addrs[0]))
+}
+
+// storageExists checks if the storage container exists and is accessible.
+func (d *driver) storageExists(cr *imageregistryv1.Config) (bool, error) {
 	if d.Config.AccountName == "" || d.Config.Container == "" {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonNotConfigured, "Storage is not configured")
 		return false, nil
 	}
 
-	cfg, err := GetConfig(d.Listers.Secrets)
+	cfg, err := d.getConfig()
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get configuration: %s", err))
 		return false, err
@@ -428,13 +866,20 @@ func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
 		return false, err
 	}
 
-	key, err := d.getKey(cfg, environment)
+	if cfg.SASToken != "" {
+		if err := checkSASToken(cr, cfg.SASToken, time.Now()); err != nil {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Invalid shared access signature: %s", err))
+			return false, err
+		}
+	}
+
+	creds, err := d.getCredentials(cfg, environment)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get storage account key: %s", err))
 		return false, err
 	}
 
-	exists, err := d.containerExists(d.Context, environment, d.Config.AccountName, key, d.Config.Container)
+	exists, err := d.containerExists(d.Context, environment, d.Config.AccountName, creds, d.Config.Container)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("%s", err))
 		return false, err
@@ -492,13 +937,36 @@ func (d *driver) assureStorageAccount(cfg *Azure, infra *configv1.Infrastructure
 		if err := d.createStorageAccount(
 			storageAccountsClient, cfg.ResourceGroup, accountName, cfg.Region,
 		); err != nil {
-			return "", false, err
+			return "", false, util.NewProvisioningError("StorageAccountCreationFailed", err)
 		}
+	} else if err := d.checkAccountSKU(storageAccountsClient, cfg.ResourceGroup, accountName); err != nil {
+		return "", false, err
 	}
 
 	return accountName, storageAccountCreated, nil
 }
 
+// assureDataProtection applies the data protection settings to the storage
+// account. Blob versioning is not configured, the isVersioningEnabled property
+// is only part of the storage management API 2019-06-01 and later.
+func (d *driver) assureDataProtection(cfg *Azure) error {
+	if d.Config.SoftDeleteDays == 0 {
+		return nil
+	}
+
+	environment, err := getEnvironmentByName(d.Config.CloudName)
+	if err != nil {
+		return err
+	}
+
+	blobServicesClient, err := d.blobServicesClient(cfg, environment)
+	if err != nil {
+		return err
+	}
+
+	return d.assureSoftDelete(blobServicesClient, cfg.ResourceGroup, d.Config.AccountName)
+}
+
 // assureContainer makes sure we have a container in place. Container name may be provided or
 // generated automatically. Returns the container name (the provided one or the automatically
 // generated), if the container was created or was already there and an error.
@@ -508,14 +976,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 		return "", false, err
 	}
 
-	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
-	if err != nil {
-		return "", false, err
-	}
-
-	key, err := d.getAccountPrimaryKey(
-		storageAccountsClient, cfg.ResourceGroup, d.Config.AccountName,
-	)
+	creds, err := d.getCredentials(cfg, environment)
 	if err != nil {
 		return "", false, err
 	}
@@ -527,7 +988,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 		}
 
 		if err = d.createStorageContainer(
-			environment, d.Config.AccountName, key, containerName,
+			environment, d.Config.AccountName, creds, containerName,
 		); err != nil {
 			return "", false, err
 		}
@@ -536,7 +997,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	}
 
 	if exists, err := d.containerExists(
-		d.Context, environment, d.Config.AccountName, key, d.Config.Container,
+		d.Context, environment, d.Config.AccountName, creds, d.Config.Container,
 	); err != nil {
 		return "", false, err
 	} else if exists {
@@ -544,7 +1005,7 @@ func (d *driver) assureContainer(cfg *Azure) (string, bool, error) {
 	}
 
 	if err = d.createStorageContainer(
-		environment, d.Config.AccountName, key, d.Config.Container,
+		environment, d.Config.AccountName, creds, d.Config.Container,
 	); err != nil {
 		return "", false, err
 	}
@@ -592,11 +1053,33 @@ func (d *driver) processUPI(cr *imageregistryv1.Config) {
 		storageExistsReasonUserManaged,
 		"Storage is managed by the user",
 	)
+	setStorageEncrypted(cr)
+}
+
+// setStorageEncrypted reports the storage as encrypted. Azure Storage Service
+// Encryption is enabled for every storage account and cannot be disabled.
+func setStorageEncrypted(cr *imageregistryv1.Config) {
+	util.UpdateCondition(
+		cr,
+		defaults.StorageEncrypted,
+		operatorapiv1.ConditionTrue,
+		storageEncryptedReasonEncryptedAtRest,
+		"Azure Storage encrypts all data at rest",
+	)
 }
 
-// CreateStorage attempts to create a storage account and a storage container.
+// CreateStorage provisions the storage, and reports through the
+// CloudAPIUnavailable condition whether Azure answered.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
-	cfg, err := GetConfig(d.Listers.Secrets)
+	err := d.createStorage(cr)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	d.checkPrivateEndpoint(cr)
+	return err
+}
+
+// createStorage attempts to create a storage account and a storage container.
+func (d *driver) createStorage(cr *imageregistryv1.Config) error {
+	cfg, err := d.getConfig()
 	if err != nil {
 		util.UpdateCondition(
 			cr,
@@ -608,6 +1091,68 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	if err := validatePrivateEndpointSuffix(d.Config.PrivateEndpointSuffix); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionFalse,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Invalid storage account configuration: %s", err),
+		)
+		return err
+	}
+
+	// the managed identity is only allowed to access the blobs of an existing
+	// storage account, we can only make sure the container is in place.
+	if cfg.ManagedIdentityClientID != "" {
+		if d.Config.AccountName != "" && d.Config.Container != "" {
+			if _, _, err := d.assureContainer(cfg); err != nil {
+				util.UpdateCondition(
+					cr,
+					defaults.StorageExists,
+					operatorapiv1.ConditionUnknown,
+					storageExistsReasonAzureError,
+					fmt.Sprintf("Unable to process storage container: %s", err),
+				)
+				return err
+			}
+		}
+
+		d.processUPI(cr)
+		return nil
+	}
+
+	// a shared access signature does not allow us to manage the storage
+	// account, we can only make sure the container is in place.
+	if cfg.SASToken != "" {
+		if err := checkSASToken(cr, cfg.SASToken, time.Now()); err != nil {
+			util.UpdateCondition(
+				cr,
+				defaults.StorageExists,
+				operatorapiv1.ConditionUnknown,
+				storageExistsReasonConfigError,
+				fmt.Sprintf("Invalid shared access signature: %s", err),
+			)
+			return err
+		}
+
+		if d.Config.AccountName != "" && d.Config.Container != "" {
+			if _, _, err := d.assureContainer(cfg); err != nil {
+				util.UpdateCondition(
+					cr,
+					defaults.StorageExists,
+					operatorapiv1.ConditionUnknown,
+					storageExistsReasonAzureError,
+					fmt.Sprintf("Unable to process storage container: %s", err),
+				)
+				return err
+			}
+		}
+
+		d.processUPI(cr)
+		return nil
+	}
+
 	// if AccountKey is present in our configuration it means it was provided by the user
 	// so we only verify if everything we need is in place.
 	if cfg.AccountKey != "" {
@@ -636,8 +1181,39 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
+	if err := d.validateSoftDeleteDays(); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionFalse,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Invalid storage account configuration: %s", err),
+		)
+		return err
+	}
+
+	if _, _, err := d.accountSKU(); err != nil {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionFalse,
+			storageExistsReasonConfigError,
+			fmt.Sprintf("Invalid storage account configuration: %s", err),
+		)
+		return err
+	}
+
 	storageAccountName, storageAccountCreated, err := d.assureStorageAccount(cfg, infra)
-	if err != nil {
+	if _, ok := err.(*errAccountSKUChanged); ok {
+		util.UpdateCondition(
+			cr,
+			defaults.StorageExists,
+			operatorapiv1.ConditionFalse,
+			storageExistsReasonAccountSKUChanged,
+			err.Error(),
+		)
+		return err
+	} else if err != nil {
 		util.UpdateCondition(
 			cr,
 			defaults.StorageExists,
@@ -649,6 +1225,24 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	}
 	d.Config.AccountName = storageAccountName
 
+	// The data protection settings are only applied to the storage accounts
+	// the operator manages, the accounts provided by the user are left as
+	// they are.
+	if storageAccountCreated || cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		if err := d.assureDataProtection(cfg); err != nil {
+			util.UpdateCondition(
+				cr,
+				defaults.StorageExists,
+				operatorapiv1.ConditionUnknown,
+				storageExistsReasonAzureError,
+				fmt.Sprintf("Unable to configure the data protection of the storage account: %s", err),
+			)
+			return err
+		}
+	} else if d.Config.SoftDeleteDays != 0 {
+		klog.Infof("the azure storage account %s is not managed by the operator, its soft delete settings are left unchanged", storageAccountName)
+	}
+
 	containerName, containerCreated, err := d.assureContainer(cfg)
 	if err != nil {
 		util.UpdateCondition(
@@ -683,6 +1277,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		storageExistsReasonContainerExists,
 		"Storage container exists",
 	)
+	setStorageEncrypted(cr)
 	return nil
 }
 
@@ -696,7 +1291,7 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		return false, nil
 	}
 
-	cfg, err := GetConfig(d.Listers.Secrets)
+	cfg, err := d.getConfig()
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonConfigError, fmt.Sprintf("Unable to get configuration: %s", err))
 		return false, err
@@ -708,6 +1303,27 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 		return false, err
 	}
 
+	// The storage account accessed with a managed identity is provided by
+	// the user, only the container can be removed.
+	if cfg.ManagedIdentityClientID != "" {
+		if d.Config.Container == "" {
+			return false, nil
+		}
+		creds, err := d.getCredentials(cfg, environment)
+		if err != nil {
+			return false, err
+		}
+		if err := d.deleteStorageContainer(environment, d.Config.AccountName, creds, d.Config.Container); err != nil {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container: %s", err))
+			return false, err
+		}
+		d.Config.Container = ""
+		cr.Spec.Storage.Azure.Container = ""
+		cr.Status.Storage.Azure.Container = ""
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionFalse, storageExistsReasonContainerDeleted, "Storage container has been deleted")
+		return false, nil
+	}
+
 	storageAccountsClient, err := d.storageAccountsClient(cfg, environment)
 	if err != nil {
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to get accounts client: %s", err))
@@ -728,7 +1344,7 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (retry bool, err erro
 			return false, err
 		}
 
-		err = d.deleteStorageContainer(environment, d.Config.AccountName, key, d.Config.Container)
+		err = d.deleteStorageContainer(environment, d.Config.AccountName, credentials{accountKey: key}, d.Config.Container)
 		if err != nil {
 			util.UpdateCondition(cr, defaults.StorageExists, operatorapiv1.ConditionUnknown, storageExistsReasonAzureError, fmt.Sprintf("Unable to delete storage container: %s", err))
 			return false, err // TODO: is it retryable?
@@ -3,14 +3,20 @@ package azure
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-sdk-for-go/services/storage/mgmt/2019-04-01/storage"
 	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/mocks"
 
 	corev1 "k8s.io/api/core/v1"
@@ -22,6 +28,7 @@ import (
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapiv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -120,6 +127,25 @@ func TestGetConfig(t *testing.T) {
 				AccountKey: "cba",
 			},
 		},
+		{
+			name: "user provided shared access signature",
+			secrets: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.ImageRegistryPrivateConfigurationUser,
+						Namespace: "test",
+					},
+					Data: map[string][]byte{
+						"REGISTRY_STORAGE_AZURE_SASTOKEN":   []byte("sv=2019-12-12&se=2030-01-01T00:00:00Z&sig=abc"),
+						"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("cba"),
+					},
+				},
+			},
+			result: &Azure{
+				AccountKey: "cba",
+				SASToken:   "sv=2019-12-12&se=2030-01-01T00:00:00Z&sig=abc",
+			},
+		},
 		{
 			name: "cloud credentials",
 			secrets: []runtime.Object{
@@ -329,6 +355,544 @@ func TestConfigEnvWithUserKey(t *testing.T) {
 	}
 }
 
+func TestConfigEnvWithSASToken(t *testing.T) {
+	ctx := context.Background()
+
+	config := &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: "account",
+		Container:   "container",
+	}
+
+	for _, tt := range []struct {
+		name       string
+		data       map[string][]byte
+		err        string
+		accountKey string
+	}{
+		{
+			name: "shared access signature only",
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_AZURE_SASTOKEN": []byte("se=2030-01-01&sig=abc"),
+			},
+			err: "the registry cannot authenticate with a shared access signature, the secret openshift-image-registry/image-registry-private-configuration-user must also contain REGISTRY_STORAGE_AZURE_ACCOUNTKEY",
+		},
+		{
+			name: "shared access signature and account key",
+			data: map[string][]byte{
+				"REGISTRY_STORAGE_AZURE_SASTOKEN":   []byte("se=2030-01-01&sig=abc"),
+				"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("key"),
+			},
+			accountKey: "key",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testBuilder := cirofake.NewFixturesBuilder()
+			testBuilder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryPrivateConfigurationUser,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: tt.data,
+			})
+
+			listers := testBuilder.BuildListers()
+
+			d := NewDriver(ctx, config, listers)
+			envvars, err := d.ConfigEnv()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedVars := map[string]interface{}{
+				"REGISTRY_STORAGE":                   "azure",
+				"REGISTRY_STORAGE_AZURE_CONTAINER":   "container",
+				"REGISTRY_STORAGE_AZURE_ACCOUNTNAME": "account",
+				"REGISTRY_STORAGE_AZURE_ACCOUNTKEY":  tt.accountKey,
+			}
+			for key, value := range expectedVars {
+				e := findEnvVar(envvars, key)
+				if e == nil {
+					t.Fatalf("envvar %s not found, %v", key, envvars)
+				}
+				if e.Value != value {
+					t.Errorf("%s: got %#+v, want %#+v", key, e.Value, value)
+				}
+			}
+			if e := findEnvVar(envvars, "REGISTRY_STORAGE_AZURE_SASTOKEN"); e != nil {
+				t.Errorf("unexpected envvar REGISTRY_STORAGE_AZURE_SASTOKEN: %v", e)
+			}
+		})
+	}
+}
+
+func Test_checkSASToken(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		err    string
+		status operatorapiv1.ConditionStatus
+		reason string
+	}{
+		{
+			name:   "valid token",
+			token:  "?sv=2019-12-12&ss=b&srt=co&sp=rwdlac&se=2020-12-31T00:00:00Z&sig=abc",
+			status: operatorapiv1.ConditionTrue,
+			reason: "Valid",
+		},
+		{
+			name:   "date only expiry",
+			token:  "se=2020-12-31&sig=abc",
+			status: operatorapiv1.ConditionTrue,
+			reason: "Valid",
+		},
+		{
+			name:   "expiring soon",
+			token:  "se=2020-06-03T00:00Z&sig=abc",
+			status: operatorapiv1.ConditionTrue,
+			reason: "ExpiringSoon",
+		},
+		{
+			name:   "expired",
+			token:  "se=2020-05-01T00:00:00Z&sig=abc",
+			err:    "shared access signature expired at 2020-05-01T00:00:00Z",
+			status: operatorapiv1.ConditionFalse,
+			reason: "Expired",
+		},
+		{
+			name:   "missing signature",
+			token:  "se=2020-12-31T00:00:00Z",
+			err:    "shared access signature does not contain a signature (sig)",
+			status: operatorapiv1.ConditionFalse,
+			reason: "Invalid",
+		},
+		{
+			name:   "missing expiry",
+			token:  "sig=abc",
+			err:    "shared access signature does not contain an expiry time (se)",
+			status: operatorapiv1.ConditionFalse,
+			reason: "Invalid",
+		},
+		{
+			name:   "invalid expiry",
+			token:  "se=tomorrow&sig=abc",
+			err:    `shared access signature has invalid expiry time "tomorrow"`,
+			status: operatorapiv1.ConditionFalse,
+			reason: "Invalid",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+
+			err := checkSASToken(cr, tt.token, now)
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			var found bool
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageSASTokenValid {
+					continue
+				}
+				found = true
+				if cond.Status != tt.status || cond.Reason != tt.reason {
+					t.Errorf("expected condition %s/%s, got %s/%s", tt.status, tt.reason, cond.Status, cond.Reason)
+				}
+			}
+			if !found {
+				t.Errorf("condition %s not found", defaults.StorageSASTokenValid)
+			}
+		})
+	}
+}
+
+func TestCreateStorageWithSASToken(t *testing.T) {
+	token := "se=" + time.Now().Add(30*24*time.Hour).UTC().Format(time.RFC3339) + "&sig=abc"
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_AZURE_SASTOKEN": []byte(token),
+		},
+	})
+	listers := builder.BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+					AccountName: "account",
+					Container:   "container",
+				},
+			},
+		},
+	}
+
+	var queries []string
+	drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, listers)
+	drv.httpSender = pipeline.FactoryFunc(
+		func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(_ context.Context, req pipeline.Request) (pipeline.Response, error) {
+				queries = append(queries, req.URL.RawQuery)
+				if req.Header.Get("Authorization") != "" {
+					t.Errorf("unexpected Authorization header on SAS request")
+				}
+				return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
+			}
+		},
+	)
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queries) == 0 {
+		t.Fatal("expected the container to be checked")
+	}
+	for _, q := range queries {
+		if !strings.Contains(q, "sig=abc") {
+			t.Errorf("expected shared access signature in query, got %q", q)
+		}
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateUnmanaged {
+		t.Errorf("expected storage to be unmanaged, got %q", cr.Spec.Storage.ManagementState)
+	}
+
+	expected := map[string]string{
+		defaults.StorageExists:        "UserManaged",
+		defaults.StorageSASTokenValid: "Valid",
+		defaults.StorageEncrypted:     "EncryptedAtRest",
+	}
+	for _, cond := range cr.Status.Conditions {
+		if reason, ok := expected[cond.Type]; ok {
+			if cond.Status != operatorapiv1.ConditionTrue || cond.Reason != reason {
+				t.Errorf("%s: expected True/%s, got %s/%s", cond.Type, reason, cond.Status, cond.Reason)
+			}
+			delete(expected, cond.Type)
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing conditions: %v", expected)
+	}
+}
+
+func TestConfigEnvWithManagedIdentity(t *testing.T) {
+	config := &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName: "account",
+		Container:   "container",
+		ClientID:    "11111111-2222-3333-4444-555555555555",
+	}
+
+	// Neither the cloud credentials nor the user provided secrets exist.
+	listers := cirofake.NewFixturesBuilder().BuildListers()
+
+	d := NewDriver(context.Background(), config, listers)
+	envvars, err := d.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedVars := map[string]interface{}{
+		"REGISTRY_STORAGE":                        "azure",
+		"REGISTRY_STORAGE_AZURE_CONTAINER":        "container",
+		"REGISTRY_STORAGE_AZURE_ACCOUNTNAME":      "account",
+		"REGISTRY_STORAGE_AZURE_CREDENTIALS_TYPE": "default_credentials",
+		"AZURE_CLIENT_ID":                         "11111111-2222-3333-4444-555555555555",
+	}
+	for key, value := range expectedVars {
+		e := findEnvVar(envvars, key)
+		if e == nil {
+			t.Fatalf("envvar %s not found, %v", key, envvars)
+		}
+		if e.Value != value {
+			t.Errorf("%s: got %#+v, want %#+v", key, e.Value, value)
+		}
+	}
+	for _, key := range []string{"REGISTRY_STORAGE_AZURE_ACCOUNTKEY", "REGISTRY_STORAGE_AZURE_SASTOKEN"} {
+		if e := findEnvVar(envvars, key); e != nil {
+			t.Errorf("unexpected envvar %s: %v", key, e)
+		}
+	}
+	for _, e := range envvars {
+		if e.Secret {
+			t.Errorf("%s: expected no envvar to be stored in a secret", e.Name)
+		}
+	}
+
+	volumes, mounts, err := d.Volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 0 || len(mounts) != 0 {
+		t.Errorf("expected no volumes, got %v and %v", volumes, mounts)
+	}
+	secrets, err := d.VolumeSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("expected no secrets to be mounted, got %v", secrets)
+	}
+}
+
+func TestCreateStorageWithManagedIdentity(t *testing.T) {
+	listers := cirofake.NewFixturesBuilder().BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+					AccountName: "account",
+					Container:   "container",
+					ClientID:    "11111111-2222-3333-4444-555555555555",
+				},
+			},
+		},
+	}
+
+	var authorizations []string
+	drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, listers)
+	drv.identityToken = func(_ context.Context, resource, clientID string) (string, error) {
+		if resource != autorestazure.PublicCloud.ResourceIdentifiers.Storage {
+			t.Errorf("unexpected token resource %q", resource)
+		}
+		if clientID != "11111111-2222-3333-4444-555555555555" {
+			t.Errorf("unexpected client ID %q", clientID)
+		}
+		return "token", nil
+	}
+	drv.httpSender = pipeline.FactoryFunc(
+		func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(_ context.Context, req pipeline.Request) (pipeline.Response, error) {
+				authorizations = append(authorizations, req.Header.Get("Authorization"))
+				return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
+			}
+		},
+	)
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(authorizations) == 0 {
+		t.Fatal("expected the container to be checked")
+	}
+	for _, a := range authorizations {
+		if a != "Bearer token" {
+			t.Errorf("expected the managed identity token, got the Authorization header %q", a)
+		}
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateUnmanaged {
+		t.Errorf("expected storage to be unmanaged, got %q", cr.Spec.Storage.ManagementState)
+	}
+	for _, cond := range cr.Status.Conditions {
+		if cond.Type == defaults.StorageExists && (cond.Status != operatorapiv1.ConditionTrue || cond.Reason != "UserManaged") {
+			t.Errorf("%s: expected True/UserManaged, got %s/%s", cond.Type, cond.Status, cond.Reason)
+		}
+	}
+}
+
+func Test_validatePrivateEndpointSuffix(t *testing.T) {
+	for _, tt := range []struct {
+		suffix  string
+		wantErr bool
+	}{
+		{suffix: ""},
+		{suffix: "privatelink.blob.core.windows.net"},
+		{suffix: "blob.storage.example.com"},
+		{suffix: "localhost", wantErr: true},
+		{suffix: "https://privatelink.blob.core.windows.net", wantErr: true},
+		{suffix: ".privatelink.blob.core.windows.net", wantErr: true},
+		{suffix: "Privatelink.Blob.Core.Windows.Net", wantErr: true},
+	} {
+		err := validatePrivateEndpointSuffix(tt.suffix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v, want error %t", tt.suffix, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCreateStorageWithPrivateEndpoint(t *testing.T) {
+	token := "se=" + time.Now().Add(30*24*time.Hour).UTC().Format(time.RFC3339) + "&sig=abc"
+
+	for _, tt := range []struct {
+		name           string
+		addrs          []string
+		lookupErr      error
+		dialErr        error
+		expectedStatus operatorapiv1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "reachable",
+			addrs:          []string{"10.0.1.4"},
+			expectedStatus: operatorapiv1.ConditionTrue,
+			expectedReason: "Reachable",
+		},
+		{
+			name:           "not resolved",
+			lookupErr:      fmt.Errorf("no such host"),
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "DNSLookupFailed",
+		},
+		{
+			name:           "public address",
+			addrs:          []string{"10.0.1.4", "20.60.0.1"},
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "PublicAddress",
+		},
+		{
+			name:           "unreachable",
+			addrs:          []string{"10.0.1.4"},
+			dialErr:        fmt.Errorf("connection refused"),
+			expectedStatus: operatorapiv1.ConditionFalse,
+			expectedReason: "ConnectionFailed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := cirofake.NewFixturesBuilder()
+			builder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryPrivateConfigurationUser,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"REGISTRY_STORAGE_AZURE_SASTOKEN": []byte(token),
+				},
+			})
+			listers := builder.BuildListers()
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName:           "account",
+							Container:             "container",
+							PrivateEndpointSuffix: "privatelink.blob.core.windows.net",
+						},
+					},
+				},
+			}
+
+			var hosts []string
+			drv := NewDriver(context.Background(), cr.Spec.Storage.Azure, listers)
+			drv.httpSender = pipeline.FactoryFunc(
+				func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
+					return func(_ context.Context, req pipeline.Request) (pipeline.Response, error) {
+						hosts = append(hosts, req.URL.Host)
+						return pipeline.NewHTTPResponse(mocks.NewResponseWithContent(`{}`)), nil
+					}
+				},
+			)
+			drv.lookupHost = func(_ context.Context, host string) ([]string, error) {
+				if host != "account.privatelink.blob.core.windows.net" {
+					t.Errorf("unexpected lookup of %s", host)
+				}
+				return tt.addrs, tt.lookupErr
+			}
+			drv.dial = func(_ context.Context, network, address string) (net.Conn, error) {
+				if address != "10.0.1.4:443" {
+					t.Errorf("unexpected connection to %s", address)
+				}
+				if tt.dialErr != nil {
+					return nil, tt.dialErr
+				}
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			}
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(hosts) == 0 {
+				t.Fatal("expected the container to be checked")
+			}
+			for _, host := range hosts {
+				if host != "account.privatelink.blob.core.windows.net" {
+					t.Errorf("expected the private endpoint to be used, got %s", host)
+				}
+			}
+
+			cond := v1helpers.FindOperatorCondition(cr.Status.Conditions, defaults.StoragePrivateEndpointReachable)
+			if cond == nil {
+				t.Fatalf("expected the %s condition to be set", defaults.StoragePrivateEndpointReachable)
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s, got %s/%s: %s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason, cond.Message)
+			}
+		})
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	for addr, private := range map[string]bool{
+		"10.0.1.4":       true,
+		"172.16.0.1":     true,
+		"172.31.255.255": true,
+		"172.32.0.1":     false,
+		"192.168.1.1":    true,
+		"20.60.0.1":      false,
+		"fd00::1":        true,
+		"2603:1030::1":   false,
+	} {
+		if got := isPrivateIP(net.ParseIP(addr)); got != private {
+			t.Errorf("%s: got private %t, want %t", addr, got, private)
+		}
+	}
+}
+
+func TestConfigEnvWithPrivateEndpoint(t *testing.T) {
+	config := &imageregistryv1.ImageRegistryConfigStorageAzure{
+		AccountName:           "account",
+		Container:             "container",
+		PrivateEndpointSuffix: "privatelink.blob.core.windows.net",
+	}
+
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_AZURE_ACCOUNTKEY": []byte("key"),
+		},
+	})
+
+	d := NewDriver(context.Background(), config, testBuilder.BuildListers())
+	envvars, err := d.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := findEnvVar(envvars, "REGISTRY_STORAGE_AZURE_SERVICEURL")
+	if e == nil {
+		t.Fatalf("envvar REGISTRY_STORAGE_AZURE_SERVICEURL not found, %v", envvars)
+	}
+	if e.Value != "https://account.privatelink.blob.core.windows.net" {
+		t.Errorf("got %#+v, want %#+v", e.Value, "https://account.privatelink.blob.core.windows.net")
+	}
+}
+
 func Test_assureStorageAccount(t *testing.T) {
 	for _, tt := range []struct {
 		name          string
@@ -389,6 +953,30 @@ func Test_assureStorageAccount(t *testing.T) {
 				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
 			},
 		},
+		{
+			name:        "existing account with the requested SKU",
+			accountName: "myotheraccountname",
+			storageConfig: &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: "myotheraccountname",
+				AccountSKU:  "Standard_GRS",
+			},
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
+				mocks.NewResponseWithContent(`{"sku":{"name":"Standard_GRS"},"kind":"StorageV2"}`),
+			},
+		},
+		{
+			name: "existing account with another SKU",
+			err:  "the storage account myotheraccountname has the SKU Standard_LRS, it can't be changed to Standard_GRS",
+			storageConfig: &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName: "myotheraccountname",
+				AccountSKU:  "Standard_GRS",
+			},
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
+				mocks.NewResponseWithContent(`{"sku":{"name":"Standard_LRS"},"kind":"StorageV2"}`),
+			},
+		},
 		{
 			name: "invalid environment",
 			err:  `There is no cloud environment matching the name "INVALID"`,
@@ -453,6 +1041,175 @@ func Test_assureStorageAccount(t *testing.T) {
 	}
 }
 
+func Test_accountSKU(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		sku  string
+		want storage.SkuName
+		kind storage.Kind
+		err  string
+	}{
+		{
+			name: "default",
+			want: storage.StandardLRS,
+			kind: storage.StorageV2,
+		},
+		{
+			name: "geo-redundant",
+			sku:  "Standard_GRS",
+			want: storage.StandardGRS,
+			kind: storage.StorageV2,
+		},
+		{
+			name: "premium",
+			sku:  "Premium_LRS",
+			want: storage.PremiumLRS,
+			kind: storage.BlockBlobStorage,
+		},
+		{
+			name: "unsupported",
+			sku:  "Standard_XRS",
+			err:  `unsupported account SKU "Standard_XRS"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountSKU: tt.sku,
+			}, nil)
+
+			sku, kind, err := drv.accountSKU()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sku != tt.want || kind != tt.kind {
+				t.Errorf("got %s (%s), want %s (%s)", sku, kind, tt.want, tt.kind)
+			}
+		})
+	}
+}
+
+func Test_assureSoftDelete(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		days          int32
+		mockResponses []*http.Response
+		requests      []string
+		body          string
+		err           string
+	}{
+		{
+			name: "soft delete not requested",
+		},
+		{
+			name: "soft delete already enabled",
+			days: 7,
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7}}}`),
+			},
+			requests: []string{http.MethodGet},
+		},
+		{
+			name: "soft delete disabled",
+			days: 7,
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"properties":{"cors":{"corsRules":[]},"deleteRetentionPolicy":{"enabled":false}}}`),
+				mocks.NewResponseWithContent(`{}`),
+			},
+			requests: []string{http.MethodGet, http.MethodPut},
+			body:     `{"properties":{"cors":{"corsRules":[]},"deleteRetentionPolicy":{"enabled":true,"days":7}}}`,
+		},
+		{
+			name: "another retention",
+			days: 30,
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7}}}`),
+				mocks.NewResponseWithContent(`{}`),
+			},
+			requests: []string{http.MethodGet, http.MethodPut},
+			body:     `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":30}}}`,
+		},
+		{
+			name: "error updating the properties",
+			days: 7,
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"properties":{}}`),
+				mocks.NewResponseWithStatus("bad request", http.StatusBadRequest),
+			},
+			requests: []string{http.MethodGet, http.MethodPut},
+			body:     `{"properties":{"deleteRetentionPolicy":{"enabled":true,"days":7}}}`,
+			err:      "failed to enable the soft delete of blobs on the storage account account",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := mocks.NewSender()
+			for _, response := range tt.mockResponses {
+				sender.AppendResponse(response)
+			}
+
+			var requests []string
+			var body string
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+				AccountName:    "account",
+				SoftDeleteDays: tt.days,
+			}, nil)
+			drv.authorizer = autorest.NullAuthorizer{}
+			drv.sender = autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+				requests = append(requests, r.Method)
+				if r.Body != nil {
+					b, err := ioutil.ReadAll(r.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					body = string(b)
+				}
+				return sender.Do(r)
+			})
+
+			err := drv.assureDataProtection(&Azure{
+				SubscriptionID: "subscription_id",
+				ResourceGroup:  "resource_group",
+			})
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to contain %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("expected requests %v, got %v", tt.requests, requests)
+			}
+			if body != tt.body {
+				t.Errorf("expected the blob service properties %s, got %s", tt.body, body)
+			}
+		})
+	}
+}
+
+func Test_validateSoftDeleteDays(t *testing.T) {
+	for days, valid := range map[int32]bool{
+		-1:  false,
+		0:   true,
+		1:   true,
+		365: true,
+		366: false,
+	} {
+		drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageAzure{
+			SoftDeleteDays: days,
+		}, nil)
+		if err := drv.validateSoftDeleteDays(); (err == nil) != valid {
+			t.Errorf("%d days: expected valid=%t, got %v", days, valid, err)
+		}
+	}
+}
+
 func Test_processUPI(t *testing.T) {
 	for _, tt := range []struct {
 		name            string
@@ -864,7 +1621,7 @@ func Test_containerExists(t *testing.T) {
 				context.Background(),
 				environment,
 				tt.accountName,
-				tt.accountKey,
+				credentials{accountKey: tt.accountKey},
 				tt.containerName,
 			)
 
@@ -925,6 +1682,7 @@ func Test_storageManagementState(t *testing.T) {
 		mockResponses  []*http.Response
 		httpSender     func(int) func(_ context.Context, _ pipeline.Request) (pipeline.Response, error)
 		err            string
+		attempts       int
 		checkFn        func(*imageregistryv1.Config)
 	}{
 		{
@@ -970,6 +1728,30 @@ func Test_storageManagementState(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "soft delete not applied to the account provided by the user",
+			mockResponses: []*http.Response{
+				mocks.NewResponseWithContent(`{"nameAvailable":false}`),
+				mocks.NewResponseWithContent(`{"keys":[{"value":"firstKey"}]}`),
+			},
+			registryConfig: &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Azure: &imageregistryv1.ImageRegistryConfigStorageAzure{
+							AccountName:    "foo_account",
+							Container:      "foo_container",
+							SoftDeleteDays: 7,
+						},
+					},
+				},
+			},
+			attempts: 1,
+			checkFn: func(cr *imageregistryv1.Config) {
+				if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateUnmanaged {
+					t.Errorf("expected to be unmanaged, %q instead", cr.Spec.Storage.ManagementState)
+				}
+			},
+		},
 		{
 			name: "user providing container and account name (both don't exist)",
 			registryConfig: &imageregistryv1.Config{
@@ -1127,7 +1909,44 @@ func Test_storageManagementState(t *testing.T) {
 				t.Errorf("expected error %q, nil received instead", tt.err)
 			}
 
+			if tt.attempts != 0 && sender.Attempts() != tt.attempts {
+				t.Errorf("expected %d requests to the azure api, got %d", tt.attempts, sender.Attempts())
+			}
+
 			tt.checkFn(tt.registryConfig)
 		})
 	}
 }
+
+func TestIsCloudAPIUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{
+			name:        "service unavailable",
+			err:         autorest.DetailedError{StatusCode: http.StatusServiceUnavailable, Message: "Failure responding to request"},
+			unavailable: true,
+		},
+		{
+			name:        "wrapped while provisioning the account",
+			err:         fmt.Errorf("failed to start creating storage account: %w", autorest.DetailedError{StatusCode: http.StatusInternalServerError}),
+			unavailable: true,
+		},
+		{
+			name: "authorization failed",
+			err:  fmt.Errorf("failed to start creating storage account: %w", autorest.DetailedError{StatusCode: http.StatusForbidden}),
+		},
+		{
+			name: "connection failed",
+			err:  fmt.Errorf("failed to start creating storage account: %w", autorest.DetailedError{Original: fmt.Errorf("dial tcp: connection refused")}),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if unavailable := isCloudAPIUnavailable(tt.err); unavailable != tt.unavailable {
+				t.Errorf("expected %t, got %t", tt.unavailable, unavailable)
+			}
+		})
+	}
+}
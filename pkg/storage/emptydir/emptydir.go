@@ -81,6 +81,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			EmptyDir: d.Config.DeepCopy(),
 		}
 		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Creation Successful", "EmptyDir storage successfully created")
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", "EmptyDir storage is encrypted only if the node filesystem is")
 	}
 
 	return nil
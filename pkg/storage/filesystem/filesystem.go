@@ -0,0 +1,139 @@
+package filesystem
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+const (
+	mountPath = "/registry"
+)
+
+// driver stores the registry data on an inline CSI volume, e.g. one backed
+// by a WebDAV gateway, using the registry's filesystem driver.
+type driver struct {
+	Config *imageregistryv1.ImageRegistryConfigStorageFilesystem
+}
+
+func NewDriver(c *imageregistryv1.ImageRegistryConfigStorageFilesystem) *driver {
+	return &driver{
+		Config: c,
+	}
+}
+
+func (d *driver) validate() error {
+	if d.Config.CSI == nil {
+		return fmt.Errorf("a CSI volume source is required")
+	}
+	if len(d.Config.CSI.Driver) == 0 {
+		return fmt.Errorf("the CSI driver name must not be empty")
+	}
+	if d.Config.CSI.ReadOnly != nil && *d.Config.CSI.ReadOnly {
+		return fmt.Errorf("the CSI volume must not be read-only")
+	}
+	if ref := d.Config.CSI.NodePublishSecretRef; ref != nil && len(ref.Name) == 0 {
+		return fmt.Errorf("the CSI node publish secret name must not be empty")
+	}
+	if dir := d.Config.RootDirectory; dir != "" && (path.IsAbs(dir) || path.Clean(dir) != dir || strings.HasPrefix(dir, "..")) {
+		return fmt.Errorf("rootDirectory %q must be a clean path relative to the root of the volume", dir)
+	}
+	return nil
+}
+
+func (d *driver) rootDirectory() string {
+	return path.Join(mountPath, d.Config.RootDirectory)
+}
+
+func (d *driver) ConfigEnv() (envs envvar.List, err error) {
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	envs = append(envs,
+		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "filesystem"},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: d.rootDirectory()},
+	)
+
+	return
+}
+
+func (d *driver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	if err := d.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	vol := corev1.Volume{
+		Name: "registry-storage",
+		VolumeSource: corev1.VolumeSource{
+			CSI: d.Config.CSI.DeepCopy(),
+		},
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      vol.Name,
+		MountPath: mountPath,
+	}
+
+	return []corev1.Volume{vol}, []corev1.VolumeMount{mount}, nil
+}
+
+func (d *driver) VolumeSecrets() (map[string]string, error) {
+	return nil, nil
+}
+
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+	return true, nil
+}
+
+func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
+	if !reflect.DeepEqual(cr.Status.Storage.Filesystem, cr.Spec.Storage.Filesystem) {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Filesystem Configuration Changed", "Filesystem storage is in an unknown state")
+		return true
+	}
+
+	return false
+}
+
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+	if err := d.validate(); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid Filesystem Configuration", err.Error())
+		return err
+	}
+
+	if cr.Spec.Storage.ManagementState == "" {
+		cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+	}
+	if !reflect.DeepEqual(cr.Status.Storage.Filesystem, cr.Spec.Storage.Filesystem) {
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			Filesystem: d.Config.DeepCopy(),
+		}
+	}
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Filesystem Configured", fmt.Sprintf("the registry uses a volume provided by the CSI driver %s", d.Config.CSI.Driver))
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", "Filesystem storage is encrypted only if the CSI driver encrypts it")
+
+	return nil
+}
+
+// RemoveStorage never removes the volume, it is provided by the user.
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+	return false, nil
+}
+
+// ID returns the name of the CSI driver and the root directory.
+func (d *driver) ID() string {
+	if d.Config.CSI == nil {
+		return ""
+	}
+	return d.Config.CSI.Driver + ":" + d.rootDirectory()
+}
@@ -0,0 +1,140 @@
+package filesystem
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+)
+
+func TestFilesystemVolumes(t *testing.T) {
+	drv := NewDriver(&imageregistryv1.ImageRegistryConfigStorageFilesystem{
+		CSI: &corev1.CSIVolumeSource{
+			Driver: "webdav.csi.example.com",
+			VolumeAttributes: map[string]string{
+				"url": "https://webdav.example.com/registry",
+			},
+			NodePublishSecretRef: &corev1.LocalObjectReference{
+				Name: "webdav-credentials",
+			},
+		},
+		RootDirectory: "docker",
+	})
+
+	volumes, mounts, err := drv.Volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || len(mounts) != 1 {
+		t.Fatalf("expected one volume and one mount, got %d and %d", len(volumes), len(mounts))
+	}
+	if !reflect.DeepEqual(volumes[0].CSI, drv.Config.CSI) {
+		t.Errorf("expected the CSI volume source %#v, got %#v", drv.Config.CSI, volumes[0].VolumeSource)
+	}
+	if mounts[0].Name != volumes[0].Name || mounts[0].MountPath != "/registry" {
+		t.Errorf("unexpected mount %#v", mounts[0])
+	}
+
+	envs, err := drv.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEnvs := envvar.List{
+		{Name: "REGISTRY_STORAGE", Value: "filesystem"},
+		{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: "/registry/docker"},
+	}
+	if !reflect.DeepEqual(envs, expectedEnvs) {
+		t.Errorf("unexpected environment: %#v", envs)
+	}
+}
+
+func TestFilesystemCreateStorage(t *testing.T) {
+	readOnly := true
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.ImageRegistryConfigStorageFilesystem
+		err    string
+	}{
+		{
+			name: "valid",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{
+				CSI: &corev1.CSIVolumeSource{Driver: "webdav.csi.example.com"},
+			},
+		},
+		{
+			name:   "missing volume source",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{},
+			err:    "a CSI volume source is required",
+		},
+		{
+			name: "missing driver",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{
+				CSI: &corev1.CSIVolumeSource{},
+			},
+			err: "the CSI driver name must not be empty",
+		},
+		{
+			name: "read-only volume",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{
+				CSI: &corev1.CSIVolumeSource{Driver: "webdav.csi.example.com", ReadOnly: &readOnly},
+			},
+			err: "must not be read-only",
+		},
+		{
+			name: "absolute root directory",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{
+				CSI:           &corev1.CSIVolumeSource{Driver: "webdav.csi.example.com"},
+				RootDirectory: "/docker",
+			},
+			err: "must be a clean path relative to the root of the volume",
+		},
+		{
+			name: "root directory outside of the volume",
+			config: &imageregistryv1.ImageRegistryConfigStorageFilesystem{
+				CSI:           &corev1.CSIVolumeSource{Driver: "webdav.csi.example.com"},
+				RootDirectory: "../docker",
+			},
+			err: "must be a clean path relative to the root of the volume",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						Filesystem: tt.config,
+					},
+				},
+			}
+
+			drv := NewDriver(cr.Spec.Storage.Filesystem)
+			err := drv.CreateStorage(cr)
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to contain %q, got %v", tt.err, err)
+				}
+				if _, _, err := drv.Volumes(); err == nil {
+					t.Errorf("expected the volumes of an invalid configuration to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cr.Status.Storage.Filesystem, tt.config) {
+				t.Errorf("expected status to contain %#v, got %#v", tt.config, cr.Status.Storage.Filesystem)
+			}
+			if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateUnmanaged {
+				t.Errorf("expected storage to be unmanaged, got %q", cr.Spec.Storage.ManagementState)
+			}
+			if drv.StorageChanged(cr) {
+				t.Errorf("expected storage not to be changed after creation")
+			}
+		})
+	}
+}
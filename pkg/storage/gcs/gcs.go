@@ -1,17 +1,33 @@
 package gcs
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	gstorage "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/oauth2"
 	goauth2 "golang.org/x/oauth2/google"
 	gapi "google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	goption "google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -28,10 +44,226 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
+// gcsMultiRegions and gcsDualRegions are the multi-region and predefined
+// dual-region locations of GCS buckets.
+var (
+	gcsMultiRegions = []string{"ASIA", "EU", "US"}
+	gcsDualRegions  = []string{"ASIA1", "EUR4", "EUR5", "EUR7", "EUR8", "NAM4"}
+)
+
+// gcsRegionPattern matches the names of GCP regions, e.g. us-central1 or
+// northamerica-northeast1.
+var gcsRegionPattern = regexp.MustCompile(`^(?i)[a-z]+-[a-z]+[0-9]+$`)
+
+// IsRegion returns true if the location of the bucket is a single region,
+// as opposed to a multi-region or a dual-region.
+func IsRegion(location string) bool {
+	return gcsRegionPattern.MatchString(location)
+}
+
+// validateLocation returns an error when the location is neither a region,
+// a multi-region nor a predefined dual-region.
+func validateLocation(location string) error {
+	if len(location) == 0 || gcsRegionPattern.MatchString(location) {
+		return nil
+	}
+	for _, l := range append(gcsMultiRegions, gcsDualRegions...) {
+		if strings.EqualFold(l, location) {
+			return nil
+		}
+	}
+	return fmt.Errorf("region %q is not a GCS region, multi-region (%s) or dual-region (%s)", location, strings.Join(gcsMultiRegions, ", "), strings.Join(gcsDualRegions, ", "))
+}
+
+// maxUserAgentLength is the longest user agent accepted for the requests to
+// GCS.
+const maxUserAgentLength = 256
+
+// validateUserAgent returns an error when the user agent can't be sent as
+// the value of the User-Agent header.
+func validateUserAgent(userAgent string) error {
+	if len(userAgent) > maxUserAgentLength || !httpguts.ValidHeaderFieldValue(userAgent) {
+		return fmt.Errorf("userAgent: must be a valid HTTP header value of at most %d characters, got %q", maxUserAgentLength, userAgent)
+	}
+	return nil
+}
+
+// validateRequestTimeout returns an error when the timeout of the requests
+// is negative. Zero means the requests don't time out.
+func validateRequestTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("requestTimeout: must be positive, got %s", timeout)
+	}
+	return nil
+}
+
+// gcsJSONAPIPath is the path of the GCS JSON API on its endpoints.
+const gcsJSONAPIPath = "/storage/v1/"
+
+// validateEndpoint returns an error when the endpoint is not an https URL
+// without a path, a query or a fragment.
+func validateEndpoint(endpoint string) error {
+	if len(endpoint) == 0 {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint %q is not a valid URL: %v", endpoint, err)
+	}
+	if u.Scheme != "https" || len(u.Host) == 0 {
+		return fmt.Errorf("endpoint %q must be an https URL", endpoint)
+	}
+	if strings.Trim(u.Path, "/") != "" || len(u.RawQuery) != 0 || len(u.Fragment) != 0 {
+		return fmt.Errorf("endpoint %q must not have a path, a query or a fragment", endpoint)
+	}
+	return nil
+}
+
+// gcsInteroperabilityEndpoint is the endpoint of the XML API of GCS, the S3
+// compatible API that accepts HMAC keys.
+const gcsInteroperabilityEndpoint = "https://storage.googleapis.com"
+
+// gcsHMACAutoRegion lets GCS pick the location of the bucket when the
+// requests are signed with HMAC keys.
+const gcsHMACAutoRegion = "auto"
+
+// gcsHMACAccessIDPattern and gcsHMACSecretPattern match the access IDs and
+// the secrets of GCS HMAC keys, the access IDs of service accounts are
+// longer than the ones of user accounts.
+var (
+	gcsHMACAccessIDPattern = regexp.MustCompile(`^GOOG[A-Z0-9]{20,57}$`)
+	gcsHMACSecretPattern   = regexp.MustCompile(`^[A-Za-z0-9+/]{40}$`)
+)
+
+// validateHMACKey returns an error when the access ID or the secret are not
+// the ones of a GCS HMAC key.
+func validateHMACKey(accessID, secret string) error {
+	if !gcsHMACAccessIDPattern.MatchString(accessID) {
+		return fmt.Errorf("REGISTRY_STORAGE_GCS_HMAC_ACCESSID: must be the access ID of a GCS HMAC key")
+	}
+	if !gcsHMACSecretPattern.MatchString(secret) {
+		return fmt.Errorf("REGISTRY_STORAGE_GCS_HMAC_SECRET: must be the 40 characters base64 secret of a GCS HMAC key")
+	}
+	return nil
+}
+
+// iamCredentialsEndpoint is the endpoint of the IAM Service Account
+// Credentials API, it issues the access tokens of impersonated service
+// accounts.
+const iamCredentialsEndpoint = "https://iamcredentials.googleapis.com"
+
+// impersonatedTokenLifetime is the lifetime of the access tokens requested
+// for the impersonated service account, the longest one allowed by default.
+const impersonatedTokenLifetime = time.Hour
+
+// gcsServiceAccountPattern matches the emails of user-managed and default
+// compute service accounts.
+var gcsServiceAccountPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{4,28}[a-z0-9]@([a-z][a-z0-9-]{4,28}[a-z0-9]\.iam|developer)\.gserviceaccount\.com$`)
+
+// validateServiceAccount returns an error when the service account set in
+// field is not the email of a GCP service account.
+func validateServiceAccount(field, serviceAccount string) error {
+	if len(serviceAccount) == 0 || gcsServiceAccountPattern.MatchString(serviceAccount) {
+		return nil
+	}
+	return fmt.Errorf("%s %q is not the email of a GCP service account", field, serviceAccount)
+}
+
+// impersonationURL returns the URL of the IAM Service Account Credentials
+// API generating the access tokens of the service account.
+func impersonationURL(serviceAccount string) string {
+	return fmt.Sprintf("%s/v1/projects/-/serviceAccounts/%s:generateAccessToken", iamCredentialsEndpoint, serviceAccount)
+}
+
+// impersonatedTokenSource requests access tokens of serviceAccount with the
+// tokens of base.
+type impersonatedTokenSource struct {
+	ctx            context.Context
+	base           oauth2.TokenSource
+	serviceAccount string
+	scopes         []string
+}
+
+func (ts *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    ts.scopes,
+		"lifetime": fmt.Sprintf("%.0fs", impersonatedTokenLifetime.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, impersonationURL(ts.serviceAccount), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := oauth2.NewClient(ts.ctx, ts.base).Do(req.WithContext(ts.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got HTTP response code %d with body %s", resp.StatusCode, respBody)
+	}
+
+	var token struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return nil, fmt.Errorf("unable to parse the access token: %v", err)
+	}
+	if len(token.AccessToken) == 0 {
+		return nil, fmt.Errorf("the response doesn't contain an access token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      token.ExpireTime,
+	}, nil
+}
+
+// impersonationError is returned when the operator can't impersonate
+// impersonateServiceAccount.
+type impersonationError struct {
+	serviceAccount string
+	err            error
+}
+
+func (e *impersonationError) Error() string {
+	return fmt.Sprintf("unable to impersonate the service account %s: %v", e.serviceAccount, e.err)
+}
+
+func (e *impersonationError) Unwrap() error {
+	return e.err
+}
+
 type GCS struct {
 	KeyfileData string
 	Region      string
 	ProjectID   string
+
+	// HMACAccessID and HMACSecret are the HMAC key used instead of the
+	// service account keyfile, only the XML API of GCS accepts them.
+	HMACAccessID string
+	HMACSecret   string
+
+	// WorkloadIdentity is true when the bucket is accessed with the
+	// credentials of the Kubernetes service accounts, there is no keyfile.
+	WorkloadIdentity bool
+}
+
+// UsesHMAC returns true when the bucket is accessed with an HMAC key.
+func (c *GCS) UsesHMAC() bool {
+	return len(c.HMACAccessID) != 0
 }
 
 type driver struct {
@@ -42,6 +274,11 @@ type driver struct {
 
 	// httpClient is used only during tests.
 	httpClient *http.Client
+
+	// impersonation is the source of the access tokens of
+	// impersonateServiceAccount, it is set once the operator impersonated
+	// it.
+	impersonation oauth2.TokenSource
 }
 
 func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorageGCS, kubeconfig *rest.Config, listers *regopclient.Listers) *driver {
@@ -56,24 +293,78 @@ func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorag
 // getGCSClient returns a client that allows us to interact
 // with the GCS services
 func (d *driver) getGCSClient() (*gstorage.Client, error) {
-	cfg, err := GetConfig(d.Listers)
+	cfg, err := d.getConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.UsesHMAC() {
+		return nil, fmt.Errorf("the GCS JSON API can't be used with HMAC keys")
+	}
+
 	if len(d.Config.Region) == 0 {
 		d.Config.Region = cfg.Region
 		d.Config.ProjectID = cfg.ProjectID
 	}
 
-	credentials, err := goauth2.CredentialsFromJSON(d.Context, []byte(cfg.KeyfileData), gstorage.ScopeFullControl)
+	ctx := d.Context
+	if d.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, d.httpClient)
+	}
+
+	var creds *goauth2.Credentials
+	if cfg.WorkloadIdentity {
+		creds, err = goauth2.FindDefaultCredentials(ctx, gstorage.ScopeFullControl)
+	} else {
+		creds, err = goauth2.CredentialsFromJSON(ctx, []byte(cfg.KeyfileData), gstorage.ScopeFullControl)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	opts := []goption.ClientOption{goption.WithCredentials(credentials)}
-	if d.httpClient != nil {
-		opts = append(opts, goption.WithHTTPClient(d.httpClient))
+	opts := []goption.ClientOption{goption.WithCredentials(creds)}
+	if serviceAccount := d.Config.ImpersonateServiceAccount; len(serviceAccount) != 0 {
+		if err := validateServiceAccount("impersonateServiceAccount", serviceAccount); err != nil {
+			return nil, err
+		}
+		if d.impersonation == nil {
+			ts := oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+				ctx:            ctx,
+				base:           creds.TokenSource,
+				serviceAccount: serviceAccount,
+				scopes:         []string{gstorage.ScopeFullControl},
+			})
+			// The service account is impersonated before the first
+			// request to the bucket so that IAM errors aren't mistaken
+			// for GCS ones.
+			if _, err := ts.Token(); err != nil {
+				return nil, &impersonationError{serviceAccount: serviceAccount, err: err}
+			}
+			d.impersonation = ts
+		}
+		opts = []goption.ClientOption{goption.WithTokenSource(d.impersonation)}
+	}
+	if len(d.Config.Endpoint) != 0 {
+		if err := validateEndpoint(d.Config.Endpoint); err != nil {
+			return nil, err
+		}
+		opts = append(opts, goption.WithEndpoint(strings.TrimSuffix(d.Config.Endpoint, "/")+gcsJSONAPIPath))
+	}
+	if err := validateUserAgent(d.Config.UserAgent); err != nil {
+		return nil, err
+	}
+	if len(d.Config.UserAgent) != 0 {
+		opts = append(opts, goption.WithUserAgent(d.Config.UserAgent))
+	}
+	if err := validateRequestTimeout(d.Config.RequestTimeout.Duration); err != nil {
+		return nil, err
+	}
+	httpClient, err := d.managementHTTPClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		opts = append(opts, goption.WithHTTPClient(httpClient))
 	}
 
 	gcsClient, err := gstorage.NewClient(d.Context, opts...)
@@ -84,8 +375,34 @@ func (d *driver) getGCSClient() (*gstorage.Client, error) {
 	return gcsClient, nil
 }
 
-// GetConfig reads configuration for the GCS cloud platform services.
-func GetConfig(listers *regopclient.Listers) (*GCS, error) {
+// managementHTTPClient returns the HTTP client of the operator's GCS client
+// when it can't be left to the storage library, i.e. when its requests time
+// out after requestTimeout or during tests.
+func (d *driver) managementHTTPClient(ctx context.Context, opts []goption.ClientOption) (*http.Client, error) {
+	timeout := d.Config.RequestTimeout.Duration
+	if d.httpClient != nil {
+		// The requests of the tests aren't authenticated, only their user
+		// agent is set.
+		transport, err := htransport.NewTransport(ctx, d.httpClient.Transport, goption.WithoutAuthentication(), goption.WithUserAgent(d.Config.UserAgent))
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: transport, Timeout: timeout}, nil
+	}
+	if timeout == 0 {
+		return nil, nil
+	}
+
+	httpClient, _, err := htransport.NewClient(ctx, append([]goption.ClientOption{goption.WithScopes(gstorage.ScopeFullControl)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = timeout
+	return httpClient, nil
+}
+
+// platformConfig reads the region and the project of the cluster.
+func platformConfig(listers *regopclient.Listers) (*GCS, error) {
 	gcsConfig := &GCS{}
 
 	infra, err := util.GetInfrastructure(listers)
@@ -98,6 +415,16 @@ func GetConfig(listers *regopclient.Listers) (*GCS, error) {
 		gcsConfig.ProjectID = infra.Status.PlatformStatus.GCP.ProjectID
 	}
 
+	return gcsConfig, nil
+}
+
+// GetConfig reads configuration for the GCS cloud platform services.
+func GetConfig(listers *regopclient.Listers) (*GCS, error) {
+	gcsConfig, err := platformConfig(listers)
+	if err != nil {
+		return nil, err
+	}
+
 	// Look for a user defined secret to get the AWS credentials from first
 	sec, err := listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
 	if err != nil && errors.IsNotFound(err) {
@@ -114,7 +441,13 @@ func GetConfig(listers *regopclient.Listers) (*GCS, error) {
 	} else if err != nil {
 		return nil, err
 	} else {
-		if v, ok := sec.Data["REGISTRY_STORAGE_GCS_KEYFILE"]; ok {
+		if v, ok := sec.Data["REGISTRY_STORAGE_GCS_HMAC_ACCESSID"]; ok {
+			gcsConfig.HMACAccessID = string(v)
+			gcsConfig.HMACSecret = string(sec.Data["REGISTRY_STORAGE_GCS_HMAC_SECRET"])
+			if err := validateHMACKey(gcsConfig.HMACAccessID, gcsConfig.HMACSecret); err != nil {
+				return nil, fmt.Errorf("secret %q: %s", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser), err)
+			}
+		} else if v, ok := sec.Data["REGISTRY_STORAGE_GCS_KEYFILE"]; ok {
 			gcsConfig.KeyfileData = string(v)
 		} else {
 			return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_GCS_KEYFILE\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
@@ -124,16 +457,119 @@ func GetConfig(listers *regopclient.Listers) (*GCS, error) {
 	return gcsConfig, nil
 }
 
+// getConfig reads the configuration of the driver. With Workload Identity the
+// credentials secrets are neither required nor read.
+func (d *driver) getConfig() (*GCS, error) {
+	if d.Config == nil || len(d.Config.WorkloadIdentityServiceAccount) == 0 {
+		return GetConfig(d.Listers)
+	}
+	if err := validateServiceAccount("workloadIdentityServiceAccount", d.Config.WorkloadIdentityServiceAccount); err != nil {
+		return nil, err
+	}
+	gcsConfig, err := platformConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+	gcsConfig.WorkloadIdentity = true
+	return gcsConfig, nil
+}
+
+// interoperabilityEndpoint returns the endpoint of the XML API, the private
+// endpoints serve both APIs.
+func (d *driver) interoperabilityEndpoint() string {
+	if len(d.Config.Endpoint) != 0 {
+		return strings.TrimSuffix(d.Config.Endpoint, "/")
+	}
+	return gcsInteroperabilityEndpoint
+}
+
+// hmacRegion returns the region the requests signed with HMAC keys are
+// scoped to.
+func (d *driver) hmacRegion() string {
+	if len(d.Config.Region) != 0 {
+		return d.Config.Region
+	}
+	return gcsHMACAutoRegion
+}
+
+// hmacConfigEnv configures the S3 driver of the registry against the XML
+// API of GCS, the gcs driver only supports service account keyfiles.
+func (d *driver) hmacConfigEnv(cfg *GCS) (envs envvar.List, err error) {
+	if len(d.Config.ImpersonateServiceAccount) != 0 {
+		return nil, fmt.Errorf("impersonateServiceAccount: is not supported with HMAC keys")
+	}
+	if len(d.Config.UserAgent) != 0 {
+		return nil, fmt.Errorf("userAgent: is not supported with HMAC keys")
+	}
+	if d.Config.RequestTimeout.Duration != 0 {
+		return nil, fmt.Errorf("requestTimeout: is not supported with HMAC keys")
+	}
+	if err := validateEndpoint(d.Config.Endpoint); err != nil {
+		return nil, err
+	}
+
+	envs = append(envs,
+		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "s3"},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: d.Config.Bucket},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGION", Value: d.hmacRegion()},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGIONENDPOINT", Value: d.interoperabilityEndpoint()},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", Value: cfg.HMACAccessID, Secret: true},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_SECRETKEY", Value: cfg.HMACSecret, Secret: true},
+	)
+	return
+}
+
 func (d *driver) ConfigEnv() (envs envvar.List, err error) {
+	cfg, err := d.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UsesHMAC() {
+		return d.hmacConfigEnv(cfg)
+	}
+
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "gcs"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_GCS_BUCKET", Value: d.Config.Bucket},
-		envvar.EnvVar{Name: "REGISTRY_STORAGE_GCS_KEYFILE", Value: "/gcs/keyfile"},
 	)
+	if cfg.WorkloadIdentity {
+		// Without a keyfile the operator uses the credentials of its
+		// service account, it has no private key to impersonate another
+		// service account with.
+		if len(d.Config.ImpersonateServiceAccount) != 0 {
+			return nil, fmt.Errorf("impersonateServiceAccount: is not supported with Workload Identity")
+		}
+	} else {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_GCS_KEYFILE", Value: "/gcs/keyfile"})
+	}
+
+	if err := validateServiceAccount("impersonateServiceAccount", d.Config.ImpersonateServiceAccount); err != nil {
+		return nil, err
+	}
+
+	if err := validateUserAgent(d.Config.UserAgent); err != nil {
+		return nil, err
+	}
+	if err := validateRequestTimeout(d.Config.RequestTimeout.Duration); err != nil {
+		return nil, err
+	}
+	// The user agent, the timeout and the endpoint only apply to the
+	// requests of the operator, the GCS driver of the registry can't be
+	// configured with them.
 	return
 }
 
 func (d *driver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	cfg, err := d.getConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.UsesHMAC() || cfg.WorkloadIdentity {
+		// The HMAC key is passed through the environment, there is no
+		// keyfile with Workload Identity.
+		return nil, nil, nil
+	}
+
 	optional := false
 
 	vol := corev1.Volume{
@@ -161,28 +597,111 @@ func (d *driver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
 }
 
 func (d *driver) VolumeSecrets() (map[string]string, error) {
-	cfg, err := GetConfig(d.Listers)
+	cfg, err := d.getConfig()
 	if err != nil {
 		return nil, err
 	}
+	if cfg.UsesHMAC() || cfg.WorkloadIdentity {
+		return nil, nil
+	}
 
+	// The GCS driver of the registry only accepts the keys of service
+	// accounts, it can't impersonate impersonateServiceAccount.
 	return map[string]string{
 		"REGISTRY_STORAGE_GCS_KEYFILE": cfg.KeyfileData,
 	}, nil
 }
 
-func (d *driver) bucketExists(bucketName string) error {
+func (d *driver) bucketAttrs(bucketName string) (*gstorage.BucketAttrs, error) {
 	client, err := d.getGCSClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Bucket(bucketName).Attrs(d.Context)
+}
+
+// hmacBucketExists checks through the XML API of GCS whether the bucket
+// exists and is accessible with the HMAC key.
+func (d *driver) hmacBucketExists(cfg *GCS, bucketName string) error {
+	awsConfig := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(cfg.HMACAccessID, cfg.HMACSecret, "")).
+		WithEndpoint(d.interoperabilityEndpoint()).
+		WithRegion(d.hmacRegion()).
+		WithS3ForcePathStyle(true)
+	if d.httpClient != nil {
+		awsConfig.WithHTTPClient(d.httpClient)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigDisable,
+	})
 	if err != nil {
 		return err
 	}
 
-	_, err = client.Bucket(d.Config.Bucket).Attrs(d.Context)
+	_, err = s3.New(sess).HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return gstorage.ErrBucketNotExist
+	}
+	return err
+}
+
+// isCloudAPIUnavailable returns true when GCS responded with a server error,
+// through either API.
+func isCloudAPIUnavailable(err error) bool {
+	var reqErr awserr.RequestFailure
+	if goerrors.As(err, &reqErr) {
+		return reqErr.StatusCode() >= http.StatusInternalServerError
+	}
+	var gerr *gapi.Error
+	return goerrors.As(err, &gerr) && gerr.Code >= http.StatusInternalServerError
+}
+
+func (d *driver) bucketExists(bucketName string) error {
+	cfg, err := d.getConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.UsesHMAC() {
+		return d.hmacBucketExists(cfg, bucketName)
+	}
 
+	_, err = d.bucketAttrs(bucketName)
 	return err
 }
 
+// StorageExists checks whether the storage exists and is accessible, and
+// reports through the CloudAPIUnavailable condition whether GCS
+// answered.
 func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+	exists, err := d.storageExists(cr)
+	d.checkImpersonation(cr, err)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return exists, err
+}
+
+// checkImpersonation sets the StorageServiceAccountImpersonated condition
+// when the bucket is accessed through impersonateServiceAccount, err is the
+// error of the last access.
+func (d *driver) checkImpersonation(cr *imageregistryv1.Config, err error) {
+	if d.Config == nil || len(d.Config.ImpersonateServiceAccount) == 0 {
+		return
+	}
+	var impersonationErr *impersonationError
+	if goerrors.As(err, &impersonationErr) {
+		util.UpdateCondition(cr, defaults.StorageServiceAccountImpersonated, operatorapi.ConditionFalse, "Impersonation Failed", impersonationErr.Error())
+		return
+	}
+	if d.impersonation != nil {
+		util.UpdateCondition(cr, defaults.StorageServiceAccountImpersonated, operatorapi.ConditionTrue, "Service Account Impersonated", fmt.Sprintf("The service account %s is impersonated to access the bucket", d.Config.ImpersonateServiceAccount))
+	}
+}
+
+func (d *driver) storageExists(cr *imageregistryv1.Config) (bool, error) {
 	if len(d.Config.Bucket) == 0 {
 		return false, nil
 	}
@@ -210,7 +729,63 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
+// CreateStorage provisions the storage, and reports through the
+// CloudAPIUnavailable condition whether GCS answered.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+	err := d.createStorage(cr)
+	d.checkImpersonation(cr, err)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return err
+}
+
+func (d *driver) createStorage(cr *imageregistryv1.Config) error {
+	// The region is filled from the cluster infrastructure when it isn't
+	// set, only the one requested by the user is checked against the
+	// location of existing buckets.
+	requestedRegion := d.Config.Region
+
+	if err := validateLocation(requestedRegion); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Region", err.Error())
+		return err
+	}
+
+	if err := validateEndpoint(d.Config.Endpoint); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Endpoint", err.Error())
+		return err
+	}
+
+	if err := validateUserAgent(d.Config.UserAgent); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Configuration", err.Error())
+		return err
+	}
+	if err := validateRequestTimeout(d.Config.RequestTimeout.Duration); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Configuration", err.Error())
+		return err
+	}
+
+	cfg, err := d.getConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.UsesHMAC() {
+		if len(d.Config.ImpersonateServiceAccount) != 0 {
+			err := fmt.Errorf("impersonateServiceAccount cannot be used with an HMAC key")
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Configuration", err.Error())
+			return err
+		}
+		return d.createHMACStorage(cr, cfg)
+	}
+
+	if err := validateServiceAccount("impersonateServiceAccount", d.Config.ImpersonateServiceAccount); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Configuration", err.Error())
+		return err
+	}
+	if cfg.WorkloadIdentity && len(d.Config.ImpersonateServiceAccount) != 0 {
+		err := fmt.Errorf("impersonateServiceAccount cannot be used with Workload Identity")
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid GCS Configuration", err.Error())
+		return err
+	}
+
 	gclient, err := d.getGCSClient()
 	if err != nil {
 		return err
@@ -222,7 +797,14 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	var bucketExists bool
 	var bucketCreated bool
 	if len(d.Config.Bucket) != 0 {
-		if err := d.bucketExists(d.Config.Bucket); err == nil {
+		if attrs, err := d.bucketAttrs(d.Config.Bucket); err == nil {
+			// The location of a bucket can't be changed once it is
+			// created.
+			if len(requestedRegion) != 0 && len(attrs.Location) != 0 && !strings.EqualFold(attrs.Location, requestedRegion) {
+				err := fmt.Errorf("the bucket %s is located in %s, its region can't be changed to %s after it is created", d.Config.Bucket, attrs.Location, requestedRegion)
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "GCS Region Immutable", err.Error())
+				return err
+			}
 			bucketExists = true
 		} else if err != gstorage.ErrBucketNotExist {
 			util.UpdateCondition(
@@ -258,11 +840,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		if err != nil {
 			if gerr, ok := err.(*gapi.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, strconv.Itoa(gerr.Code), gerr.Error())
-				return err
 			} else {
 				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
-				return err
 			}
+			return util.NewProvisioningError("BucketCreationFailed", err)
 		}
 		if cr.Spec.Storage.ManagementState == "" {
 			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
@@ -302,8 +883,11 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				}
 				cr.Spec.Storage.GCS = d.Config.DeepCopy()
 			}
+		} else {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Google-Managed Encryption", "Data on the GCS bucket is encrypted at rest with Google-managed keys")
 		}
 	} else {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encrypted At Rest", "Data on GCS buckets is always encrypted at rest")
 		if !reflect.DeepEqual(cr.Status.Storage.GCS, d.Config) {
 			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 				GCS: d.Config.DeepCopy(),
@@ -314,10 +898,48 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 	return nil
 }
 
+// createHMACStorage checks the bucket accessed with an HMAC key. The key only
+// gives access to the XML API, the bucket isn't created by the operator.
+func (d *driver) createHMACStorage(cr *imageregistryv1.Config, cfg *GCS) error {
+	if len(d.Config.Bucket) == 0 {
+		err := fmt.Errorf("the bucket must be set when an HMAC key is used, it can't be created by the operator")
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Bucket Not Configured", err.Error())
+		return err
+	}
+
+	err := d.hmacBucketExists(cfg, d.Config.Bucket)
+	if err == gstorage.ErrBucketNotExist {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Bucket does not exist", err.Error())
+		return err
+	} else if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return err
+	}
+
+	if cr.Spec.Storage.ManagementState == "" {
+		cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+	}
+	if !reflect.DeepEqual(cr.Status.Storage.GCS, d.Config) {
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			GCS: d.Config.DeepCopy(),
+		}
+	}
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "GCS Bucket Exists", "User supplied GCS bucket exists and is accessible with the HMAC key")
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encrypted At Rest", "Data on GCS buckets is always encrypted at rest")
+
+	return nil
+}
+
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
 		return false, nil
 	}
+	if cfg, err := d.getConfig(); err != nil {
+		return false, err
+	} else if cfg.UsesHMAC() {
+		klog.Warningf("the GCS bucket %s is kept, it can't be removed with an HMAC key", d.Config.Bucket)
+		return false, nil
+	}
 	gclient, err := d.getGCSClient()
 	if err != nil {
 		return false, err
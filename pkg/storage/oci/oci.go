@@ -0,0 +1,401 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// ociCompatibilityEndpoint is the endpoint of the Amazon S3 Compatibility
+// API of OCI Object Storage, it is specific to the namespace of the tenancy
+// and to the region.
+const ociCompatibilityEndpoint = "https://%s.compat.objectstorage.%s.oraclecloud.com"
+
+// ociNamespacePattern matches the Object Storage namespaces, and
+// ociRegionPattern the identifiers of OCI regions, e.g. us-ashburn-1 or
+// eu-frankfurt-1.
+var (
+	ociNamespacePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+	ociRegionPattern    = regexp.MustCompile(`^[a-z]+(-[a-z]+)+-[0-9]+$`)
+)
+
+// OCI holds the customer secret key used to access the Amazon S3
+// Compatibility API.
+type OCI struct {
+	AccessKey string
+	SecretKey string
+}
+
+type driver struct {
+	Context context.Context
+	Config  *imageregistryv1.ImageRegistryConfigStorageOCI
+	Listers *regopclient.Listers
+
+	// httpClient is used only during tests.
+	httpClient *http.Client
+}
+
+func NewDriver(ctx context.Context, c *imageregistryv1.ImageRegistryConfigStorageOCI, listers *regopclient.Listers) *driver {
+	return &driver{
+		Context: ctx,
+		Config:  c,
+		Listers: listers,
+	}
+}
+
+// GetConfig reads configuration for the OCI cloud platform services.
+func GetConfig(listers *regopclient.Listers) (*OCI, error) {
+	cfg := &OCI{}
+
+	// OCI credentials aren't provisioned by the cloud-credential-operator,
+	// the customer secret key has to be provided by the user.
+	sec, err := listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if err != nil && errors.IsNotFound(err) {
+		return nil, fmt.Errorf("the OCI customer secret key has to be provided in the secret %q", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
+	} else if err != nil {
+		return nil, err
+	}
+
+	for key, value := range map[string]*string{
+		"REGISTRY_STORAGE_OCI_ACCESSKEY": &cfg.AccessKey,
+		"REGISTRY_STORAGE_OCI_SECRETKEY": &cfg.SecretKey,
+	} {
+		v, ok := sec.Data[key]
+		if !ok || len(v) == 0 {
+			return nil, fmt.Errorf("secret %q does not contain required key %q", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser), key)
+		}
+		*value = string(v)
+	}
+
+	return cfg, nil
+}
+
+// validate returns an error when the namespace or the region can't be used
+// to build the endpoint of the Amazon S3 Compatibility API.
+func (d *driver) validate() error {
+	if len(d.Config.Namespace) == 0 {
+		return fmt.Errorf("the Object Storage namespace of the tenancy must be set")
+	}
+	if !ociNamespacePattern.MatchString(d.Config.Namespace) {
+		return fmt.Errorf("namespace %q is not an Object Storage namespace", d.Config.Namespace)
+	}
+	if len(d.Config.Region) == 0 {
+		return fmt.Errorf("the OCI region must be set")
+	}
+	if !ociRegionPattern.MatchString(d.Config.Region) {
+		return fmt.Errorf("region %q is not an OCI region", d.Config.Region)
+	}
+	return nil
+}
+
+// endpoint returns the endpoint of the Amazon S3 Compatibility API for the
+// configured namespace and region.
+func (d *driver) endpoint() string {
+	return fmt.Sprintf(ociCompatibilityEndpoint, d.Config.Namespace, d.Config.Region)
+}
+
+// getS3Service returns a client for the Amazon S3 Compatibility API of
+// OCI Object Storage, it only supports path-style requests.
+func (d *driver) getS3Service(cfg *OCI) (*s3.S3, error) {
+	awsConfig := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")).
+		WithEndpoint(d.endpoint()).
+		WithRegion(d.Config.Region).
+		WithS3ForcePathStyle(true)
+	if d.httpClient != nil {
+		awsConfig.WithHTTPClient(d.httpClient)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigDisable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// isCloudAPIUnavailable returns true when OCI Object Storage responded with
+// a server error.
+func isCloudAPIUnavailable(err error) bool {
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.StatusCode() >= http.StatusInternalServerError
+}
+
+// isNotFound returns true when the bucket doesn't exist.
+func isNotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == s3.ErrCodeNoSuchBucket
+}
+
+// ConfigEnv configures the S3 driver of the registry against the Amazon S3
+// Compatibility API of OCI Object Storage.
+func (d *driver) ConfigEnv() (envs envvar.List, err error) {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	envs = append(envs,
+		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "s3"},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: d.Config.Bucket},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGION", Value: d.Config.Region},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGIONENDPOINT", Value: d.endpoint()},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE", Value: false},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_ACCESSKEY", Value: cfg.AccessKey, Secret: true},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_SECRETKEY", Value: cfg.SecretKey, Secret: true},
+	)
+	return
+}
+
+func (d *driver) Volumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	// The customer secret key is passed through the environment.
+	return nil, nil, nil
+}
+
+func (d *driver) VolumeSecrets() (map[string]string, error) {
+	return nil, nil
+}
+
+// StorageExists checks whether the storage exists and is accessible, and
+// reports through the CloudAPIUnavailable condition whether OCI answered.
+func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+	exists, err := d.storageExists(cr)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return exists, err
+}
+
+func (d *driver) storageExists(cr *imageregistryv1.Config) (bool, error) {
+	if len(d.Config.Bucket) == 0 {
+		return false, nil
+	}
+
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return false, err
+	}
+	if err := d.validate(); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid OCI Configuration", err.Error())
+		return false, err
+	}
+
+	svc, err := d.getS3Service(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = svc.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil && isNotFound(err) {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Bucket does not exist", err.Error())
+		return false, nil
+	} else if err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return false, err
+	}
+
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "OCI Bucket Exists", "")
+	return true, nil
+}
+
+func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
+	if !reflect.DeepEqual(cr.Status.Storage.OCI, cr.Spec.Storage.OCI) {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "OCI Configuration Changed", "OCI storage is in an unknown state")
+		return true
+	}
+
+	return false
+}
+
+// CreateStorage provisions the storage, and reports through the
+// CloudAPIUnavailable condition whether OCI answered.
+func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+	err := d.createStorage(cr)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return err
+}
+
+func (d *driver) createStorage(cr *imageregistryv1.Config) error {
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return err
+	}
+
+	if len(d.Config.Namespace) == 0 {
+		err := fmt.Errorf("the Object Storage namespace of the tenancy must be set, it can't be discovered through the Amazon S3 Compatibility API")
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Namespace Not Configured", err.Error())
+		return err
+	}
+	if err := d.validate(); err != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Invalid OCI Configuration", err.Error())
+		return err
+	}
+
+	svc, err := d.getS3Service(cfg)
+	if err != nil {
+		return err
+	}
+
+	// If a bucket name is supplied, and it already exists and we can access it
+	// just update the config
+	bucketExists := false
+	if len(d.Config.Bucket) != 0 {
+		_, err := svc.HeadBucketWithContext(d.Context, &s3.HeadBucketInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if err == nil {
+			bucketExists = true
+		} else if !isNotFound(err) {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+			return err
+		}
+	}
+
+	if bucketExists {
+		if cr.Spec.Storage.ManagementState == "" {
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateUnmanaged
+		}
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "OCI Bucket Exists", "User supplied OCI bucket exists and is accessible")
+	} else {
+		// If the bucket name is blank, let's generate one
+		if len(d.Config.Bucket) == 0 {
+			if d.Config.Bucket, err = util.GenerateStorageName(d.Listers, d.Config.Region); err != nil {
+				return err
+			}
+		}
+
+		_, err := svc.CreateBucketWithContext(d.Context, &s3.CreateBucketInput{
+			Bucket: aws.String(d.Config.Bucket),
+			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
+				LocationConstraint: aws.String(d.Config.Region),
+			},
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+			} else {
+				util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+			}
+			return err
+		}
+
+		if cr.Spec.Storage.ManagementState == "" {
+			cr.Spec.Storage.ManagementState = imageregistryv1.StorageManagementStateManaged
+		}
+		cr.Spec.Storage.OCI = d.Config.DeepCopy()
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Creation Successful", "OCI bucket was successfully created")
+	}
+
+	if !reflect.DeepEqual(cr.Status.Storage.OCI, d.Config) {
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			OCI: d.Config.DeepCopy(),
+		}
+	}
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encrypted At Rest", "Data on OCI Object Storage buckets is always encrypted at rest")
+
+	return nil
+}
+
+func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		return false, nil
+	}
+	if len(d.Config.Bucket) == 0 {
+		return false, nil
+	}
+
+	cfg, err := GetConfig(d.Listers)
+	if err != nil {
+		return false, err
+	}
+	if err := d.validate(); err != nil {
+		return false, err
+	}
+
+	svc, err := d.getS3Service(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	klog.V(5).Infof("deleting all objects in bucket %s", d.Config.Bucket)
+	var deleteErr error
+	err = svc.ListObjectsV2PagesWithContext(d.Context, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.Config.Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			klog.V(5).Infof("deleting object %s", aws.StringValue(obj.Key))
+			if _, deleteErr = svc.DeleteObjectWithContext(d.Context, &s3.DeleteObjectInput{
+				Bucket: aws.String(d.Config.Bucket),
+				Key:    obj.Key,
+			}); deleteErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	if err == nil {
+		_, err = svc.DeleteBucketWithContext(d.Context, &s3.DeleteBucketInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if err != nil && !isNotFound(err) {
+			util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "", err.Error())
+			return false, err
+		}
+	}
+
+	if cr.Spec.Storage.OCI != nil {
+		cr.Spec.Storage.OCI.Bucket = ""
+	}
+
+	d.Config.Bucket = ""
+
+	if !reflect.DeepEqual(cr.Status.Storage.OCI, d.Config) {
+		cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
+			OCI: d.Config.DeepCopy(),
+		}
+	}
+
+	util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, "OCI Bucket Deleted", "The OCI bucket has been removed.")
+
+	return true, nil
+}
+
+// ID return the underlying storage identificator, on this case the bucket name.
+func (d *driver) ID() string {
+	return d.Config.Bucket
+}
@@ -0,0 +1,495 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+const (
+	testAccessKey = "0123456789abcdef0123456789abcdef01234567"
+	testSecretKey = "c2VjcmV0IGtleSBvZiB0aGUgaW1hZ2UgcmVnaXN0cnk="
+)
+
+// tripper is injected on the S3 client to simulate api responses.
+type tripper struct {
+	req            int
+	requests       []string
+	responseCodes  []int
+	responseBodies []string
+}
+
+func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer func() {
+		r.req++
+	}()
+	r.requests = append(r.requests, req.Method+" "+req.URL.String())
+	return &http.Response{
+		StatusCode: r.responseCodes[r.req],
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(r.responseBodies[r.req])),
+	}, nil
+}
+
+func (r *tripper) AddResponse(code int, body string) {
+	r.responseCodes = append(r.responseCodes, code)
+	r.responseBodies = append(r.responseBodies, body)
+}
+
+func testListers(t *testing.T, secretData map[string][]byte) *regopclient.Listers {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "oci-cluster",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.NonePlatformType,
+			},
+		},
+	})
+	if secretData != nil {
+		builder.AddSecrets(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      defaults.ImageRegistryPrivateConfigurationUser,
+				Namespace: defaults.ImageRegistryOperatorNamespace,
+			},
+			Data: secretData,
+		})
+	}
+	return builder.BuildListers()
+}
+
+func customerSecretKey() map[string][]byte {
+	return map[string][]byte{
+		"REGISTRY_STORAGE_OCI_ACCESSKEY": []byte(testAccessKey),
+		"REGISTRY_STORAGE_OCI_SECRETKEY": []byte(testSecretKey),
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		secretData map[string][]byte
+		err        string
+	}{
+		{
+			name:       "customer secret key",
+			secretData: customerSecretKey(),
+		},
+		{
+			name: "no secret",
+			err:  `the OCI customer secret key has to be provided in the secret "openshift-image-registry/image-registry-private-configuration-user"`,
+		},
+		{
+			name: "missing secret key",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_OCI_ACCESSKEY": []byte(testAccessKey),
+			},
+			err: `secret "openshift-image-registry/image-registry-private-configuration-user" does not contain required key "REGISTRY_STORAGE_OCI_SECRETKEY"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := GetConfig(testListers(t, tt.secretData))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &OCI{
+				AccessKey: testAccessKey,
+				SecretKey: testSecretKey,
+			}
+			if !reflect.DeepEqual(cfg, expected) {
+				t.Errorf("expected config %#v, got %#v", expected, cfg)
+			}
+		})
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		config   *imageregistryv1.ImageRegistryConfigStorageOCI
+		endpoint string
+		region   string
+		err      string
+	}{
+		{
+			name: "region not set",
+			config: &imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+			},
+			err: "the OCI region must be set",
+		},
+		{
+			name: "configured region",
+			config: &imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "eu-frankfurt-1",
+			},
+			endpoint: "https://tenancyns.compat.objectstorage.eu-frankfurt-1.oraclecloud.com",
+			region:   "eu-frankfurt-1",
+		},
+		{
+			name: "invalid namespace",
+			config: &imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancy.example.com",
+			},
+			err: `namespace "tenancy.example.com" is not an Object Storage namespace`,
+		},
+		{
+			name: "invalid region",
+			config: &imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "us-east-1.amazonaws.com",
+			},
+			err: `region "us-east-1.amazonaws.com" is not an OCI region`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), tt.config, testListers(t, customerSecretKey()))
+
+			envs, err := d.ConfigEnv()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]interface{}{
+				"REGISTRY_STORAGE":                       "s3",
+				"REGISTRY_STORAGE_S3_BUCKET":             "abucket",
+				"REGISTRY_STORAGE_S3_REGION":             tt.region,
+				"REGISTRY_STORAGE_S3_REGIONENDPOINT":     tt.endpoint,
+				"REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE": false,
+				"REGISTRY_STORAGE_S3_ACCESSKEY":          testAccessKey,
+				"REGISTRY_STORAGE_S3_SECRETKEY":          testSecretKey,
+			}
+			if len(envs) != len(expected) {
+				t.Errorf("expected %d variables, got %v", len(expected), envs)
+			}
+			for _, e := range envs {
+				if v, ok := expected[e.Name]; !ok || v != e.Value {
+					t.Errorf("unexpected value %v for %s", e.Value, e.Name)
+				}
+				if secret := e.Name == "REGISTRY_STORAGE_S3_ACCESSKEY" || e.Name == "REGISTRY_STORAGE_S3_SECRETKEY"; secret != e.Secret {
+					t.Errorf("expected %s to be a secret: %t", e.Name, secret)
+				}
+			}
+		})
+	}
+}
+
+func findCondition(cr *imageregistryv1.Config, conditionType string) *operatorapi.OperatorCondition {
+	for i := range cr.Status.Conditions {
+		if cr.Status.Conditions[i].Type == conditionType {
+			return &cr.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func TestCreateStorage(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		config           imageregistryv1.ImageRegistryConfigStorageOCI
+		responseCodes    []int
+		expectedRequests []string
+		expectedBucket   string
+		managementState  string
+		reason           string
+		err              string
+	}{
+		{
+			name: "existing bucket",
+			config: imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "us-ashburn-1",
+			},
+			responseCodes: []int{http.StatusOK},
+			expectedRequests: []string{
+				"HEAD https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket",
+			},
+			expectedBucket:  "abucket",
+			managementState: imageregistryv1.StorageManagementStateUnmanaged,
+			reason:          "OCI Bucket Exists",
+		},
+		{
+			name: "missing bucket",
+			config: imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "us-ashburn-1",
+			},
+			responseCodes: []int{http.StatusNotFound, http.StatusOK},
+			expectedRequests: []string{
+				"HEAD https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket",
+				"PUT https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket",
+			},
+			expectedBucket:  "abucket",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			reason:          "Creation Successful",
+		},
+		{
+			name: "generated bucket",
+			config: imageregistryv1.ImageRegistryConfigStorageOCI{
+				Namespace: "tenancyns",
+				Region:    "us-ashburn-1",
+			},
+			responseCodes: []int{http.StatusOK},
+			expectedRequests: []string{
+				"PUT https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/oci-cluster-image-registry-us-ashburn-1",
+			},
+			expectedBucket:  "oci-cluster-image-registry-us-ashburn-1",
+			managementState: imageregistryv1.StorageManagementStateManaged,
+			reason:          "Creation Successful",
+		},
+		{
+			name: "namespace not set",
+			config: imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket: "abucket",
+			},
+			reason: "Namespace Not Configured",
+			err:    "the Object Storage namespace of the tenancy must be set, it can't be discovered through the Amazon S3 Compatibility API",
+		},
+		{
+			name: "invalid region",
+			config: imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "ashburn",
+			},
+			reason: "Invalid OCI Configuration",
+			err:    `region "ashburn" is not an OCI region`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						OCI: tt.config.DeepCopy(),
+					},
+				},
+			}
+
+			rt := &tripper{}
+			for _, code := range tt.responseCodes {
+				rt.AddResponse(code, "")
+			}
+
+			drv := NewDriver(context.Background(), config.Spec.Storage.OCI, testListers(t, customerSecretKey()))
+			drv.httpClient = &http.Client{Transport: rt}
+
+			err := drv.CreateStorage(config)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			// The generated bucket names end with a random suffix.
+			if len(rt.requests) != len(tt.expectedRequests) {
+				t.Errorf("expected requests %v, got %v", tt.expectedRequests, rt.requests)
+			}
+			for i := 0; i < len(rt.requests) && i < len(tt.expectedRequests); i++ {
+				if !strings.HasPrefix(rt.requests[i], tt.expectedRequests[i]) {
+					t.Errorf("expected request %d to be %q, got %q", i, tt.expectedRequests[i], rt.requests[i])
+				}
+			}
+			if cond := findCondition(config, defaults.StorageExists); cond == nil || cond.Reason != tt.reason {
+				t.Errorf("expected %s reason to be %q, got %#v", defaults.StorageExists, tt.reason, cond)
+			}
+			if tt.err != "" {
+				return
+			}
+
+			if config.Spec.Storage.ManagementState != tt.managementState {
+				t.Errorf("expected the management state %q, got %q", tt.managementState, config.Spec.Storage.ManagementState)
+			}
+			if config.Status.Storage.OCI == nil || !strings.HasPrefix(config.Status.Storage.OCI.Bucket, tt.expectedBucket) || config.Status.Storage.OCI.Region != "us-ashburn-1" {
+				t.Errorf("unexpected storage status %#v", config.Status.Storage.OCI)
+			}
+			if drv.StorageChanged(config) {
+				t.Errorf("expected the storage status to match the spec")
+			}
+			if cond := findCondition(config, defaults.StorageEncrypted); cond == nil || cond.Status != operatorapi.ConditionTrue {
+				t.Errorf("expected the storage to be encrypted, got %#v", cond)
+			}
+		})
+	}
+}
+
+func TestStorageExists(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		responseCode int
+		exists       bool
+		reason       string
+		apiError     bool
+	}{
+		{
+			name:         "exists",
+			responseCode: http.StatusOK,
+			exists:       true,
+			reason:       "OCI Bucket Exists",
+		},
+		{
+			name:         "does not exist",
+			responseCode: http.StatusNotFound,
+			reason:       "Bucket does not exist",
+		},
+		{
+			name:         "server error",
+			responseCode: http.StatusServiceUnavailable,
+			reason:       "Unknown Error Occurred",
+			apiError:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &imageregistryv1.Config{}
+
+			rt := &tripper{}
+			// The SDK retries the server errors.
+			for i := 0; i < 4; i++ {
+				rt.AddResponse(tt.responseCode, "")
+			}
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageOCI{
+				Bucket:    "abucket",
+				Namespace: "tenancyns",
+				Region:    "us-ashburn-1",
+			}, testListers(t, customerSecretKey()))
+			drv.httpClient = &http.Client{Transport: rt}
+
+			exists, err := drv.StorageExists(config)
+			if tt.apiError != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists != tt.exists {
+				t.Errorf("expected exists to be %t, got %t", tt.exists, exists)
+			}
+			if cond := findCondition(config, defaults.StorageExists); cond == nil || cond.Reason != tt.reason {
+				t.Errorf("expected %s reason to be %q, got %#v", defaults.StorageExists, tt.reason, cond)
+			}
+			if cond := findCondition(config, defaults.CloudAPIUnavailable); (cond != nil && cond.Status == operatorapi.ConditionTrue) != tt.apiError {
+				t.Errorf("unexpected %s condition %#v", defaults.CloudAPIUnavailable, cond)
+			}
+		})
+	}
+}
+
+func TestRemoveStorage(t *testing.T) {
+	const listObjects = `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>abucket</Name>
+  <KeyCount>2</KeyCount>
+  <IsTruncated>false</IsTruncated>
+  <Contents><Key>docker/registry/v2/blobs/a</Key></Contents>
+  <Contents><Key>docker/registry/v2/blobs/b</Key></Contents>
+</ListBucketResult>`
+
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				OCI: &imageregistryv1.ImageRegistryConfigStorageOCI{
+					Bucket:    "abucket",
+					Namespace: "tenancyns",
+					Region:    "us-ashburn-1",
+				},
+			},
+		},
+	}
+
+	rt := &tripper{}
+	rt.AddResponse(http.StatusOK, listObjects)
+	rt.AddResponse(http.StatusNoContent, "")
+	rt.AddResponse(http.StatusNoContent, "")
+	rt.AddResponse(http.StatusNoContent, "")
+
+	drv := NewDriver(context.Background(), config.Spec.Storage.OCI.DeepCopy(), testListers(t, customerSecretKey()))
+	drv.httpClient = &http.Client{Transport: rt}
+
+	removed, err := drv.RemoveStorage(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed {
+		t.Errorf("expected the storage to be removed")
+	}
+
+	expectedRequests := []string{
+		"GET https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket?list-type=2",
+		"DELETE https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket/docker/registry/v2/blobs/a",
+		"DELETE https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket/docker/registry/v2/blobs/b",
+		"DELETE https://tenancyns.compat.objectstorage.us-ashburn-1.oraclecloud.com/abucket",
+	}
+	if !reflect.DeepEqual(rt.requests, expectedRequests) {
+		t.Errorf("expected requests %v, got %v", expectedRequests, rt.requests)
+	}
+	if config.Spec.Storage.OCI.Bucket != "" || config.Status.Storage.OCI == nil || config.Status.Storage.OCI.Bucket != "" {
+		t.Errorf("expected the bucket to be cleared, got spec %#v and status %#v", config.Spec.Storage.OCI, config.Status.Storage.OCI)
+	}
+	if cond := findCondition(config, defaults.StorageExists); cond == nil || cond.Reason != "OCI Bucket Deleted" {
+		t.Errorf("unexpected %s condition %#v", defaults.StorageExists, cond)
+	}
+}
+
+func TestRemoveUnmanagedStorage(t *testing.T) {
+	config := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateUnmanaged,
+				OCI: &imageregistryv1.ImageRegistryConfigStorageOCI{
+					Bucket:    "abucket",
+					Namespace: "tenancyns",
+					Region:    "us-ashburn-1",
+				},
+			},
+		},
+	}
+
+	rt := &tripper{}
+	drv := NewDriver(context.Background(), config.Spec.Storage.OCI, testListers(t, customerSecretKey()))
+	drv.httpClient = &http.Client{Transport: rt}
+
+	removed, err := drv.RemoveStorage(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed || len(rt.requests) != 0 {
+		t.Errorf("expected the unmanaged bucket to be kept, got requests %v", rt.requests)
+	}
+}
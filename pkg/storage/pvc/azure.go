@@ -0,0 +1,154 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
+)
+
+// azureDiskProvisioners are the provisioners of Azure managed disks, the CSI
+// driver and the in-tree plugin.
+var azureDiskProvisioners = []string{
+	"disk.csi.azure.com",
+	"kubernetes.io/azure-disk",
+}
+
+// azureDiskSKUParameters are the storage class parameters holding the SKU of
+// the Azure disks, the CSI driver and the in-tree plugin use different ones.
+var azureDiskSKUParameters = []string{
+	"skuName",
+	"storageaccounttype",
+}
+
+// onAzure returns whether the cluster runs on Azure.
+func (d *driver) onAzure() (bool, error) {
+	infra, err := util.GetInfrastructure(d.Listers)
+	if err != nil {
+		return false, err
+	}
+	return infra.Status.PlatformStatus.Type == configv1.AzurePlatformType, nil
+}
+
+// isAzureDisk returns whether the storage class provisions Azure managed
+// disks.
+func isAzureDisk(class *storagev1.StorageClass) bool {
+	for _, provisioner := range azureDiskProvisioners {
+		if class.Provisioner == provisioner {
+			return true
+		}
+	}
+	return false
+}
+
+// azureDiskSKU returns the SKU of the disks provisioned by the storage class,
+// or an empty string if it's not set.
+func azureDiskSKU(class *storagev1.StorageClass) string {
+	for key, value := range class.Parameters {
+		for _, param := range azureDiskSKUParameters {
+			if strings.EqualFold(key, param) {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// isPremiumAzureDisk returns whether the storage class provisions premium
+// SSD or ultra disks. The provisioners default to standard disks.
+func isPremiumAzureDisk(class *storagev1.StorageClass) bool {
+	sku := strings.ToLower(azureDiskSKU(class))
+	return isAzureDisk(class) && (strings.HasPrefix(sku, "premium") || strings.HasPrefix(sku, "ultrassd"))
+}
+
+// premiumAzureDiskClass returns the storage class provisioning premium Azure
+// disks that is recommended for the registry, the default storage class if
+// it does, the first one by name otherwise. It returns nil if there is none.
+func (d *driver) premiumAzureDiskClass() (*storagev1.StorageClass, error) {
+	classes, err := d.StorageClient.StorageClasses().List(
+		context.TODO(), metav1.ListOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var premium []*storagev1.StorageClass
+	for i := range classes.Items {
+		if isPremiumAzureDisk(&classes.Items[i]) {
+			premium = append(premium, &classes.Items[i])
+		}
+	}
+	if len(premium) == 0 {
+		return nil, nil
+	}
+	sort.Slice(premium, func(i, j int) bool {
+		iDefault := premium[i].Annotations[defaultStorageClassAnnotation] == "true"
+		jDefault := premium[j].Annotations[defaultStorageClassAnnotation] == "true"
+		if iDefault != jDefault {
+			return iDefault
+		}
+		return premium[i].Name < premium[j].Name
+	})
+	return premium[0], nil
+}
+
+// claimStorageClass returns the storage class of the claim created by the
+// operator, nil if the claim should use the default storage class.
+func (d *driver) claimStorageClass() (*storagev1.StorageClass, error) {
+	if len(d.Config.StorageClassName) != 0 {
+		return d.StorageClient.StorageClasses().Get(
+			context.TODO(), d.Config.StorageClassName, metav1.GetOptions{},
+		)
+	}
+
+	azure, err := d.onAzure()
+	if err != nil || !azure {
+		return nil, err
+	}
+	return d.premiumAzureDiskClass()
+}
+
+// checkAzureDisk reports through the StorageClassSuboptimal condition
+// whether the claim is backed by standard Azure disks while premium SSD
+// disks are recommended for the registry.
+func (d *driver) checkAzureDisk(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) {
+	azure, err := d.onAzure()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageClassSuboptimal, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return
+	}
+	if !azure {
+		return
+	}
+
+	class, err := d.storageClass(claim)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageClassSuboptimal, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return
+	}
+	if class == nil || !isAzureDisk(class) {
+		util.UpdateCondition(cr, defaults.StorageClassSuboptimal, operatorapi.ConditionFalse, "Not Azure Disk", "")
+		return
+	}
+	if isPremiumAzureDisk(class) {
+		util.UpdateCondition(cr, defaults.StorageClassSuboptimal, operatorapi.ConditionFalse, "Premium Disk", fmt.Sprintf("Storage class %s provisions %s disks", class.Name, azureDiskSKU(class)))
+		return
+	}
+
+	message := fmt.Sprintf("Storage class %s provisions standard disks, a storage class provisioning premium SSD disks is recommended for the registry", class.Name)
+	if premium, err := d.premiumAzureDiskClass(); err == nil && premium != nil {
+		message = fmt.Sprintf("Storage class %s provisions standard disks, the storage class %s provisioning premium SSD disks is recommended for the registry", class.Name, premium.Name)
+	}
+	util.UpdateCondition(cr, defaults.StorageClassSuboptimal, operatorapi.ConditionTrue, "Standard Disk", message)
+}
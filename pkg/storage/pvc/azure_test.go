@@ -0,0 +1,167 @@
+package pvc
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func azureDiskClass(name, provisioner, sku string, isDefault bool) *storagev1.StorageClass {
+	class := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Provisioner: provisioner,
+	}
+	if sku != "" {
+		class.Parameters = map[string]string{"skuName": sku}
+	}
+	if isDefault {
+		class.Annotations = map[string]string{
+			defaultStorageClassAnnotation: "true",
+		}
+	}
+	return class
+}
+
+func TestAzureClaimStorageClass(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		platform           configv1.PlatformType
+		storageClassName   string
+		objects            []runtime.Object
+		expectedClass      string
+		expectedAccessMode corev1.PersistentVolumeAccessMode
+		expectedStatus     operatorapi.ConditionStatus
+		expectedReason     string
+	}{
+		{
+			name:     "premium class selected on Azure",
+			platform: configv1.AzurePlatformType,
+			objects: []runtime.Object{
+				azureDiskClass("managed-csi", "disk.csi.azure.com", "StandardSSD_LRS", true),
+				azureDiskClass("managed-premium", "disk.csi.azure.com", "Premium_LRS", false),
+			},
+			expectedClass:      "managed-premium",
+			expectedAccessMode: corev1.ReadWriteOnce,
+			expectedStatus:     operatorapi.ConditionFalse,
+			expectedReason:     "Premium Disk",
+		},
+		{
+			name:     "default premium class preferred",
+			platform: configv1.AzurePlatformType,
+			objects: []runtime.Object{
+				azureDiskClass("a-premium", "kubernetes.io/azure-disk", "Premium_LRS", false),
+				azureDiskClass("b-premium", "disk.csi.azure.com", "Premium_ZRS", true),
+			},
+			expectedClass:      "b-premium",
+			expectedAccessMode: corev1.ReadWriteOnce,
+			expectedStatus:     operatorapi.ConditionFalse,
+			expectedReason:     "Premium Disk",
+		},
+		{
+			name:             "standard class requested on Azure",
+			platform:         configv1.AzurePlatformType,
+			storageClassName: "managed-csi",
+			objects: []runtime.Object{
+				azureDiskClass("managed-csi", "disk.csi.azure.com", "", true),
+				azureDiskClass("managed-premium", "disk.csi.azure.com", "Premium_LRS", false),
+			},
+			expectedClass:      "managed-csi",
+			expectedAccessMode: corev1.ReadWriteOnce,
+			expectedStatus:     operatorapi.ConditionTrue,
+			expectedReason:     "Standard Disk",
+		},
+		{
+			name:     "no premium class on Azure",
+			platform: configv1.AzurePlatformType,
+			objects: []runtime.Object{
+				azureDiskClass("managed-csi", "disk.csi.azure.com", "StandardSSD_LRS", true),
+			},
+			expectedAccessMode: corev1.ReadWriteMany,
+			expectedStatus:     operatorapi.ConditionTrue,
+			expectedReason:     "Standard Disk",
+		},
+		{
+			name:     "not on Azure",
+			platform: configv1.AWSPlatformType,
+			objects: []runtime.Object{
+				azureDiskClass("managed-premium", "disk.csi.azure.com", "Premium_LRS", false),
+			},
+			expectedAccessMode: corev1.ReadWriteMany,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cliset := fake.NewSimpleClientset(tt.objects...)
+
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Replicas:        1,
+					RolloutStrategy: "Recreate",
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+							StorageClassName: tt.storageClassName,
+						},
+					},
+				},
+			}
+
+			drv := &driver{
+				Namespace:     "openshift-image-registry",
+				Config:        cr.Spec.Storage.PVC,
+				Client:        cliset.CoreV1(),
+				StorageClient: cliset.StorageV1(),
+				Listers:       platformListers(tt.platform),
+			}
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			claim, err := drv.Client.PersistentVolumeClaims(drv.Namespace).Get(context.TODO(), defaults.PVCImageRegistryName, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			class := ""
+			if claim.Spec.StorageClassName != nil {
+				class = *claim.Spec.StorageClassName
+			}
+			if class != tt.expectedClass {
+				t.Errorf("expected storage class %q, got %q", tt.expectedClass, class)
+			}
+			if len(claim.Spec.AccessModes) != 1 || claim.Spec.AccessModes[0] != tt.expectedAccessMode {
+				t.Errorf("expected access mode %s, got %v", tt.expectedAccessMode, claim.Spec.AccessModes)
+			}
+
+			var cond *operatorapi.OperatorCondition
+			for i := range cr.Status.Conditions {
+				if cr.Status.Conditions[i].Type == defaults.StorageClassSuboptimal {
+					cond = &cr.Status.Conditions[i]
+				}
+			}
+			if tt.expectedStatus == "" {
+				if cond != nil {
+					t.Errorf("unexpected condition %s", cond.Type)
+				}
+				return
+			}
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageClassSuboptimal)
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+			}
+		})
+	}
+}
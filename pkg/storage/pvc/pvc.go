@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strconv"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	coreset "k8s.io/client-go/kubernetes/typed/core/v1"
+	storageset "k8s.io/client-go/kubernetes/typed/storage/v1"
 	"k8s.io/client-go/rest"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -25,15 +28,33 @@ import (
 const (
 	rootDirectory      = "/registry"
 	PVCOwnerAnnotation = "imageregistry.openshift.io"
+
+	// defaultStorageClassAnnotation marks the storage class used for claims
+	// that don't request one.
+	defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+	// minMaxThreads is the lowest maxthreads the filesystem driver of the
+	// registry accepts.
+	minMaxThreads = 25
 )
 
+// encryptionKeyParameters are storage class parameters that, when set, make
+// the provisioner encrypt volumes with the referenced key.
+var encryptionKeyParameters = []string{
+	"kmsKeyId",
+	"disk-encryption-kms-key",
+	"diskEncryptionSetID",
+}
+
 type driver struct {
-	Namespace string
-	Config    *imageregistryv1.ImageRegistryConfigStoragePVC
-	Client    coreset.CoreV1Interface
+	Namespace     string
+	Config        *imageregistryv1.ImageRegistryConfigStoragePVC
+	Client        coreset.CoreV1Interface
+	StorageClient storageset.StorageV1Interface
+	Listers       *regopclient.Listers
 }
 
-func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *rest.Config) (*driver, error) {
+func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *rest.Config, listers *regopclient.Listers) (*driver, error) {
 	namespace, err := regopclient.GetWatchNamespace()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get watch namespace: %s", err)
@@ -44,18 +65,45 @@ func NewDriver(c *imageregistryv1.ImageRegistryConfigStoragePVC, kubeconfig *res
 		return nil, err
 	}
 
+	storageClient, err := storageset.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
 	return &driver{
-		Namespace: namespace,
-		Config:    c,
-		Client:    client,
+		Namespace:     namespace,
+		Config:        c,
+		Client:        client,
+		StorageClient: storageClient,
+		Listers:       listers,
+	}, nil
+}
+
+// maxThreadsEnv returns the environment variable that limits the concurrent
+// filesystem operations of the registry, if the limit is set.
+func maxThreadsEnv(maxThreads int32) (envvar.List, error) {
+	if maxThreads == 0 {
+		return nil, nil
+	}
+	if maxThreads < minMaxThreads {
+		return nil, fmt.Errorf("maxThreads must be at least %d, got %d", minMaxThreads, maxThreads)
+	}
+	return envvar.List{
+		{Name: "REGISTRY_STORAGE_FILESYSTEM_MAXTHREADS", Value: maxThreads},
 	}, nil
 }
 
 func (d *driver) ConfigEnv() (envs envvar.List, err error) {
+	threadsEnvs, err := maxThreadsEnv(d.Config.MaxThreads)
+	if err != nil {
+		return nil, err
+	}
+
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "filesystem"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_FILESYSTEM_ROOTDIRECTORY", Value: rootDirectory},
 	)
+	envs = append(envs, threadsEnvs...)
 	return
 }
 
@@ -153,7 +201,83 @@ func (d *driver) checkPVC(cr *imageregistryv1.Config, claim *corev1.PersistentVo
 	return fmt.Errorf("PVC %s does not contain the necessary access modes: %s or %s", d.Config.Claim, corev1.ReadWriteMany, corev1.ReadWriteOnce)
 }
 
+// checkEncryption reports through the StorageEncrypted condition whether the
+// storage class backing the claim encrypts its volumes.
+func (d *driver) checkEncryption(cr *imageregistryv1.Config, claim *corev1.PersistentVolumeClaim) {
+	var err error
+	if claim == nil {
+		claim, err = d.Client.PersistentVolumeClaims(d.Namespace).Get(
+			context.TODO(), d.Config.Claim, metav1.GetOptions{},
+		)
+		if err != nil {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+			return
+		}
+	}
+
+	class, err := d.storageClass(claim)
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return
+	}
+	if class == nil {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", fmt.Sprintf("PVC %s does not use a storage class", claim.Name))
+		return
+	}
+
+	for _, param := range encryptionKeyParameters {
+		if len(class.Parameters[param]) != 0 {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Storage Class Encrypted", fmt.Sprintf("Storage class %s encrypts volumes with a customer-managed key", class.Name))
+			return
+		}
+	}
+	if value, ok := class.Parameters["encrypted"]; ok {
+		encrypted, err := strconv.ParseBool(value)
+		if err == nil && encrypted {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Storage Class Encrypted", fmt.Sprintf("Storage class %s encrypts volumes", class.Name))
+			return
+		}
+		if err == nil {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Storage Class Not Encrypted", fmt.Sprintf("Storage class %s does not encrypt volumes", class.Name))
+			return
+		}
+	}
+
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", fmt.Sprintf("Unable to determine whether storage class %s encrypts volumes", class.Name))
+}
+
+// storageClass returns the storage class used by the claim. It returns nil
+// if the claim doesn't use one.
+func (d *driver) storageClass(claim *corev1.PersistentVolumeClaim) (*storagev1.StorageClass, error) {
+	if claim.Spec.StorageClassName != nil {
+		if len(*claim.Spec.StorageClassName) == 0 {
+			return nil, nil
+		}
+		return d.StorageClient.StorageClasses().Get(
+			context.TODO(), *claim.Spec.StorageClassName, metav1.GetOptions{},
+		)
+	}
+
+	classes, err := d.StorageClient.StorageClasses().List(
+		context.TODO(), metav1.ListOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range classes.Items {
+		if classes.Items[i].Annotations[defaultStorageClassAnnotation] == "true" {
+			return &classes.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolumeClaim, error) {
+	class, err := d.claimStorageClass()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the storage class of the claim: %s", err)
+	}
+
 	claim := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      d.Config.Claim,
@@ -173,6 +297,15 @@ func (d *driver) createPVC(cr *imageregistryv1.Config) (*corev1.PersistentVolume
 			},
 		},
 	}
+	if class != nil {
+		claim.Spec.StorageClassName = &class.Name
+		// Azure disks can only be attached to a single node.
+		if isAzureDisk(class) {
+			claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			}
+		}
+	}
 
 	return d.Client.PersistentVolumeClaims(d.Namespace).Create(
 		context.TODO(), claim, metav1.CreateOptions{},
@@ -221,6 +354,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	d.checkEncryption(cr, claim)
+	d.checkAzureDisk(cr, claim)
+
 	if cr.Spec.Storage.ManagementState == "" {
 		cr.Spec.Storage.ManagementState = managementState
 	}
@@ -5,15 +5,36 @@ import (
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
 
+	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 
+	"github.com/openshift/cluster-image-registry-operator/pkg/client"
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 )
 
+func platformListers(platform configv1.PlatformType) *client.Listers {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: platform,
+			},
+		},
+	})
+	return builder.BuildListers()
+}
+
 func TestStorageManagementState(t *testing.T) {
 	for _, tt := range []struct {
 		name                    string
@@ -192,9 +213,11 @@ func TestStorageManagementState(t *testing.T) {
 			}
 
 			drv := &driver{
-				Namespace: "openshift-image-registry",
-				Config:    tt.config.Spec.Storage.PVC,
-				Client:    cliset.CoreV1(),
+				Namespace:     "openshift-image-registry",
+				Config:        tt.config.Spec.Storage.PVC,
+				Client:        cliset.CoreV1(),
+				StorageClient: cliset.StorageV1(),
+				Listers:       platformListers(configv1.AWSPlatformType),
 			}
 
 			if err := drv.CreateStorage(tt.config); err != nil {
@@ -219,3 +242,192 @@ func TestStorageManagementState(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageEncryption(t *testing.T) {
+	storageClass := func(name string, params map[string]string, isDefault bool) *storagev1.StorageClass {
+		class := &storagev1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Parameters: params,
+		}
+		if isDefault {
+			class.Annotations = map[string]string{
+				defaultStorageClassAnnotation: "true",
+			}
+		}
+		return class
+	}
+
+	for _, tt := range []struct {
+		name             string
+		storageClassName *string
+		objects          []runtime.Object
+		expectedStatus   operatorapi.ConditionStatus
+	}{
+		{
+			name:             "encrypted storage class",
+			storageClassName: pointer.StringPtr("gp2"),
+			objects: []runtime.Object{
+				storageClass("gp2", map[string]string{"encrypted": "true"}, false),
+			},
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:             "storage class with encryption key",
+			storageClassName: pointer.StringPtr("standard"),
+			objects: []runtime.Object{
+				storageClass("standard", map[string]string{"disk-encryption-kms-key": "projects/p/keys/k"}, false),
+			},
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:             "unencrypted storage class",
+			storageClassName: pointer.StringPtr("gp2"),
+			objects: []runtime.Object{
+				storageClass("gp2", map[string]string{"encrypted": "false"}, false),
+			},
+			expectedStatus: operatorapi.ConditionFalse,
+		},
+		{
+			name: "default storage class",
+			objects: []runtime.Object{
+				storageClass("other", nil, false),
+				storageClass("gp2", map[string]string{"encrypted": "true"}, true),
+			},
+			expectedStatus: operatorapi.ConditionTrue,
+		},
+		{
+			name:             "storage class without encryption parameters",
+			storageClassName: pointer.StringPtr("nfs"),
+			objects: []runtime.Object{
+				storageClass("nfs", nil, false),
+			},
+			expectedStatus: operatorapi.ConditionUnknown,
+		},
+		{
+			name:             "no storage class",
+			storageClassName: pointer.StringPtr(""),
+			expectedStatus:   operatorapi.ConditionUnknown,
+		},
+		{
+			name:             "missing storage class",
+			storageClassName: pointer.StringPtr("gp2"),
+			expectedStatus:   operatorapi.ConditionUnknown,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "openshift-image-registry",
+					Name:      "user-provided-pvc",
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteMany,
+					},
+					StorageClassName: tt.storageClassName,
+				},
+			}
+			cliset := fake.NewSimpleClientset(append(tt.objects, claim)...)
+
+			config := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						PVC: &imageregistryv1.ImageRegistryConfigStoragePVC{
+							Claim: claim.Name,
+						},
+					},
+				},
+			}
+
+			drv := &driver{
+				Namespace:     "openshift-image-registry",
+				Config:        config.Spec.Storage.PVC,
+				Client:        cliset.CoreV1(),
+				StorageClient: cliset.StorageV1(),
+				Listers:       platformListers(configv1.AWSPlatformType),
+			}
+
+			if err := drv.CreateStorage(config); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var status operatorapi.ConditionStatus
+			for _, cond := range config.Status.Conditions {
+				if cond.Type == defaults.StorageEncrypted {
+					status = cond.Status
+				}
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("expected %s to be %q, %q instead", defaults.StorageEncrypted, tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestConfigEnvMaxThreads(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		maxThreads int32
+		expected   string
+		err        string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:       "configured",
+			maxThreads: 50,
+			expected:   "50",
+		},
+		{
+			name:       "minimum",
+			maxThreads: 25,
+			expected:   "25",
+		},
+		{
+			name:       "too low",
+			maxThreads: 24,
+			err:        "maxThreads must be at least 25, got 24",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			drv := &driver{
+				Config: &imageregistryv1.ImageRegistryConfigStoragePVC{
+					Claim:      "registry",
+					MaxThreads: tt.maxThreads,
+				},
+			}
+
+			envs, err := drv.ConfigEnv()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			envvars, err := envs.EnvVars("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var maxThreads *corev1.EnvVar
+			for i := range envvars {
+				if envvars[i].Name == "REGISTRY_STORAGE_FILESYSTEM_MAXTHREADS" {
+					maxThreads = &envvars[i]
+				}
+			}
+			if tt.expected == "" {
+				if maxThreads != nil {
+					t.Errorf("unexpected envvar %s=%q", maxThreads.Name, maxThreads.Value)
+				}
+			} else if maxThreads == nil || maxThreads.Value != tt.expected {
+				t.Errorf("expected REGISTRY_STORAGE_FILESYSTEM_MAXTHREADS=%s, got %#v", tt.expected, maxThreads)
+			}
+		})
+	}
+}
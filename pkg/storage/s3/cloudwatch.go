@@ -0,0 +1,104 @@
+package s3
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+)
+
+// cloudWatchEndpointsID is the ID of CloudWatch in the endpoints of the SDK.
+const cloudWatchEndpointsID = "monitoring"
+
+// cloudWatch is a client of the only CloudWatch operation the operator
+// needs, the CloudWatch package of the SDK isn't vendored.
+type cloudWatch struct {
+	*client.Client
+}
+
+// dimension is a name/value pair of the dimensions of a metric.
+type dimension struct {
+	_ struct{} `type:"structure"`
+
+	Name  *string `type:"string"`
+	Value *string `type:"string"`
+}
+
+// getMetricStatisticsInput is the input of GetMetricStatistics.
+type getMetricStatisticsInput struct {
+	_ struct{} `type:"structure"`
+
+	Namespace  *string      `type:"string"`
+	MetricName *string      `type:"string"`
+	Dimensions []*dimension `type:"list"`
+	StartTime  *time.Time   `type:"timestamp"`
+	EndTime    *time.Time   `type:"timestamp"`
+	Period     *int64       `type:"integer"`
+	Statistics []*string    `type:"list"`
+}
+
+// datapoint is a statistic of a metric over a period.
+type datapoint struct {
+	_ struct{} `type:"structure"`
+
+	Timestamp *time.Time `type:"timestamp"`
+	Average   *float64   `type:"double"`
+}
+
+// getMetricStatisticsOutput is the output of GetMetricStatistics.
+type getMetricStatisticsOutput struct {
+	_ struct{} `type:"structure"`
+
+	Datapoints []*datapoint `type:"list"`
+}
+
+// newCloudWatch returns a CloudWatch client for the region of sess. The
+// endpoint of the session, if any, is the one of S3 and isn't used.
+func newCloudWatch(sess *session.Session) *cloudWatch {
+	c := sess.ClientConfig(cloudWatchEndpointsID, &aws.Config{
+		Endpoint:     aws.String(""),
+		UseDualStack: aws.Bool(false),
+	})
+	signingName := c.SigningName
+	if c.SigningNameDerived || len(signingName) == 0 {
+		signingName = cloudWatchEndpointsID
+	}
+
+	svc := &cloudWatch{
+		Client: client.New(*c.Config, metadata.ClientInfo{
+			ServiceName:   cloudWatchEndpointsID,
+			ServiceID:     "CloudWatch",
+			SigningName:   signingName,
+			SigningRegion: c.SigningRegion,
+			PartitionID:   c.PartitionID,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2010-08-01",
+		}, c.Handlers),
+	}
+	// The requests to CloudWatch don't acknowledge the charges of S3.
+	svc.Handlers.Build.RemoveByName("openshift.io/request-payer")
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return svc
+}
+
+// getMetricStatistics returns the statistics of a metric.
+func (c *cloudWatch) getMetricStatistics(ctx context.Context, input *getMetricStatisticsInput) (*getMetricStatisticsOutput, error) {
+	output := &getMetricStatisticsOutput{}
+	req := c.NewRequest(&request.Operation{
+		Name:       "GetMetricStatistics",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output)
+	req.SetContext(ctx)
+	return output, req.Send()
+}
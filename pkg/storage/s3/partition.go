@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+)
+
+// standardPartition is the partition of the commercial AWS regions.
+const standardPartition = "aws"
+
+// regionPartition returns the AWS partition of the region, e.g. aws-cn for
+// the China regions or aws-us-gov for GovCloud. The regions unknown to the
+// vendored SDK are matched by the region patterns of the partitions.
+func regionPartition(region string) (endpoints.Partition, bool) {
+	if len(region) == 0 {
+		return endpoints.Partition{}, false
+	}
+	return endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+}
+
+// arnPartition returns the partition of the ARN, or false if arn is not an
+// ARN.
+func arnPartition(arn string) (string, bool) {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// checkPartition verifies that the ARNs of the configuration are in the
+// partition of the bucket region, the credentials and the keys of a
+// partition can't be used in another one.
+func checkPartition(config *imageregistryv1.ImageRegistryConfigStorageS3) error {
+	partition, ok := regionPartition(config.Region)
+	if !ok {
+		return nil
+	}
+
+	for _, arn := range []struct {
+		field string
+		value string
+	}{
+		{field: "roleARN", value: config.RoleARN},
+		{field: "assumeRoleARN", value: config.AssumeRoleARN},
+		{field: "kmsKeyID", value: config.KMSKeyID},
+	} {
+		id, ok := arnPartition(arn.value)
+		if !ok || id == partition.ID() {
+			continue
+		}
+		return fmt.Errorf("%s %q is in the partition %s, but the region %s is in the partition %s", arn.field, arn.value, id, config.Region, partition.ID())
+	}
+	return nil
+}
+
+// partitionEndpoint returns the S3 endpoint of the region when it's outside
+// of the standard partition. The registry only accepts the regions known to
+// its SDK unless an endpoint is given, so the endpoint is set explicitly for
+// the partitions the SDKs are the most likely to lag behind on.
+func partitionEndpoint(config *imageregistryv1.ImageRegistryConfigStorageS3) (string, bool) {
+	partition, ok := regionPartition(config.Region)
+	if !ok || partition.ID() == standardPartition {
+		return "", false
+	}
+
+	scheme := "https"
+	if isInsecure(config) {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://s3.%s.%s", scheme, config.Region, partition.DNSSuffix()), true
+}
@@ -0,0 +1,224 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+
+	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
+	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
+)
+
+func TestPartitionEndpoint(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "cn-north-1",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name             string
+		config           *imageregistryv1.ImageRegistryConfigStorageS3
+		expectedEndpoint string
+		expectedHost     string
+	}{
+		{
+			name: "China cluster region",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+			},
+			expectedEndpoint: "https://s3.cn-north-1.amazonaws.com.cn",
+			expectedHost:     "a-bucket.s3.cn-north-1.amazonaws.com.cn",
+		},
+		{
+			name: "China region unknown to the SDK",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+				Region: "cn-south-9",
+			},
+			expectedEndpoint: "https://s3.cn-south-9.amazonaws.com.cn",
+			expectedHost:     "a-bucket.s3.cn-south-9.amazonaws.com.cn",
+		},
+		{
+			name: "GovCloud region",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+				Region: "us-gov-east-1",
+			},
+			expectedEndpoint: "https://s3.us-gov-east-1.amazonaws.com",
+			expectedHost:     "a-bucket.s3.us-gov-east-1.amazonaws.com",
+		},
+		{
+			name: "GovCloud FIPS",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:  "a-bucket",
+				Region:  "us-gov-west-1",
+				UseFIPS: true,
+			},
+			expectedEndpoint: "https://s3-fips.us-gov-west-1.amazonaws.com",
+			expectedHost:     "a-bucket.s3-fips.us-gov-west-1.amazonaws.com",
+		},
+		{
+			name: "standard partition",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+				Region: "eu-west-1",
+			},
+			expectedHost: "a-bucket.s3.dualstack.eu-west-1.amazonaws.com",
+		},
+		{
+			name: "custom endpoint",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:             "a-bucket",
+				Region:             "cn-northwest-1",
+				RegionEndpoint:     "https://s3.example.cn",
+				VirtualHostedStyle: true,
+			},
+			expectedEndpoint: "https://s3.example.cn",
+			expectedHost:     "a-bucket.s3.example.cn",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), tt.config, listers)
+
+			envvars, err := d.ConfigEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_REGIONENDPOINT")
+			if len(tt.expectedEndpoint) == 0 {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_REGIONENDPOINT is expected to be unset, but got %v", e)
+				}
+			} else {
+				if e == nil || e.Value != tt.expectedEndpoint {
+					t.Errorf("REGISTRY_STORAGE_S3_REGIONENDPOINT: got %v, want %s", e, tt.expectedEndpoint)
+				}
+				if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE"); e == nil || e.Value != true {
+					t.Errorf("REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE: got %v, want true", e)
+				}
+			}
+
+			rt := &tripper{}
+			d.roundTripper = rt
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: tt.config,
+					},
+				},
+			}
+			if _, err := d.StorageExists(cr); err != nil {
+				t.Fatal(err)
+			}
+			if len(rt.reqHosts) == 0 || rt.reqHosts[0] != tt.expectedHost {
+				t.Errorf("expected the management client to use %s, got %v", tt.expectedHost, rt.reqHosts)
+			}
+		})
+	}
+}
+
+func TestPartitionARNs(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "cn-north-1",
+				},
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.ImageRegistryConfigStorageS3
+		err    string
+	}{
+		{
+			name: "China role",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				RoleARN: "arn:aws-cn:iam::123456789012:role/image-registry",
+			},
+		},
+		{
+			name: "GovCloud key",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Region:   "us-gov-west-1",
+				KMSKeyID: "arn:aws-us-gov:kms:us-gov-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+			},
+		},
+		{
+			name: "key ID",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				KMSKeyID: "1234abcd-12ab-34cd-56ef-1234567890ab",
+			},
+		},
+		{
+			name: "standard role in China",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				RoleARN: "arn:aws:iam::123456789012:role/image-registry",
+			},
+			err: `roleARN "arn:aws:iam::123456789012:role/image-registry" is in the partition aws, but the region cn-north-1 is in the partition aws-cn`,
+		},
+		{
+			name: "China role in GovCloud",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Region:        "us-gov-east-1",
+				AssumeRoleARN: "arn:aws-cn:iam::123456789012:role/image-registry",
+			},
+			err: `assumeRoleARN "arn:aws-cn:iam::123456789012:role/image-registry" is in the partition aws-cn, but the region us-gov-east-1 is in the partition aws-us-gov`,
+		},
+		{
+			name: "standard key in China",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				KMSKeyID: "arn:aws:kms:us-east-1:123456789012:alias/registry",
+			},
+			err: `kmsKeyID "arn:aws:kms:us-east-1:123456789012:alias/registry" is in the partition aws, but the region cn-north-1 is in the partition aws-cn`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDriver(context.Background(), tt.config, listers).UpdateEffectiveConfig()
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
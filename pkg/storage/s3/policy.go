@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// conditionKeyKMSKeyID is the bucket policy condition key matched against
+// the KMS key requested by uploads.
+const conditionKeyKMSKeyID = "s3:x-amz-server-side-encryption-aws-kms-key-id"
+
+// stringOrSlice is a policy element that can be either a single string or a
+// list of strings.
+type stringOrSlice []string
+
+func (s *stringOrSlice) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		*s = []string{str}
+		return nil
+	}
+	var strs []string
+	if err := json.Unmarshal(b, &strs); err != nil {
+		return err
+	}
+	*s = strs
+	return nil
+}
+
+type policyStatement struct {
+	Effect    string
+	Action    stringOrSlice
+	Condition map[string]map[string]stringOrSlice
+}
+
+// policyStatements is the Statement element of a policy, it can be either a
+// single statement or a list of statements.
+type policyStatements []policyStatement
+
+func (s *policyStatements) UnmarshalJSON(b []byte) error {
+	var stmt policyStatement
+	if err := json.Unmarshal(b, &stmt); err == nil {
+		*s = []policyStatement{stmt}
+		return nil
+	}
+	var stmts []policyStatement
+	if err := json.Unmarshal(b, &stmts); err != nil {
+		return err
+	}
+	*s = stmts
+	return nil
+}
+
+type bucketPolicy struct {
+	Statement policyStatements
+}
+
+// policyPatternMatch reports whether value matches the policy wildcard
+// pattern, where * matches any sequence of characters and ? any single
+// character.
+func policyPatternMatch(pattern, value string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return regexp.MustCompile("(?i)^" + expr + "$").MatchString(value)
+}
+
+// policyDeniesKMSKey reports whether the bucket policy denies uploads
+// encrypted with keyID. Only the statements that deny s3:PutObject unless
+// the requested key is one of a list of keys are considered.
+func policyDeniesKMSKey(policy string, keyID string) (bool, error) {
+	var p bucketPolicy
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return false, err
+	}
+
+	for _, stmt := range p.Statement {
+		if !strings.EqualFold(stmt.Effect, "Deny") {
+			continue
+		}
+
+		putObject := false
+		for _, action := range stmt.Action {
+			if policyPatternMatch(action, "s3:PutObject") {
+				putObject = true
+				break
+			}
+		}
+		if !putObject {
+			continue
+		}
+
+		for op, conditions := range stmt.Condition {
+			like := false
+			switch strings.TrimSuffix(op, "IfExists") {
+			case "StringNotEquals":
+			case "StringNotLike":
+				like = true
+			default:
+				continue
+			}
+
+			for key, values := range conditions {
+				if !strings.EqualFold(key, conditionKeyKMSKeyID) {
+					continue
+				}
+				allowed := false
+				for _, v := range values {
+					if v == keyID || (like && policyPatternMatch(v, keyID)) {
+						allowed = true
+						break
+					}
+				}
+				if !allowed {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package s3
+
+import (
+	"testing"
+)
+
+func TestPolicyDeniesKMSKey(t *testing.T) {
+	const keyARN = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	for _, tt := range []struct {
+		name   string
+		policy string
+		denied bool
+	}{
+		{
+			name:   "no statements",
+			policy: `{"Version":"2012-10-17","Statement":[]}`,
+		},
+		{
+			name: "key allowed",
+			policy: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:PutObject","Resource":"arn:aws:s3:::bucket/*",
+				"Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption-aws-kms-key-id":["arn:aws:kms:us-east-1:123456789012:key/other","` + keyARN + `"]}}}]}`,
+		},
+		{
+			name: "key denied",
+			policy: `{"Version":"2012-10-17","Statement":{"Effect":"Deny","Principal":"*","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::bucket/*",
+				"Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"arn:aws:kms:us-east-1:123456789012:key/other"}}}}`,
+			denied: true,
+		},
+		{
+			name: "key denied by a wildcard action",
+			policy: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:*","Resource":"arn:aws:s3:::bucket/*",
+				"Condition":{"StringNotEqualsIfExists":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"arn:aws:kms:us-east-1:123456789012:key/other"}}}]}`,
+			denied: true,
+		},
+		{
+			name: "key allowed by a pattern",
+			policy: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:Put*","Resource":"arn:aws:s3:::bucket/*",
+				"Condition":{"StringNotLike":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"arn:aws:kms:us-east-1:123456789012:key/*"}}}]}`,
+		},
+		{
+			name: "other actions denied",
+			policy: `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:DeleteObject","Resource":"arn:aws:s3:::bucket/*",
+				"Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"arn:aws:kms:us-east-1:123456789012:key/other"}}}]}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			denied, err := policyDeniesKMSKey(tt.policy, keyARN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if denied != tt.denied {
+				t.Errorf("expected denied to be %t, got %t", tt.denied, denied)
+			}
+		})
+	}
+}
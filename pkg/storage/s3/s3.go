@@ -3,6 +3,7 @@ package s3
 import (
 	"bytes"
 	"context"
+	goerrors "errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
@@ -29,6 +31,7 @@ import (
 	configapiv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
 	operatorapi "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -40,8 +43,106 @@ import (
 const (
 	imageRegistrySecretMountpoint = "/var/run/secrets/cloud"
 	imageRegistrySecretDataKey    = "credentials"
+
+	// webIdentityTokenFile is the bound service account token projected into
+	// both the operator and the registry pods.
+	webIdentityTokenFile = "/var/run/secrets/openshift/serviceaccount/token"
+
+	// assumeRoleSourceProfile is the profile of the credentials file holding
+	// the credentials assumeRoleARN is assumed with, and
+	// assumeRoleSessionName the name of the sessions of the assumed role.
+	assumeRoleSourceProfile = "assume-role-source"
+	assumeRoleSessionName   = "openshift-image-registry"
+
+	providerAWS = "AWS"
+	providerRGW = "RGW"
+
+	// credentialsSourceSecret, credentialsSourceEnvironment and
+	// credentialsSourceInstanceProfile are the valid values of
+	// credentialsSource, an empty one is the same as Secret.
+	credentialsSourceSecret          = "Secret"
+	credentialsSourceEnvironment     = "Environment"
+	credentialsSourceInstanceProfile = "InstanceProfile"
+
+	// rgwDefaultRegion is used when no region is provided for a Ceph Object
+	// Gateway. RGW ignores it, but the registry and the AWS SDK require one.
+	rgwDefaultRegion = "us-east-1"
+
+	// errCodeEncryptionConfigurationNotFound is returned by
+	// GetBucketEncryption when the bucket has no default encryption.
+	errCodeEncryptionConfigurationNotFound = "ServerSideEncryptionConfigurationNotFoundError"
+
+	// errCodeNoSuchBucketPolicy is returned by GetBucketPolicy when the
+	// bucket has no policy.
+	errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+
+	// sessionExpirationWarning is how long before the expiration of the
+	// session token the StorageCredentialsExpiring condition is set.
+	sessionExpirationWarning = time.Hour
+
+	// minCredentialsRefreshInterval keeps the operator from re-reading the
+	// credentials in a tight loop.
+	minCredentialsRefreshInterval = time.Minute
 )
 
+// kmsKeyIDPattern matches the KMS key identifiers accepted by S3: key IDs,
+// key ARNs, alias names and alias ARNs.
+var kmsKeyIDPattern = regexp.MustCompile(`^(arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:(key/[a-zA-Z0-9-]+|alias/[a-zA-Z0-9/_-]+)|alias/[a-zA-Z0-9/_-]+|(mrk-)?[a-fA-F0-9-]+)$`)
+
+// roleARNPattern matches the ARNs of IAM roles.
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$`)
+
+// externalIDPattern matches the characters of the external IDs accepted by
+// STS, they are 2 to 1224 characters long.
+var externalIDPattern = regexp.MustCompile(`^[A-Za-z0-9+=,.@:/-]+$`)
+
+// defaultProfilePattern matches the header of the default profile of a
+// credentials file.
+var defaultProfilePattern = regexp.MustCompile(`(?m)^[ \t]*\[[ \t]*default[ \t]*\][ \t]*$`)
+
+// checksumAlgorithms are the additional checksum algorithms supported by S3.
+var checksumAlgorithms = []string{"CRC32", "CRC32C", "SHA1", "SHA256"}
+
+// awsManagedKMSKeyAlias is the alias of the KMS key AWS manages for S3, it
+// encrypts the objects when aws:kms encryption is requested without a key.
+const awsManagedKMSKeyAlias = "alias/aws/s3"
+
+// requestPayerRequester is the requestPayer acknowledging the charges of
+// the requests to requester-pays buckets.
+const requestPayerRequester = "Requester"
+
+// multipartPartSizeLimits are the smallest and the largest parts of multipart
+// uploads accepted by the backends. Ceph Object Gateway uses the limits of
+// S3 unless rgw_multipart_min_part_size or rgw_max_put_size are changed.
+var multipartPartSizeLimits = map[string]struct{ min, max int64 }{
+	providerAWS: {min: 5 << 20, max: 5 << 30},
+	providerRGW: {min: 5 << 20, max: 5 << 30},
+}
+
+// fipsRegions are the regions where S3 provides FIPS endpoints. The vendored
+// SDK doesn't know about most of them, so they are resolved here.
+var fipsRegions = map[string]bool{
+	"ca-central-1":  true,
+	"us-east-1":     true,
+	"us-east-2":     true,
+	"us-gov-east-1": true,
+	"us-gov-west-1": true,
+	"us-west-1":     true,
+	"us-west-2":     true,
+}
+
+// fipsEndpoint returns the S3 FIPS endpoint for the region.
+func fipsEndpoint(region string) (string, error) {
+	if !fipsRegions[region] {
+		return "", fmt.Errorf("S3 FIPS endpoints are not available in region %q", region)
+	}
+	dnsSuffix := "amazonaws.com"
+	if partition, ok := regionPartition(region); ok {
+		dnsSuffix = partition.DNSSuffix()
+	}
+	return fmt.Sprintf("https://s3-fips.%s.%s", region, dnsSuffix), nil
+}
+
 type driver struct {
 	Context context.Context
 	Config  *imageregistryv1.ImageRegistryConfigStorageS3
@@ -49,6 +150,9 @@ type driver struct {
 
 	// roundTripper is used only during tests.
 	roundTripper http.RoundTripper
+
+	// roleAssumed is true once the operator assumed assumeRoleARN.
+	roleAssumed bool
 }
 
 // NewDriver creates a new s3 storage driver
@@ -98,11 +202,224 @@ func (d *driver) UpdateEffectiveConfig() (*imageregistryv1.ImageRegistryConfigSt
 		}
 	}
 
+	if len(effectiveConfig.ChecksumAlgorithm) != 0 && !isValidChecksumAlgorithm(effectiveConfig.ChecksumAlgorithm) {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q, valid values are %s", effectiveConfig.ChecksumAlgorithm, strings.Join(checksumAlgorithms, ", "))
+	}
+
+	switch effectiveConfig.EncryptionType {
+	case "", s3.ServerSideEncryptionAwsKms:
+	case s3.ServerSideEncryptionAes256:
+		if len(effectiveConfig.KeyID) != 0 || len(effectiveConfig.KMSKeyID) != 0 {
+			return nil, fmt.Errorf("keyID and kmsKeyID cannot be used when encryptionType is %s", s3.ServerSideEncryptionAes256)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryptionType %q, valid values are %s and %s", effectiveConfig.EncryptionType, s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms)
+	}
+
+	if len(effectiveConfig.RequestPayer) != 0 && effectiveConfig.RequestPayer != requestPayerRequester {
+		return nil, fmt.Errorf("unsupported requestPayer %q, the only valid value is %s", effectiveConfig.RequestPayer, requestPayerRequester)
+	}
+
+	if len(effectiveConfig.KMSKeyID) != 0 && !kmsKeyIDPattern.MatchString(effectiveConfig.KMSKeyID) {
+		return nil, fmt.Errorf("kmsKeyID %q is not a KMS key ID, key ARN, alias name or alias ARN", effectiveConfig.KMSKeyID)
+	}
+
+	switch effectiveConfig.CredentialsSource {
+	case "", credentialsSourceSecret:
+	case credentialsSourceEnvironment, credentialsSourceInstanceProfile:
+		if len(effectiveConfig.RoleARN) != 0 {
+			return nil, fmt.Errorf("roleARN cannot be used when credentialsSource is %s", effectiveConfig.CredentialsSource)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported credentialsSource %q, valid values are %s, %s and %s", effectiveConfig.CredentialsSource, credentialsSourceSecret, credentialsSourceEnvironment, credentialsSourceInstanceProfile)
+	}
+
+	if len(effectiveConfig.RoleARN) != 0 {
+		if !roleARNPattern.MatchString(effectiveConfig.RoleARN) {
+			return nil, fmt.Errorf("roleARN %q is not the ARN of an IAM role", effectiveConfig.RoleARN)
+		}
+		if effectiveConfig.Provider == providerRGW {
+			return nil, fmt.Errorf("roleARN cannot be used when the storage provider is %s", providerRGW)
+		}
+	}
+
+	if len(effectiveConfig.AssumeRoleARN) != 0 {
+		if !roleARNPattern.MatchString(effectiveConfig.AssumeRoleARN) {
+			return nil, fmt.Errorf("assumeRoleARN %q is not the ARN of an IAM role", effectiveConfig.AssumeRoleARN)
+		}
+		if effectiveConfig.Provider == providerRGW {
+			return nil, fmt.Errorf("assumeRoleARN cannot be used when the storage provider is %s", providerRGW)
+		}
+		if externalID := effectiveConfig.AssumeRoleExternalID; len(externalID) != 0 && (len(externalID) < 2 || len(externalID) > 1224 || !externalIDPattern.MatchString(externalID)) {
+			return nil, fmt.Errorf("assumeRoleExternalID must be 2 to 1224 characters among letters, digits and +=,.@:/-")
+		}
+	} else if len(effectiveConfig.AssumeRoleExternalID) != 0 {
+		return nil, fmt.Errorf("assumeRoleExternalID cannot be used without assumeRoleARN")
+	}
+
+	if isInsecure(effectiveConfig) {
+		if effectiveConfig.UseFIPS {
+			return nil, fmt.Errorf("secure cannot be set to false together with useFIPS")
+		}
+		if strings.HasPrefix(strings.ToLower(effectiveConfig.RegionEndpoint), "https://") {
+			return nil, fmt.Errorf("secure cannot be set to false together with the https regionEndpoint %s", effectiveConfig.RegionEndpoint)
+		}
+	}
+
+	if effectiveConfig.UseFIPS {
+		if effectiveConfig.Provider == providerRGW {
+			return nil, fmt.Errorf("useFIPS cannot be used when the storage provider is %s", providerRGW)
+		}
+		endpoint, err := fipsEndpoint(effectiveConfig.Region)
+		if err != nil {
+			return nil, err
+		}
+		// The effective configuration is stored, so the endpoint may
+		// already be the one selected here.
+		if len(effectiveConfig.RegionEndpoint) != 0 && effectiveConfig.RegionEndpoint != endpoint {
+			return nil, fmt.Errorf("useFIPS cannot be used together with regionEndpoint %s", effectiveConfig.RegionEndpoint)
+		}
+		effectiveConfig.RegionEndpoint = endpoint
+		effectiveConfig.VirtualHostedStyle = true
+	}
+
+	if !isRGW(effectiveConfig) {
+		if err := checkPartition(effectiveConfig); err != nil {
+			return nil, err
+		}
+		if len(effectiveConfig.RegionEndpoint) == 0 {
+			if endpoint, ok := partitionEndpoint(effectiveConfig); ok {
+				effectiveConfig.RegionEndpoint = endpoint
+				effectiveConfig.VirtualHostedStyle = true
+			}
+		}
+	}
+
+	if effectiveConfig.IncompleteUploadExpirationDays < 0 {
+		return nil, fmt.Errorf("incompleteUploadExpirationDays must not be negative, got %d", effectiveConfig.IncompleteUploadExpirationDays)
+	}
+	if effectiveConfig.IncompleteUploadExpirationDays != 0 && isRGW(effectiveConfig) {
+		return nil, fmt.Errorf("incompleteUploadExpirationDays cannot be used when the storage provider is %s", providerRGW)
+	}
+
+	if effectiveConfig.PrunedBlobExpiration != nil {
+		if effectiveConfig.PrunedBlobExpiration.ExpirationDays < 1 {
+			return nil, fmt.Errorf("prunedBlobExpiration: expirationDays must be at least 1, got %d", effectiveConfig.PrunedBlobExpiration.ExpirationDays)
+		}
+		if effectiveConfig.ObjectLock != nil {
+			return nil, fmt.Errorf("prunedBlobExpiration cannot be used together with objectLock")
+		}
+		if isRGW(effectiveConfig) {
+			return nil, fmt.Errorf("prunedBlobExpiration cannot be used when the storage provider is %s", providerRGW)
+		}
+	}
+
+	if isRGW(effectiveConfig) {
+		if len(effectiveConfig.RegionEndpoint) == 0 {
+			return nil, fmt.Errorf("regionEndpoint must be set when the storage provider is %s", providerRGW)
+		}
+		if len(effectiveConfig.Region) == 0 {
+			effectiveConfig.Region = rgwDefaultRegion
+		}
+	}
+
 	d.Config = effectiveConfig.DeepCopy()
 
 	return effectiveConfig, nil
 }
 
+func isValidChecksumAlgorithm(algorithm string) bool {
+	for _, a := range checksumAlgorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// isRGW returns true if the storage is provided by a Ceph Object Gateway.
+// The gateway has to be selected explicitly with the provider, any other
+// endpoint is treated as AWS.
+func isRGW(config *imageregistryv1.ImageRegistryConfigStorageS3) bool {
+	return config.Provider == providerRGW
+}
+
+// isInsecure returns true when the S3 endpoint is accessed over http.
+func isInsecure(config *imageregistryv1.ImageRegistryConfigStorageS3) bool {
+	return config.Secure != nil && !*config.Secure
+}
+
+// checkInsecureCABundle rejects the custom CA bundle of the cloud config when
+// the S3 endpoint is accessed over http, it would silently not be used.
+func checkInsecureCABundle(config *imageregistryv1.ImageRegistryConfigStorageS3, caBundle string) error {
+	if isInsecure(config) && caBundle != "" {
+		return fmt.Errorf("secure cannot be set to false when the cloud config provides a custom CA bundle, the S3 endpoint is expected to serve TLS")
+	}
+	return nil
+}
+
+// checkSecure sets the StorageInsecure condition, and warns when the bucket
+// starts being accessed over http.
+func (d *driver) checkSecure(cr *imageregistryv1.Config) {
+	if !isInsecure(d.Config) {
+		util.UpdateCondition(cr, defaults.StorageInsecure, operatorapi.ConditionFalse, "Secure Scheme", "")
+		return
+	}
+	alreadyInsecure := false
+	for _, c := range cr.Status.Conditions {
+		if c.Type == defaults.StorageInsecure && c.Status == operatorapi.ConditionTrue {
+			alreadyInsecure = true
+		}
+	}
+	if !alreadyInsecure {
+		klog.Warningf("the S3 bucket %s is accessed over http, the images and the signed requests are sent unencrypted; an endpoint serving TLS is recommended", d.Config.Bucket)
+	}
+	util.UpdateCondition(cr, defaults.StorageInsecure, operatorapi.ConditionTrue, "Insecure Scheme", "The bucket is accessed over http, the images and the signed requests are sent unencrypted; an endpoint serving TLS is recommended")
+}
+
+// CredentialsRefreshInterval returns how often the credentials of the storage
+// should be re-read, zero means they are only re-read on changes.
+func CredentialsRefreshInterval(config *imageregistryv1.ImageRegistryConfigStorageS3) (time.Duration, error) {
+	interval := config.CredentialsRefreshInterval.Duration
+	if interval != 0 && interval < minCredentialsRefreshInterval {
+		return 0, fmt.Errorf("credentialsRefreshInterval: must be at least %s, got %s", minCredentialsRefreshInterval, interval)
+	}
+	return interval, nil
+}
+
+// multipartPartSize returns the size of the parts of the multipart uploads of
+// the registry clamped to the limits of the backend, and whether the
+// configured size had to be clamped. Zero means the registry default.
+func multipartPartSize(config *imageregistryv1.ImageRegistryConfigStorageS3) (int64, bool) {
+	if config.MultipartPartSize <= 0 {
+		return 0, false
+	}
+
+	provider := providerAWS
+	if isRGW(config) {
+		provider = providerRGW
+	}
+	limits := multipartPartSizeLimits[provider]
+
+	switch {
+	case config.MultipartPartSize < limits.min:
+		return limits.min, true
+	case config.MultipartPartSize > limits.max:
+		return limits.max, true
+	}
+	return config.MultipartPartSize, false
+}
+
+// checkMultipartPartSize sets the StorageMultipartPartSizeClamped condition.
+func (d *driver) checkMultipartPartSize(cr *imageregistryv1.Config) {
+	size, clamped := multipartPartSize(d.Config)
+	if clamped {
+		util.UpdateCondition(cr, defaults.StorageMultipartPartSizeClamped, operatorapi.ConditionTrue, "Part Size Out Of Limits", fmt.Sprintf("The multipart part size %d is not supported by the storage backend, %d is used", d.Config.MultipartPartSize, size))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageMultipartPartSizeClamped, operatorapi.ConditionFalse, "Part Size Within Limits", "")
+}
+
 // GetCredentialsFile will create and return the location of an AWS config file that can
 // be used to create AWS clients with. Caller is responsible for cleaning up the file.
 // sharedCredentialsFile, err := d.GetCredentialsFile()
@@ -124,38 +441,147 @@ func (d *driver) GetCredentialsFile() (string, error) {
 	return saveSharedCredentialsFile(data)
 }
 
-func (d *driver) getCredentialsConfigData() ([]byte, error) {
+// credentialsSecret returns the secret the AWS credentials are read from and
+// whether it is the one provided by the user.
+func (d *driver) credentialsSecret() (*corev1.Secret, bool, error) {
 	// Look for a user defined secret to get the AWS credentials from first
 	sec, err := d.Listers.Secrets.Get(defaults.ImageRegistryPrivateConfigurationUser)
 	if err != nil && errors.IsNotFound(err) {
 		// Fall back to those provided by the credential minter if nothing is provided by the user
 		sec, err = d.Listers.Secrets.Get(defaults.CloudCredentialsName)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get cluster minted credentials %q: %v", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.CloudCredentialsName), err)
+			return nil, false, fmt.Errorf("unable to get cluster minted credentials %q: %v", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.CloudCredentialsName), err)
+		}
+		return sec, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return sec, true, nil
+}
+
+func (d *driver) getCredentialsConfigData() ([]byte, error) {
+	data, err := d.getSourceCredentialsConfigData()
+	if err != nil {
+		return nil, err
+	}
+	if d.Config != nil && len(d.Config.AssumeRoleARN) != 0 {
+		return sharedCredentialsDataWithAssumeRole(data, d.Config.AssumeRoleARN, d.Config.AssumeRoleExternalID)
+	}
+	return data, nil
+}
+
+// credentialsSource returns the valid credentialsSource of the driver
+// configuration, Secret when it's not set.
+func (d *driver) credentialsSource() string {
+	if d.Config == nil || len(d.Config.CredentialsSource) == 0 {
+		return credentialsSourceSecret
+	}
+	return d.Config.CredentialsSource
+}
+
+// getSourceCredentialsConfigData returns the credentials file with the
+// credentials of the operator and the registry, assumeRoleARN aside.
+func (d *driver) getSourceCredentialsConfigData() ([]byte, error) {
+	switch d.credentialsSource() {
+	case credentialsSourceEnvironment:
+		// The registry pods don't get the environment of the operator, so
+		// the credentials are passed through the credentials file.
+		accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if len(accessKey) == 0 || len(secretKey) == 0 {
+			return nil, fmt.Errorf("credentialsSource is %s, but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set in the environment of the operator", credentialsSourceEnvironment)
 		}
+		return sharedCredentialsDataFromStaticCreds(accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN")), nil
+	case credentialsSourceInstanceProfile:
+		// A profile without credentials makes the SDK fall back to the
+		// instance metadata.
+		return []byte("[default]\n"), nil
+	}
+
+	// The role is assumed with the service account token, no secret is
+	// needed.
+	if d.Config != nil && len(d.Config.RoleARN) != 0 {
+		return sharedCredentialsDataFromWebIdentity(d.Config.RoleARN, webIdentityTokenFile), nil
+	}
 
+	sec, user, err := d.credentialsSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if !user {
 		data, err := sharedCredentialsDataFromSecret(sec)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate shared secrets data: %v", err)
 		}
 		return data, nil
-	} else if err != nil {
-		return nil, err
+	}
+
+	var accessKey, secretKey string
+	if v, ok := sec.Data["REGISTRY_STORAGE_S3_ACCESSKEY"]; ok {
+		accessKey = string(v)
 	} else {
-		var accessKey, secretKey string
-		if v, ok := sec.Data["REGISTRY_STORAGE_S3_ACCESSKEY"]; ok {
-			accessKey = string(v)
-		} else {
-			return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_ACCESSKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
-		}
-		if v, ok := sec.Data["REGISTRY_STORAGE_S3_SECRETKEY"]; ok {
-			secretKey = string(v)
-		} else {
-			return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_SECRETKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
-		}
+		return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_ACCESSKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
+	}
+	if v, ok := sec.Data["REGISTRY_STORAGE_S3_SECRETKEY"]; ok {
+		secretKey = string(v)
+	} else {
+		return nil, fmt.Errorf("secret %q does not contain required key \"REGISTRY_STORAGE_S3_SECRETKEY\"", fmt.Sprintf("%s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser))
+	}
+	sessionToken := string(sec.Data["REGISTRY_STORAGE_S3_SESSIONTOKEN"])
+
+	return sharedCredentialsDataFromStaticCreds(accessKey, secretKey, sessionToken), nil
+}
 
-		return sharedCredentialsDataFromStaticCreds(accessKey, secretKey), nil
+// sessionExpiration returns when the session token of temporary credentials
+// expires. The zero time is returned when the expiration is unknown, e.g.
+// for static credentials.
+func (d *driver) sessionExpiration() (time.Time, error) {
+	// Web identity and instance profile credentials are renewed by the SDK,
+	// the expiration of the environment isn't known.
+	if d.Config != nil && len(d.Config.RoleARN) != 0 || d.credentialsSource() != credentialsSourceSecret {
+		return time.Time{}, nil
 	}
+
+	sec, user, err := d.credentialsSecret()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	key := "aws_session_expiration"
+	if user {
+		key = "REGISTRY_STORAGE_S3_SESSIONEXPIRATION"
+	}
+	v := strings.TrimSpace(string(sec.Data[key]))
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+
+	expiration, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse the key %q of the secret %s/%s: %v", key, sec.Namespace, sec.Name, err)
+	}
+	return expiration, nil
+}
+
+// checkCredentialsExpiration sets the StorageCredentialsExpiring condition.
+// The secret is read again on every sync and the registry is rolled out when
+// its data changes, so renewing the token in the secret is enough.
+func (d *driver) checkCredentialsExpiration(cr *imageregistryv1.Config) {
+	expiration, err := d.sessionExpiration()
+	if err != nil {
+		util.UpdateCondition(cr, defaults.StorageCredentialsExpiring, operatorapi.ConditionUnknown, "Unknown Expiration", err.Error())
+		return
+	}
+	if expiration.IsZero() {
+		util.UpdateCondition(cr, defaults.StorageCredentialsExpiring, operatorapi.ConditionFalse, "No Expiration", "")
+		return
+	}
+
+	if time.Until(expiration) < sessionExpirationWarning {
+		util.UpdateCondition(cr, defaults.StorageCredentialsExpiring, operatorapi.ConditionTrue, "Session Token Expiring", fmt.Sprintf("The session token of the storage credentials expires at %s, the credentials secret needs to be updated", expiration.Format(time.RFC3339)))
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageCredentialsExpiring, operatorapi.ConditionFalse, "Session Token Valid", fmt.Sprintf("The session token of the storage credentials expires at %s", expiration.Format(time.RFC3339)))
 }
 
 // getCABundle gets the custom CA bundle for trusting communication with the AWS API
@@ -179,6 +605,15 @@ func (d *driver) getCABundle() (string, error) {
 // getS3Service returns a client that allows us to interact
 // with the aws S3 service
 func (d *driver) getS3Service() (*s3.S3, error) {
+	sess, err := d.getSession()
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// getSession returns the AWS session of the clients of the bucket.
+func (d *driver) getSession() (*session.Session, error) {
 	credentialsFilename, err := d.GetCredentialsFile()
 	if err != nil {
 		return nil, err
@@ -215,13 +650,18 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		},
 		SharedConfigState: session.SharedConfigEnable,
 		SharedConfigFiles: []string{credentialsFilename},
+		// Without an explicit profile the SDK prefers the credentials
+		// from the environment over the credentials file, the registry
+		// only has the file.
+		Profile: "default",
 	}
 
 	if d.roundTripper != nil {
 		awsOptions.Config.HTTPClient.Transport = d.roundTripper
 	}
 
-	awsOptions.Config.WithUseDualStack(true)
+	awsOptions.Config.WithUseDualStack(!isRGW(d.Config))
+	awsOptions.Config.WithDisableSSL(isInsecure(d.Config))
 	if d.Config.RegionEndpoint != "" {
 		if !d.Config.VirtualHostedStyle {
 			awsOptions.Config.WithS3ForcePathStyle(true)
@@ -229,10 +669,14 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		awsOptions.Config.WithEndpoint(d.Config.RegionEndpoint)
 	}
 
-	switch caBundle, err := d.getCABundle(); {
-	case err != nil:
+	caBundle, err := d.getCABundle()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInsecureCABundle(d.Config, caBundle); err != nil {
 		return nil, err
-	case caBundle != "":
+	}
+	if caBundle != "" {
 		awsOptions.CustomCABundle = strings.NewReader(caBundle)
 	}
 
@@ -244,8 +688,67 @@ func (d *driver) getS3Service() (*s3.S3, error) {
 		Name: "openshift.io/cluster-image-registry-operator",
 		Fn:   request.MakeAddToUserAgentHandler("openshift.io cluster-image-registry-operator", version.Version),
 	})
+	// Requester-pays buckets reject the requests that don't acknowledge
+	// the charges, the header is signed with the request.
+	if d.Config.RequestPayer == requestPayerRequester {
+		sess.Handlers.Build.PushBackNamed(request.NamedHandler{
+			Name: "openshift.io/request-payer",
+			Fn: func(r *request.Request) {
+				r.HTTPRequest.Header.Set("X-Amz-Request-Payer", s3.RequestPayerRequester)
+			},
+		})
+	}
 
-	return s3.New(sess), nil
+	// The role is assumed before the first request to the bucket so that
+	// STS errors aren't mistaken for S3 ones.
+	if len(d.Config.AssumeRoleARN) != 0 {
+		if _, err := sess.Config.Credentials.GetWithContext(d.Context); err != nil {
+			return nil, &assumeRoleError{roleARN: d.Config.AssumeRoleARN, err: err}
+		}
+		d.roleAssumed = true
+	}
+
+	return sess, nil
+}
+
+// assumeRoleError is returned when the operator can't assume assumeRoleARN.
+type assumeRoleError struct {
+	roleARN string
+	err     error
+}
+
+func (e *assumeRoleError) Error() string {
+	return fmt.Sprintf("unable to assume the role %s: %v", e.roleARN, e.err)
+}
+
+func (e *assumeRoleError) Unwrap() error {
+	return e.err
+}
+
+// checkAssumeRole sets the StorageRoleAssumed condition when the bucket is
+// accessed through assumeRoleARN, err is the error of the last access.
+func (d *driver) checkAssumeRole(cr *imageregistryv1.Config, err error) {
+	if d.Config == nil || len(d.Config.AssumeRoleARN) == 0 {
+		return
+	}
+	var assumeErr *assumeRoleError
+	if goerrors.As(err, &assumeErr) {
+		util.UpdateCondition(cr, defaults.StorageRoleAssumed, operatorapi.ConditionFalse, "Assume Role Failed", assumeErr.Error())
+		return
+	}
+	if d.roleAssumed {
+		util.UpdateCondition(cr, defaults.StorageRoleAssumed, operatorapi.ConditionTrue, "Role Assumed", fmt.Sprintf("The role %s is assumed to access the bucket", d.Config.AssumeRoleARN))
+	}
+}
+
+// isCloudAPIUnavailable returns true when S3 responded with a server error,
+// throttling aside.
+func isCloudAPIUnavailable(err error) bool {
+	var reqErr awserr.RequestFailure
+	if !goerrors.As(err, &reqErr) {
+		return false
+	}
+	return reqErr.StatusCode() >= http.StatusInternalServerError && reqErr.Code() != "SlowDown"
 }
 
 func isBucketNotFound(err interface{}) bool {
@@ -281,21 +784,57 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		return
 	}
 
+	if _, err = CredentialsRefreshInterval(d.Config); err != nil {
+		return
+	}
+
 	if len(d.Config.RegionEndpoint) != 0 {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGIONENDPOINT", Value: d.Config.RegionEndpoint})
 	}
 
-	if len(d.Config.KeyID) != 0 {
+	if isInsecure(d.Config) {
+		caBundle, err := d.getCABundle()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkInsecureCABundle(d.Config, caBundle); err != nil {
+			return nil, err
+		}
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_SECURE", Value: false})
+	}
+
+	// The registry passes its key with every object it writes, keyID is
+	// only used for it when no key is set for the objects.
+	if len(d.Config.KMSKeyID) != 0 {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_KEYID", Value: d.Config.KMSKeyID})
+	} else if len(d.Config.KeyID) != 0 {
 		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_KEYID", Value: d.Config.KeyID})
+	} else if d.Config.EncryptionType == s3.ServerSideEncryptionAwsKms {
+		// Without a key the registry would fall back to AES256.
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_KEYID", Value: awsManagedKMSKeyAlias})
+	}
+
+	// The checksum algorithm only applies to the objects written by the
+	// registry, the SDK used by the operator to manage the bucket doesn't
+	// support additional checksums and keeps relying on Content-MD5.
+	if len(d.Config.ChecksumAlgorithm) != 0 {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_CHECKSUMALGORITHM", Value: d.Config.ChecksumAlgorithm})
+	}
+
+	// The S3 driver of the registry can't acknowledge the charges of
+	// requester-pays buckets, only the operator sends the header.
+
+	if size, _ := multipartPartSize(d.Config); size != 0 {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_CHUNKSIZE", Value: size})
 	}
 
 	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "s3"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_BUCKET", Value: d.Config.Bucket},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_REGION", Value: d.Config.Region},
-		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_ENCRYPT", Value: d.Config.Encrypt},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_ENCRYPT", Value: d.Config.Encrypt || len(d.Config.EncryptionType) != 0},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE", Value: d.Config.VirtualHostedStyle},
-		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_USEDUALSTACK", Value: true},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_USEDUALSTACK", Value: !isRGW(d.Config)},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_S3_CREDENTIALSCONFIGPATH", Value: filepath.Join(imageRegistrySecretMountpoint, imageRegistrySecretDataKey)},
 	)
 
@@ -396,13 +935,73 @@ func (d *driver) bucketExists(bucketName string) error {
 	return err
 }
 
-// StorageExists checks if an S3 bucket with the given name exists
-// and we can access it
+// StorageUsage returns the size of the bucket reported by the daily
+// BucketSizeBytes metric of CloudWatch, which only counts the objects of the
+// STANDARD storage class. Buckets have no fixed capacity.
+func (d *driver) StorageUsage() (int64, int64, error) {
+	sess, err := d.getSession()
+	if err != nil {
+		return 0, 0, err
+	}
+	if isRGW(d.Config) {
+		return 0, 0, util.ErrStorageUsageNotSupported
+	}
+
+	// CloudWatch computes the size of the buckets once a day, two days
+	// are requested to get at least one datapoint.
+	end := time.Now()
+	start := end.Add(-48 * time.Hour)
+	output, err := newCloudWatch(sess).getMetricStatistics(d.Context, &getMetricStatisticsInput{
+		Namespace:  aws.String("AWS/S3"),
+		MetricName: aws.String("BucketSizeBytes"),
+		Dimensions: []*dimension{
+			{Name: aws.String("BucketName"), Value: aws.String(d.Config.Bucket)},
+			{Name: aws.String("StorageType"), Value: aws.String("StandardStorage")},
+		},
+		StartTime:  &start,
+		EndTime:    &end,
+		Period:     aws.Int64(24 * 60 * 60),
+		Statistics: []*string{aws.String("Average")},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get the size of the bucket %s: %w", d.Config.Bucket, err)
+	}
+
+	var latest *datapoint
+	for _, dp := range output.Datapoints {
+		if dp.Timestamp != nil && dp.Average != nil && (latest == nil || dp.Timestamp.After(*latest.Timestamp)) {
+			latest = dp
+		}
+	}
+	if latest == nil {
+		// New and empty buckets have no datapoints.
+		return 0, -1, nil
+	}
+
+	return int64(*latest.Average), -1, nil
+}
+
+// StorageExists checks whether the storage exists and is accessible, and
+// reports through the CloudAPIUnavailable condition whether S3
+// answered.
 func (d *driver) StorageExists(cr *imageregistryv1.Config) (bool, error) {
+	exists, err := d.storageExists(cr)
+	d.checkAssumeRole(cr, err)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return exists, err
+}
+
+// storageExists checks if an S3 bucket with the given name exists
+// and we can access it
+func (d *driver) storageExists(cr *imageregistryv1.Config) (bool, error) {
 	if len(d.Config.Bucket) == 0 {
 		return false, nil
 	}
 
+	d.checkCredentialsExpiration(cr)
+	d.checkMultipartPartSize(cr)
+	d.checkSecure(cr)
+
 	err := d.bucketExists(d.Config.Bucket)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
@@ -432,14 +1031,25 @@ func (d *driver) StorageChanged(cr *imageregistryv1.Config) bool {
 	return false
 }
 
-// CreateStorage attempts to create an s3 bucket
-// and apply any provided tags
+// CreateStorage provisions the storage, and reports through the
+// CloudAPIUnavailable condition whether S3 answered.
 func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
+	err := d.createStorage(cr)
+	d.checkAssumeRole(cr, err)
+	util.UpdateCloudAPICondition(cr, err, isCloudAPIUnavailable)
+	return err
+}
+
+// createStorage attempts to create an s3 bucket
+// and apply any provided tags
+func (d *driver) createStorage(cr *imageregistryv1.Config) error {
 	svc, err := d.getS3Service()
 	if err != nil {
 		return err
 	}
 
+	d.checkCredentialsExpiration(cr)
+
 	infra, err := util.GetInfrastructure(d.Listers)
 	if err != nil {
 		return err
@@ -449,6 +1059,9 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	d.checkMultipartPartSize(cr)
+	d.checkSecure(cr)
+
 	// If a bucket name is supplied, and it already exists and we can access it
 	// just update the config
 	var bucketExists bool
@@ -497,9 +1110,14 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 				generatedName = true
 			}
 
-			_, err := svc.CreateBucketWithContext(d.Context, &s3.CreateBucketInput{
+			input := &s3.CreateBucketInput{
 				Bucket: aws.String(d.Config.Bucket),
-			})
+			}
+			// Object lock can only be enabled when the bucket is created.
+			if d.Config.ObjectLock != nil {
+				input.ObjectLockEnabledForBucket = aws.Bool(true)
+			}
+			_, err := svc.CreateBucketWithContext(d.Context, input)
 			if err != nil {
 				if aerr, ok := err.(awserr.Error); ok {
 					switch aerr.Code() {
@@ -512,7 +1130,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 						continue
 					default:
 						util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
-						return err
+						return util.NewProvisioningError("BucketCreationFailed", err)
 					}
 				}
 			}
@@ -545,8 +1163,15 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		return err
 	}
 
+	// Ceph Object Gateway doesn't implement the AWS specific APIs used below,
+	// so we only provision the bucket.
+	rgw := isRGW(d.Config)
+	if rgw && cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+		klog.Info("storage is provided by Ceph Object Gateway, skipping public access block, tagging, encryption and lifecycle configuration")
+	}
+
 	// Block public access to the s3 bucket and its objects by default
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged && !rgw {
 		_, err := svc.PutPublicAccessBlockWithContext(d.Context, &s3.PutPublicAccessBlockInput{
 			Bucket: aws.String(d.Config.Bucket),
 			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
@@ -574,7 +1199,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 
 	// Tag the bucket with the openshiftClusterID
 	// along with any user defined tags from the cluster configuration
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged && !rgw {
 		klog.Info("setting aws bucket tags")
 
 		tagset := []*s3.Tag{
@@ -618,27 +1243,14 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		} else {
 			util.UpdateCondition(cr, defaults.StorageTagged, operatorapi.ConditionTrue, "Tagging Successful", "Tags were successfully applied to the S3 bucket")
 		}
-	} else {
+	} else if !rgw {
 		klog.Info("ignoring bucket tags, storage is not managed")
 	}
 
 	// Enable default encryption on the bucket
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
-		var encryption *s3.ServerSideEncryptionByDefault
-		var encryptionType string
-
-		if len(d.Config.KeyID) != 0 {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm:   aws.String(s3.ServerSideEncryptionAwsKms),
-				KMSMasterKeyID: aws.String(d.Config.KeyID),
-			}
-			encryptionType = s3.ServerSideEncryptionAwsKms
-		} else {
-			encryption = &s3.ServerSideEncryptionByDefault{
-				SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
-			}
-			encryptionType = s3.ServerSideEncryptionAes256
-		}
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged && !rgw {
+		encryption := bucketEncryption(d.Config)
+		encryptionType := aws.StringValue(encryption.SSEAlgorithm)
 
 		_, err = svc.PutBucketEncryptionWithContext(d.Context, &s3.PutBucketEncryptionInput{
 			Bucket: aws.String(d.Config.Bucket),
@@ -665,6 +1277,7 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 			cr.Spec.Storage.S3 = d.Config.DeepCopy()
 		}
 	} else {
+		d.checkBucketEncryption(cr, svc, rgw)
 		if !reflect.DeepEqual(cr.Status.Storage.S3, d.Config) {
 			cr.Status.Storage = imageregistryv1.ImageRegistryConfigStorage{
 				S3: d.Config.DeepCopy(),
@@ -672,39 +1285,300 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		}
 	}
 
-	// Enable default incomplete multipart upload cleanup after one (1) day
-	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged {
+	if len(d.Config.KMSKeyID) != 0 && !rgw {
+		if err := d.checkBucketPolicyKMSKey(cr, svc); err != nil {
+			return err
+		}
+	}
+
+	// Enable incomplete multipart upload cleanup, after one (1) day by
+	// default
+	if cr.Spec.Storage.ManagementState == imageregistryv1.StorageManagementStateManaged && !rgw {
+		rules := []*s3.LifecycleRule{
+			{
+				ID:     aws.String("cleanup-incomplete-multipart-registry-uploads"),
+				Status: aws.String("Enabled"),
+				Filter: &s3.LifecycleRuleFilter{
+					Prefix: aws.String(""),
+				},
+				AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+					DaysAfterInitiation: aws.Int64(incompleteUploadExpirationDays(d.Config)),
+				},
+			},
+		}
+		if d.Config.PrunedBlobExpiration != nil {
+			rules = append(rules, prunedBlobExpirationRule(d.Config.PrunedBlobExpiration))
+		}
+
 		_, err = svc.PutBucketLifecycleConfigurationWithContext(d.Context, &s3.PutBucketLifecycleConfigurationInput{
 			Bucket: aws.String(d.Config.Bucket),
 			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
-				Rules: []*s3.LifecycleRule{
-					{
-						ID:     aws.String("cleanup-incomplete-multipart-registry-uploads"),
-						Status: aws.String("Enabled"),
-						Filter: &s3.LifecycleRuleFilter{
-							Prefix: aws.String(""),
-						},
-						AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
-							DaysAfterInitiation: aws.Int64(1),
-						},
-					},
-				},
+				Rules: rules,
 			},
 		})
 		if err != nil {
 			if aerr, ok := err.(awserr.Error); ok {
 				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+				if d.Config.PrunedBlobExpiration != nil {
+					util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+				}
 			} else {
 				util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+				if d.Config.PrunedBlobExpiration != nil {
+					util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+				}
 			}
 		} else {
-			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled")
+			util.UpdateCondition(cr, defaults.StorageIncompleteUploadCleanupEnabled, operatorapi.ConditionTrue, "Enable Cleanup Successful", incompleteUploadCleanupMessage(d.Config))
+			if d.Config.PrunedBlobExpiration != nil {
+				util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionTrue, "Expiration Enabled", prunedBlobExpirationMessage(int64(d.Config.PrunedBlobExpiration.ExpirationDays)))
+			}
 		}
+	} else if d.Config.PrunedBlobExpiration != nil {
+		d.checkPrunedBlobExpiration(cr, svc)
+	}
+	if d.Config.PrunedBlobExpiration == nil {
+		v1helpers.RemoveOperatorCondition(&cr.Status.Conditions, defaults.StoragePrunedBlobExpirationEnabled)
+	}
+
+	if d.Config.ObjectLock != nil {
+		d.configureObjectLock(cr, svc)
 	}
 
 	return nil
 }
 
+const (
+	// prunedBlobTagKey and prunedBlobTagValue are the tag of the objects
+	// expired by the lifecycle rule when prunedBlobExpiration is set. The
+	// registry doesn't set it, the objects have to be tagged by the
+	// administrator.
+	prunedBlobTagKey   = "image-registry.openshift.io/pruned"
+	prunedBlobTagValue = "true"
+
+	// prunedBlobExpirationRuleID is the ID of the lifecycle rule expiring the
+	// tagged blobs.
+	prunedBlobExpirationRuleID = "expire-pruned-registry-blobs"
+)
+
+// prunedBlobExpirationRule returns the lifecycle rule expiring the tagged
+// objects.
+func prunedBlobExpirationRule(config *imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration) *s3.LifecycleRule {
+	return &s3.LifecycleRule{
+		ID:     aws.String(prunedBlobExpirationRuleID),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{
+			Tag: &s3.Tag{
+				Key:   aws.String(prunedBlobTagKey),
+				Value: aws.String(prunedBlobTagValue),
+			},
+		},
+		Expiration: &s3.LifecycleExpiration{
+			Days: aws.Int64(int64(config.ExpirationDays)),
+		},
+	}
+}
+
+// incompleteUploadExpirationDays returns the number of days after which the
+// lifecycle rule of the bucket aborts the incomplete multipart uploads.
+func incompleteUploadExpirationDays(config *imageregistryv1.ImageRegistryConfigStorageS3) int64 {
+	if config.IncompleteUploadExpirationDays > 0 {
+		return int64(config.IncompleteUploadExpirationDays)
+	}
+	return 1
+}
+
+// incompleteUploadCleanupMessage describes how the incomplete multipart
+// uploads are aborted.
+func incompleteUploadCleanupMessage(config *imageregistryv1.ImageRegistryConfigStorageS3) string {
+	message := "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled"
+	if days := incompleteUploadExpirationDays(config); days != 1 {
+		message = fmt.Sprintf("Cleanup of incomplete multipart uploads after %d days was successfully enabled", days)
+	}
+	return message
+}
+
+// prunedBlobExpirationMessage describes when the tagged objects are removed
+// from the bucket.
+func prunedBlobExpirationMessage(days int64) string {
+	return fmt.Sprintf("The objects tagged with %s=%s expire after %d days", prunedBlobTagKey, prunedBlobTagValue, days)
+}
+
+// checkPrunedBlobExpiration reports through the
+// StoragePrunedBlobExpirationEnabled condition whether a bucket the operator
+// doesn't configure has a lifecycle rule expiring the tagged objects.
+func (d *driver) checkPrunedBlobExpiration(cr *imageregistryv1.Config, svc *s3.S3) {
+	out, err := svc.GetBucketLifecycleConfigurationWithContext(d.Context, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() != "NoSuchLifecycleConfiguration" {
+		util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionUnknown, aerr.Code(), aerr.Error())
+		return
+	} else if err != nil && !ok {
+		util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		return
+	}
+	if out != nil {
+		for _, rule := range out.Rules {
+			if aws.StringValue(rule.Status) != "Enabled" || rule.Filter == nil || rule.Filter.Tag == nil || rule.Expiration == nil || rule.Expiration.Days == nil {
+				continue
+			}
+			if aws.StringValue(rule.Filter.Tag.Key) == prunedBlobTagKey && aws.StringValue(rule.Filter.Tag.Value) == prunedBlobTagValue {
+				util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionTrue, "Expiration Enabled", prunedBlobExpirationMessage(aws.Int64Value(rule.Expiration.Days)))
+				return
+			}
+		}
+	}
+	util.UpdateCondition(cr, defaults.StoragePrunedBlobExpirationEnabled, operatorapi.ConditionFalse, "Expiration Not Enabled", fmt.Sprintf("The S3 bucket has no lifecycle rule expiring the objects tagged with %s=%s, the tagged objects are never removed", prunedBlobTagKey, prunedBlobTagValue))
+}
+
+// objectLockNotEnabled is reported when object lock is requested for a bucket
+// that was created without it.
+const objectLockNotEnabled = "Object lock is not enabled on the S3 bucket, it can only be enabled when the bucket is created"
+
+// objectLockMessage describes the retention of the objects and what it
+// implies for the registry.
+func objectLockMessage(mode string, days int64) string {
+	return fmt.Sprintf("Objects written to the S3 bucket are retained for %d days in %s mode; the registry doesn't delete blobs, the image pruner only prunes image objects and the bucket can't be removed before the retention of its objects ends", days, mode)
+}
+
+// configureObjectLock sets the default retention of a managed bucket, or
+// verifies that object lock is enabled on an unmanaged one, and reports the
+// result through the StorageObjectLocked condition.
+func (d *driver) configureObjectLock(cr *imageregistryv1.Config, svc *s3.S3) {
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		out, err := svc.GetObjectLockConfigurationWithContext(d.Context, &s3.GetObjectLockConfigurationInput{
+			Bucket: aws.String(d.Config.Bucket),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ObjectLockConfigurationNotFoundError" {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionFalse, "Object Lock Not Enabled", objectLockNotEnabled)
+			return
+		} else if err != nil {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+			return
+		}
+		config := out.ObjectLockConfiguration
+		if config == nil || aws.StringValue(config.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionFalse, "Object Lock Not Enabled", objectLockNotEnabled)
+			return
+		}
+		if config.Rule == nil || config.Rule.DefaultRetention == nil {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionTrue, "Object Lock Enabled", "Object lock is enabled on the S3 bucket without a default retention")
+			return
+		}
+		retention := config.Rule.DefaultRetention
+		util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionTrue, "Object Lock Enabled", objectLockMessage(aws.StringValue(retention.Mode), aws.Int64Value(retention.Days)))
+		return
+	}
+
+	mode := strings.ToUpper(d.Config.ObjectLock.Mode)
+	_, err := svc.PutObjectLockConfigurationWithContext(d.Context, &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(d.Config.Bucket),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			Rule: &s3.ObjectLockRule{
+				DefaultRetention: &s3.DefaultRetention{
+					Mode: aws.String(mode),
+					Days: aws.Int64(int64(d.Config.ObjectLock.RetentionDays)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidBucketState" {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionFalse, "Object Lock Not Enabled", objectLockNotEnabled)
+		} else if ok {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionFalse, aerr.Code(), aerr.Error())
+		} else {
+			util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionFalse, "Unknown Error Occurred", err.Error())
+		}
+		return
+	}
+	util.UpdateCondition(cr, defaults.StorageObjectLocked, operatorapi.ConditionTrue, "Object Lock Enabled", objectLockMessage(mode, int64(d.Config.ObjectLock.RetentionDays)))
+}
+
+// bucketEncryption returns the default encryption of the bucket. An aws:kms
+// encryption without keyID leaves the key unset, S3 then uses the AWS
+// managed aws/s3 key.
+func bucketEncryption(config *imageregistryv1.ImageRegistryConfigStorageS3) *s3.ServerSideEncryptionByDefault {
+	encryptionType := config.EncryptionType
+	if len(encryptionType) == 0 {
+		encryptionType = s3.ServerSideEncryptionAes256
+		if len(config.KeyID) != 0 {
+			encryptionType = s3.ServerSideEncryptionAwsKms
+		}
+	}
+
+	encryption := &s3.ServerSideEncryptionByDefault{
+		SSEAlgorithm: aws.String(encryptionType),
+	}
+	if encryptionType == s3.ServerSideEncryptionAwsKms && len(config.KeyID) != 0 {
+		encryption.KMSMasterKeyID = aws.String(config.KeyID)
+	}
+	return encryption
+}
+
+// checkBucketEncryption reports through the StorageEncrypted condition
+// whether default encryption is enabled on a bucket the operator doesn't
+// configure.
+func (d *driver) checkBucketEncryption(cr *imageregistryv1.Config, svc *s3.S3, rgw bool) {
+	if rgw {
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", "Unable to determine whether buckets provided by Ceph Object Gateway are encrypted")
+		return
+	}
+
+	out, err := svc.GetBucketEncryptionWithContext(d.Context, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeEncryptionConfigurationNotFound {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Encryption Not Enabled", "Default encryption is not enabled on the S3 bucket")
+		} else {
+			util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Unknown Error Occurred", err.Error())
+		}
+		return
+	}
+
+	if out.ServerSideEncryptionConfiguration != nil {
+		for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+			if rule.ApplyServerSideEncryptionByDefault != nil {
+				util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionTrue, "Encryption Enabled", fmt.Sprintf("Default %s encryption is enabled on the S3 bucket", aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)))
+				return
+			}
+		}
+	}
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "Encryption Not Enabled", "Default encryption is not enabled on the S3 bucket")
+}
+
+// checkBucketPolicyKMSKey makes sure the bucket policy doesn't deny the
+// uploads encrypted with kmsKeyID, the registry wouldn't be able to push
+// anything otherwise. A policy that can't be read doesn't block the
+// registry, it only leaves a warning in the logs.
+func (d *driver) checkBucketPolicyKMSKey(cr *imageregistryv1.Config, svc *s3.S3) error {
+	out, err := svc.GetBucketPolicyWithContext(d.Context, &s3.GetBucketPolicyInput{
+		Bucket: aws.String(d.Config.Bucket),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeNoSuchBucketPolicy {
+			return nil
+		}
+		klog.Warningf("unable to check that the policy of the bucket %s allows the KMS key %s: %s", d.Config.Bucket, d.Config.KMSKeyID, err)
+		return nil
+	}
+
+	denied, err := policyDeniesKMSKey(aws.StringValue(out.Policy), d.Config.KMSKeyID)
+	if err != nil {
+		klog.Warningf("unable to parse the policy of the bucket %s: %s", d.Config.Bucket, err)
+		return nil
+	}
+	if denied {
+		err := fmt.Errorf("the policy of the bucket %s denies uploads encrypted with the KMS key %s", d.Config.Bucket, d.Config.KMSKeyID)
+		util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionFalse, "KMS Key Denied", err.Error())
+		return err
+	}
+	return nil
+}
+
 // RemoveStorage deletes the storage medium that we created
 // The s3 bucket must be empty before it can be removed
 func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
@@ -713,6 +1587,13 @@ func (d *driver) RemoveStorage(cr *imageregistryv1.Config) (bool, error) {
 		return false, nil
 	}
 
+	// The locked objects can't be deleted before their retention expires,
+	// the bucket could never be emptied and is retained instead.
+	if d.Config.ObjectLock != nil {
+		util.UpdateCondition(cr, defaults.StorageExists, operatorapi.ConditionTrue, "Storage Retained", fmt.Sprintf("The S3 bucket %s has object lock enabled, it is retained with its objects", d.Config.Bucket))
+		return false, nil
+	}
+
 	svc, err := d.getS3Service()
 	if err != nil {
 		return false, err
@@ -800,17 +1681,57 @@ func sharedCredentialsDataFromSecret(secret *corev1.Secret) ([]byte, error) {
 	case len(secret.Data["aws_access_key_id"]) > 0 && len(secret.Data["aws_secret_access_key"]) > 0:
 		accessKey := string(secret.Data["aws_access_key_id"])
 		secretKey := string(secret.Data["aws_secret_access_key"])
-		return sharedCredentialsDataFromStaticCreds(accessKey, secretKey), nil
+		sessionToken := string(secret.Data["aws_session_token"])
+		return sharedCredentialsDataFromStaticCreds(accessKey, secretKey, sessionToken), nil
 	default:
 		return nil, fmt.Errorf("invalid secret for aws credentials")
 	}
 }
 
-func sharedCredentialsDataFromStaticCreds(accessKey, accessSecret string) []byte {
+// sharedCredentialsDataFromWebIdentity returns the credentials file that
+// assumes the role using the service account token.
+func sharedCredentialsDataFromWebIdentity(roleARN, tokenFile string) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprint(buf, "[default]\n")
+	fmt.Fprintf(buf, "role_arn = %s\n", roleARN)
+	fmt.Fprintf(buf, "web_identity_token_file = %s\n", tokenFile)
+
+	return buf.Bytes()
+}
+
+// sharedCredentialsDataWithAssumeRole returns the credentials file that
+// assumes roleARN with the credentials of the default profile of data.
+func sharedCredentialsDataWithAssumeRole(data []byte, roleARN, externalID string) ([]byte, error) {
+	if !defaultProfilePattern.Match(data) {
+		return nil, fmt.Errorf("the storage credentials have no default profile, the role %s can't be assumed with them", roleARN)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(defaultProfilePattern.ReplaceAllLiteral(data, []byte("["+assumeRoleSourceProfile+"]")))
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		fmt.Fprint(buf, "\n")
+	}
+	fmt.Fprint(buf, "[default]\n")
+	fmt.Fprintf(buf, "role_arn = %s\n", roleARN)
+	fmt.Fprintf(buf, "source_profile = %s\n", assumeRoleSourceProfile)
+	fmt.Fprintf(buf, "role_session_name = %s\n", assumeRoleSessionName)
+	if len(externalID) != 0 {
+		fmt.Fprintf(buf, "external_id = %s\n", externalID)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sharedCredentialsDataFromStaticCreds returns the credentials file. The
+// session token is only set for temporary credentials.
+func sharedCredentialsDataFromStaticCreds(accessKey, accessSecret, sessionToken string) []byte {
 	buf := &bytes.Buffer{}
 	fmt.Fprint(buf, "[default]\n")
 	fmt.Fprintf(buf, "aws_access_key_id = %s\n", accessKey)
 	fmt.Fprintf(buf, "aws_secret_access_key = %s\n", accessSecret)
+	if len(sessionToken) != 0 {
+		fmt.Fprintf(buf, "aws_session_token = %s\n", sessionToken)
+	}
 
 	return buf.Bytes()
 }
@@ -4,16 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/private/protocol/xml/xmlutil"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/ghodss/yaml"
 	"github.com/google/go-cmp/cmp"
 
 	corev1 "k8s.io/api/core/v1"
@@ -21,10 +31,12 @@ import (
 
 	configv1 "github.com/openshift/api/config/v1"
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 
 	cirofake "github.com/openshift/cluster-image-registry-operator/pkg/client/fake"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/util"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -138,6 +150,15 @@ func findEnvVar(envvars envvar.List, name string) *envvar.EnvVar {
 	return nil
 }
 
+func findCondition(conditions []operatorapi.OperatorCondition, condType string) *operatorapi.OperatorCondition {
+	for i, c := range conditions {
+		if c.Type == condType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
 func TestConfigEnv(t *testing.T) {
 	ctx := context.Background()
 
@@ -264,9 +285,14 @@ func TestServiceEndpointCanBeOverwritten(t *testing.T) {
 }
 
 type tripper struct {
-	req           int
-	reqBodies     [][]byte
-	responseCodes []int
+	req            int
+	reqBodies      [][]byte
+	reqQueries     []string
+	reqHosts       []string
+	reqSchemes     []string
+	reqHeaders     []http.Header
+	responseCodes  []int
+	responseBodies []string
 }
 
 func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -274,6 +300,11 @@ func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		r.req++
 	}()
 
+	r.reqQueries = append(r.reqQueries, req.URL.RawQuery)
+	r.reqHosts = append(r.reqHosts, req.URL.Host)
+	r.reqSchemes = append(r.reqSchemes, req.URL.Scheme)
+	r.reqHeaders = append(r.reqHeaders, req.Header)
+
 	if req.Body != nil {
 		dt, err := ioutil.ReadAll(req.Body)
 		if err != nil {
@@ -287,14 +318,24 @@ func (r *tripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		code = r.responseCodes[r.req]
 	}
 
+	body := "{}"
+	if r.req < len(r.responseBodies) && r.responseBodies[r.req] != "" {
+		body = r.responseBodies[r.req]
+	}
+
 	return &http.Response{
 		StatusCode: code,
-		Body:       ioutil.NopCloser(bytes.NewBufferString("{}")),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
 	}, nil
 }
 
 func (r *tripper) AddResponse(code int) {
+	r.AddResponseWithBody(code, "")
+}
+
+func (r *tripper) AddResponseWithBody(code int, body string) {
 	r.responseCodes = append(r.responseCodes, code)
+	r.responseBodies = append(r.responseBodies, body)
 }
 
 func TestStorageManagementState(t *testing.T) {
@@ -693,3 +734,2832 @@ func TestUserProvidedTags(t *testing.T) {
 		})
 	}
 }
+
+func TestIsRGW(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config imageregistryv1.ImageRegistryConfigStorageS3
+		rgw    bool
+	}{
+		{
+			name: "aws",
+		},
+		{
+			name: "custom endpoint",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				RegionEndpoint: "https://minio.example.com",
+			},
+		},
+		{
+			name: "rook endpoint without provider",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				RegionEndpoint: "http://rook-ceph-rgw-my-store.rook-ceph.svc:80",
+			},
+		},
+		{
+			name: "explicit provider",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:       "RGW",
+				RegionEndpoint: "https://s3.openshift-storage.svc",
+			},
+			rgw: true,
+		},
+		{
+			name: "explicit aws provider",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:       "AWS",
+				RegionEndpoint: "https://rgw.example.com",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rgw := isRGW(&tt.config); rgw != tt.rgw {
+				t.Errorf("got %t, want %t", rgw, tt.rgw)
+			}
+		})
+	}
+}
+
+func TestCreateStorageRGW(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.BareMetalPlatformType,
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.ImageRegistryPrivateConfigurationUser,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"REGISTRY_STORAGE_S3_ACCESSKEY": []byte("access"),
+			"REGISTRY_STORAGE_S3_SECRETKEY": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket:         "rgw-bucket",
+					Provider:       "RGW",
+					RegionEndpoint: "https://rgw.example.com",
+				},
+			},
+		},
+	}
+
+	drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+	rt := &tripper{}
+	// the bucket does not exist yet
+	rt.AddResponse(http.StatusNotFound)
+	drv.roundTripper = rt
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	if cr.Spec.Storage.ManagementState != imageregistryv1.StorageManagementStateManaged {
+		t.Errorf("expected storage to be managed, got %q", cr.Spec.Storage.ManagementState)
+	}
+	if cr.Status.Storage.S3 == nil || cr.Status.Storage.S3.Bucket != "rgw-bucket" {
+		t.Errorf("unexpected storage status: %#v", cr.Status.Storage.S3)
+	}
+
+	for _, q := range rt.reqQueries {
+		for _, api := range []string{"publicAccessBlock", "tagging", "encryption", "lifecycle"} {
+			if strings.Contains(q, api) {
+				t.Errorf("unexpected %s request to Ceph Object Gateway", api)
+			}
+		}
+	}
+	for _, cond := range cr.Status.Conditions {
+		switch cond.Type {
+		case defaults.StoragePublicAccessBlocked, defaults.StorageTagged, defaults.StorageIncompleteUploadCleanupEnabled:
+			t.Errorf("unexpected condition %s", cond.Type)
+		case defaults.StorageEncrypted:
+			if cond.Status != operatorapi.ConditionUnknown {
+				t.Errorf("expected %s to be Unknown, got %s", cond.Type, cond.Status)
+			}
+		}
+	}
+
+	envvars, err := drv.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedVars := map[string]interface{}{
+		"REGISTRY_STORAGE_S3_BUCKET":         "rgw-bucket",
+		"REGISTRY_STORAGE_S3_REGION":         "us-east-1",
+		"REGISTRY_STORAGE_S3_REGIONENDPOINT": "https://rgw.example.com",
+		"REGISTRY_STORAGE_S3_USEDUALSTACK":   false,
+	}
+	for key, value := range expectedVars {
+		e := findEnvVar(envvars, key)
+		if e == nil {
+			t.Fatalf("envvar %s not found, %v", key, envvars)
+		}
+		if e.Value != value {
+			t.Errorf("%s: got %#+v, want %#+v", key, e.Value, value)
+		}
+	}
+}
+
+func TestRGWRequiresRegionEndpoint(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.BareMetalPlatformType,
+			},
+		},
+	})
+	listers := builder.BuildListers()
+
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+		Provider: "RGW",
+	}, listers)
+
+	_, err := drv.UpdateEffectiveConfig()
+	if err == nil || err.Error() != "regionEndpoint must be set when the storage provider is RGW" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestUnmanagedBucketEncryption(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name           string
+		responseCode   int
+		responseBody   string
+		expectedStatus operatorapi.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "default encryption enabled",
+			responseCode:   http.StatusOK,
+			responseBody:   `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>aws:kms</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`,
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Encryption Enabled",
+		},
+		{
+			name:           "default encryption not configured",
+			responseCode:   http.StatusNotFound,
+			responseBody:   `<Error><Code>ServerSideEncryptionConfigurationNotFoundError</Code><Message>The server side encryption configuration was not found</Message></Error>`,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Encryption Not Enabled",
+		},
+		{
+			name:           "access denied",
+			responseCode:   http.StatusForbidden,
+			responseBody:   `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`,
+			expectedStatus: operatorapi.ConditionUnknown,
+			expectedReason: "Unknown Error Occurred",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket: "a-bucket",
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			// the bucket exists, once for the existence check and once
+			// for the waiter
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponseWithBody(tt.responseCode, tt.responseBody)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			if len(rt.reqQueries) < 3 || !strings.HasPrefix(rt.reqQueries[2], "encryption") {
+				t.Fatalf("expected bucket encryption to be queried, got %v", rt.reqQueries)
+			}
+
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageEncrypted {
+					continue
+				}
+				if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+					t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+				}
+				return
+			}
+			t.Errorf("%s condition not found", defaults.StorageEncrypted)
+		})
+	}
+}
+
+func TestConfigEnvChecksumAlgorithm(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name      string
+		algorithm string
+		err       string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:      "crc32c",
+			algorithm: "CRC32C",
+		},
+		{
+			name:      "sha256",
+			algorithm: "SHA256",
+		},
+		{
+			name:      "unsupported",
+			algorithm: "MD5",
+			err:       `unsupported checksum algorithm "MD5", valid values are CRC32, CRC32C, SHA1, SHA256`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+				ChecksumAlgorithm: tt.algorithm,
+			}, listers)
+
+			envvars, err := d.ConfigEnv()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_CHECKSUMALGORITHM")
+			if len(tt.algorithm) == 0 {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_CHECKSUMALGORITHM is expected to be unset, but got %v", e)
+				}
+				return
+			}
+			if e == nil {
+				t.Fatalf("envvar REGISTRY_STORAGE_S3_CHECKSUMALGORITHM not found, %v", envvars)
+			}
+			if e.Value != tt.algorithm {
+				t.Errorf("REGISTRY_STORAGE_S3_CHECKSUMALGORITHM: got %#+v, want %#+v", e.Value, tt.algorithm)
+			}
+		})
+	}
+}
+
+func TestRequestPayer(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name           string
+		requestPayer   string
+		expectedHeader string
+		err            string
+	}{
+		{
+			name: "bucket owner pays",
+		},
+		{
+			name:           "requester pays",
+			requestPayer:   "Requester",
+			expectedHeader: "requester",
+		},
+		{
+			name:         "unsupported",
+			requestPayer: "BucketOwner",
+			err:          `unsupported requestPayer "BucketOwner", the only valid value is Requester`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket:       "shared-bucket",
+							RequestPayer: tt.requestPayer,
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			rt.AddResponse(http.StatusOK)
+
+			d := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			d.roundTripper = rt
+
+			exists, err := d.StorageExists(cr)
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				if _, err := d.ConfigEnv(); err == nil || err.Error() != tt.err {
+					t.Fatalf("expected the registry configuration to fail with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Fatalf("expected the bucket to exist")
+			}
+
+			if len(rt.reqHeaders) != 1 {
+				t.Fatalf("expected one request, got %d", len(rt.reqHeaders))
+			}
+			if header := rt.reqHeaders[0].Get("X-Amz-Request-Payer"); header != tt.expectedHeader {
+				t.Errorf("expected the X-Amz-Request-Payer header %q, got %q", tt.expectedHeader, header)
+			}
+			if tt.expectedHeader != "" && !strings.Contains(rt.reqHeaders[0].Get("Authorization"), "x-amz-request-payer") {
+				t.Errorf("expected the X-Amz-Request-Payer header to be signed, got %q", rt.reqHeaders[0].Get("Authorization"))
+			}
+
+			envvars, err := d.ConfigEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_REQUESTPAYER"); e != nil {
+				t.Errorf("REGISTRY_STORAGE_S3_REQUESTPAYER is expected to be unset, but got %v", e)
+			}
+		})
+	}
+}
+
+func TestStorageUsage(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	rt := &tripper{}
+	rt.AddResponseWithBody(http.StatusOK, `<GetMetricStatisticsResponse>
+		<GetMetricStatisticsResult>
+			<Datapoints>
+				<member><Timestamp>2021-06-01T00:00:00Z</Timestamp><Average>100</Average></member>
+				<member><Timestamp>2021-06-02T00:00:00Z</Timestamp><Average>600</Average></member>
+			</Datapoints>
+		</GetMetricStatisticsResult>
+	</GetMetricStatisticsResponse>`)
+
+	d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+		Bucket:       "registry",
+		RequestPayer: "Requester",
+	}, listers)
+	d.roundTripper = rt
+
+	used, capacity, err := d.StorageUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 600 {
+		t.Errorf("expected 600 bytes used, got %d", used)
+	}
+	if capacity >= 0 {
+		t.Errorf("expected the bucket to have no capacity, got %d", capacity)
+	}
+
+	if len(rt.reqBodies) != 1 {
+		t.Fatalf("expected one request, got %d", len(rt.reqBodies))
+	}
+	if rt.reqHosts[0] != "monitoring.us-east-1.amazonaws.com" {
+		t.Errorf("expected the request to be sent to CloudWatch, got %s", rt.reqHosts[0])
+	}
+	if header := rt.reqHeaders[0].Get("X-Amz-Request-Payer"); header != "" {
+		t.Errorf("expected no X-Amz-Request-Payer header, got %q", header)
+	}
+	query, err := url.ParseQuery(string(rt.reqBodies[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"Action":                    "GetMetricStatistics",
+		"Namespace":                 "AWS/S3",
+		"MetricName":                "BucketSizeBytes",
+		"Dimensions.member.1.Name":  "BucketName",
+		"Dimensions.member.1.Value": "registry",
+		"Dimensions.member.2.Value": "StandardStorage",
+	} {
+		if query.Get(key) != value {
+			t.Errorf("expected %s=%s, got %q", key, value, query.Get(key))
+		}
+	}
+
+	rt = &tripper{}
+	rt.AddResponseWithBody(http.StatusOK, `<GetMetricStatisticsResponse><GetMetricStatisticsResult><Datapoints/></GetMetricStatisticsResult></GetMetricStatisticsResponse>`)
+	d.roundTripper = rt
+	if used, _, err := d.StorageUsage(); err != nil || used != 0 {
+		t.Errorf("expected an empty bucket, got %d bytes, %v", used, err)
+	}
+
+	rt = &tripper{}
+	rt.AddResponseWithBody(http.StatusForbidden, `<ErrorResponse><Error><Code>AccessDenied</Code></Error></ErrorResponse>`)
+	d.roundTripper = rt
+	if _, _, err := d.StorageUsage(); err == nil || !strings.Contains(err.Error(), "unable to get the size of the bucket registry") {
+		t.Errorf("expected the request to fail, got %v", err)
+	}
+
+	d = NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+		Bucket:         "registry",
+		RegionEndpoint: "https://rgw.example.com",
+		Provider:       "RGW",
+	}, listers)
+	d.roundTripper = &tripper{}
+	if _, _, err := d.StorageUsage(); err != util.ErrStorageUsageNotSupported {
+		t.Errorf("expected the usage of RGW not to be supported, got %v", err)
+	}
+}
+
+func TestFIPSEndpoint(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-2",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name             string
+		config           *imageregistryv1.ImageRegistryConfigStorageS3
+		expectedEndpoint string
+		expectedHost     string
+		err              string
+	}{
+		{
+			name: "disabled",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+			},
+			expectedHost: "a-bucket.s3.dualstack.us-east-2.amazonaws.com",
+		},
+		{
+			name: "cluster region",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:  "a-bucket",
+				UseFIPS: true,
+			},
+			expectedEndpoint: "https://s3-fips.us-east-2.amazonaws.com",
+			expectedHost:     "a-bucket.s3-fips.us-east-2.amazonaws.com",
+		},
+		{
+			name: "government region",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:  "a-bucket",
+				Region:  "us-gov-west-1",
+				UseFIPS: true,
+			},
+			expectedEndpoint: "https://s3-fips.us-gov-west-1.amazonaws.com",
+			expectedHost:     "a-bucket.s3-fips.us-gov-west-1.amazonaws.com",
+		},
+		{
+			name: "previously selected endpoint",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-2",
+				RegionEndpoint: "https://s3-fips.us-east-2.amazonaws.com",
+				UseFIPS:        true,
+			},
+			expectedEndpoint: "https://s3-fips.us-east-2.amazonaws.com",
+			expectedHost:     "a-bucket.s3-fips.us-east-2.amazonaws.com",
+		},
+		{
+			name: "region without FIPS endpoints",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:  "a-bucket",
+				Region:  "eu-west-1",
+				UseFIPS: true,
+			},
+			err: `S3 FIPS endpoints are not available in region "eu-west-1"`,
+		},
+		{
+			name: "custom endpoint",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-2",
+				RegionEndpoint: "https://s3.example.com",
+				UseFIPS:        true,
+			},
+			err: "useFIPS cannot be used together with regionEndpoint https://s3.example.com",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), tt.config, listers)
+
+			envvars, err := d.ConfigEnv()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_REGIONENDPOINT")
+			if len(tt.expectedEndpoint) == 0 {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_REGIONENDPOINT is expected to be unset, but got %v", e)
+				}
+			} else {
+				if e == nil || e.Value != tt.expectedEndpoint {
+					t.Errorf("REGISTRY_STORAGE_S3_REGIONENDPOINT: got %v, want %s", e, tt.expectedEndpoint)
+				}
+				if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE"); e == nil || e.Value != true {
+					t.Errorf("REGISTRY_STORAGE_S3_VIRTUALHOSTEDSTYLE: got %v, want true", e)
+				}
+			}
+
+			rt := &tripper{}
+			d.roundTripper = rt
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: tt.config,
+					},
+				},
+			}
+			if _, err := d.StorageExists(cr); err != nil {
+				t.Fatal(err)
+			}
+			if len(rt.reqHosts) == 0 || rt.reqHosts[0] != tt.expectedHost {
+				t.Errorf("expected the management client to use %s, got %v", tt.expectedHost, rt.reqHosts)
+			}
+		})
+	}
+}
+
+func TestConfigEnvKMSKeyID(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	testBuilder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name     string
+		keyID    string
+		kmsKeyID string
+		expected string
+		err      string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "bucket key",
+			keyID:    "1234abcd-12ab-34cd-56ef-1234567890ab",
+			expected: "1234abcd-12ab-34cd-56ef-1234567890ab",
+		},
+		{
+			name:     "object key ARN",
+			kmsKeyID: "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+			expected: "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+		},
+		{
+			name:     "object key takes precedence",
+			keyID:    "1234abcd-12ab-34cd-56ef-1234567890ab",
+			kmsKeyID: "alias/registry",
+			expected: "alias/registry",
+		},
+		{
+			name:     "invalid object key",
+			kmsKeyID: "registry key",
+			err:      `kmsKeyID "registry key" is not a KMS key ID, key ARN, alias name or alias ARN`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+				Encrypt:  true,
+				KeyID:    tt.keyID,
+				KMSKeyID: tt.kmsKeyID,
+			}, listers)
+
+			envvars, err := d.ConfigEnv()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_KEYID")
+			if len(tt.expected) == 0 {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_KEYID is expected to be unset, but got %v", e)
+				}
+				return
+			}
+			if e == nil {
+				t.Fatalf("envvar REGISTRY_STORAGE_S3_KEYID not found, %v", envvars)
+			}
+			if e.Value != tt.expected {
+				t.Errorf("REGISTRY_STORAGE_S3_KEYID: got %#+v, want %#+v", e.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEncryptionType(t *testing.T) {
+	const keyARN = "arn:aws:kms:us-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name              string
+		encryptionType    string
+		keyID             string
+		expectedAlgorithm string
+		expectedBucketKey string
+		expectedEnvKey    string
+		err               string
+	}{
+		{
+			name:              "unset",
+			expectedAlgorithm: "AES256",
+		},
+		{
+			name:              "unset with a key",
+			keyID:             keyARN,
+			expectedAlgorithm: "aws:kms",
+			expectedBucketKey: keyARN,
+			expectedEnvKey:    keyARN,
+		},
+		{
+			name:              "SSE-S3",
+			encryptionType:    "AES256",
+			expectedAlgorithm: "AES256",
+		},
+		{
+			name:              "SSE-KMS",
+			encryptionType:    "aws:kms",
+			keyID:             keyARN,
+			expectedAlgorithm: "aws:kms",
+			expectedBucketKey: keyARN,
+			expectedEnvKey:    keyARN,
+		},
+		{
+			name:              "SSE-KMS with the AWS managed key",
+			encryptionType:    "aws:kms",
+			expectedAlgorithm: "aws:kms",
+			expectedEnvKey:    "alias/aws/s3",
+		},
+		{
+			name:           "SSE-S3 with a key",
+			encryptionType: "AES256",
+			keyID:          keyARN,
+			err:            "keyID and kmsKeyID cannot be used when encryptionType is AES256",
+		},
+		{
+			name:           "unsupported",
+			encryptionType: "aws:kms:dsse",
+			err:            `unsupported encryptionType "aws:kms:dsse", valid values are AES256 and aws:kms`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						ManagementState: imageregistryv1.StorageManagementStateManaged,
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket:         "encrypted-bucket",
+							EncryptionType: tt.encryptionType,
+							KeyID:          tt.keyID,
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			err := drv.CreateStorage(cr)
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			var encryptionBody string
+			for _, body := range rt.reqBodies {
+				if strings.Contains(string(body), "<ServerSideEncryptionConfiguration") {
+					encryptionBody = string(body)
+				}
+			}
+			if !strings.Contains(encryptionBody, "<SSEAlgorithm>"+tt.expectedAlgorithm+"</SSEAlgorithm>") {
+				t.Errorf("expected the default %s encryption of the bucket, got %s", tt.expectedAlgorithm, encryptionBody)
+			}
+			if tt.expectedBucketKey != "" && !strings.Contains(encryptionBody, "<KMSMasterKeyID>"+tt.expectedBucketKey+"</KMSMasterKeyID>") {
+				t.Errorf("expected the default encryption of the bucket to use %s, got %s", tt.expectedBucketKey, encryptionBody)
+			} else if tt.expectedBucketKey == "" && strings.Contains(encryptionBody, "KMSMasterKeyID") {
+				t.Errorf("expected the default encryption of the bucket not to set a key, got %s", encryptionBody)
+			}
+
+			envvars, err := drv.ConfigEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_ENCRYPT"); e == nil || e.Value != true {
+				t.Errorf("expected REGISTRY_STORAGE_S3_ENCRYPT to be true, got %v", e)
+			}
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_KEYID")
+			if tt.expectedEnvKey == "" {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_KEYID is expected to be unset, but got %v", e)
+				}
+			} else if e == nil || e.Value != tt.expectedEnvKey {
+				t.Errorf("REGISTRY_STORAGE_S3_KEYID: got %v, want %s", e, tt.expectedEnvKey)
+			}
+		})
+	}
+}
+
+func TestEncryptionKeyIDChanged(t *testing.T) {
+	const (
+		oldKeyARN = "arn:aws:kms:us-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+		newKeyARN = "arn:aws:kms:us-west-1:123456789012:key/0987dcba-09fe-87dc-65ba-ab0987654321"
+	)
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	provisioned := &imageregistryv1.ImageRegistryConfigStorageS3{
+		Bucket:         "encrypted-bucket",
+		Region:         "us-west-1",
+		Encrypt:        true,
+		EncryptionType: "aws:kms",
+		KeyID:          oldKeyARN,
+	}
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3:              provisioned.DeepCopy(),
+			},
+		},
+		Status: imageregistryv1.ImageRegistryStatus{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: provisioned.DeepCopy(),
+			},
+		},
+	}
+	cr.Spec.Storage.S3.KeyID = newKeyARN
+
+	rt := &tripper{}
+	drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+	drv.roundTripper = rt
+
+	if !drv.StorageChanged(cr) {
+		t.Fatalf("expected the change of the key to be detected")
+	}
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	var encryptionBody string
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<ServerSideEncryptionConfiguration") {
+			encryptionBody = string(body)
+		}
+	}
+	if !strings.Contains(encryptionBody, "<KMSMasterKeyID>"+newKeyARN+"</KMSMasterKeyID>") {
+		t.Errorf("expected the default encryption of the bucket to be updated to %s, got %s", newKeyARN, encryptionBody)
+	}
+	if cr.Status.Storage.S3 == nil || cr.Status.Storage.S3.KeyID != newKeyARN {
+		t.Errorf("expected the new key in the status, got %#v", cr.Status.Storage.S3)
+	}
+	if drv.StorageChanged(cr) {
+		t.Errorf("expected the storage to be up to date once the encryption is applied")
+	}
+}
+
+func TestKMSKeyIDBucketPolicy(t *testing.T) {
+	const keyARN = "arn:aws:kms:us-west-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name         string
+		responseCode int
+		responseBody string
+		err          string
+	}{
+		{
+			name:         "no policy",
+			responseCode: http.StatusNotFound,
+			responseBody: `<Error><Code>NoSuchBucketPolicy</Code><Message>The bucket policy does not exist</Message></Error>`,
+		},
+		{
+			name:         "key allowed",
+			responseCode: http.StatusOK,
+			responseBody: `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:PutObject","Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"` + keyARN + `"}}}]}`,
+		},
+		{
+			name:         "key denied",
+			responseCode: http.StatusOK,
+			responseBody: `{"Statement":[{"Effect":"Deny","Principal":"*","Action":"s3:PutObject","Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption-aws-kms-key-id":"arn:aws:kms:us-west-1:123456789012:key/other"}}}]}`,
+			err:          "denies uploads encrypted with the KMS key",
+		},
+		{
+			name:         "policy not readable",
+			responseCode: http.StatusForbidden,
+			responseBody: `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket:   "a-bucket",
+							Encrypt:  true,
+							KMSKeyID: keyARN,
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			// the bucket exists, once for the existence check and once
+			// for the waiter
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponseWithBody(http.StatusOK, `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>aws:kms</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`)
+			rt.AddResponseWithBody(tt.responseCode, tt.responseBody)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			err := drv.CreateStorage(cr)
+			if len(rt.reqQueries) < 4 || !strings.HasPrefix(rt.reqQueries[3], "policy") {
+				t.Fatalf("expected the bucket policy to be queried, got %v", rt.reqQueries)
+			}
+			if len(tt.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error to contain %q, got %v", tt.err, err)
+				}
+				for _, cond := range cr.Status.Conditions {
+					if cond.Type == defaults.StorageEncrypted && cond.Reason != "KMS Key Denied" {
+						t.Errorf("expected %s to be reported as denied, got %s", cond.Type, cond.Reason)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+		})
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		secret   *corev1.Secret
+		expected string
+	}{
+		{
+			name: "minted temporary credentials",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+					"aws_session_token":     []byte("token"),
+				},
+			},
+			expected: "[default]\naws_access_key_id = access\naws_secret_access_key = secret\naws_session_token = token\n",
+		},
+		{
+			name: "user provided temporary credentials",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.ImageRegistryPrivateConfigurationUser,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"REGISTRY_STORAGE_S3_ACCESSKEY":    []byte("access"),
+					"REGISTRY_STORAGE_S3_SECRETKEY":    []byte("secret"),
+					"REGISTRY_STORAGE_S3_SESSIONTOKEN": []byte("token"),
+				},
+			},
+			expected: "[default]\naws_access_key_id = access\naws_secret_access_key = secret\naws_session_token = token\n",
+		},
+		{
+			name: "static credentials",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			},
+			expected: "[default]\naws_access_key_id = access\naws_secret_access_key = secret\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			listers := cirofake.NewFixturesBuilder().AddSecrets(tt.secret).BuildListers()
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{}, listers)
+			secrets, err := drv.VolumeSecrets()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets[imageRegistrySecretDataKey] != tt.expected {
+				t.Errorf("expected credentials %q, got %q", tt.expected, secrets[imageRegistrySecretDataKey])
+			}
+		})
+	}
+}
+
+func TestCredentialsExpiration(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		expiration string
+		status     operatorapi.ConditionStatus
+		reason     string
+	}{
+		{
+			name:   "static credentials",
+			status: operatorapi.ConditionFalse,
+			reason: "No Expiration",
+		},
+		{
+			name:       "valid session token",
+			expiration: time.Now().Add(12 * time.Hour).Format(time.RFC3339),
+			status:     operatorapi.ConditionFalse,
+			reason:     "Session Token Valid",
+		},
+		{
+			name:       "session token about to expire",
+			expiration: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+			status:     operatorapi.ConditionTrue,
+			reason:     "Session Token Expiring",
+		},
+		{
+			name:       "expired session token",
+			expiration: time.Now().Add(-time.Minute).Format(time.RFC3339),
+			status:     operatorapi.ConditionTrue,
+			reason:     "Session Token Expiring",
+		},
+		{
+			name:       "invalid expiration",
+			expiration: "tomorrow",
+			status:     operatorapi.ConditionUnknown,
+			reason:     "Unknown Expiration",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sec := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+					"aws_session_token":     []byte("token"),
+				},
+			}
+			if len(tt.expiration) != 0 {
+				sec.Data["aws_session_expiration"] = []byte(tt.expiration)
+			}
+			listers := cirofake.NewFixturesBuilder().AddSecrets(sec).BuildListers()
+
+			cr := &imageregistryv1.Config{}
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{}, listers)
+			drv.checkCredentialsExpiration(cr)
+
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageCredentialsExpiring {
+					continue
+				}
+				if cond.Status != tt.status || cond.Reason != tt.reason {
+					t.Errorf("expected %s to be %s with reason %q, got %s %q", cond.Type, tt.status, tt.reason, cond.Status, cond.Reason)
+				}
+				return
+			}
+			t.Errorf("%s condition not found", defaults.StorageCredentialsExpiring)
+		})
+	}
+}
+
+func TestRoleARN(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	// No credentials secret is needed when the role is assumed with the
+	// service account token.
+	listers := testBuilder.BuildListers()
+
+	roleARN := "arn:aws:iam::123456789012:role/image-registry"
+	drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+		Bucket:  "bucket",
+		RoleARN: roleARN,
+	}, listers)
+
+	secrets, err := drv.VolumeSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[default]\nrole_arn = " + roleARN + "\nweb_identity_token_file = /var/run/secrets/openshift/serviceaccount/token\n"
+	if secrets[imageRegistrySecretDataKey] != expected {
+		t.Errorf("expected credentials %q, got %q", expected, secrets[imageRegistrySecretDataKey])
+	}
+
+	cr := &imageregistryv1.Config{}
+	drv.checkCredentialsExpiration(cr)
+	if len(cr.Status.Conditions) != 1 || cr.Status.Conditions[0].Reason != "No Expiration" {
+		t.Errorf("expected web identity credentials not to expire, got %#v", cr.Status.Conditions)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.ImageRegistryConfigStorageS3
+		err    string
+	}{
+		{
+			name:   "not a role",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{RoleARN: "arn:aws:iam::123456789012:user/registry"},
+			err:    `roleARN "arn:aws:iam::123456789012:user/registry" is not the ARN of an IAM role`,
+		},
+		{
+			name: "RGW",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				RoleARN:        roleARN,
+				Provider:       "RGW",
+				RegionEndpoint: "https://rgw.example.com",
+			},
+			err: "roleARN cannot be used when the storage provider is RGW",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDriver(context.Background(), tt.config, listers).UpdateEffectiveConfig()
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAssumeRole(t *testing.T) {
+	assumeRoleARN := "arn:aws:iam::210987654321:role/registry-bucket"
+
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	t.Run("credentials", func(t *testing.T) {
+		for _, tt := range []struct {
+			name     string
+			config   *imageregistryv1.ImageRegistryConfigStorageS3
+			expected string
+		}{
+			{
+				name: "static credentials",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{
+					AssumeRoleARN:        assumeRoleARN,
+					AssumeRoleExternalID: "registry-external-id",
+				},
+				expected: "[assume-role-source]\naws_access_key_id = access\naws_secret_access_key = secret\n" +
+					"[default]\nrole_arn = " + assumeRoleARN + "\nsource_profile = assume-role-source\nrole_session_name = openshift-image-registry\nexternal_id = registry-external-id\n",
+			},
+			{
+				name: "web identity",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{
+					RoleARN:       "arn:aws:iam::123456789012:role/image-registry",
+					AssumeRoleARN: assumeRoleARN,
+				},
+				expected: "[assume-role-source]\nrole_arn = arn:aws:iam::123456789012:role/image-registry\nweb_identity_token_file = /var/run/secrets/openshift/serviceaccount/token\n" +
+					"[default]\nrole_arn = " + assumeRoleARN + "\nsource_profile = assume-role-source\nrole_session_name = openshift-image-registry\n",
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				secrets, err := NewDriver(context.Background(), tt.config, listers).VolumeSecrets()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if secrets[imageRegistrySecretDataKey] != tt.expected {
+					t.Errorf("expected credentials %q, got %q", tt.expected, secrets[imageRegistrySecretDataKey])
+				}
+			})
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		for _, tt := range []struct {
+			name   string
+			config *imageregistryv1.ImageRegistryConfigStorageS3
+			err    string
+		}{
+			{
+				name:   "not a role",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{AssumeRoleARN: "arn:aws:iam::210987654321:user/registry"},
+				err:    `assumeRoleARN "arn:aws:iam::210987654321:user/registry" is not the ARN of an IAM role`,
+			},
+			{
+				name: "invalid external ID",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{
+					AssumeRoleARN:        assumeRoleARN,
+					AssumeRoleExternalID: "external id",
+				},
+				err: "assumeRoleExternalID must be 2 to 1224 characters among letters, digits and +=,.@:/-",
+			},
+			{
+				name:   "external ID without role",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{AssumeRoleExternalID: "registry-external-id"},
+				err:    "assumeRoleExternalID cannot be used without assumeRoleARN",
+			},
+			{
+				name: "RGW",
+				config: &imageregistryv1.ImageRegistryConfigStorageS3{
+					AssumeRoleARN:  assumeRoleARN,
+					Provider:       "RGW",
+					RegionEndpoint: "https://rgw.example.com",
+				},
+				err: "assumeRoleARN cannot be used when the storage provider is RGW",
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := NewDriver(context.Background(), tt.config, listers).UpdateEffectiveConfig()
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+			})
+		}
+	})
+
+	for _, tt := range []struct {
+		name           string
+		stsCode        int
+		stsBody        string
+		exists         bool
+		err            string
+		expectedStatus operatorapi.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "role assumed",
+			stsCode:        http.StatusOK,
+			stsBody:        `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials><AccessKeyId>assumed-access</AccessKeyId><SecretAccessKey>assumed-secret</SecretAccessKey><SessionToken>assumed-token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`,
+			exists:         true,
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Role Assumed",
+		},
+		{
+			name:           "access denied",
+			stsCode:        http.StatusForbidden,
+			stsBody:        `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized to perform sts:AssumeRole</Message></Error></ErrorResponse>`,
+			err:            "unable to assume the role " + assumeRoleARN,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Assume Role Failed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{}
+
+			rt := &tripper{}
+			rt.AddResponseWithBody(tt.stsCode, tt.stsBody)
+			rt.AddResponse(http.StatusOK)
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:               "cross-account-bucket",
+				AssumeRoleARN:        assumeRoleARN,
+				AssumeRoleExternalID: "registry-external-id",
+			}, listers)
+			drv.roundTripper = rt
+
+			exists, err := drv.StorageExists(cr)
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.exists {
+				t.Errorf("expected exists to be %t, got %t", tt.exists, exists)
+			}
+
+			if len(rt.reqBodies) == 0 {
+				t.Fatalf("expected the role to be assumed")
+			}
+			stsRequest := string(rt.reqBodies[0])
+			for _, param := range []string{"Action=AssumeRole", "RoleArn=" + url.QueryEscape(assumeRoleARN), "ExternalId=registry-external-id", "RoleSessionName=openshift-image-registry"} {
+				if !strings.Contains(stsRequest, param) {
+					t.Errorf("expected the STS request to contain %q, got %q", param, stsRequest)
+				}
+			}
+			if tt.err != "" && rt.req != 1 {
+				t.Errorf("expected the bucket not to be accessed without the role, got %d requests", rt.req)
+			}
+
+			cond := findCondition(cr.Status.Conditions, defaults.StorageRoleAssumed)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageRoleAssumed)
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+			}
+		})
+	}
+}
+
+// instanceMetadataTripper answers the requests to the instance metadata
+// service with the credentials of the instance profile, the other requests
+// are passed to next.
+type instanceMetadataTripper struct {
+	next http.RoundTripper
+}
+
+func (r *instanceMetadataTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "169.254.169.254" {
+		return r.next.RoundTrip(req)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+	var body string
+	switch req.URL.Path {
+	case "/latest/api/token":
+		resp.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+		body = "metadata-token"
+	case "/latest/meta-data/iam/security-credentials/":
+		body = "registry-role"
+	case "/latest/meta-data/iam/security-credentials/registry-role":
+		body = `{"Code":"Success","AccessKeyId":"instance-access","SecretAccessKey":"instance-secret","Token":"instance-token","Expiration":"2100-01-01T00:00:00Z"}`
+	default:
+		resp.StatusCode = http.StatusNotFound
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(body))
+	return resp, nil
+}
+
+func TestCredentialsSource(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access"),
+			"aws_secret_access_key": []byte("secret"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	// setenv replaces the AWS credentials of the environment and returns a
+	// function restoring them.
+	setenv := func(env map[string]string) func() {
+		saved := map[string]*string{}
+		for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+			if v, ok := os.LookupEnv(name); ok {
+				saved[name] = &v
+			} else {
+				saved[name] = nil
+			}
+			if v, ok := env[name]; ok {
+				os.Setenv(name, v)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+		return func() {
+			for name, v := range saved {
+				if v != nil {
+					os.Setenv(name, *v)
+				} else {
+					os.Unsetenv(name)
+				}
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name              string
+		credentialsSource string
+		env               map[string]string
+		expected          string
+		expectedAccessKey string
+		err               string
+	}{
+		{
+			name:              "secret over the environment",
+			credentialsSource: "Secret",
+			env:               map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			expected:          "[default]\naws_access_key_id = access\naws_secret_access_key = secret\n",
+			expectedAccessKey: "access",
+		},
+		{
+			name:              "secret by default",
+			env:               map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			expected:          "[default]\naws_access_key_id = access\naws_secret_access_key = secret\n",
+			expectedAccessKey: "access",
+		},
+		{
+			name:              "environment",
+			credentialsSource: "Environment",
+			env:               map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret", "AWS_SESSION_TOKEN": "env-token"},
+			expected:          "[default]\naws_access_key_id = env-access\naws_secret_access_key = env-secret\naws_session_token = env-token\n",
+			expectedAccessKey: "env-access",
+		},
+		{
+			name:              "environment without credentials",
+			credentialsSource: "Environment",
+			err:               "credentialsSource is Environment, but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set in the environment of the operator",
+		},
+		{
+			name:              "instance profile",
+			credentialsSource: "InstanceProfile",
+			env:               map[string]string{"AWS_ACCESS_KEY_ID": "env-access", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			expected:          "[default]\n",
+			expectedAccessKey: "instance-access",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setenv(tt.env)()
+
+			drv := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:            "bucket",
+				CredentialsSource: tt.credentialsSource,
+			}, listers)
+			secrets, err := drv.VolumeSecrets()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets[imageRegistrySecretDataKey] != tt.expected {
+				t.Errorf("expected credentials %q, got %q", tt.expected, secrets[imageRegistrySecretDataKey])
+			}
+
+			rt := &tripper{}
+			rt.AddResponse(http.StatusOK)
+			drv.roundTripper = &instanceMetadataTripper{next: rt}
+
+			if _, err := drv.StorageExists(&imageregistryv1.Config{}); err != nil {
+				t.Fatal(err)
+			}
+			if rt.req != 1 {
+				t.Fatalf("expected 1 request to the bucket, got %d", rt.req)
+			}
+			auth := rt.reqHeaders[0].Get("Authorization")
+			if !strings.Contains(auth, "Credential="+tt.expectedAccessKey+"/") {
+				t.Errorf("expected the bucket to be accessed with the access key %s, got %q", tt.expectedAccessKey, auth)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name   string
+		config *imageregistryv1.ImageRegistryConfigStorageS3
+		err    string
+	}{
+		{
+			name:   "unknown source",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{CredentialsSource: "Vault"},
+			err:    `unsupported credentialsSource "Vault", valid values are Secret, Environment and InstanceProfile`,
+		},
+		{
+			name: "role with the environment",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				CredentialsSource: "Environment",
+				RoleARN:           "arn:aws:iam::123456789012:role/image-registry",
+			},
+			err: "roleARN cannot be used when credentialsSource is Environment",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDriver(context.Background(), tt.config, listers).UpdateEffectiveConfig()
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestMultipartPartSize(t *testing.T) {
+	const mib = 1 << 20
+
+	for _, tt := range []struct {
+		name     string
+		config   imageregistryv1.ImageRegistryConfigStorageS3
+		expected int64
+		clamped  bool
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:     "within the AWS limits",
+			config:   imageregistryv1.ImageRegistryConfigStorageS3{MultipartPartSize: 64 * mib},
+			expected: 64 * mib,
+		},
+		{
+			name:     "below the AWS limits",
+			config:   imageregistryv1.ImageRegistryConfigStorageS3{MultipartPartSize: mib},
+			expected: 5 * mib,
+			clamped:  true,
+		},
+		{
+			name:     "above the AWS limits",
+			config:   imageregistryv1.ImageRegistryConfigStorageS3{MultipartPartSize: 6 << 30},
+			expected: 5 << 30,
+			clamped:  true,
+		},
+		{
+			name: "below the RGW limits",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:          "RGW",
+				RegionEndpoint:    "https://rook-ceph-rgw-ocs-storagecluster-cephobjectstore.openshift-storage.svc",
+				MultipartPartSize: 4 * mib,
+			},
+			expected: 5 * mib,
+			clamped:  true,
+		},
+		{
+			name: "within the RGW limits",
+			config: imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:          providerRGW,
+				RegionEndpoint:    "https://s3.example.com",
+				MultipartPartSize: 5 * mib,
+			},
+			expected: 5 * mib,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			size, clamped := multipartPartSize(&tt.config)
+			if size != tt.expected || clamped != tt.clamped {
+				t.Errorf("expected part size %d (clamped=%t), got %d (clamped=%t)", tt.expected, tt.clamped, size, clamped)
+			}
+
+			cr := &imageregistryv1.Config{}
+			d := NewDriver(context.Background(), &tt.config, nil)
+			d.checkMultipartPartSize(cr)
+			status := operatorapi.ConditionFalse
+			if tt.clamped {
+				status = operatorapi.ConditionTrue
+			}
+			var found bool
+			for _, cond := range cr.Status.Conditions {
+				if cond.Type != defaults.StorageMultipartPartSizeClamped {
+					continue
+				}
+				found = true
+				if cond.Status != status {
+					t.Errorf("expected %s to be %s, got %s: %s", cond.Type, status, cond.Status, cond.Message)
+				}
+			}
+			if !found {
+				t.Errorf("%s condition not found", defaults.StorageMultipartPartSizeClamped)
+			}
+		})
+	}
+}
+
+func TestConfigEnvMultipartPartSize(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	d := NewDriver(context.Background(), &imageregistryv1.ImageRegistryConfigStorageS3{
+		MultipartPartSize: 1 << 20,
+	}, listers)
+	envvars, err := d.ConfigEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_CHUNKSIZE")
+	if e == nil {
+		t.Fatalf("envvar REGISTRY_STORAGE_S3_CHUNKSIZE not found, %v", envvars)
+	}
+	if e.Value != int64(5<<20) {
+		t.Errorf("REGISTRY_STORAGE_S3_CHUNKSIZE: got %#+v, want %#+v", e.Value, int64(5<<20))
+	}
+}
+
+func TestCredentialsRefreshInterval(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		interval time.Duration
+		expected time.Duration
+		err      string
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:     "minimum",
+			interval: time.Minute,
+			expected: time.Minute,
+		},
+		{
+			name:     "hourly",
+			interval: time.Hour,
+			expected: time.Hour,
+		},
+		{
+			name:     "too short",
+			interval: 30 * time.Second,
+			err:      "credentialsRefreshInterval: must be at least 1m0s, got 30s",
+		},
+		{
+			name:     "negative",
+			interval: -time.Minute,
+			err:      "credentialsRefreshInterval: must be at least 1m0s, got -1m0s",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, err := CredentialsRefreshInterval(&imageregistryv1.ImageRegistryConfigStorageS3{
+				CredentialsRefreshInterval: metav1.Duration{Duration: tt.interval},
+			})
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if interval != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, interval)
+			}
+		})
+	}
+}
+
+func TestCreateStorageObjectLock(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "worm-bucket",
+					ObjectLock: &imageregistryv1.ImageRegistryConfigStorageS3ObjectLock{
+						Mode:          "Compliance",
+						RetentionDays: 30,
+					},
+				},
+			},
+		},
+	}
+
+	rt := &tripper{}
+	// the bucket does not exist yet
+	rt.AddResponse(http.StatusNotFound)
+
+	drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+	drv.roundTripper = rt
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	if len(rt.reqHeaders) < 2 || rt.reqHeaders[1].Get("X-Amz-Bucket-Object-Lock-Enabled") != "true" {
+		t.Errorf("expected the bucket to be created with object lock enabled, got %v", rt.reqHeaders)
+	}
+
+	// the object lock configuration is set last
+	if q := rt.reqQueries[len(rt.reqQueries)-1]; !strings.HasPrefix(q, "object-lock") {
+		t.Fatalf("expected the object lock configuration to be set, got %v", rt.reqQueries)
+	}
+	lockBody := rt.reqBodies[len(rt.reqBodies)-1]
+	for _, s := range []string{"<Mode>COMPLIANCE</Mode>", "<Days>30</Days>", "<ObjectLockEnabled>Enabled</ObjectLockEnabled>"} {
+		if !strings.Contains(string(lockBody), s) {
+			t.Errorf("expected %s in the object lock configuration, got %s", s, lockBody)
+		}
+	}
+
+	cond := findCondition(cr.Status.Conditions, defaults.StorageObjectLocked)
+	if cond == nil {
+		t.Fatalf("%s condition not found", defaults.StorageObjectLocked)
+	}
+	if cond.Status != operatorapi.ConditionTrue || !strings.Contains(cond.Message, "retained for 30 days in COMPLIANCE mode") {
+		t.Errorf("unexpected condition %#v", cond)
+	}
+}
+
+func TestUnmanagedBucketObjectLock(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name           string
+		responseCode   int
+		responseBody   string
+		expectedStatus operatorapi.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "object lock enabled",
+			responseCode:   http.StatusOK,
+			responseBody:   `<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled><Rule><DefaultRetention><Mode>GOVERNANCE</Mode><Days>7</Days></DefaultRetention></Rule></ObjectLockConfiguration>`,
+			expectedStatus: operatorapi.ConditionTrue,
+			expectedReason: "Object Lock Enabled",
+		},
+		{
+			name:           "object lock not enabled",
+			responseCode:   http.StatusNotFound,
+			responseBody:   `<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>`,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Object Lock Not Enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket: "a-bucket",
+							ObjectLock: &imageregistryv1.ImageRegistryConfigStorageS3ObjectLock{
+								Mode:          "Governance",
+								RetentionDays: 7,
+							},
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			// the bucket exists, once for the existence check and once
+			// for the waiter, then the default encryption is queried
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponseWithBody(http.StatusOK, `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>AES256</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`)
+			rt.AddResponseWithBody(tt.responseCode, tt.responseBody)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			if len(rt.reqQueries) < 4 || !strings.HasPrefix(rt.reqQueries[3], "object-lock") {
+				t.Fatalf("expected the object lock configuration to be queried, got %v", rt.reqQueries)
+			}
+
+			cond := findCondition(cr.Status.Conditions, defaults.StorageObjectLocked)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageObjectLocked)
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+			}
+		})
+	}
+}
+
+func TestRemoveStorageObjectLock(t *testing.T) {
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				ManagementState: imageregistryv1.StorageManagementStateManaged,
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "worm-bucket",
+					ObjectLock: &imageregistryv1.ImageRegistryConfigStorageS3ObjectLock{
+						Mode:          "Governance",
+						RetentionDays: 7,
+					},
+				},
+			},
+		},
+	}
+
+	rt := &tripper{}
+	drv := NewDriver(context.Background(), cr.Spec.Storage.S3, cirofake.NewFixturesBuilder().BuildListers())
+	drv.roundTripper = rt
+
+	retriable, err := drv.RemoveStorage(cr)
+	if err != nil || retriable {
+		t.Fatalf("expected the removal to be done, got retriable=%t err=%v", retriable, err)
+	}
+	if rt.req != 0 {
+		t.Errorf("expected no requests to S3, got %d", rt.req)
+	}
+
+	cond := findCondition(cr.Status.Conditions, defaults.StorageExists)
+	if cond == nil {
+		t.Fatalf("%s condition not found", defaults.StorageExists)
+	}
+	if cond.Status != operatorapi.ConditionTrue || cond.Reason != "Storage Retained" {
+		t.Errorf("expected the bucket to be retained, got %#v", cond)
+	}
+}
+
+// TestCredentialsRequestCoversCalls checks that the credentials request grants
+// an action for every call the driver makes to AWS.
+func TestCredentialsRequestCoversCalls(t *testing.T) {
+	actions := map[string][]string{
+		"HeadBucketWithContext":                      {"s3:ListBucket"},
+		"WaitUntilBucketExistsWithContext":           {"s3:ListBucket"},
+		"WaitUntilBucketNotExistsWithContext":        {"s3:ListBucket"},
+		"CreateBucketWithContext":                    {"s3:CreateBucket", "s3:PutBucketVersioning"},
+		"DeleteBucketWithContext":                    {"s3:DeleteBucket"},
+		"PutPublicAccessBlockWithContext":            {"s3:PutBucketPublicAccessBlock"},
+		"PutBucketTaggingWithContext":                {"s3:PutBucketTagging"},
+		"PutBucketEncryptionWithContext":             {"s3:PutEncryptionConfiguration"},
+		"GetBucketEncryptionWithContext":             {"s3:GetEncryptionConfiguration"},
+		"GetBucketPolicyWithContext":                 {"s3:GetBucketPolicy"},
+		"PutBucketLifecycleConfigurationWithContext": {"s3:PutLifecycleConfiguration"},
+		"GetBucketLifecycleConfigurationWithContext": {"s3:GetLifecycleConfiguration"},
+		"PutObjectLockConfigurationWithContext":      {"s3:PutBucketObjectLockConfiguration"},
+		"GetObjectLockConfigurationWithContext":      {"s3:GetBucketObjectLockConfiguration"},
+		"NewDeleteListIterator":                      {"s3:ListBucket"},
+		"NewBatchDeleteWithClient":                   {"s3:DeleteObject"},
+		"getMetricStatistics":                        {"cloudwatch:GetMetricStatistics"},
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "manifests", "01-registry-credentials-request.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Spec struct {
+			ProviderSpec struct {
+				StatementEntries []struct {
+					Action []string `json:"action"`
+				} `json:"statementEntries"`
+			} `json:"providerSpec"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	granted := map[string]bool{}
+	for _, entry := range manifest.Spec.ProviderSpec.StatementEntries {
+		for _, action := range entry.Action {
+			granted[action] = true
+		}
+	}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			recv, ok := sel.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			name := sel.Sel.Name
+			switch {
+			case recv.Name == "svc" && strings.HasSuffix(name, "WithContext"):
+			case recv.Name == "s3manager" && strings.HasPrefix(name, "New"):
+			case name == "getMetricStatistics":
+			default:
+				return true
+			}
+			required, ok := actions[name]
+			if !ok {
+				t.Errorf("%s: no IAM action is known for %s", fset.Position(call.Pos()), name)
+				return true
+			}
+			for _, action := range required {
+				if !granted[action] {
+					t.Errorf("%s: %s requires %s, it is missing from the credentials request", fset.Position(call.Pos()), name, action)
+				}
+			}
+			return true
+		})
+	}
+}
+
+func TestConfigEnvPrunedBlobExpiration(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name          string
+		config        *imageregistryv1.ImageRegistryConfigStorageS3
+		expectedError string
+	}{
+		{
+			name:   "not set",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{},
+		},
+		{
+			name: "set",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{
+					ExpirationDays: 7,
+				},
+			},
+		},
+		{
+			name: "no expiration days",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{},
+			},
+			expectedError: "prunedBlobExpiration: expirationDays must be at least 1, got 0",
+		},
+		{
+			name: "object lock",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{
+					ExpirationDays: 7,
+				},
+				ObjectLock: &imageregistryv1.ImageRegistryConfigStorageS3ObjectLock{
+					Mode:          "Governance",
+					RetentionDays: 7,
+				},
+			},
+			expectedError: "prunedBlobExpiration cannot be used together with objectLock",
+		},
+		{
+			name: "rgw",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:       "RGW",
+				RegionEndpoint: "https://rgw.example.com",
+				PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{
+					ExpirationDays: 7,
+				},
+			},
+			expectedError: "prunedBlobExpiration cannot be used when the storage provider is RGW",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), tt.config, listers)
+			envvars, err := d.ConfigEnv()
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The registry has no setting to tag the blobs it deletes, only
+			// the lifecycle rule of the bucket is configured.
+			if e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_DELETETAG"); e != nil {
+				t.Errorf("REGISTRY_STORAGE_S3_DELETETAG is expected to be unset, but got %v", e)
+			}
+		})
+	}
+}
+
+func TestCreateStoragePrunedBlobExpiration(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	cr := &imageregistryv1.Config{
+		Spec: imageregistryv1.ImageRegistrySpec{
+			Storage: imageregistryv1.ImageRegistryConfigStorage{
+				S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+					Bucket: "a-bucket",
+					PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{
+						ExpirationDays: 14,
+					},
+				},
+			},
+		},
+	}
+
+	rt := &tripper{}
+	// the bucket does not exist yet
+	rt.AddResponse(http.StatusNotFound)
+
+	drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+	drv.roundTripper = rt
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	var lifecycleBody string
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<LifecycleConfiguration") {
+			lifecycleBody = string(body)
+		}
+	}
+	if lifecycleBody == "" {
+		t.Fatalf("expected the lifecycle configuration to be set")
+	}
+	for _, s := range []string{
+		"<ID>cleanup-incomplete-multipart-registry-uploads</ID>",
+		"<ID>expire-pruned-registry-blobs</ID>",
+		"<Key>image-registry.openshift.io/pruned</Key>",
+		"<Value>true</Value>",
+		"<Expiration><Days>14</Days></Expiration>",
+	} {
+		if !strings.Contains(lifecycleBody, s) {
+			t.Errorf("expected %s in the lifecycle configuration, got %s", s, lifecycleBody)
+		}
+	}
+
+	cond := findCondition(cr.Status.Conditions, defaults.StoragePrunedBlobExpirationEnabled)
+	if cond == nil {
+		t.Fatalf("%s condition not found", defaults.StoragePrunedBlobExpirationEnabled)
+	}
+	if cond.Status != operatorapi.ConditionTrue || !strings.Contains(cond.Message, "expire after 14 days") {
+		t.Errorf("unexpected condition %#v", cond)
+	}
+
+	// Removing the field removes the rule and the condition.
+	cr.Spec.Storage.S3.PrunedBlobExpiration = nil
+
+	rt = &tripper{}
+	drv = NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+	drv.roundTripper = rt
+
+	if err := drv.CreateStorage(cr); err != nil {
+		t.Fatalf("unexpected err %q", err)
+	}
+
+	lifecycleBody = ""
+	for _, body := range rt.reqBodies {
+		if strings.Contains(string(body), "<LifecycleConfiguration") {
+			lifecycleBody = string(body)
+		}
+	}
+	if lifecycleBody == "" {
+		t.Fatalf("expected the lifecycle configuration to be set")
+	}
+	if strings.Contains(lifecycleBody, "<ID>expire-pruned-registry-blobs</ID>") {
+		t.Errorf("expected the expiration rule to be removed, got %s", lifecycleBody)
+	}
+	if cond := findCondition(cr.Status.Conditions, defaults.StoragePrunedBlobExpirationEnabled); cond != nil {
+		t.Errorf("expected the %s condition to be removed, got %#v", defaults.StoragePrunedBlobExpirationEnabled, cond)
+	}
+}
+
+func TestConfigEnvIncompleteUploads(t *testing.T) {
+	testBuilder := cirofake.NewFixturesBuilder()
+	testBuilder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-east-1",
+				},
+			},
+		},
+	})
+	listers := testBuilder.BuildListers()
+
+	for _, tt := range []struct {
+		name          string
+		config        *imageregistryv1.ImageRegistryConfigStorageS3
+		expectedError string
+	}{
+		{
+			name:   "not set",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{},
+		},
+		{
+			name: "expiration days",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				IncompleteUploadExpirationDays: 3,
+			},
+		},
+		{
+			name: "negative expiration days",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				IncompleteUploadExpirationDays: -1,
+			},
+			expectedError: "incompleteUploadExpirationDays must not be negative, got -1",
+		},
+		{
+			name: "expiration days with rgw",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Provider:                       "RGW",
+				RegionEndpoint:                 "https://rgw.example.com",
+				IncompleteUploadExpirationDays: 3,
+			},
+			expectedError: "incompleteUploadExpirationDays cannot be used when the storage provider is RGW",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(context.Background(), tt.config, listers)
+			_, err := d.ConfigEnv()
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCreateStorageIncompleteUploadExpiration(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "tinfra",
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name            string
+		config          *imageregistryv1.ImageRegistryConfigStorageS3
+		expectedDays    string
+		expectedMessage string
+	}{
+		{
+			name: "default",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket: "a-bucket",
+			},
+			expectedDays:    "<DaysAfterInitiation>1</DaysAfterInitiation>",
+			expectedMessage: "Default cleanup of incomplete multipart uploads after one (1) day was successfully enabled",
+		},
+		{
+			name: "expiration days",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:                         "a-bucket",
+				IncompleteUploadExpirationDays: 3,
+			},
+			expectedDays:    "<DaysAfterInitiation>3</DaysAfterInitiation>",
+			expectedMessage: "Cleanup of incomplete multipart uploads after 3 days was successfully enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: tt.config,
+					},
+				},
+			}
+
+			rt := &tripper{}
+			// the bucket does not exist yet
+			rt.AddResponse(http.StatusNotFound)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			var lifecycleBody string
+			for _, body := range rt.reqBodies {
+				if strings.Contains(string(body), "<LifecycleConfiguration") {
+					lifecycleBody = string(body)
+				}
+			}
+			if !strings.Contains(lifecycleBody, tt.expectedDays) {
+				t.Errorf("expected %s in the lifecycle configuration, got %s", tt.expectedDays, lifecycleBody)
+			}
+
+			cond := findCondition(cr.Status.Conditions, defaults.StorageIncompleteUploadCleanupEnabled)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StorageIncompleteUploadCleanupEnabled)
+			}
+			if cond.Status != operatorapi.ConditionTrue || cond.Message != tt.expectedMessage {
+				t.Errorf("unexpected condition %#v", cond)
+			}
+		})
+	}
+}
+
+func TestUnmanagedBucketPrunedBlobExpiration(t *testing.T) {
+	builder := cirofake.NewFixturesBuilder()
+	builder.AddInfraConfig(&configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+		Status: configv1.InfrastructureStatus{
+			PlatformStatus: &configv1.PlatformStatus{
+				Type: configv1.AWSPlatformType,
+				AWS: &configv1.AWSPlatformStatus{
+					Region: "us-west-1",
+				},
+			},
+		},
+	})
+	builder.AddSecrets(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaults.CloudCredentialsName,
+			Namespace: defaults.ImageRegistryOperatorNamespace,
+		},
+		Data: map[string][]byte{
+			"aws_access_key_id":     []byte("access_key_id"),
+			"aws_secret_access_key": []byte("secret_access_key"),
+		},
+	})
+	listers := builder.BuildListers()
+
+	for _, tt := range []struct {
+		name            string
+		responseCode    int
+		responseBody    string
+		expectedStatus  operatorapi.ConditionStatus
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name:            "expiration rule",
+			responseCode:    http.StatusOK,
+			responseBody:    `<LifecycleConfiguration><Rule><ID>expire</ID><Status>Enabled</Status><Filter><Tag><Key>image-registry.openshift.io/pruned</Key><Value>true</Value></Tag></Filter><Expiration><Days>30</Days></Expiration></Rule></LifecycleConfiguration>`,
+			expectedStatus:  operatorapi.ConditionTrue,
+			expectedReason:  "Expiration Enabled",
+			expectedMessage: "expire after 30 days",
+		},
+		{
+			name:           "disabled expiration rule",
+			responseCode:   http.StatusOK,
+			responseBody:   `<LifecycleConfiguration><Rule><ID>expire</ID><Status>Disabled</Status><Filter><Tag><Key>image-registry.openshift.io/pruned</Key><Value>true</Value></Tag></Filter><Expiration><Days>30</Days></Expiration></Rule></LifecycleConfiguration>`,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Expiration Not Enabled",
+		},
+		{
+			name:           "no lifecycle configuration",
+			responseCode:   http.StatusNotFound,
+			responseBody:   `<Error><Code>NoSuchLifecycleConfiguration</Code><Message>The lifecycle configuration does not exist</Message></Error>`,
+			expectedStatus: operatorapi.ConditionFalse,
+			expectedReason: "Expiration Not Enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: &imageregistryv1.ImageRegistryConfigStorageS3{
+							Bucket: "a-bucket",
+							PrunedBlobExpiration: &imageregistryv1.ImageRegistryConfigStorageS3PrunedBlobExpiration{
+								ExpirationDays: 30,
+							},
+						},
+					},
+				},
+			}
+
+			rt := &tripper{}
+			// the bucket exists, once for the existence check and once
+			// for the waiter, then the default encryption is queried
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponse(http.StatusOK)
+			rt.AddResponseWithBody(http.StatusOK, `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>AES256</SSEAlgorithm></ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`)
+			rt.AddResponseWithBody(tt.responseCode, tt.responseBody)
+
+			drv := NewDriver(context.Background(), cr.Spec.Storage.S3, listers)
+			drv.roundTripper = rt
+
+			if err := drv.CreateStorage(cr); err != nil {
+				t.Fatalf("unexpected err %q", err)
+			}
+
+			if len(rt.reqQueries) < 4 || !strings.HasPrefix(rt.reqQueries[3], "lifecycle") {
+				t.Fatalf("expected the lifecycle configuration to be queried, got %v", rt.reqQueries)
+			}
+
+			cond := findCondition(cr.Status.Conditions, defaults.StoragePrunedBlobExpirationEnabled)
+			if cond == nil {
+				t.Fatalf("%s condition not found", defaults.StoragePrunedBlobExpirationEnabled)
+			}
+			if cond.Status != tt.expectedStatus || cond.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedStatus, tt.expectedReason, cond.Status, cond.Reason)
+			}
+			if !strings.Contains(cond.Message, tt.expectedMessage) {
+				t.Errorf("expected the message to contain %q, got %q", tt.expectedMessage, cond.Message)
+			}
+		})
+	}
+}
+
+func TestIsCloudAPIUnavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{
+			name:        "service unavailable",
+			err:         awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Service Unavailable", nil), http.StatusServiceUnavailable, "id"),
+			unavailable: true,
+		},
+		{
+			name:        "internal error",
+			err:         awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error", nil), http.StatusInternalServerError, "id"),
+			unavailable: true,
+		},
+		{
+			name: "throttled",
+			err:  awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate", nil), http.StatusServiceUnavailable, "id"),
+		},
+		{
+			name: "access denied",
+			err:  awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "id"),
+		},
+		{
+			name: "connection failed",
+			err:  awserr.New(request.ErrCodeRequestError, "send request failed", fmt.Errorf("dial tcp: connection refused")),
+		},
+		{
+			name:        "provisioning error",
+			err:         util.NewProvisioningError("BucketCreationFailed", awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Service Unavailable", nil), http.StatusServiceUnavailable, "id")),
+			unavailable: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if unavailable := isCloudAPIUnavailable(tt.err); unavailable != tt.unavailable {
+				t.Errorf("expected %t, got %t", tt.unavailable, unavailable)
+			}
+		})
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	insecure := false
+	for _, tt := range []struct {
+		name              string
+		config            *imageregistryv1.ImageRegistryConfigStorageS3
+		caBundle          string
+		expectedScheme    string
+		expectedCondition operatorapi.ConditionStatus
+		err               string
+	}{
+		{
+			name: "default",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-1",
+				RegionEndpoint: "s3.example.internal",
+			},
+			expectedScheme:    "https",
+			expectedCondition: operatorapi.ConditionFalse,
+		},
+		{
+			name: "insecure",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-1",
+				RegionEndpoint: "s3.example.internal",
+				Secure:         &insecure,
+			},
+			expectedScheme:    "http",
+			expectedCondition: operatorapi.ConditionTrue,
+		},
+		{
+			name: "insecure with an http endpoint",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-1",
+				RegionEndpoint: "http://s3.example.internal:8080",
+				Secure:         &insecure,
+			},
+			expectedScheme:    "http",
+			expectedCondition: operatorapi.ConditionTrue,
+		},
+		{
+			name: "insecure with an https endpoint",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-1",
+				RegionEndpoint: "https://s3.example.internal",
+				Secure:         &insecure,
+			},
+			err: "secure cannot be set to false together with the https regionEndpoint https://s3.example.internal",
+		},
+		{
+			name: "insecure with FIPS",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:  "a-bucket",
+				UseFIPS: true,
+				Secure:  &insecure,
+			},
+			err: "secure cannot be set to false together with useFIPS",
+		},
+		{
+			name: "insecure with a CA bundle",
+			config: &imageregistryv1.ImageRegistryConfigStorageS3{
+				Bucket:         "a-bucket",
+				Region:         "us-east-1",
+				RegionEndpoint: "s3.example.internal",
+				Secure:         &insecure,
+			},
+			caBundle: "-----BEGIN CERTIFICATE-----",
+			err:      "secure cannot be set to false when the cloud config provides a custom CA bundle, the S3 endpoint is expected to serve TLS",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testBuilder := cirofake.NewFixturesBuilder()
+			testBuilder.AddInfraConfig(&configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster",
+				},
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: &configv1.PlatformStatus{
+						Type: configv1.AWSPlatformType,
+						AWS: &configv1.AWSPlatformStatus{
+							Region: "us-east-2",
+						},
+					},
+				},
+			})
+			testBuilder.AddSecrets(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      defaults.CloudCredentialsName,
+					Namespace: defaults.ImageRegistryOperatorNamespace,
+				},
+				Data: map[string][]byte{
+					"aws_access_key_id":     []byte("access"),
+					"aws_secret_access_key": []byte("secret"),
+				},
+			})
+			if tt.caBundle != "" {
+				testBuilder.AddConfigMaps(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      defaults.KubeCloudConfigName,
+						Namespace: "openshift-config-managed",
+					},
+					Data: map[string]string{
+						defaults.CloudCABundleKey: tt.caBundle,
+					},
+				})
+			}
+			listers := testBuilder.BuildListers()
+
+			d := NewDriver(context.Background(), tt.config, listers)
+
+			envvars, err := d.ConfigEnv()
+			if len(tt.err) != 0 {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := findEnvVar(envvars, "REGISTRY_STORAGE_S3_SECURE")
+			if tt.expectedScheme == "https" {
+				if e != nil {
+					t.Errorf("REGISTRY_STORAGE_S3_SECURE is expected to be unset, but got %v", e)
+				}
+			} else if e == nil || e.Value != false {
+				t.Errorf("REGISTRY_STORAGE_S3_SECURE: got %v, want false", e)
+			}
+
+			rt := &tripper{}
+			d.roundTripper = rt
+			cr := &imageregistryv1.Config{
+				Spec: imageregistryv1.ImageRegistrySpec{
+					Storage: imageregistryv1.ImageRegistryConfigStorage{
+						S3: tt.config,
+					},
+				},
+			}
+			if _, err := d.StorageExists(cr); err != nil {
+				t.Fatal(err)
+			}
+			if len(rt.reqSchemes) == 0 || rt.reqSchemes[0] != tt.expectedScheme {
+				t.Errorf("expected the management client to use %s, got %v", tt.expectedScheme, rt.reqSchemes)
+			}
+
+			var condition *operatorapi.OperatorCondition
+			for i, c := range cr.Status.Conditions {
+				if c.Type == defaults.StorageInsecure {
+					condition = &cr.Status.Conditions[i]
+				}
+			}
+			if condition == nil || condition.Status != tt.expectedCondition {
+				t.Errorf("expected the %s condition to be %s, got %#v", defaults.StorageInsecure, tt.expectedCondition, condition)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
@@ -15,7 +18,9 @@ import (
 	"github.com/openshift/cluster-image-registry-operator/pkg/envvar"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/azure"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/emptydir"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/filesystem"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/gcs"
+	"github.com/openshift/cluster-image-registry-operator/pkg/storage/oci"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/pvc"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/s3"
 	"github.com/openshift/cluster-image-registry-operator/pkg/storage/swift"
@@ -54,7 +59,19 @@ type Driver interface {
 	ID() string
 }
 
-func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.Listers) (Driver, error) {
+// UsageReporter is implemented by the drivers that can measure how much of
+// their storage is used. Only the S3 driver implements it.
+type UsageReporter interface {
+	// StorageUsage returns the number of bytes stored in the storage and
+	// its capacity in bytes, the capacity is negative when the storage has
+	// no fixed capacity.
+	StorageUsage() (used int64, capacity int64, err error)
+}
+
+// NewDriver returns the driver for the configured storage. The drivers that
+// talk to cloud APIs bind their calls to ctx, so they are cancelled when ctx
+// is done.
+func NewDriver(ctx context.Context, cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest.Config, listers *regopclient.Listers) (Driver, error) {
 	var names []string
 	var drivers []Driver
 
@@ -65,7 +82,6 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 
 	if cfg.S3 != nil {
 		names = append(names, "S3")
-		ctx := context.Background()
 		drivers = append(drivers, s3.NewDriver(ctx, cfg.S3, listers))
 	}
 
@@ -76,12 +92,11 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 
 	if cfg.GCS != nil {
 		names = append(names, "GCS")
-		ctx := context.Background()
 		drivers = append(drivers, gcs.NewDriver(ctx, cfg.GCS, kubeconfig, listers))
 	}
 
 	if cfg.PVC != nil {
-		drv, err := pvc.NewDriver(cfg.PVC, kubeconfig)
+		drv, err := pvc.NewDriver(cfg.PVC, kubeconfig, listers)
 		if err != nil {
 			return nil, err
 		}
@@ -91,10 +106,19 @@ func NewDriver(cfg *imageregistryv1.ImageRegistryConfigStorage, kubeconfig *rest
 
 	if cfg.Azure != nil {
 		names = append(names, "Azure")
-		ctx := context.Background()
 		drivers = append(drivers, azure.NewDriver(ctx, cfg.Azure, listers))
 	}
 
+	if cfg.OCI != nil {
+		names = append(names, "OCI")
+		drivers = append(drivers, oci.NewDriver(ctx, cfg.OCI, listers))
+	}
+
+	if cfg.Filesystem != nil {
+		names = append(names, "Filesystem")
+		drivers = append(drivers, filesystem.NewDriver(cfg.Filesystem))
+	}
+
 	switch len(drivers) {
 	case 0:
 		return nil, ErrStorageNotConfigured
@@ -174,3 +198,63 @@ func GetPlatformStorage(listers *regopclient.Listers) (imageregistryv1.ImageRegi
 
 	return cfg, replicas, nil
 }
+
+// RegionMismatch returns the region of the storage and the region of the
+// cluster when they differ. Only the S3 buckets on AWS and the GCS buckets
+// located in a single region on GCP are compared, the buckets behind a
+// custom endpoint and the multi-region buckets can't be located.
+func RegionMismatch(cfg *imageregistryv1.ImageRegistryConfigStorage, listers *regopclient.Listers) (storageRegion string, clusterRegion string, err error) {
+	infra, err := util.GetInfrastructure(listers)
+	if err != nil {
+		return "", "", err
+	}
+
+	platformStatus := infra.Status.PlatformStatus
+	switch {
+	case cfg.S3 != nil && platformStatus.AWS != nil:
+		if len(cfg.S3.RegionEndpoint) != 0 {
+			return "", "", nil
+		}
+		storageRegion, clusterRegion = cfg.S3.Region, platformStatus.AWS.Region
+	case cfg.GCS != nil && platformStatus.GCP != nil:
+		if !gcs.IsRegion(cfg.GCS.Region) {
+			return "", "", nil
+		}
+		storageRegion, clusterRegion = cfg.GCS.Region, platformStatus.GCP.Region
+	default:
+		return "", "", nil
+	}
+
+	if len(storageRegion) == 0 || len(clusterRegion) == 0 || strings.EqualFold(storageRegion, clusterRegion) {
+		return "", "", nil
+	}
+	return storageRegion, clusterRegion, nil
+}
+
+// CredentialsRefreshInterval returns how often the credentials of the storage
+// should be re-read, zero if they are only re-read when the credentials
+// secret or the registry configuration changes. Invalid intervals are
+// reported by the driver.
+func CredentialsRefreshInterval(cfg *imageregistryv1.ImageRegistryConfigStorage) time.Duration {
+	if cfg.S3 == nil {
+		return 0
+	}
+	interval, err := s3.CredentialsRefreshInterval(cfg.S3)
+	if err != nil {
+		return 0
+	}
+	return interval
+}
+
+// ProvisioningDeferred returns true if the provisioning of the storage and
+// of the registry is deferred, i.e. it is requested and the storage isn't
+// provisioned yet.
+func ProvisioningDeferred(cr *imageregistryv1.Config) bool {
+	if cr.Spec.Storage.Provisioning != imageregistryv1.StorageProvisioningDeferred {
+		return false
+	}
+	provisioned := cr.Status.Storage
+	provisioned.ManagementState = ""
+	provisioned.Provisioning = ""
+	return reflect.DeepEqual(provisioned, imageregistryv1.ImageRegistryConfigStorage{})
+}
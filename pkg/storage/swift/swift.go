@@ -21,6 +21,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sutilerrors "k8s.io/apimachinery/pkg/util/errors"
+	kcorelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 
 	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
@@ -42,6 +43,11 @@ type Swift struct {
 	DomainID           string
 	RegionName         string
 	IdentityAPIVersion string
+	// The application credential is used instead of the password when
+	// its secret is set.
+	ApplicationCredentialID     string
+	ApplicationCredentialName   string
+	ApplicationCredentialSecret string
 }
 
 type driver struct {
@@ -51,6 +57,10 @@ type driver struct {
 	Listers *regopclient.Listers
 }
 
+// supportedAuthVersions are the Identity API versions the operator can
+// authenticate with.
+var supportedAuthVersions = []string{"2", "3"}
+
 // replaceEmpty is a helper function to replace empty fields with another field
 func replaceEmpty(a string, b string) string {
 	if a == "" {
@@ -117,6 +127,9 @@ func GetConfig(listers *regopclient.Listers) (*Swift, error) {
 				cfg.AuthURL = cloud.AuthInfo.AuthURL
 				cfg.Username = cloud.AuthInfo.Username
 				cfg.Password = cloud.AuthInfo.Password
+				cfg.ApplicationCredentialID = cloud.AuthInfo.ApplicationCredentialID
+				cfg.ApplicationCredentialName = cloud.AuthInfo.ApplicationCredentialName
+				cfg.ApplicationCredentialSecret = cloud.AuthInfo.ApplicationCredentialSecret
 				cfg.Tenant = cloud.AuthInfo.ProjectName
 				cfg.TenantID = cloud.AuthInfo.ProjectID
 				cfg.Domain = cloud.AuthInfo.DomainName
@@ -137,6 +150,12 @@ func GetConfig(listers *regopclient.Listers) (*Swift, error) {
 		}
 	} else if err != nil {
 		return nil, err
+	} else if _, ok := sec.Data["REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET"]; ok {
+		// The username is only needed to look up an application
+		// credential by its name.
+		cfg.ApplicationCredentialSecret = string(sec.Data["REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET"])
+		cfg.Username = string(sec.Data["REGISTRY_STORAGE_SWIFT_USERNAME"])
+		cfg.Password = string(sec.Data["REGISTRY_STORAGE_SWIFT_PASSWORD"])
 	} else {
 		cfg.Username, err = util.GetValueFromSecret(sec, "REGISTRY_STORAGE_SWIFT_USERNAME")
 		if err != nil {
@@ -151,6 +170,69 @@ func GetConfig(listers *regopclient.Listers) (*Swift, error) {
 	return cfg, nil
 }
 
+// VerifyApplicationCredential rejects the configuration when the registry
+// would be given both an application credential and the password of the
+// image-registry-private-configuration-user secret.
+func VerifyApplicationCredential(c *imageregistryv1.ImageRegistryConfigStorageSwift, secLister kcorelisters.SecretNamespaceLister) error {
+	if c == nil {
+		return nil
+	}
+
+	sec, err := secLister.Get(defaults.ImageRegistryPrivateConfigurationUser)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get user provided secrets: %s", err)
+	}
+
+	if c.ApplicationCredentialID == "" && c.ApplicationCredentialName == "" && len(sec.Data["REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET"]) == 0 {
+		return nil
+	}
+	if len(sec.Data["REGISTRY_STORAGE_SWIFT_PASSWORD"]) != 0 {
+		return fmt.Errorf("the swift application credential cannot be used together with REGISTRY_STORAGE_SWIFT_PASSWORD of the secret %s/%s, one of them has to be removed", sec.Namespace, sec.Name)
+	}
+	return nil
+}
+
+// applicationCredential holds the Keystone application credential the
+// registry authenticates with.
+type applicationCredential struct {
+	ID     string
+	Name   string
+	Secret string
+}
+
+// applicationCredential returns the application credential of the
+// configuration, or nil when the registry authenticates with a password.
+func (d *driver) applicationCredential(cfg *Swift) (*applicationCredential, error) {
+	id := replaceEmpty(d.Config.ApplicationCredentialID, cfg.ApplicationCredentialID)
+	name := replaceEmpty(d.Config.ApplicationCredentialName, cfg.ApplicationCredentialName)
+	if id == "" && name == "" && cfg.ApplicationCredentialSecret == "" {
+		return nil, nil
+	}
+
+	if cfg.Password != "" {
+		return nil, fmt.Errorf("the swift application credential cannot be used together with a password")
+	}
+	if cfg.ApplicationCredentialSecret == "" {
+		return nil, fmt.Errorf("the secret of the swift application credential is not set, it should be in the key REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET of the secret %s/%s", defaults.ImageRegistryOperatorNamespace, defaults.ImageRegistryPrivateConfigurationUser)
+	}
+	if id == "" && name == "" {
+		return nil, fmt.Errorf("either applicationCredentialID or applicationCredentialName is required to use the swift application credential")
+	}
+	if id == "" && cfg.Username == "" {
+		return nil, fmt.Errorf("applicationCredentialName requires the username of the owner of the application credential")
+	}
+	if id != "" {
+		name = ""
+	}
+	return &applicationCredential{
+		ID:     id,
+		Name:   name,
+		Secret: cfg.ApplicationCredentialSecret,
+	}, nil
+}
+
 func getCloudProviderCert(listers *regopclient.Listers) (string, error) {
 	cm, err := listers.OpenShiftConfig.Get("cloud-provider-config")
 	if err != nil {
@@ -159,6 +241,29 @@ func getCloudProviderCert(listers *regopclient.Listers) (string, error) {
 	return string(cm.Data["ca-bundle.pem"]), nil
 }
 
+// authVersion returns the configured Identity API version. An empty string
+// is returned when no version is configured, unless the registry uses an
+// application credential.
+func (d *driver) authVersion(cfg *Swift, appCred *applicationCredential) (string, error) {
+	authVersion := replaceEmpty(d.Config.AuthVersion, cfg.IdentityAPIVersion)
+	if appCred != nil {
+		// Application credentials only exist in the Identity v3 API.
+		if authVersion != "" && authVersion != "3" {
+			return "", fmt.Errorf("authVersion %q cannot be used with the swift application credential, it requires the version 3", authVersion)
+		}
+		return "3", nil
+	}
+	if authVersion == "" {
+		return "", nil
+	}
+	for _, v := range supportedAuthVersions {
+		if authVersion == v {
+			return authVersion, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported authVersion %q, valid values are %s", authVersion, strings.Join(supportedAuthVersions, ", "))
+}
+
 // getSwiftClient returns a client that allows to interact with the OpenStack Swift service
 func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 	cfg, err := GetConfig(d.Listers)
@@ -173,6 +278,22 @@ func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 	domainID := replaceEmpty(d.Config.DomainID, cfg.DomainID)
 	regionName := replaceEmpty(d.Config.RegionName, cfg.RegionName)
 
+	appCred, err := d.applicationCredential(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	authVersion, err := d.authVersion(cfg, appCred)
+	if err != nil {
+		return nil, err
+	}
+	if authVersion != "" {
+		authURL, err = ensureAuthURLHasAPIVersion(authURL, authVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	opts := &gophercloud.AuthOptions{
 		IdentityEndpoint: authURL,
 		Username:         cfg.Username,
@@ -182,6 +303,16 @@ func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 		TenantID:         tenantID,
 		TenantName:       tenant,
 	}
+	if appCred != nil {
+		// An application credential is bound to its project, Keystone
+		// rejects the tokens requests that ask for another scope.
+		opts.Password = ""
+		opts.TenantID = ""
+		opts.TenantName = ""
+		opts.ApplicationCredentialID = appCred.ID
+		opts.ApplicationCredentialName = appCred.Name
+		opts.ApplicationCredentialSecret = appCred.Secret
+	}
 
 	provider, err := openstack.NewClient(opts.IdentityEndpoint)
 	if err != nil {
@@ -209,7 +340,16 @@ func (d *driver) getSwiftClient() (*gophercloud.ServiceClient, error) {
 		provider.HTTPClient = client
 	}
 
-	err = openstack.Authenticate(provider, *opts)
+	// Without a configured version the most recent one supported by the
+	// identity service is used.
+	switch authVersion {
+	case "2":
+		err = openstack.AuthenticateV2(provider, *opts, gophercloud.EndpointOpts{})
+	case "3":
+		err = openstack.AuthenticateV3(provider, opts, gophercloud.EndpointOpts{})
+	default:
+		err = openstack.Authenticate(provider, *opts)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to authenticate provider client: %v", err)
 	}
@@ -254,7 +394,14 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 	domain := replaceEmpty(d.Config.Domain, cfg.Domain)
 	domainID := replaceEmpty(d.Config.DomainID, cfg.DomainID)
 	regionName := replaceEmpty(d.Config.RegionName, cfg.RegionName)
-	authVersionStr := replaceEmpty(d.Config.AuthVersion, cfg.IdentityAPIVersion)
+	appCred, err := d.applicationCredential(cfg)
+	if err != nil {
+		return nil, err
+	}
+	authVersionStr, err := d.authVersion(cfg, appCred)
+	if err != nil {
+		return nil, err
+	}
 	authVersionStr = replaceEmpty(authVersionStr, "3")
 
 	authVersion, err := strconv.Atoi(authVersionStr)
@@ -271,6 +418,12 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 		envvar.EnvVar{Name: "REGISTRY_STORAGE", Value: "swift"},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_CONTAINER", Value: d.Config.Container},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_AUTHURL", Value: authURL},
+	)
+	if appCred != nil {
+		envs = append(envs, applicationCredentialEnv(appCred, cfg.Username, authVersion, domain, domainID, regionName)...)
+		return
+	}
+	envs = append(envs,
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_USERNAME", Value: cfg.Username, Secret: true},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_PASSWORD", Value: cfg.Password, Secret: true},
 		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_AUTHVERSION", Value: authVersion},
@@ -294,6 +447,37 @@ func (d *driver) ConfigEnv() (envs envvar.List, err error) {
 	return
 }
 
+// applicationCredentialEnv returns the authentication settings of a registry
+// that uses an application credential. Only its secret goes into the secret
+// of the deployment, and the project is the one of the credential. The user
+// and its domain are only given to find a credential by its name.
+func applicationCredentialEnv(appCred *applicationCredential, username string, authVersion int, domain, domainID, regionName string) (envs envvar.List) {
+	if appCred.ID != "" {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALID", Value: appCred.ID})
+	} else {
+		envs = append(envs,
+			envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALNAME", Value: appCred.Name},
+			envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_USERNAME", Value: username},
+		)
+	}
+	envs = append(envs,
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET", Value: appCred.Secret, Secret: true},
+		envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_AUTHVERSION", Value: authVersion},
+	)
+	if appCred.ID == "" {
+		if domain != "" {
+			envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_DOMAIN", Value: domain})
+		}
+		if domainID != "" {
+			envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_DOMAINID", Value: domainID})
+		}
+	}
+	if regionName != "" {
+		envs = append(envs, envvar.EnvVar{Name: "REGISTRY_STORAGE_SWIFT_REGION", Value: regionName})
+	}
+	return envs
+}
+
 func ensureAuthURLHasAPIVersion(authURL, authVersion string) (string, error) {
 	authURL, err := urlx.NormalizeString(authURL)
 	if err != nil {
@@ -438,6 +622,10 @@ func (d *driver) CreateStorage(cr *imageregistryv1.Config) error {
 		break
 	}
 
+	// Encryption at rest on Swift is configured by the cloud operator and
+	// not exposed through the object storage API.
+	util.UpdateCondition(cr, defaults.StorageEncrypted, operatorapi.ConditionUnknown, "Encryption Unknown", "Swift does not report whether the container is encrypted at rest")
+
 	return nil
 }
 
@@ -387,6 +387,8 @@ func TestSwiftCreateStorageNativeSecret(t *testing.T) {
 	th.AssertEquals(t, imageregistryv1.StorageManagementStateManaged, installConfig.Spec.Storage.ManagementState)
 	th.AssertEquals(t, "StorageExists", installConfig.Status.Conditions[0].Type)
 	th.AssertEquals(t, operatorapi.ConditionTrue, installConfig.Status.Conditions[0].Status)
+	th.AssertEquals(t, "StorageEncrypted", installConfig.Status.Conditions[1].Type)
+	th.AssertEquals(t, operatorapi.ConditionUnknown, installConfig.Status.Conditions[1].Status)
 	th.AssertEquals(t, container, installConfig.Status.Storage.Swift.Container)
 }
 
@@ -1088,3 +1090,352 @@ func TestConfigStatusUpdate(t *testing.T) {
 		spew.Dump(status)
 	}
 }
+
+func handleAuthenticationV2(t *testing.T) {
+	th.Mux.HandleFunc("/v2.0/tokens", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{
+			"auth": {
+				"passwordCredentials": {
+					"username": "`+username+`",
+					"password": "`+password+`"
+				},
+				"tenantName": "`+tenant+`"
+			}
+		}`)
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access": {
+				"token": {
+					"id": "token",
+					"expires": "2030-10-02T13:45:00.000000Z"
+				},
+				"serviceCatalog": [{
+					"name": "swift",
+					"type": "object-store",
+					"endpoints": [{
+						"region": "RegionOne",
+						"publicURL": "`+th.Endpoint()+`one/"
+					}, {
+						"region": "RegionTwo",
+						"publicURL": "`+th.Endpoint()+`two/"
+					}]
+				}]
+			}
+		}`)
+	})
+}
+
+func TestSwiftAuthVersion(t *testing.T) {
+	th.SetupHTTP()
+	defer th.TeardownHTTP()
+
+	handleAuthentication(t, "object-store")
+	handleAuthenticationV2(t)
+
+	for _, tt := range []struct {
+		name        string
+		authVersion string
+		regionName  string
+		endpoint    string
+		authURL     string
+		err         string
+	}{
+		{
+			name:        "v2 in the first region",
+			authVersion: "2",
+			regionName:  "RegionOne",
+			endpoint:    th.Endpoint() + "one/",
+			authURL:     th.Endpoint() + "v2",
+		},
+		{
+			name:        "v2 in the second region",
+			authVersion: "2",
+			regionName:  "RegionTwo",
+			endpoint:    th.Endpoint() + "two/",
+			authURL:     th.Endpoint() + "v2",
+		},
+		{
+			name:        "v3",
+			authVersion: "3",
+			regionName:  "RegionOne",
+			endpoint:    th.Endpoint(),
+			authURL:     th.Endpoint() + "v3",
+		},
+		{
+			name:        "unsupported version",
+			authVersion: "1",
+			err:         `unsupported authVersion "1", valid values are 2, 3`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := mockConfig(false, th.Endpoint(), MockUPISecretNamespaceLister{}, false)
+			d.Config.AuthVersion = tt.authVersion
+			d.Config.RegionName = tt.regionName
+
+			client, err := d.getSwiftClient()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				if _, err := d.ConfigEnv(); err == nil || err.Error() != tt.err {
+					t.Errorf("expected ConfigEnv to fail with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			th.AssertNoErr(t, err)
+			th.AssertEquals(t, tt.endpoint, client.Endpoint)
+
+			envs, err := d.ConfigEnv()
+			th.AssertNoErr(t, err)
+			for _, e := range envs {
+				switch e.Name {
+				case "REGISTRY_STORAGE_SWIFT_AUTHURL":
+					th.AssertEquals(t, tt.authURL, e.Value)
+				case "REGISTRY_STORAGE_SWIFT_REGION":
+					th.AssertEquals(t, tt.regionName, e.Value)
+				case "REGISTRY_STORAGE_SWIFT_AUTHVERSION":
+					th.AssertEquals(t, tt.authVersion, fmt.Sprint(e.Value))
+				}
+			}
+		})
+	}
+}
+
+func handleAuthenticationApplicationCredential(t *testing.T, applicationCredential string) {
+	th.Mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{
+			"auth": {
+			  "identity": {
+				"methods": [
+				  "application_credential"
+				],
+				"application_credential": `+applicationCredential+`
+			  }
+			}
+		  }`)
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{
+			"token": {
+				"expires_at": "2030-10-02T13:45:00.000000Z",
+				"catalog": [{
+					"endpoints": [{
+					"url": "`+th.Endpoint()+`",
+					"interface": "public",
+					"id": "29beb2f1567642eb810b042b6719ea88",
+					"region": "RegionOne",
+					"region_id": "RegionOne"
+					}],
+					"type": "object-store",
+					"name": "swift"
+				}]
+			}
+		}`)
+	})
+}
+
+func TestSwiftApplicationCredential(t *testing.T) {
+	const (
+		appCredID     = "0ab3c1f4e9d84d5c8f4b5f6f6c1a8e2d"
+		appCredName   = "image-registry"
+		appCredSecret = "myApplicationCredentialSecret"
+	)
+
+	for _, tt := range []struct {
+		name            string
+		secretData      map[string][]byte
+		cloudsYAML      string
+		config          imageregistryv1.ImageRegistryConfigStorageSwift
+		authRequest     string
+		expectedEnv     map[string]interface{}
+		expectedSecrets map[string]string
+		err             string
+	}{
+		{
+			name: "password",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_USERNAME": []byte(username),
+				"REGISTRY_STORAGE_SWIFT_PASSWORD": []byte(password),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				AuthVersion: "3",
+			},
+			expectedEnv: map[string]interface{}{
+				"REGISTRY_STORAGE_SWIFT_AUTHVERSION": 3,
+				"REGISTRY_STORAGE_SWIFT_DOMAIN":      domain,
+				"REGISTRY_STORAGE_SWIFT_TENANT":      tenant,
+			},
+			expectedSecrets: map[string]string{
+				"REGISTRY_STORAGE_SWIFT_USERNAME": username,
+				"REGISTRY_STORAGE_SWIFT_PASSWORD": password,
+			},
+		},
+		{
+			name: "application credential ID",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte(appCredSecret),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialID: appCredID,
+			},
+			authRequest: `{"id": "` + appCredID + `", "secret": "` + appCredSecret + `"}`,
+			expectedEnv: map[string]interface{}{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALID": appCredID,
+				"REGISTRY_STORAGE_SWIFT_AUTHVERSION":             3,
+			},
+			expectedSecrets: map[string]string{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": appCredSecret,
+			},
+		},
+		{
+			name: "application credential name",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_USERNAME":                    []byte(username),
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte(appCredSecret),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialName: appCredName,
+			},
+			authRequest: `{"name": "` + appCredName + `", "secret": "` + appCredSecret + `", "user": {"name": "` + username + `", "domain": {"name": "` + domain + `"}}}`,
+			expectedEnv: map[string]interface{}{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALNAME": appCredName,
+				"REGISTRY_STORAGE_SWIFT_USERNAME":                  username,
+				"REGISTRY_STORAGE_SWIFT_AUTHVERSION":               3,
+				"REGISTRY_STORAGE_SWIFT_DOMAIN":                    domain,
+			},
+			expectedSecrets: map[string]string{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": appCredSecret,
+			},
+		},
+		{
+			name: "application credential from the cloud credentials",
+			cloudsYAML: `clouds:
+  ` + cloudName + `:
+    auth:
+      auth_url: "http://localhost:5000/v3"
+      application_credential_id: ` + appCredID + `
+      application_credential_secret: ` + appCredSecret + `
+    auth_type: v3applicationcredential
+    region_name: RegionOne`,
+			authRequest: `{"id": "` + appCredID + `", "secret": "` + appCredSecret + `"}`,
+			expectedEnv: map[string]interface{}{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALID": appCredID,
+				"REGISTRY_STORAGE_SWIFT_AUTHVERSION":             3,
+				"REGISTRY_STORAGE_SWIFT_REGION":                  "RegionOne",
+			},
+			expectedSecrets: map[string]string{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": appCredSecret,
+			},
+		},
+		{
+			name: "application credential and password",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_PASSWORD":                    []byte(password),
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte(appCredSecret),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialID: appCredID,
+			},
+			err: "the swift application credential cannot be used together with a password",
+		},
+		{
+			name: "application credential without its secret",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_USERNAME": []byte(username),
+				"REGISTRY_STORAGE_SWIFT_PASSWORD": []byte(""),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialID: appCredID,
+			},
+			err: "the secret of the swift application credential is not set, it should be in the key REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET of the secret openshift-image-registry/image-registry-private-configuration-user",
+		},
+		{
+			name: "application credential name without a username",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte(appCredSecret),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialName: appCredName,
+			},
+			err: "applicationCredentialName requires the username of the owner of the application credential",
+		},
+		{
+			name: "application credential with Identity v2",
+			secretData: map[string][]byte{
+				"REGISTRY_STORAGE_SWIFT_APPLICATIONCREDENTIALSECRET": []byte(appCredSecret),
+			},
+			config: imageregistryv1.ImageRegistryConfigStorageSwift{
+				ApplicationCredentialID: appCredID,
+				AuthVersion:             "2",
+			},
+			err: `authVersion "2" cannot be used with the swift application credential, it requires the version 3`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			th.SetupHTTP()
+			defer th.TeardownHTTP()
+
+			if tt.authRequest != "" {
+				handleAuthenticationApplicationCredential(t, tt.authRequest)
+			} else {
+				handleAuthentication(t, "object-store")
+			}
+
+			var secretLister MockSecretNamespaceLister = MockUPISecretNamespaceLister{}
+			if tt.cloudsYAML != "" {
+				secretLister = MockIPISecretNamespaceLister{}
+				fakeCloudsYAML = map[string][]byte{
+					cloudSecretKey: []byte(tt.cloudsYAML),
+				}
+			} else {
+				savedSecretData := fakeSecretData
+				fakeSecretData = tt.secretData
+				defer func() {
+					fakeSecretData = savedSecretData
+				}()
+			}
+
+			d, _ := mockConfig(false, th.Endpoint(), secretLister, false)
+			d.Config.ApplicationCredentialID = tt.config.ApplicationCredentialID
+			d.Config.ApplicationCredentialName = tt.config.ApplicationCredentialName
+			d.Config.AuthVersion = tt.config.AuthVersion
+
+			_, err := d.getSwiftClient()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				if _, err := d.ConfigEnv(); err == nil || err.Error() != tt.err {
+					t.Errorf("expected ConfigEnv to fail with %q, got %v", tt.err, err)
+				}
+				return
+			}
+			th.AssertNoErr(t, err)
+
+			envs, err := d.ConfigEnv()
+			th.AssertNoErr(t, err)
+			env := map[string]interface{}{}
+			for _, e := range envs {
+				switch e.Name {
+				case "REGISTRY_STORAGE", "REGISTRY_STORAGE_SWIFT_CONTAINER", "REGISTRY_STORAGE_SWIFT_AUTHURL":
+				default:
+					if !e.Secret {
+						env[e.Name] = e.Value
+					}
+				}
+			}
+			if !reflect.DeepEqual(env, tt.expectedEnv) {
+				t.Errorf("got the environment %v, want %v", env, tt.expectedEnv)
+			}
+
+			secrets, err := envs.SecretData()
+			th.AssertNoErr(t, err)
+			if !reflect.DeepEqual(secrets, tt.expectedSecrets) {
+				t.Errorf("got the secrets %v, want %v", secrets, tt.expectedSecrets)
+			}
+		})
+	}
+}
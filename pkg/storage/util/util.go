@@ -22,6 +22,10 @@ import (
 var (
 	// multiDashes is a regexp matching multiple dashes in a sequence.
 	multiDashes = regexp.MustCompile(`-{2,}`)
+
+	// ErrStorageUsageNotSupported is returned by the drivers that can't
+	// measure the usage of the configured storage.
+	ErrStorageUsageNotSupported = fmt.Errorf("storage usage not supported")
 )
 
 // UpdateCondition will update or add the provided condition.
@@ -106,6 +110,45 @@ func GetInfrastructure(listers *regopclient.Listers) (*configv1.Infrastructure,
 	return infra, nil
 }
 
+// ProvisioningError is returned by the drivers when the cloud provider
+// refused to provision the storage, e.g. because the credentials of the
+// operator lack a permission. The operator reports it with a Warning event
+// of the reason on the registry config.
+type ProvisioningError struct {
+	Reason string
+	Err    error
+}
+
+// NewProvisioningError returns a ProvisioningError for err.
+func NewProvisioningError(reason string, err error) error {
+	return &ProvisioningError{
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+func (e *ProvisioningError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProvisioningError) Unwrap() error {
+	return e.Err
+}
+
+// UpdateCloudAPICondition sets the CloudAPIUnavailable condition from the
+// error returned by a call to the cloud API, unavailable classifies the
+// errors of the backend. The other errors, e.g. denied access or connection
+// failures, are reported by the StorageExists condition and leave this one
+// unchanged.
+func UpdateCloudAPICondition(cr *imageregistryv1.Config, err error, unavailable func(error) bool) {
+	switch {
+	case err == nil:
+		UpdateCondition(cr, defaults.CloudAPIUnavailable, operatorapi.ConditionFalse, "CloudAPIAvailable", "")
+	case unavailable(err):
+		UpdateCondition(cr, defaults.CloudAPIUnavailable, operatorapi.ConditionTrue, "CloudAPIUnavailable", fmt.Sprintf("The cloud provider API is unavailable, the operation will be retried: %s", err))
+	}
+}
+
 // GetValueFromSecret gets value for key in a secret
 // or returns an error if it does not exist
 func GetValueFromSecret(sec *corev1.Secret, key string) (string, error) {
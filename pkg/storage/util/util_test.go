@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"testing"
@@ -9,6 +10,8 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 
 	configv1 "github.com/openshift/api/config/v1"
+	imageregistryv1 "github.com/openshift/api/imageregistry/v1"
+	operatorapi "github.com/openshift/api/operator/v1"
 
 	regopclient "github.com/openshift/cluster-image-registry-operator/pkg/client"
 	"github.com/openshift/cluster-image-registry-operator/pkg/defaults"
@@ -126,3 +129,39 @@ func TestGenerateStorageName(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateCloudAPICondition(t *testing.T) {
+	unavailable := func(err error) bool {
+		return strings.Contains(err.Error(), "503")
+	}
+	cloudAPICondition := func(cr *imageregistryv1.Config) *operatorapi.OperatorCondition {
+		for i := range cr.Status.Conditions {
+			if cr.Status.Conditions[i].Type == defaults.CloudAPIUnavailable {
+				return &cr.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	cr := &imageregistryv1.Config{}
+	UpdateCloudAPICondition(cr, fmt.Errorf("403 access denied"), unavailable)
+	if cond := cloudAPICondition(cr); cond != nil {
+		t.Fatalf("expected other errors not to set the condition, got %#v", cond)
+	}
+
+	UpdateCloudAPICondition(cr, fmt.Errorf("503 service unavailable"), unavailable)
+	if cond := cloudAPICondition(cr); cond == nil || cond.Status != operatorapi.ConditionTrue {
+		t.Fatalf("expected the cloud API to be reported unavailable, got %#v", cond)
+	}
+
+	// Denied access doesn't tell whether the outage is over.
+	UpdateCloudAPICondition(cr, fmt.Errorf("403 access denied"), unavailable)
+	if cond := cloudAPICondition(cr); cond == nil || cond.Status != operatorapi.ConditionTrue {
+		t.Fatalf("expected the condition to be unchanged, got %#v", cond)
+	}
+
+	UpdateCloudAPICondition(cr, nil, unavailable)
+	if cond := cloudAPICondition(cr); cond == nil || cond.Status != operatorapi.ConditionFalse {
+		t.Fatalf("expected the cloud API to be reported available, got %#v", cond)
+	}
+}
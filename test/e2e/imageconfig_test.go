@@ -3,6 +3,7 @@ package e2e
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -164,7 +165,7 @@ func TestSwapStorage(t *testing.T) {
 		ManagementState: imageregistryv1.StorageManagementStateManaged,
 		EmptyDir:        config.Status.Storage.EmptyDir,
 	}
-	if config.Status.Storage != expected {
+	if !reflect.DeepEqual(config.Status.Storage, expected) {
 		t.Errorf("multi storage config found: %+v", config.Status.Storage)
 	}
 }
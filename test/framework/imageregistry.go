@@ -3,6 +3,7 @@ package framework
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -487,7 +488,7 @@ func PlatformHasDefaultStorage(te TestEnv) bool {
 func SetupAvailableImageRegistry(t *testing.T, spec *imageregistryapiv1.ImageRegistrySpec) TestEnv {
 	te := Setup(t)
 
-	noStorage := (spec == nil || spec.Storage == imageregistryapiv1.ImageRegistryConfigStorage{})
+	noStorage := spec == nil || reflect.DeepEqual(spec.Storage, imageregistryapiv1.ImageRegistryConfigStorage{})
 	if noStorage && !PlatformHasDefaultStorage(te) {
 		t.Skip("skipping because the current platform does not provide default storage configuration")
 	}